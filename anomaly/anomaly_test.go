@@ -0,0 +1,91 @@
+package anomaly
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/geoip"
+	"cloud_compliance_checker/trailstore"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const database = `network,country_code,asn,as_name,latitude,longitude
+198.51.100.0/24,US,64500,Example Telecom,38.9,-77.0
+203.0.113.0/24,DE,AS64501,Example Hosting,50.1,8.7
+`
+
+// event returns a CloudTrail event of an IAM user
+func event(t *testing.T, user string, at time.Time, api, ip, agent string) trailstore.Event {
+	service, name, _ := strings.Cut(api, ":")
+	e, err := trailstore.ParseEvent([]byte(fmt.Sprintf(`{"eventTime": %q, "eventSource": "%s.amazonaws.com", "eventName": %q,
+		"awsRegion": "us-east-1", "sourceIPAddress": %q, "userAgent": %q,
+		"userIdentity": {"type": "IAMUser", "userName": %q, "arn": "arn:aws:iam::111122223333:user/%s"}}`,
+		at.Format(time.RFC3339), service, name, ip, agent, user, user)))
+	assert.NoError(t, err)
+	return e
+}
+
+func TestAnalyze(t *testing.T) {
+	geo, err := geoip.Read(strings.NewReader(database))
+	if !assert.NoError(t, err) {
+		return
+	}
+	split := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	var events []trailstore.Event
+	for day := 1; day <= 25; day++ {
+		at := split.AddDate(0, 0, -day).Add(10 * time.Hour)
+		events = append(events, event(t, "alice", at, "s3:GetObject", "198.51.100.7", "aws-cli/2.15.0 Python/3.11"))
+	}
+	for day := 1; day <= 3; day++ {
+		events = append(events, event(t, "bob", split.AddDate(0, 0, -day), "s3:GetObject", "198.51.100.8", "aws-cli/2.15.0"))
+	}
+	events = append(events,
+		event(t, "alice", split.Add(10*time.Hour), "s3:GetObject", "198.51.100.7", "aws-cli/2.16.1"),
+		event(t, "alice", split.Add(10*time.Hour+30*time.Minute), "iam:CreateAccessKey", "198.51.100.7", "aws-cli/2.16.1"),
+		event(t, "alice", split.Add(11*time.Hour), "iam:CreateAccessKey", "198.51.100.7", "aws-cli/2.16.1"),
+		event(t, "alice", split.Add(11*time.Hour+30*time.Minute), "signin:ConsoleLogin", "203.0.113.5", "Mozilla/5.0 (X11; Linux x86_64)"),
+		event(t, "bob", split.Add(time.Hour), "iam:CreateAccessKey", "203.0.113.6", "aws-cli/2.15.0"),
+	)
+
+	anomalies := Analyze(events, split, geo, NewOptions(config.AnomalyConfig{}))
+	if !assert.Len(t, anomalies, 2) {
+		return
+	}
+
+	// The first use of a sensitive API is reported once, bob has too few events for a baseline
+	assert.Equal(t, "iam:CreateAccessKey", anomalies[0].API)
+	assert.Equal(t, "arn:aws:iam::111122223333:user/alice", anomalies[0].Principal)
+	assert.Equal(t, 3.0, anomalies[0].Score)
+	assert.Equal(t, []string{"first use of the sensitive API iam:CreateAccessKey in 26 baseline events since 2024-04-06"}, anomalies[0].Reasons)
+
+	assert.Equal(t, "signin:ConsoleLogin", anomalies[1].API)
+	assert.Equal(t, 7.5, anomalies[1].Score)
+	assert.Equal(t, []string{
+		"first use of signin:ConsoleLogin in 28 baseline events since 2024-04-06",
+		"console login from new country DE (usual: US)",
+		"new network AS64501 Example Hosting (usual: AS64500 Example Telecom)",
+		"new user agent mozilla (usual: aws-cli)",
+	}, anomalies[1].Reasons)
+
+	// Ignored principals and higher thresholds
+	assert.Empty(t, Analyze(events, split, geo, NewOptions(config.AnomalyConfig{IgnorePrincipals: []string{"alice"}})))
+	assert.Len(t, Analyze(events, split, geo, NewOptions(config.AnomalyConfig{Threshold: 5})), 1)
+
+	// Only alice has a usable baseline, without her nothing is scored
+	_, usable := analyze(events, split, geo, NewOptions(config.AnomalyConfig{}))
+	assert.Equal(t, 1, usable)
+	_, usable = analyze(events, split, geo, NewOptions(config.AnomalyConfig{IgnorePrincipals: []string{"alice"}}))
+	assert.Equal(t, 0, usable)
+}
+
+func TestAgentFamily(t *testing.T) {
+	assert.Equal(t, "aws-cli", AgentFamily("aws-cli/2.15.0 Python/3.11.6 Linux/6.1"))
+	assert.Equal(t, "boto3", AgentFamily("Boto3/1.34.0 md/Botocore#1.34.0"))
+	assert.Equal(t, "console.amazonaws.com", AgentFamily("console.amazonaws.com"))
+	assert.Equal(t, "unknown", AgentFamily(""))
+}
@@ -0,0 +1,196 @@
+// Package anomaly builds a behavioral baseline of each principal from the CloudTrail events and scores
+// the new events by how far they deviate from it: APIs, regions, countries, networks, hours and user
+// agents never seen for the principal. It also finds the consecutive console logins of an identity too far
+// apart to be travelled in the time between them.
+package anomaly
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud_compliance_checker/geoip"
+	"cloud_compliance_checker/trailstore"
+)
+
+// Profile is the baseline of a principal: how many events used each value of the features
+type Profile struct {
+	Principal  string
+	Events     int
+	First      time.Time
+	Last       time.Time
+	APIs       map[string]int
+	Regions    map[string]int
+	SourceIPs  map[string]int
+	ASNs       map[string]int
+	Countries  map[string]int
+	UserAgents map[string]int
+	Hours      [24]int // UTC
+}
+
+// features are the values of an event compared with the baseline
+type features struct {
+	principal string
+	api       string
+	region    string
+	sourceIP  string // empty when the source is an AWS service
+	asn       string
+	country   string
+	agent     string
+	hour      int
+}
+
+// newProfile returns an empty profile
+func newProfile(principal string) *Profile {
+	return &Profile{
+		Principal:  principal,
+		APIs:       map[string]int{},
+		Regions:    map[string]int{},
+		SourceIPs:  map[string]int{},
+		ASNs:       map[string]int{},
+		Countries:  map[string]int{},
+		UserAgents: map[string]int{},
+	}
+}
+
+// add records the features of an event
+func (p *Profile) add(f features, at time.Time) {
+	if p.Events == 0 || at.Before(p.First) {
+		p.First = at
+	}
+	if at.After(p.Last) {
+		p.Last = at
+	}
+	p.Events++
+	p.APIs[f.api]++
+	p.Regions[f.region]++
+	p.Hours[f.hour]++
+	p.UserAgents[f.agent]++
+	if f.sourceIP != "" {
+		p.SourceIPs[f.sourceIP]++
+	}
+	if f.asn != "" {
+		p.ASNs[f.asn]++
+	}
+	if f.country != "" {
+		p.Countries[f.country]++
+	}
+}
+
+// Principal returns the identity a baseline is kept for: the role of an assumed role session, otherwise
+// the ARN or the name of the identity. Requests made by AWS services are not attributed.
+func Principal(e trailstore.Event) string {
+	identity := e.UserIdentity
+	switch {
+	case identity.Type == "AWSService":
+		return ""
+	case identity.SessionContext.SessionIssuer.ARN != "":
+		return identity.SessionContext.SessionIssuer.ARN
+	case identity.ARN != "":
+		return identity.ARN
+	}
+	return e.User()
+}
+
+// API returns the API of an event as service:Action, such as iam:CreateAccessKey
+func API(e trailstore.Event) string {
+	return strings.TrimSuffix(e.EventSource, ".amazonaws.com") + ":" + e.EventName
+}
+
+// AgentFamily returns the client of a user agent without its version, such as aws-cli or boto3
+func AgentFamily(agent string) string {
+	agent = strings.ToLower(strings.TrimLeft(strings.TrimSpace(agent), "["))
+	switch {
+	case agent == "":
+		return "unknown"
+	case strings.HasSuffix(agent, ".amazonaws.com"), strings.HasPrefix(agent, "aws internal"):
+		return agent
+	}
+	if i := strings.IndexAny(agent, " /(,;"); i > 0 {
+		return agent[:i]
+	}
+	return agent
+}
+
+// extract returns the features of an event
+func extract(e trailstore.Event, geo *geoip.DB) features {
+	f := features{
+		principal: Principal(e),
+		api:       API(e),
+		region:    e.Region,
+		agent:     AgentFamily(e.UserAgent),
+		hour:      e.EventTime.UTC().Hour(),
+	}
+	if _, err := netip.ParseAddr(e.SourceIP); err == nil {
+		f.sourceIP = e.SourceIP
+		if location, ok := geo.Lookup(e.SourceIP); ok {
+			f.asn, f.country = location.ASN, location.Country
+			if f.asn != "" && location.Organization != "" {
+				f.asn += " " + location.Organization
+			}
+		}
+	}
+	return f
+}
+
+// Build returns the baseline of each principal from the events
+func Build(events []trailstore.Event, geo *geoip.DB) map[string]*Profile {
+	profiles := map[string]*Profile{}
+	for _, e := range events {
+		f := extract(e, geo)
+		if f.principal == "" {
+			continue
+		}
+		profile, ok := profiles[f.principal]
+		if !ok {
+			profile = newProfile(f.principal)
+			profiles[f.principal] = profile
+		}
+		profile.add(f, e.EventTime)
+	}
+	return profiles
+}
+
+// usual returns the most frequent values of a feature
+func usual(counts map[string]int) string {
+	values := make([]string, 0, len(counts))
+	for value := range counts {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if counts[values[i]] != counts[values[j]] {
+			return counts[values[i]] > counts[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	if len(values) > 3 {
+		return strings.Join(values[:3], ", ") + fmt.Sprintf(" and %d more", len(values)-3)
+	}
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ", ")
+}
+
+// usualHours returns the hours with activity as ranges, such as 08-12, 14
+func usualHours(hours [24]int) string {
+	var ranges []string
+	for h := 0; h < 24; h++ {
+		if hours[h] == 0 {
+			continue
+		}
+		end := h
+		for end+1 < 24 && hours[end+1] > 0 {
+			end++
+		}
+		if end == h {
+			ranges = append(ranges, fmt.Sprintf("%02d", h))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%02d-%02d", h, end))
+		}
+		h = end
+	}
+	return strings.Join(ranges, ", ")
+}
@@ -0,0 +1,241 @@
+package anomaly
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/geoip"
+	"cloud_compliance_checker/trailstore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+)
+
+// Defaults of the anomaly detection
+const (
+	defaultBaselineDays   = 30
+	defaultDetectionHours = 24
+	defaultMinEvents      = 20
+	defaultThreshold      = 3
+)
+
+// Weights of the deviations from the baseline
+const (
+	weightNewAPI         = 1
+	weightSensitiveAPI   = 3
+	weightNewRegion      = 2
+	weightNewCountry     = 3
+	weightConsoleCountry = 4
+	weightNewNetwork     = 1.5
+	weightNewSourceIP    = 1 // only without GeoIP data for the address
+	weightUnusualHour    = 1
+	weightNewAgentFamily = 1
+)
+
+// consoleLoginEventName is the event of the sign-ins to the console
+const consoleLoginEventName = "ConsoleLogin"
+
+// defaultSensitiveAPIs are APIs whose first use by a principal is a strong signal: persistence, privilege
+// escalation and defense evasion
+var defaultSensitiveAPIs = []string{
+	"iam:CreateAccessKey", "iam:CreateUser", "iam:CreateLoginProfile", "iam:UpdateLoginProfile",
+	"iam:AttachUserPolicy", "iam:AttachRolePolicy", "iam:PutUserPolicy", "iam:PutRolePolicy",
+	"iam:AddUserToGroup", "iam:UpdateAssumeRolePolicy", "iam:CreatePolicyVersion", "iam:DeactivateMFADevice",
+	"sts:GetFederationToken", "cloudtrail:StopLogging", "cloudtrail:DeleteTrail", "cloudtrail:UpdateTrail",
+	"guardduty:DeleteDetector", "config:StopConfigurationRecorder", "kms:ScheduleKeyDeletion", "kms:DisableKey",
+	"s3:PutBucketPolicy", "s3:DeleteBucketPolicy", "s3:PutBucketAcl", "ec2:AuthorizeSecurityGroupIngress",
+	"ec2:ModifySnapshotAttribute", "organizations:LeaveOrganization",
+}
+
+// Options are the settings of the scoring
+type Options struct {
+	MinEvents int
+	Threshold float64
+	Sensitive map[string]bool
+	Ignore    []string
+}
+
+// NewOptions returns the options of anomaly_detection with the defaults
+func NewOptions(anomalyCfg config.AnomalyConfig) Options {
+	opts := Options{
+		MinEvents: anomalyCfg.MinEvents,
+		Threshold: anomalyCfg.Threshold,
+		Sensitive: map[string]bool{},
+		Ignore:    anomalyCfg.IgnorePrincipals,
+	}
+	if opts.MinEvents <= 0 {
+		opts.MinEvents = defaultMinEvents
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = defaultThreshold
+	}
+	for _, api := range append(append([]string{}, defaultSensitiveAPIs...), anomalyCfg.SensitiveAPIs...) {
+		opts.Sensitive[strings.ToLower(api)] = true
+	}
+	return opts
+}
+
+// Anomaly is an event that deviates from the baseline of its principal
+type Anomaly struct {
+	Time      time.Time
+	Principal string
+	User      string
+	API       string
+	SourceIP  string
+	Score     float64
+	Reasons   []string // what deviated from the baseline
+}
+
+func (a Anomaly) String() string {
+	return fmt.Sprintf("%s %s %s from %s (score %.1f): %s", a.Time.UTC().Format(time.RFC3339), a.User, a.API, a.SourceIP,
+		a.Score, strings.Join(a.Reasons, "; "))
+}
+
+// ignored checks if a principal is excluded from the detection, by name or ARN
+func (o Options) ignored(principal, user string) bool {
+	for _, ignore := range o.Ignore {
+		if strings.EqualFold(ignore, principal) || strings.EqualFold(ignore, user) ||
+			strings.HasSuffix(strings.ToLower(principal), "/"+strings.ToLower(ignore)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Analyze builds the baselines from the events before split and scores the events from split on. Each new
+// value is learned once reported, so that it is reported only on its first use. Principals with fewer than
+// MinEvents baseline events are not scored.
+func Analyze(events []trailstore.Event, split time.Time, geo *geoip.DB, opts Options) []Anomaly {
+	anomalies, _ := analyze(events, split, geo, opts)
+	return anomalies
+}
+
+// analyze scores the events like Analyze and also returns the number of principals with a usable baseline
+func analyze(events []trailstore.Event, split time.Time, geo *geoip.DB, opts Options) ([]Anomaly, int) {
+	var baseline, recent []trailstore.Event
+	for _, e := range events {
+		if e.EventTime.Before(split) {
+			baseline = append(baseline, e)
+		} else {
+			recent = append(recent, e)
+		}
+	}
+	profiles := Build(baseline, geo)
+	usable := 0
+	for principal, profile := range profiles {
+		if profile.Events >= opts.MinEvents && !opts.ignored(principal, "") {
+			usable++
+		}
+	}
+	sort.SliceStable(recent, func(i, j int) bool { return recent[i].EventTime.Before(recent[j].EventTime) })
+
+	var anomalies []Anomaly
+	for _, e := range recent {
+		f := extract(e, geo)
+		if f.principal == "" || opts.ignored(f.principal, e.User()) {
+			continue
+		}
+		profile, ok := profiles[f.principal]
+		if !ok {
+			profile = newProfile(f.principal)
+			profiles[f.principal] = profile
+		}
+		if profile.Events >= opts.MinEvents {
+			if score, reasons := profile.score(f, e, opts); score >= opts.Threshold {
+				anomalies = append(anomalies, Anomaly{
+					Time:      e.EventTime,
+					Principal: f.principal,
+					User:      e.User(),
+					API:       f.api,
+					SourceIP:  e.SourceIP,
+					Score:     score,
+					Reasons:   reasons,
+				})
+			}
+		}
+		profile.add(f, e.EventTime)
+	}
+	return anomalies, usable
+}
+
+// score sums the weights of the features never seen in the baseline and explains each of them
+func (p *Profile) score(f features, e trailstore.Event, opts Options) (float64, []string) {
+	var score float64
+	var reasons []string
+	since := fmt.Sprintf("in %d baseline events since %s", p.Events, p.First.UTC().Format("2006-01-02"))
+
+	if p.APIs[f.api] == 0 {
+		if opts.Sensitive[strings.ToLower(f.api)] {
+			score += weightSensitiveAPI
+			reasons = append(reasons, fmt.Sprintf("first use of the sensitive API %s %s", f.api, since))
+		} else {
+			score += weightNewAPI
+			reasons = append(reasons, fmt.Sprintf("first use of %s %s", f.api, since))
+		}
+	}
+	if f.region != "" && p.Regions[f.region] == 0 {
+		score += weightNewRegion
+		reasons = append(reasons, fmt.Sprintf("new region %s (usual: %s)", f.region, usual(p.Regions)))
+	}
+	if f.country != "" && p.Countries[f.country] == 0 {
+		if e.EventName == consoleLoginEventName {
+			score += weightConsoleCountry
+			reasons = append(reasons, fmt.Sprintf("console login from new country %s (usual: %s)", f.country, usual(p.Countries)))
+		} else {
+			score += weightNewCountry
+			reasons = append(reasons, fmt.Sprintf("new country %s (usual: %s)", f.country, usual(p.Countries)))
+		}
+	}
+	switch {
+	case f.asn != "" && p.ASNs[f.asn] == 0:
+		score += weightNewNetwork
+		reasons = append(reasons, fmt.Sprintf("new network %s (usual: %s)", f.asn, usual(p.ASNs)))
+	case f.asn == "" && f.sourceIP != "" && p.SourceIPs[f.sourceIP] == 0:
+		score += weightNewSourceIP
+		reasons = append(reasons, fmt.Sprintf("new source IP %s (usual: %s)", f.sourceIP, usual(p.SourceIPs)))
+	}
+	if p.Hours[(f.hour+23)%24]+p.Hours[f.hour]+p.Hours[(f.hour+1)%24] == 0 {
+		score += weightUnusualHour
+		reasons = append(reasons, fmt.Sprintf("activity at %02d UTC (usual hours: %s)", f.hour, usualHours(p.Hours)))
+	}
+	if p.UserAgents[f.agent] == 0 {
+		score += weightNewAgentFamily
+		reasons = append(reasons, fmt.Sprintf("new user agent %s (usual: %s)", f.agent, usual(p.UserAgents)))
+	}
+	return score, reasons
+}
+
+// Detect scores the events of the last anomaly_detection.detection_hours against the baseline of the
+// previous baseline_days, read from the event store or from LookupEvents. Without any principal with
+// min_events baseline events nothing can be scored, and an error is returned.
+func Detect(cfg aws.Config) ([]Anomaly, error) {
+	anomalyCfg := config.AppConfig.AWS.AnomalyDetection
+	baselineDays := anomalyCfg.BaselineDays
+	if baselineDays <= 0 {
+		baselineDays = defaultBaselineDays
+	}
+	detectionHours := anomalyCfg.DetectionHours
+	if detectionHours <= 0 {
+		detectionHours = defaultDetectionHours
+	}
+	geo, err := geoip.Cached(config.AppConfig.AWS.GeoIPDatabase)
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now()
+	split := end.Add(-time.Duration(detectionHours) * time.Hour)
+	events, err := trailstore.Search(cloudtrail.NewFromConfig(cfg), trailstore.Query{Start: split.AddDate(0, 0, -baselineDays), End: end})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CloudTrail events: %v", err)
+	}
+	opts := NewOptions(anomalyCfg)
+	anomalies, usable := analyze(events, split, geo, opts)
+	if usable == 0 {
+		return nil, fmt.Errorf("no principal has %d events in the baseline of the last %d days, the activity was not evaluated", opts.MinEvents, baselineDays)
+	}
+	return anomalies, nil
+}
@@ -0,0 +1,361 @@
+package anomaly
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/geoip"
+	"cloud_compliance_checker/trailstore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+)
+
+// Defaults of the impossible travel detection
+const (
+	defaultTravelDays    = 30
+	defaultMaxSpeedKmh   = 1000
+	defaultMinDistanceKm = 500
+)
+
+const (
+	earthRadiusKm  = 6371
+	tripDateLayout = "2006-01-02"
+	tripMargin     = 24 * time.Hour // the trip dates are days in the time zone of the traveler
+
+	// loginRegion is where CloudTrail records most console logins, whatever the region of the console
+	loginRegion = "us-east-1"
+)
+
+// TravelOptions are the limits of the travel between two console logins
+type TravelOptions struct {
+	MaxSpeedKmh   float64
+	MinDistanceKm float64
+	OrgNetworks   []netip.Prefix // egress of the VPN of the organization
+}
+
+// NewTravelOptions returns the options of impossible_travel with the defaults
+func NewTravelOptions(travelCfg config.ImpossibleTravelConfig) (TravelOptions, error) {
+	opts := TravelOptions{MaxSpeedKmh: travelCfg.MaxSpeedKmh, MinDistanceKm: travelCfg.MinDistanceKm}
+	if opts.MaxSpeedKmh <= 0 {
+		opts.MaxSpeedKmh = defaultMaxSpeedKmh
+	}
+	if opts.MinDistanceKm <= 0 {
+		opts.MinDistanceKm = defaultMinDistanceKm
+	}
+	for _, network := range travelCfg.OrgNetworks {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return TravelOptions{}, fmt.Errorf("invalid organization network %s: %v", network, err)
+		}
+		opts.OrgNetworks = append(opts.OrgNetworks, prefix.Masked())
+	}
+	return opts, nil
+}
+
+// orgNetwork checks if a login is from a network of the organization
+func (o TravelOptions) orgNetwork(login Login) bool {
+	addr, err := netip.ParseAddr(login.SourceIP)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range o.OrgNetworks {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Login is a geolocated console login
+type Login struct {
+	Time     time.Time
+	SourceIP string
+	Location geoip.Location
+}
+
+// TravelFinding is a pair of consecutive console logins of an identity too far apart for the time between them
+type TravelFinding struct {
+	Identity   string
+	Traveler   string // name of the high-risk traveler of the identity, if any
+	From       Login
+	To         Login
+	DistanceKm float64
+	SpeedKmh   float64 // +Inf when the logins are at the same time
+	Declared   bool    // both logins are explained by a trip of the traveler in progress
+	Note       string  // how the logins relate to the trips of the traveler
+}
+
+func (f TravelFinding) String() string {
+	speed := fmt.Sprintf("%.0f km/h", f.SpeedKmh)
+	if math.IsInf(f.SpeedKmh, 1) {
+		speed = "at the same time"
+	}
+	text := fmt.Sprintf("%s: console logins from %s (%s) at %s and %s (%s) at %s, %.0f km in %s (%s)", f.Identity,
+		f.From.Location.Country, f.From.SourceIP, f.From.Time.UTC().Format(time.RFC3339),
+		f.To.Location.Country, f.To.SourceIP, f.To.Time.UTC().Format(time.RFC3339),
+		f.DistanceKm, f.To.Time.Sub(f.From.Time), speed)
+	if f.Note != "" {
+		text += "; " + f.Note
+	}
+	return text
+}
+
+// trip is a declared travel with its dates widened by the margin
+type trip struct {
+	destinations map[string]bool
+	start, end   time.Time
+	dates        string
+}
+
+// traveler is a high-risk traveler with the identity of its console logins
+type traveler struct {
+	name     string
+	identity string
+	trips    []trip
+}
+
+// travelers returns the travelers of high_risk_travel_config.users
+func travelers(users []config.HighRiskTravelUser) ([]traveler, error) {
+	var result []traveler
+	for _, user := range users {
+		t := traveler{name: user.Name, identity: user.IAMUser}
+		if t.identity == "" {
+			t.identity = user.UserID
+		}
+		if t.name == "" {
+			t.name = user.UserID
+		}
+		for _, declared := range user.Trips {
+			departure, err := time.Parse(tripDateLayout, declared.Departure)
+			if err != nil {
+				return nil, fmt.Errorf("invalid departure of a trip of %s: %v", user.UserID, err)
+			}
+			back, err := time.Parse(tripDateLayout, declared.Return)
+			if err != nil {
+				return nil, fmt.Errorf("invalid return of a trip of %s: %v", user.UserID, err)
+			}
+			tr := trip{
+				destinations: map[string]bool{},
+				start:        departure.Add(-tripMargin),
+				end:          back.AddDate(0, 0, 1).Add(tripMargin),
+				dates:        declared.Departure + " to " + declared.Return,
+			}
+			for _, country := range declared.Destinations {
+				tr.destinations[strings.ToUpper(country)] = true
+			}
+			t.trips = append(t.trips, tr)
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+// covers checks if a login is from a destination of the trip during its dates
+func (tr *trip) covers(login Login) bool {
+	return tr.destinations[login.Location.Country] && !login.Time.Before(tr.start) && login.Time.Before(tr.end)
+}
+
+// destinationTrip returns a trip the country of a login is a destination of
+func (t *traveler) destinationTrip(login Login) *trip {
+	for i := range t.trips {
+		if t.trips[i].destinations[login.Location.Country] {
+			return &t.trips[i]
+		}
+	}
+	return nil
+}
+
+// declared returns the trip in progress that explains both logins of a travel: one is from a destination of
+// the trip, the other from a destination of the same trip or from a network of the organization
+func (t *traveler) declared(from, to Login, opts TravelOptions) *trip {
+	for i := range t.trips {
+		tr := &t.trips[i]
+		fromTrip, toTrip := tr.covers(from), tr.covers(to)
+		if (fromTrip || toTrip) && (fromTrip || opts.orgNetwork(from)) && (toTrip || opts.orgNetwork(to)) {
+			return tr
+		}
+	}
+	return nil
+}
+
+// travelNote explains how a login relates to the trips of a traveler
+func (t *traveler) travelNote(login Login, opts TravelOptions) string {
+	for i := range t.trips {
+		if t.trips[i].covers(login) {
+			return fmt.Sprintf("%s is a destination of the trip of %s from %s", login.Location.Country, t.name, t.trips[i].dates)
+		}
+	}
+	if opts.orgNetwork(login) {
+		return fmt.Sprintf("%s is a network of the organization", login.SourceIP)
+	}
+	if tr := t.destinationTrip(login); tr != nil {
+		return fmt.Sprintf("%s is a destination of the trip of %s from %s, outside its dates", login.Location.Country, t.name, tr.dates)
+	}
+	return fmt.Sprintf("%s is not a destination of a trip of %s in progress", login.Location.Country, t.name)
+}
+
+// identityLogins are the console logins of an identity
+type identityLogins struct {
+	name   string
+	arn    string
+	logins []Login
+}
+
+// successfulLogin checks that a console login did not fail
+func successfulLogin(e trailstore.Event) bool {
+	var record struct {
+		ResponseElements struct {
+			ConsoleLogin string `json:"ConsoleLogin"`
+		} `json:"responseElements"`
+	}
+	json.Unmarshal(e.Raw, &record)
+	return record.ResponseElements.ConsoleLogin != "Failure" && e.ErrorMessage == ""
+}
+
+// distanceKm returns the great-circle distance between two locations
+func distanceKm(from, to geoip.Location) float64 {
+	rad := math.Pi / 180
+	dLat := (to.Latitude - from.Latitude) * rad
+	dLon := (to.Longitude - from.Longitude) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(from.Latitude*rad)*math.Cos(to.Latitude*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// ImpossibleTravel returns the consecutive successful console logins of each identity whose distance could
+// not be travelled in the time between them. A travel of a high-risk traveler is Declared when one login is
+// from a destination of a trip in progress and the other from a destination of the same trip or from a
+// network of the organization, since travelers alternate between local connections and the VPN.
+func ImpossibleTravel(events []trailstore.Event, geo *geoip.DB, users []config.HighRiskTravelUser, opts TravelOptions) ([]TravelFinding, error) {
+	declaredTravelers, err := travelers(users)
+	if err != nil {
+		return nil, err
+	}
+
+	identities := map[string]*identityLogins{}
+	for _, e := range events {
+		if e.EventName != consoleLoginEventName || !successfulLogin(e) {
+			continue
+		}
+		location, ok := geo.Lookup(e.SourceIP)
+		if !ok || !location.HasCoordinates {
+			continue
+		}
+		key := e.UserIdentity.ARN
+		if key == "" {
+			key = e.User()
+		}
+		identity, ok := identities[key]
+		if !ok {
+			identity = &identityLogins{name: e.User(), arn: e.UserIdentity.ARN}
+			if identity.arn != "" {
+				// The session name of an assumed role, such as the user of IAM Identity Center
+				identity.name = identity.arn[strings.LastIndexAny(identity.arn, ":/")+1:]
+			}
+			identities[key] = identity
+		}
+		identity.logins = append(identity.logins, Login{Time: e.EventTime, SourceIP: e.SourceIP, Location: location})
+	}
+
+	var findings []TravelFinding
+	for _, identity := range identities {
+		var t *traveler
+		for i := range declaredTravelers {
+			if strings.EqualFold(declaredTravelers[i].identity, identity.name) || strings.EqualFold(declaredTravelers[i].identity, identity.arn) {
+				t = &declaredTravelers[i]
+				break
+			}
+		}
+
+		logins := identity.logins
+		sort.SliceStable(logins, func(i, j int) bool { return logins[i].Time.Before(logins[j].Time) })
+		for i := 1; i < len(logins); i++ {
+			from, to := logins[i-1], logins[i]
+			distance := distanceKm(from.Location, to.Location)
+			if distance < opts.MinDistanceKm {
+				continue
+			}
+			speed := math.Inf(1)
+			if hours := to.Time.Sub(from.Time).Hours(); hours > 0 {
+				speed = distance / hours
+			}
+			if speed <= opts.MaxSpeedKmh {
+				continue
+			}
+
+			finding := TravelFinding{Identity: identity.name, From: from, To: to, DistanceKm: distance, SpeedKmh: speed}
+			if t != nil {
+				finding.Traveler = t.name
+				finding.Declared = t.declared(from, to, opts) != nil
+				finding.Note = t.travelNote(from, opts) + "; " + t.travelNote(to, opts)
+			}
+			findings = append(findings, finding)
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		if !findings[i].To.Time.Equal(findings[j].To.Time) {
+			return findings[i].To.Time.Before(findings[j].To.Time)
+		}
+		return findings[i].Identity < findings[j].Identity
+	})
+	return findings, nil
+}
+
+// DetectTravel returns the impossible travels between the console logins of the last impossible_travel.days,
+// read from the event store or from LookupEvents in us-east-1 and in the configured region. Without any
+// console login the travels can't be evaluated, and an error is returned.
+func DetectTravel(cfg aws.Config) ([]TravelFinding, error) {
+	travelCfg := config.AppConfig.AWS.ImpossibleTravel
+	days := travelCfg.Days
+	if days <= 0 {
+		days = defaultTravelDays
+	}
+	if config.AppConfig.AWS.GeoIPDatabase == "" {
+		return nil, fmt.Errorf("geoip_database is required to geolocate the console logins")
+	}
+	geo, err := geoip.Cached(config.AppConfig.AWS.GeoIPDatabase)
+	if err != nil {
+		return nil, err
+	}
+
+	regions := []string{loginRegion}
+	if cfg.Region != "" && cfg.Region != loginRegion {
+		regions = append(regions, cfg.Region)
+	}
+	end := time.Now()
+	query := trailstore.Query{EventName: consoleLoginEventName, Start: end.AddDate(0, 0, -days), End: end}
+	seen := map[string]bool{}
+	var events []trailstore.Event
+	for _, region := range regions {
+		client := cloudtrail.NewFromConfig(cfg, func(o *cloudtrail.Options) {
+			o.Region = region
+		})
+		found, err := trailstore.Search(client, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the console logins of %s: %v", region, err)
+		}
+		// With an event store both searches return the same events
+		for _, e := range found {
+			if e.EventID != "" && seen[e.EventID] {
+				continue
+			}
+			seen[e.EventID] = true
+			events = append(events, e)
+		}
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("no console logins in the last %d days, impossible travel not evaluated", days)
+	}
+	opts, err := NewTravelOptions(travelCfg)
+	if err != nil {
+		return nil, err
+	}
+	return ImpossibleTravel(events, geo, config.AppConfig.AWS.HighRiskTravelConfig.Users, opts)
+}
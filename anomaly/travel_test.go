@@ -0,0 +1,102 @@
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/geoip"
+	"cloud_compliance_checker/trailstore"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const cities = `network,country_code,latitude,longitude
+198.51.100.0/24,US,38.9,-77.0
+192.0.2.0/24,US,40.7,-74.0
+203.0.113.0/24,DE,50.1,8.7
+100.64.1.0/24,CN,39.9,116.4
+`
+
+// login returns a ConsoleLogin event of an identity
+func login(t *testing.T, arn, at, ip, result string) trailstore.Event {
+	e, err := trailstore.ParseEvent([]byte(fmt.Sprintf(`{"eventTime": %q, "eventSource": "signin.amazonaws.com", "eventName": "ConsoleLogin",
+		"sourceIPAddress": %q, "userIdentity": {"arn": %q}, "responseElements": {"ConsoleLogin": %q}}`, at, ip, arn, result)))
+	assert.NoError(t, err)
+	return e
+}
+
+func TestImpossibleTravel(t *testing.T) {
+	geo, err := geoip.Read(strings.NewReader(cities))
+	if !assert.NoError(t, err) {
+		return
+	}
+	alice := "arn:aws:iam::111122223333:user/alice"
+	bob := "arn:aws:iam::111122223333:user/bob"
+	dave := "arn:aws:sts::111122223333:assumed-role/AWSReservedSSO_Admin_0123/dave@example.com"
+	events := []trailstore.Event{
+		login(t, alice, "2024-05-10T08:00:00Z", "203.0.113.5", "Failure"),
+		login(t, alice, "2024-05-10T09:00:00Z", "198.51.100.7", "Success"),
+		login(t, alice, "2024-05-10T10:00:00Z", "192.0.2.7", "Success"), // closer than min_distance_km
+		login(t, alice, "2024-05-10T12:00:00Z", "203.0.113.5", "Success"),
+		login(t, alice, "2024-05-13T12:00:00Z", "198.51.100.7", "Success"), // 72 hours later
+		login(t, dave, "2024-05-11T09:00:00Z", "198.51.100.9", "Success"),
+		login(t, dave, "2024-05-11T09:00:00Z", "203.0.113.9", "Success"),
+		login(t, bob, "2024-05-03T08:00:00Z", "198.51.100.8", "Success"),
+		login(t, bob, "2024-05-03T10:00:00Z", "203.0.113.8", "Success"),
+		login(t, bob, "2024-05-04T10:00:00Z", "203.0.113.8", "Success"),
+		login(t, bob, "2024-05-04T11:00:00Z", "100.64.1.20", "Success"),
+		login(t, bob, "2024-05-20T08:00:00Z", "198.51.100.8", "Success"),
+		login(t, bob, "2024-05-20T09:00:00Z", "203.0.113.8", "Success"),
+	}
+	users := []config.HighRiskTravelUser{{UserID: "u124", Name: "Bob", IAMUser: "bob",
+		Trips: []config.TravelTrip{{Destinations: []string{"de"}, Departure: "2024-05-01", Return: "2024-05-05"}}}}
+
+	opts, err := NewTravelOptions(config.ImpossibleTravelConfig{OrgNetworks: []string{"198.51.100.0/24"}})
+	assert.NoError(t, err)
+	findings, err := ImpossibleTravel(events, geo, users, opts)
+	if !assert.NoError(t, err) || !assert.Len(t, findings, 5) {
+		return
+	}
+
+	// During the trip, the travel between the VPN of the organization and the destination is declared
+	assert.Equal(t, "bob", findings[0].Identity)
+	assert.Equal(t, "Bob", findings[0].Traveler)
+	assert.True(t, findings[0].Declared)
+	assert.Equal(t, "198.51.100.8 is a network of the organization; DE is a destination of the trip of Bob from 2024-05-01 to 2024-05-05", findings[0].Note)
+
+	// A third country next to the destination is not explained by the trip
+	assert.Equal(t, "100.64.1.20", findings[1].To.SourceIP)
+	assert.False(t, findings[1].Declared)
+	assert.Equal(t, "DE is a destination of the trip of Bob from 2024-05-01 to 2024-05-05; CN is not a destination of a trip of Bob in progress", findings[1].Note)
+	findings = findings[1:]
+
+	assert.Equal(t, "alice", findings[1].Identity)
+	assert.Equal(t, "192.0.2.7", findings[1].From.SourceIP)
+	assert.InDelta(t, 6205, findings[1].DistanceKm, 1)
+	assert.InDelta(t, 3102, findings[1].SpeedKmh, 1)
+	assert.False(t, findings[1].Declared)
+	assert.Equal(t, "alice: console logins from US (192.0.2.7) at 2024-05-10T10:00:00Z and DE (203.0.113.5) at 2024-05-10T12:00:00Z, 6205 km in 2h0m0s (3102 km/h)", findings[1].String())
+
+	assert.Equal(t, "dave@example.com", findings[2].Identity)
+	assert.True(t, math.IsInf(findings[2].SpeedKmh, 1))
+
+	// After the trip, the same login is not declared
+	assert.False(t, findings[3].Declared)
+	assert.Equal(t, "198.51.100.8 is a network of the organization; DE is a destination of the trip of Bob from 2024-05-01 to 2024-05-05, outside its dates", findings[3].Note)
+
+	// Without the networks of the organization the login from home is not explained either
+	findings, err = ImpossibleTravel(events, geo, users, TravelOptions{MaxSpeedKmh: defaultMaxSpeedKmh, MinDistanceKm: defaultMinDistanceKm})
+	assert.NoError(t, err)
+	for _, finding := range findings {
+		assert.False(t, finding.Declared, finding.String())
+	}
+
+	_, err = NewTravelOptions(config.ImpossibleTravelConfig{OrgNetworks: []string{"vpn"}})
+	assert.Error(t, err)
+	users[0].Trips[0].Return = "05/05/2024"
+	_, err = ImpossibleTravel(events, geo, users, opts)
+	assert.Error(t, err)
+}
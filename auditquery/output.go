@@ -0,0 +1,78 @@
+package auditquery
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"cloud_compliance_checker/config"
+)
+
+// Output formats
+const (
+	FormatTable = "table"
+	FormatCSV   = "csv"
+	FormatJSON  = "json"
+)
+
+// Write writes the table as an aligned text table, CSV, or a JSON array of objects with the columns
+// in order. Counts are written as JSON numbers.
+func Write(w io.Writer, t Table, format string) error {
+	switch format {
+	case FormatTable, "":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(t.Columns, "\t"))
+		for _, row := range t.Rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(t.Columns)
+		cw.WriteAll(t.Rows)
+		return cw.Error()
+	case FormatJSON:
+		var buf bytes.Buffer
+		buf.WriteString("[")
+		for i, row := range t.Rows {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n  {")
+			for j, column := range t.Columns {
+				if j > 0 {
+					buf.WriteString(", ")
+				}
+				key, _ := json.Marshal(column)
+				buf.Write(key)
+				buf.WriteString(": ")
+				if n, err := strconv.Atoi(row[j]); err == nil && column == "count" {
+					buf.WriteString(strconv.Itoa(n))
+					continue
+				}
+				value, _ := json.Marshal(row[j])
+				buf.Write(value)
+			}
+			buf.WriteString("}")
+		}
+		buf.WriteString("\n]\n")
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	return fmt.Errorf("unknown format %q, expected table, csv or json", format)
+}
+
+// Saved returns the query of audit_queries with the given name
+func Saved(name string) (config.AuditQuery, bool) {
+	for _, saved := range config.AppConfig.AWS.AuditQueries {
+		if saved.Name == name {
+			return saved, true
+		}
+	}
+	return config.AuditQuery{}, false
+}
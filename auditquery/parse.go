@@ -0,0 +1,308 @@
+// Package auditquery reduces the CloudTrail events with a filter and aggregation language, so that
+// audit reports are built without writing Go, for example
+//
+//	user=alice AND eventName=Delete* | count by sourceIP
+//
+// The filter compares fields with =, != (case-insensitive, * matches any text), <, <=, > and >=
+// (times, numbers or text), combined with AND, OR, NOT and parentheses. It is followed by stages:
+// fields f1, f2; count [by f1, f2]; sort by f [asc|desc]; head n.
+package auditquery
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Query is a parsed query
+type Query struct {
+	Text   string
+	Filter Expr // nil selects every event
+	Stages []Stage
+}
+
+// Expr is a filter expression
+type Expr interface {
+	match(r row) bool
+}
+
+// and matches when both expressions match
+type and struct{ left, right Expr }
+
+// or matches when either expression matches
+type or struct{ left, right Expr }
+
+// not matches when the expression does not match
+type not struct{ expr Expr }
+
+// Comparison compares a field with a value
+type Comparison struct {
+	Field string
+	Op    string
+	Value string
+
+	pattern *regexp.Regexp // for = and !=
+}
+
+// comparisonOps are the operators of the comparisons
+var comparisonOps = map[string]bool{"=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+// Stage is a stage of the pipeline: fields, count, sort or head
+type Stage struct {
+	Kind   string
+	Fields []string
+	Desc   bool
+	Limit  int
+}
+
+// token is a token of the query text
+type token struct {
+	kind  string // word, string, op or end
+	value string
+	pos   int
+}
+
+// lex splits the query text in tokens
+func lex(text string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(text); {
+		c := rune(text[i])
+		switch {
+		case isSpace(text[i]):
+			i++
+		case c == '"':
+			var value strings.Builder
+			j := i + 1
+			for ; j < len(text) && text[j] != '"'; j++ {
+				if text[j] == '\\' && j+1 < len(text) {
+					j++
+				}
+				value.WriteByte(text[j])
+			}
+			if j == len(text) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, token{"string", value.String(), i})
+			i = j + 1
+		case strings.ContainsRune("()|,", c):
+			tokens = append(tokens, token{"op", string(c), i})
+			i++
+		case strings.ContainsRune("=!<>", c):
+			op := string(c)
+			if i+1 < len(text) && text[i+1] == '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("unexpected ! at %d, expected !=", i)
+			}
+			tokens = append(tokens, token{"op", op, i})
+			i += len(op)
+		default:
+			j := i
+			for j < len(text) && !isSpace(text[j]) && !strings.ContainsRune("()|,\"=!<>", rune(text[j])) {
+				j++
+			}
+			tokens = append(tokens, token{"word", text[i:j], i})
+			i = j
+		}
+	}
+	return append(tokens, token{"end", "", len(text)}), nil
+}
+
+// isSpace checks if a byte of the query text is a space
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// parser parses the tokens of a query
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Parse parses a query
+func Parse(text string) (*Query, error) {
+	tokens, err := lex(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %v", err)
+	}
+	p := &parser{tokens: tokens}
+	q := &Query{Text: text}
+	if !p.is("op", "|") && !p.is("end", "") {
+		if q.Filter, err = p.or(); err != nil {
+			return nil, fmt.Errorf("invalid query: %v", err)
+		}
+	}
+	for p.is("op", "|") {
+		p.pos++
+		stage, err := p.stage()
+		if err != nil {
+			return nil, fmt.Errorf("invalid query: %v", err)
+		}
+		q.Stages = append(q.Stages, stage)
+	}
+	if !p.is("end", "") {
+		return nil, fmt.Errorf("invalid query: unexpected %q at %d", p.peek().value, p.peek().pos)
+	}
+	return q, nil
+}
+
+// peek returns the current token
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// is checks the current token, keywords case-insensitive
+func (p *parser) is(kind, value string) bool {
+	t := p.peek()
+	return t.kind == kind && (kind == "end" || strings.EqualFold(t.value, value))
+}
+
+// keyword consumes a keyword when it is the current token
+func (p *parser) keyword(value string) bool {
+	if p.is("word", value) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// or parses expr OR expr
+func (p *parser) or() (Expr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = or{left, right}
+	}
+	return left, nil
+}
+
+// and parses expr AND expr
+func (p *parser) and() (Expr, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = and{left, right}
+	}
+	return left, nil
+}
+
+// not parses NOT expr, a parenthesized expression or a comparison
+func (p *parser) not() (Expr, error) {
+	if p.keyword("NOT") {
+		expr, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return not{expr}, nil
+	}
+	if p.is("op", "(") {
+		p.pos++
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.is("op", ")") {
+			return nil, fmt.Errorf("expected ) at %d", p.peek().pos)
+		}
+		p.pos++
+		return expr, nil
+	}
+	return p.comparison()
+}
+
+// comparison parses field op value
+func (p *parser) comparison() (Expr, error) {
+	field := p.peek()
+	if field.kind != "word" {
+		return nil, fmt.Errorf("expected a field at %d", field.pos)
+	}
+	p.pos++
+	op := p.peek()
+	if op.kind != "op" || !comparisonOps[op.value] {
+		return nil, fmt.Errorf("expected a comparison after %s at %d", field.value, op.pos)
+	}
+	p.pos++
+	value := p.peek()
+	if value.kind != "word" && value.kind != "string" {
+		return nil, fmt.Errorf("expected a value after %s%s at %d", field.value, op.value, value.pos)
+	}
+	p.pos++
+
+	c := &Comparison{Field: field.value, Op: op.value, Value: value.value}
+	if c.Op == "=" || c.Op == "!=" {
+		c.pattern = regexp.MustCompile("(?is)^" + strings.ReplaceAll(regexp.QuoteMeta(c.Value), `\*`, ".*") + "$")
+	}
+	return c, nil
+}
+
+// stage parses a stage of the pipeline
+func (p *parser) stage() (Stage, error) {
+	switch {
+	case p.keyword("fields"):
+		fields, err := p.fields()
+		return Stage{Kind: "fields", Fields: fields}, err
+	case p.keyword("count"):
+		stage := Stage{Kind: "count"}
+		if p.keyword("by") {
+			var err error
+			if stage.Fields, err = p.fields(); err != nil {
+				return stage, err
+			}
+		}
+		return stage, nil
+	case p.keyword("sort"):
+		p.keyword("by")
+		fields, err := p.fields()
+		if err != nil {
+			return Stage{}, err
+		}
+		stage := Stage{Kind: "sort", Fields: fields}
+		if p.keyword("desc") {
+			stage.Desc = true
+		} else {
+			p.keyword("asc")
+		}
+		return stage, nil
+	case p.keyword("head"):
+		t := p.peek()
+		limit, err := strconv.Atoi(t.value)
+		if t.kind != "word" || err != nil || limit < 0 {
+			return Stage{}, fmt.Errorf("expected a number after head at %d", t.pos)
+		}
+		p.pos++
+		return Stage{Kind: "head", Limit: limit}, nil
+	}
+	t := p.peek()
+	return Stage{}, fmt.Errorf("unknown stage %q at %d, expected fields, count, sort or head", t.value, t.pos)
+}
+
+// fields parses a list of fields separated by commas
+func (p *parser) fields() ([]string, error) {
+	var fields []string
+	for {
+		t := p.peek()
+		if t.kind != "word" {
+			return nil, fmt.Errorf("expected a field at %d", t.pos)
+		}
+		fields = append(fields, t.value)
+		p.pos++
+		if !p.is("op", ",") {
+			return fields, nil
+		}
+		p.pos++
+	}
+}
@@ -0,0 +1,97 @@
+package auditquery
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"cloud_compliance_checker/trailstore"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// events returns the events of CloudTrail records
+func events(t *testing.T, records ...string) []trailstore.Event {
+	var parsed []trailstore.Event
+	for _, record := range records {
+		event, err := trailstore.ParseEvent([]byte(record))
+		if assert.NoError(t, err) {
+			parsed = append(parsed, event)
+		}
+	}
+	return parsed
+}
+
+func TestRun(t *testing.T) {
+	found := events(t,
+		`{"eventID": "1", "eventTime": "2024-05-01T10:00:00Z", "eventName": "DeleteObject", "sourceIPAddress": "198.51.100.7", "awsRegion": "us-east-1",
+		  "userIdentity": {"userName": "alice"}, "requestParameters": {"bucketName": "cui-data"}}`,
+		`{"eventID": "2", "eventTime": "2024-05-01T11:00:00Z", "eventName": "DeleteBucket", "sourceIPAddress": "198.51.100.7", "awsRegion": "us-east-1",
+		  "userIdentity": {"userName": "alice"}, "errorCode": "AccessDenied", "requestParameters": {"bucketName": "cui-data"}}`,
+		`{"eventID": "3", "eventTime": "2024-05-01T12:00:00Z", "eventName": "deleteObject", "sourceIPAddress": "203.0.113.9", "awsRegion": "us-west-2",
+		  "userIdentity": {"userName": "alice"}}`,
+		`{"eventID": "4", "eventTime": "2024-05-01T13:00:00Z", "eventName": "DeleteObject", "sourceIPAddress": "198.51.100.7", "awsRegion": "us-east-1",
+		  "userIdentity": {"userName": "bob"}}`,
+		`{"eventID": "5", "eventTime": "2024-05-01T14:00:00Z", "eventName": "GetObject", "sourceIPAddress": "198.51.100.7", "awsRegion": "us-east-1",
+		  "userIdentity": {"userName": "alice"}}`,
+	)
+	run := func(text string) Table {
+		q, err := Parse(text)
+		if !assert.NoError(t, err, text) {
+			return Table{}
+		}
+		return Run(q, found)
+	}
+
+	table := run("user=alice AND eventName=Delete* | count by sourceIP")
+	assert.Equal(t, []string{"sourceIP", "count"}, table.Columns)
+	assert.Equal(t, [][]string{{"198.51.100.7", "2"}, {"203.0.113.9", "1"}}, table.Rows)
+
+	table = run(`(user=bob OR sourceIP=203.*) AND NOT region="us-west-2" | fields eventID, user`)
+	assert.Equal(t, [][]string{{"4", "bob"}}, table.Rows)
+
+	table = run("requestParameters.bucketName=cui-data AND errorCode!=AccessDenied | fields eventID")
+	assert.Equal(t, [][]string{{"1"}}, table.Rows)
+
+	table = run("eventTime>=2024-05-01T12:00:00Z | sort by eventTime desc | head 2 | fields eventID")
+	assert.Equal(t, [][]string{{"5"}, {"4"}}, table.Rows)
+
+	table = run("| count by user, region | sort by count, user")
+	assert.Equal(t, [][]string{{"alice", "us-west-2", "1"}, {"bob", "us-east-1", "1"}, {"alice", "us-east-1", "3"}}, table.Rows)
+
+	table = run("eventName=PutObject | count")
+	assert.Equal(t, [][]string{{"0"}}, table.Rows)
+
+	table = run("eventID=5")
+	assert.Equal(t, DefaultColumns, table.Columns)
+	assert.Equal(t, [][]string{{"2024-05-01T14:00:00Z", "GetObject", "alice", "198.51.100.7", "us-east-1", "", ""}}, table.Rows)
+
+	var out bytes.Buffer
+	assert.NoError(t, Write(&out, run("eventName=Delete* | count by user"), FormatJSON))
+	assert.JSONEq(t, `[{"user": "alice", "count": 3}, {"user": "bob", "count": 1}]`, out.String())
+	out.Reset()
+	assert.NoError(t, Write(&out, run("eventName=Delete* | count by user"), FormatCSV))
+	assert.Equal(t, "user,count\nalice,3\nbob,1\n", out.String())
+}
+
+func TestParse(t *testing.T) {
+	for _, text := range []string{
+		"user=",
+		"user alice",
+		"(user=alice",
+		"user=alice | group by user",
+		"user=alice | head ten",
+		`user="alice`,
+		"user=alice bob",
+	} {
+		_, err := Parse(text)
+		assert.Error(t, err, text)
+	}
+
+	// Only the equalities combined with AND narrow the events read from the store
+	q, err := Parse("user=alice AND sourceIP=198.51.100.7 AND (resource=cui-data OR eventName=GetObject) AND resource!=x")
+	if assert.NoError(t, err) {
+		start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		assert.Equal(t, trailstore.Query{User: "alice", SourceIP: "198.51.100.7", Start: start}, q.StoreQuery(start, time.Time{}))
+	}
+}
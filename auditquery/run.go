@@ -0,0 +1,314 @@
+package auditquery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud_compliance_checker/trailstore"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+)
+
+// DefaultColumns are the columns of the events when the query has no fields or count stage
+var DefaultColumns = []string{"eventTime", "eventName", "user", "sourceIP", "region", "errorCode", "resource"}
+
+// Table is the result of a query
+type Table struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// row is an event or a row of a table
+type row interface {
+	values(field string) []string
+}
+
+// eventRow exposes the fields of an event
+type eventRow struct {
+	event *trailstore.Event
+	raw   map[string]interface{} // parsed on the first field not in the Event struct
+}
+
+// values returns the values of a field. Fields not in the list below are dotted paths of the record, such
+// as requestParameters.bucketName.
+func (r *eventRow) values(field string) []string {
+	e := r.event
+	switch strings.ToLower(field) {
+	case "eventid":
+		return []string{e.EventID}
+	case "eventtime", "time":
+		return []string{e.EventTime.UTC().Format(time.RFC3339)}
+	case "eventname":
+		return []string{e.EventName}
+	case "eventsource":
+		return []string{e.EventSource}
+	case "eventtype":
+		return []string{e.EventType}
+	case "region", "awsregion":
+		return []string{e.Region}
+	case "sourceip", "sourceipaddress":
+		return []string{e.SourceIP}
+	case "useragent":
+		return []string{e.UserAgent}
+	case "errorcode":
+		return []string{e.ErrorCode}
+	case "errormessage":
+		return []string{e.ErrorMessage}
+	case "readonly":
+		if e.ReadOnly == nil {
+			return []string{""}
+		}
+		return []string{strconv.FormatBool(*e.ReadOnly)}
+	case "user", "username":
+		return []string{e.User()}
+	case "userarn":
+		return []string{e.UserIdentity.ARN}
+	case "usertype":
+		return []string{e.UserIdentity.Type}
+	case "accesskeyid":
+		return []string{e.UserIdentity.AccessKeyID}
+	case "account", "accountid":
+		return []string{e.UserIdentity.AccountID}
+	case "resource", "resources":
+		return e.ResourceNames()
+	}
+
+	if r.raw == nil {
+		r.raw = map[string]interface{}{}
+		json.Unmarshal(e.Raw, &r.raw)
+	}
+	var value interface{} = r.raw
+	for _, key := range strings.Split(field, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{""}
+		}
+		value = object[key]
+	}
+	switch v := value.(type) {
+	case nil:
+		return []string{""}
+	case string:
+		return []string{v}
+	case float64, bool:
+		return []string{fmt.Sprint(v)}
+	}
+	data, _ := json.Marshal(value)
+	return []string{string(data)}
+}
+
+// tableRow is a row produced by a stage
+type tableRow struct {
+	columns []string
+	cells   []string
+}
+
+// values returns the cell of a column, case-insensitive
+func (r *tableRow) values(field string) []string {
+	for i, column := range r.columns {
+		if strings.EqualFold(column, field) {
+			return []string{r.cells[i]}
+		}
+	}
+	return []string{""}
+}
+
+func (e and) match(r row) bool { return e.left.match(r) && e.right.match(r) }
+
+func (e or) match(r row) bool { return e.left.match(r) || e.right.match(r) }
+
+func (e not) match(r row) bool { return !e.expr.match(r) }
+
+// match checks the comparison on the values of the field: = matches any value, != none
+func (c *Comparison) match(r row) bool {
+	values := r.values(c.Field)
+	if c.Op == "!=" {
+		for _, value := range values {
+			if c.pattern.MatchString(value) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, value := range values {
+		if c.Op == "=" {
+			if c.pattern.MatchString(value) {
+				return true
+			}
+			continue
+		}
+		order := compare(value, c.Value)
+		if (c.Op == "<" && order < 0) || (c.Op == "<=" && order <= 0) || (c.Op == ">" && order > 0) || (c.Op == ">=" && order >= 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// compare compares two values as times, numbers or text
+func compare(a, b string) int {
+	if ta, err := time.Parse(time.RFC3339, a); err == nil {
+		if tb, err := time.Parse(time.RFC3339, b); err == nil {
+			return ta.Compare(tb)
+		}
+	}
+	if fa, err := strconv.ParseFloat(a, 64); err == nil {
+		if fb, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// Run runs the query on the events
+func Run(q *Query, events []trailstore.Event) Table {
+	var rows []row
+	for i := range events {
+		r := &eventRow{event: &events[i]}
+		if q.Filter == nil || q.Filter.match(r) {
+			rows = append(rows, r)
+		}
+	}
+
+	var columns []string // nil while the rows are events
+	for _, stage := range q.Stages {
+		switch stage.Kind {
+		case "fields":
+			columns, rows = stage.Fields, project(rows, stage.Fields)
+		case "count":
+			columns, rows = count(rows, stage.Fields)
+		case "sort":
+			sort.SliceStable(rows, func(i, j int) bool {
+				for _, field := range stage.Fields {
+					order := compare(cell(rows[i], field), cell(rows[j], field))
+					if order != 0 {
+						return (order < 0) != stage.Desc
+					}
+				}
+				return false
+			})
+		case "head":
+			if stage.Limit < len(rows) {
+				rows = rows[:stage.Limit]
+			}
+		}
+	}
+	if columns == nil {
+		columns, rows = DefaultColumns, project(rows, DefaultColumns)
+	}
+
+	table := Table{Columns: columns, Rows: make([][]string, 0, len(rows))}
+	for _, r := range rows {
+		table.Rows = append(table.Rows, r.(*tableRow).cells)
+	}
+	return table
+}
+
+// cell returns the values of a field joined by commas
+func cell(r row, field string) string {
+	return strings.Join(r.values(field), ",")
+}
+
+// project keeps the given fields of the rows
+func project(rows []row, fields []string) []row {
+	projected := make([]row, 0, len(rows))
+	for _, r := range rows {
+		cells := make([]string, len(fields))
+		for i, field := range fields {
+			cells[i] = cell(r, field)
+		}
+		projected = append(projected, &tableRow{columns: fields, cells: cells})
+	}
+	return projected
+}
+
+// count groups the rows by the given fields, most frequent first
+func count(rows []row, fields []string) ([]string, []row) {
+	columns := append(append([]string{}, fields...), "count")
+	counts := map[string]int{}
+	groups := map[string][]string{}
+	for _, r := range rows {
+		cells := make([]string, len(fields))
+		for i, field := range fields {
+			cells[i] = cell(r, field)
+		}
+		key := strings.Join(cells, "\x00")
+		if _, ok := groups[key]; !ok {
+			groups[key] = cells
+		}
+		counts[key]++
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(fields) == 0 && len(keys) == 0 {
+		keys, groups[""] = []string{""}, []string{}
+	}
+
+	counted := make([]row, 0, len(keys))
+	for _, key := range keys {
+		counted = append(counted, &tableRow{columns: columns, cells: append(groups[key], strconv.Itoa(counts[key]))})
+	}
+	return columns, counted
+}
+
+// StoreQuery returns the query of the event store for the equalities of the filter on indexed fields,
+// combined with AND, and the time range. The events it returns include every event matching the filter.
+func (q *Query) StoreQuery(start, end time.Time) trailstore.Query {
+	query := trailstore.Query{Start: start, End: end}
+	var visit func(Expr)
+	visit = func(expr Expr) {
+		switch e := expr.(type) {
+		case and:
+			visit(e.left)
+			visit(e.right)
+		case *Comparison:
+			if e.Op != "=" || strings.Contains(e.Value, "*") {
+				return
+			}
+			// Event names are indexed case-sensitive, while the comparison is not
+			switch strings.ToLower(e.Field) {
+			case "user", "username":
+				query.User = e.Value
+			case "sourceip", "sourceipaddress":
+				query.SourceIP = e.Value
+			case "resource", "resources":
+				query.Resource = e.Value
+			}
+		}
+	}
+	if q.Filter != nil {
+		visit(q.Filter)
+	}
+	return query
+}
+
+// Execute runs the query on the events between start and end, read from the configured event store or
+// from LookupEvents. When LookupEvents has more events than it reads, the table of the events read is
+// returned with trailstore.ErrTruncated.
+func Execute(client *cloudtrail.Client, q *Query, start, end time.Time) (Table, error) {
+	events, err := trailstore.Search(client, q.StoreQuery(start, end))
+	if err != nil && !errors.Is(err, trailstore.ErrTruncated) {
+		return Table{}, err
+	}
+	return Run(q, events), err
+}
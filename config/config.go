@@ -35,6 +35,23 @@ type AWSConfig struct {
 	SecurityAssessmentConfig       SecurityAssessmentConfig `mapstructure:"security_assessment"`
 	Protection                     ProtectionConfig         `mapstructure:"protection"`
 	Integrity                      IntegrityConfig          `mapstructure:"integrity"`
+	Scheduler                      SchedulerConfig          `mapstructure:"scheduler"`
+	APIServer                      APIServerConfig          `mapstructure:"api_server"`
+	Notifications                  NotificationsConfig      `mapstructure:"notifications"`
+	CUIScope                       CUIScope                 `mapstructure:"cui_scope"`
+	LeastPrivilege                 LeastPrivilegeConfig     `mapstructure:"least_privilege"`
+	AccountManagement              AccountManagementConfig  `mapstructure:"account_management"`
+	RootAccount                    RootAccountConfig        `mapstructure:"root_account"`
+	MFA                            MFAConfig                `mapstructure:"mfa"`
+	Reachability                   ReachabilityConfig       `mapstructure:"reachability"`
+	NetworkACLs                    []NetworkACL             `mapstructure:"network_acls"`
+	FlowLogs                       FlowLogConfig            `mapstructure:"flow_logs"`
+	TrailStore                     TrailStoreConfig         `mapstructure:"trail_store"`
+	AuditQueries                   []AuditQuery             `mapstructure:"audit_queries"`
+	GeoIPDatabase                  string                   `mapstructure:"geoip_database"`
+	AnomalyDetection               AnomalyConfig            `mapstructure:"anomaly_detection"`
+	ImpossibleTravel               ImpossibleTravelConfig   `mapstructure:"impossible_travel"`
+	ThreatIntel                    ThreatIntelConfig        `mapstructure:"threat_intel"`
 }
 
 // User represents a user in the configuration
@@ -55,6 +72,14 @@ type SecurityGroup struct {
 	AllowedEgressPorts  []int  `mapstructure:"allowed_egress_ports"`
 }
 
+// NetworkACL rappresents the rules allowed in the network ACL of a subnet in the configuration
+type NetworkACL struct {
+	Subnet              string `mapstructure:"subnet"` // subnet ID or Name tag, "*" for the subnets not listed
+	AllowedIngressPorts []int  `mapstructure:"allowed_ingress_ports"`
+	AllowedEgressPorts  []int  `mapstructure:"allowed_egress_ports"`
+	EphemeralPorts      string `mapstructure:"ephemeral_ports"` // default 1024-65535
+}
+
 // S3Bucket rappresents a S3 bucket in the configuration
 type S3Bucket struct {
 	Name       string `mapstructure:"name"`
@@ -99,9 +124,18 @@ type HighRiskTravelConfig struct {
 
 // HighRiskTravelUser represents a user associated with high-risk travel
 type HighRiskTravelUser struct {
-	UserID string `mapstructure:"user_id"`
-	Name   string `mapstructure:"name"`
-	Role   string `mapstructure:"role"`
+	UserID  string       `mapstructure:"user_id"`
+	Name    string       `mapstructure:"name"`
+	Role    string       `mapstructure:"role"`
+	IAMUser string       `mapstructure:"iam_user"` // name or ARN of the identity of the console logins, default user_id
+	Trips   []TravelTrip `mapstructure:"trips"`
+}
+
+// TravelTrip is a travel declared by a high-risk traveler
+type TravelTrip struct {
+	Destinations []string `mapstructure:"destinations"` // ISO 3166 country codes
+	Departure    string   `mapstructure:"departure"`    // YYYY-MM-DD
+	Return       string   `mapstructure:"return"`       // YYYY-MM-DD, included
 }
 
 // PostTravelChecks defines the checks that need to be performed when the individual returns from travel
@@ -128,6 +162,14 @@ type PasswordPolicy struct {
 	RequireSymbols   bool `mapstructure:"require_symbols"`
 	RequireUppercase bool `mapstructure:"require_uppercase"`
 	RequireLowercase bool `mapstructure:"require_lowercase"`
+	// Maximum password age in days (0 = not required)
+	MaxAgeDays int `mapstructure:"max_age_days"`
+	// Number of previous passwords that can't be reused (0 = not required)
+	ReusePrevention int `mapstructure:"reuse_prevention"`
+	// Expired passwords can only be reset by an administrator
+	HardExpiry bool `mapstructure:"hard_expiry"`
+	// The IAM Identity Center identity source is an external IdP, whose password policy is not checked
+	IdentityCenterExternalIdP bool `mapstructure:"identity_center_external_idp"`
 }
 
 // AttackerInstanceConfig contains the attacker instance configuration
@@ -209,6 +251,204 @@ type IntegrityConfig struct {
 	LambdaName  string   `mapstructure:"lambda_name"`
 }
 
+// APIServerConfig holds the configuration of the server mode.
+// The bearer token can also be set with the COMPLIANCE_API_TOKEN environment variable.
+type APIServerConfig struct {
+	Token string `mapstructure:"token"`
+}
+
+// SchedulerConfig holds the configuration of the daemon mode
+type SchedulerConfig struct {
+	StateFile string         `mapstructure:"state_file"`
+	OutputDir string         `mapstructure:"output_dir"`
+	Jobs      []ScheduledJob `mapstructure:"jobs"`
+}
+
+// ScheduledJob is a group of controls evaluated together at its own frequency.
+// Schedule accepts a keyword (daily, weekly, monthly), an ISO-8601 duration (P1D, PT6H) or a cron expression.
+type ScheduledJob struct {
+	Name           string   `mapstructure:"name"`
+	Schedule       string   `mapstructure:"schedule"`
+	Controls       []string `mapstructure:"controls"`
+	CheckFunctions []string `mapstructure:"check_functions"`
+}
+
+// NotificationsConfig holds the notification channels and the routing rules
+type NotificationsConfig struct {
+	Channels    []NotificationChannel `mapstructure:"channels"`
+	Routes      []NotificationRoute   `mapstructure:"routes"`
+	DedupWindow string                `mapstructure:"dedup_window"`
+	RateLimit   RateLimitConfig       `mapstructure:"rate_limit"`
+}
+
+// NotificationChannel is a notification backend: slack, teams, webhook, smtp or sns
+type NotificationChannel struct {
+	Name string `mapstructure:"name"`
+	Type string `mapstructure:"type"`
+	// slack, teams, webhook
+	URL string `mapstructure:"url"`
+	// webhook: HMAC-SHA256 key used to sign the body
+	Secret string `mapstructure:"secret"`
+	// smtp
+	Host     string   `mapstructure:"host"`
+	Port     int      `mapstructure:"port"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+	// sns
+	TopicArn string `mapstructure:"topic_arn"`
+}
+
+// NotificationRoute sends the matching events to the listed channels. Empty filters match everything.
+type NotificationRoute struct {
+	Channels    []string `mapstructure:"channels"`
+	MinSeverity string   `mapstructure:"min_severity"`
+	Families    []string `mapstructure:"families"`
+	Accounts    []string `mapstructure:"accounts"`
+}
+
+// RateLimitConfig limits the number of notifications sent to a channel in a period
+type RateLimitConfig struct {
+	Max    int    `mapstructure:"max"`
+	Period string `mapstructure:"period"`
+}
+
+// CUIScope defines the boundary of the CUI enclave. When no selector is set every asset is in scope.
+// An asset is in scope when it is in one of the accounts and regions (if listed) and matches
+// at least one of tags, vpcs and arns (if any is listed).
+type CUIScope struct {
+	Tags     []ScopeTag `mapstructure:"tags"`
+	Accounts []string   `mapstructure:"accounts"`
+	Regions  []string   `mapstructure:"regions"`
+	VPCs     []string   `mapstructure:"vpcs"`
+	ARNs     []string   `mapstructure:"arns"`
+	// Tag holding the CUI category of an asset (default "cui_category")
+	CategoryTag string `mapstructure:"category_tag"`
+	// Users and roles authorized to access the enclave, documented for 03.04.11
+	AccessUsers []string `mapstructure:"access_users"`
+}
+
+// ScopeTag matches the assets with the tag. An empty value matches any value.
+type ScopeTag struct {
+	Key   string `mapstructure:"key"`
+	Value string `mapstructure:"value"`
+}
+
+// LeastPrivilegeConfig configures the unused permissions analysis based on the IAM access advisor
+type LeastPrivilegeConfig struct {
+	// Permissions not used for this many days are reported (default 90)
+	UnusedDays int `mapstructure:"unused_days"`
+	// Directory where the right-sized policies are written (default "right_sized_policies")
+	PolicyDir string `mapstructure:"policy_dir"`
+	// Users and roles excluded from the analysis (service-linked roles are always excluded)
+	Exclude []string `mapstructure:"exclude"`
+}
+
+// AccountManagementConfig holds the limits applied to the IAM credential report, in days (default 90)
+type AccountManagementConfig struct {
+	InactiveDays        int `mapstructure:"inactive_days"`
+	PasswordMaxAgeDays  int `mapstructure:"password_max_age_days"`
+	AccessKeyMaxAgeDays int `mapstructure:"access_key_max_age_days"`
+	AccessKeyUnusedDays int `mapstructure:"access_key_unused_days"`
+}
+
+// RootAccountConfig holds the settings of the root account assessment
+type RootAccountConfig struct {
+	AllowVirtualMFA   bool     `mapstructure:"allow_virtual_mfa"`
+	UsageDays         int      `mapstructure:"usage_days"`
+	AlternateContacts []string `mapstructure:"alternate_contacts"`
+}
+
+// MFAConfig holds the MFA device requirements: virtual, hardware or fido
+type MFAConfig struct {
+	UserDevice       string `mapstructure:"user_device"`
+	PrivilegedDevice string `mapstructure:"privileged_device"`
+	SignInDays       int    `mapstructure:"sign_in_days"`
+}
+
+// ReachabilityConfig holds the ports of the CUI instances that may be reached from the internet
+// and from the subnets outside the CUI scope
+type ReachabilityConfig struct {
+	AllowedInternetPorts []int `mapstructure:"allowed_internet_ports"`
+	AllowedInternalPorts []int `mapstructure:"allowed_internal_ports"`
+}
+
+// FlowLogConfig holds the sources of the VPC Flow Log records and the thresholds of the traffic analysis
+type FlowLogConfig struct {
+	LogGroups           []string `mapstructure:"log_groups"` // default the CloudWatch Logs destinations of the flow logs
+	Files               []string `mapstructure:"files"`      // local exports, plain text or gzip
+	Hours               int      `mapstructure:"hours"`
+	MaxRecords          int      `mapstructure:"max_records"` // per log group
+	KnownDestinations   []string `mapstructure:"known_destinations"`
+	EgressThresholdMB   int      `mapstructure:"egress_threshold_mb"`
+	RejectWindowMinutes int      `mapstructure:"reject_window_minutes"`
+	RejectSpikeFactor   float64  `mapstructure:"reject_spike_factor"`
+	RejectSpikeMinimum  int      `mapstructure:"reject_spike_minimum"`
+}
+
+// TrailStoreConfig holds the local store of the CloudTrail events and the log files ingested in it
+type TrailStoreConfig struct {
+	Dir         string             `mapstructure:"dir"`         // the audit checks query the store when set
+	Directories []string           `mapstructure:"directories"` // local copies of the trail buckets
+	Buckets     []TrailStoreBucket `mapstructure:"buckets"`
+	Days        int                `mapstructure:"days"` // log files delivered in the last days read from the buckets
+	// Hours between two runs of the ingest command, default 24: the store is stale when its newest event
+	// is older than that before the end of a query
+	IngestIntervalHours int `mapstructure:"ingest_interval_hours"`
+}
+
+// TrailStoreBucket is a bucket with the CloudTrail log files to ingest
+type TrailStoreBucket struct {
+	Bucket string `mapstructure:"bucket"`
+	Prefix string `mapstructure:"prefix"`
+}
+
+// AuditQuery is a saved reduction query of the audit events, run by the 03.03.06 check
+type AuditQuery struct {
+	Name   string `mapstructure:"name"`
+	Query  string `mapstructure:"query"`
+	Days   int    `mapstructure:"days"`   // events of the last days, default 30
+	Format string `mapstructure:"format"` // table, csv or json, default csv
+	Output string `mapstructure:"output"` // default audit_query_<name>.<format>
+}
+
+// AnomalyConfig holds the window of the behavioral baseline of the principals and the score of the anomalies
+type AnomalyConfig struct {
+	BaselineDays     int      `mapstructure:"baseline_days"`     // default 30
+	DetectionHours   int      `mapstructure:"detection_hours"`   // events scored against the baseline, default 24
+	MinEvents        int      `mapstructure:"min_events"`        // baseline events of a principal to score it, default 20
+	Threshold        float64  `mapstructure:"threshold"`         // score of an anomaly, default 3
+	SensitiveAPIs    []string `mapstructure:"sensitive_apis"`    // as service:Action, added to the defaults
+	IgnorePrincipals []string `mapstructure:"ignore_principals"` // names or ARNs
+}
+
+// ImpossibleTravelConfig holds the limits of the travel between consecutive console logins of an identity
+type ImpossibleTravelConfig struct {
+	Days          int      `mapstructure:"days"`            // console logins analyzed, default 30
+	MaxSpeedKmh   float64  `mapstructure:"max_speed_kmh"`   // default 1000
+	MinDistanceKm float64  `mapstructure:"min_distance_km"` // below it the GeoIP accuracy is too low, default 500
+	OrgNetworks   []string `mapstructure:"org_networks"`    // CIDRs of the VPN egress of the organization
+}
+
+// ThreatIntelConfig holds the threat-intel feeds and the resolver query logs matched against them
+type ThreatIntelConfig struct {
+	Feeds             []ThreatIntelFeed `mapstructure:"feeds"`
+	CacheDir          string            `mapstructure:"cache_dir"`           // copies of the URL feeds, default threat_intel
+	RefreshHours      int               `mapstructure:"refresh_hours"`       // age of the copies downloaded again, default 24
+	Hours             int               `mapstructure:"hours"`               // CloudTrail events and resolver queries matched, default 24
+	ResolverLogGroups []string          `mapstructure:"resolver_log_groups"` // CloudWatch Logs destinations of the resolver query logs
+	ResolverLogFiles  []string          `mapstructure:"resolver_log_files"`  // local exports, JSON lines, plain text or gzip
+}
+
+// ThreatIntelFeed is a list of indicators in a local file or at a URL
+type ThreatIntelFeed struct {
+	Name   string `mapstructure:"name"`
+	Path   string `mapstructure:"path"`
+	URL    string `mapstructure:"url"`
+	Format string `mapstructure:"format"` // stix, csv or plain, default from the extension
+}
+
 // AppConfig is the global configuration
 var AppConfig Config
 
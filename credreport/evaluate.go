@@ -0,0 +1,168 @@
+package credreport
+
+import (
+	"fmt"
+	"time"
+
+	"cloud_compliance_checker/config"
+)
+
+// Default thresholds, in days
+const (
+	defaultInactiveDays    = 90
+	defaultPasswordMaxAge  = 90
+	defaultAccessKeyMaxAge = 90
+	defaultAccessKeyUnused = 90
+	hoursPerDay            = 24
+)
+
+// Issues reported for the credentials
+const (
+	IssueRootAccessKey   = "root_access_key"
+	IssueNoMFA           = "console_without_mfa"
+	IssuePasswordAge     = "password_age"
+	IssuePasswordUnused  = "password_unused"
+	IssueAccessKeyAge    = "access_key_age"
+	IssueAccessKeyUnused = "access_key_unused"
+	IssueInactiveUser    = "inactive_user"
+)
+
+// Thresholds are the limits of the evaluation, in days
+type Thresholds struct {
+	InactiveDays    int
+	PasswordMaxAge  int
+	AccessKeyMaxAge int
+	AccessKeyUnused int
+}
+
+// ConfiguredThresholds returns the thresholds of config.yaml, with the defaults for the missing ones
+func ConfiguredThresholds() Thresholds {
+	c := config.AppConfig.AWS.AccountManagement
+	return Thresholds{
+		InactiveDays:    orDefault(c.InactiveDays, defaultInactiveDays),
+		PasswordMaxAge:  orDefault(c.PasswordMaxAgeDays, defaultPasswordMaxAge),
+		AccessKeyMaxAge: orDefault(c.AccessKeyMaxAgeDays, defaultAccessKeyMaxAge),
+		AccessKeyUnused: orDefault(c.AccessKeyUnusedDays, defaultAccessKeyUnused),
+	}
+}
+
+// orDefault returns def when value is not set
+func orDefault(value, def int) int {
+	if value <= 0 {
+		return def
+	}
+	return value
+}
+
+// Finding is a credential issue of a user
+type Finding struct {
+	User    string
+	Issue   string
+	Message string
+}
+
+// String formats the finding for the check responses
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s", f.User, f.Message)
+}
+
+// Evaluate checks the credentials of every user of the report
+func (r *Report) Evaluate(t Thresholds, now time.Time) []Finding {
+	var findings []Finding
+	for _, e := range r.Entries {
+		findings = append(findings, e.Evaluate(t, now)...)
+	}
+	return findings
+}
+
+// Evaluate checks the credentials of a user
+func (e Entry) Evaluate(t Thresholds, now time.Time) []Finding {
+	var findings []Finding
+	add := func(issue, format string, args ...interface{}) {
+		findings = append(findings, Finding{User: e.User, Issue: issue, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if e.IsRoot() {
+		for i, key := range e.AccessKeys {
+			if key.Active {
+				add(IssueRootAccessKey, "root account has active access key %d", i+1)
+			}
+		}
+		if !e.MFAActive {
+			add(IssueNoMFA, "root account without MFA")
+		}
+		return findings
+	}
+
+	if e.PasswordEnabled {
+		if !e.MFAActive {
+			add(IssueNoMFA, "console access without MFA")
+		}
+		changed := e.PasswordLastChanged
+		if changed == nil {
+			changed = e.Created
+		}
+		if age := daysSince(changed, now); age > t.PasswordMaxAge {
+			add(IssuePasswordAge, "password not changed for %d days (max %d)", age, t.PasswordMaxAge)
+		}
+		if e.PasswordLastUsed == nil && daysSince(e.Created, now) > t.InactiveDays {
+			add(IssuePasswordUnused, "console password never used")
+		}
+	}
+
+	for i, key := range e.AccessKeys {
+		if !key.Active {
+			continue
+		}
+		age := daysSince(key.LastRotated, now)
+		if age > t.AccessKeyMaxAge {
+			add(IssueAccessKeyAge, "access key %d not rotated for %d days (max %d)", i+1, age, t.AccessKeyMaxAge)
+		}
+		if age > t.AccessKeyUnused {
+			if key.LastUsed == nil {
+				add(IssueAccessKeyUnused, "access key %d never used", i+1)
+			} else if unused := daysSince(key.LastUsed, now); unused > t.AccessKeyUnused {
+				add(IssueAccessKeyUnused, "access key %d not used for %d days", i+1, unused)
+			}
+		}
+	}
+
+	if e.IsInactive(t.InactiveDays, now) {
+		last := "never"
+		if activity := e.LastActivity(); activity != nil {
+			last = activity.Format("2006-01-02")
+		}
+		add(IssueInactiveUser, "inactive for more than %d days with enabled credentials (last activity %s)", t.InactiveDays, last)
+	}
+	return findings
+}
+
+// IsInactive checks if a user with enabled credentials has not used them for the given number of days
+func (e Entry) IsInactive(days int, now time.Time) bool {
+	if !e.PasswordEnabled && !e.HasActiveKeys() {
+		return false
+	}
+	if activity := e.LastActivity(); activity != nil {
+		return daysSince(activity, now) > days
+	}
+	return daysSince(e.Created, now) > days
+}
+
+// Status returns "active" or "inactive" for a user, as in the identifier_status of config.yaml
+func (e Entry) Status(days int, now time.Time) string {
+	if !e.PasswordEnabled && !e.HasActiveKeys() {
+		return "inactive"
+	}
+	if e.IsInactive(days, now) {
+		return "inactive"
+	}
+	return "active"
+}
+
+// daysSince returns the days elapsed since t, 0 when t is unknown
+func daysSince(t *time.Time, now time.Time) int {
+	if t == nil {
+		return 0
+	}
+	return int(now.Sub(*t).Hours() / hoursPerDay)
+}
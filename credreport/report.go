@@ -0,0 +1,213 @@
+// Package credreport generates, parses and evaluates the IAM credential report.
+package credreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// RootUser is the name of the root account in the credential report
+const RootUser = "<root_account>"
+
+// AccessKey is the state of one of the two access keys of a user
+type AccessKey struct {
+	Active      bool
+	LastRotated *time.Time
+	LastUsed    *time.Time
+}
+
+// Entry is a row of the credential report
+type Entry struct {
+	User    string
+	ARN     string
+	Created *time.Time
+
+	PasswordEnabled     bool
+	PasswordLastUsed    *time.Time
+	PasswordLastChanged *time.Time
+	MFAActive           bool
+
+	AccessKeys [2]AccessKey
+}
+
+// IsRoot checks if the entry is the root account
+func (e Entry) IsRoot() bool {
+	return e.User == RootUser
+}
+
+// HasActiveKeys checks if the user has at least one active access key
+func (e Entry) HasActiveKeys() bool {
+	return e.AccessKeys[0].Active || e.AccessKeys[1].Active
+}
+
+// LastActivity returns the last use of the password or of an access key, nil if never used
+func (e Entry) LastActivity() *time.Time {
+	last := e.PasswordLastUsed
+	for _, key := range e.AccessKeys {
+		if key.LastUsed != nil && (last == nil || key.LastUsed.After(*last)) {
+			last = key.LastUsed
+		}
+	}
+	return last
+}
+
+// Report is the parsed credential report
+type Report struct {
+	Generated time.Time
+	Entries   []Entry
+}
+
+// Entry returns the entry of a user
+func (r *Report) Entry(user string) (Entry, bool) {
+	for _, e := range r.Entries {
+		if e.User == user {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Parse parses the CSV of the credential report. Columns are read by name.
+func Parse(data []byte) (*Report, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credential report header: %v", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, required := range []string{"user", "arn", "password_enabled", "mfa_active"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("credential report without column %s", required)
+		}
+	}
+
+	report := &Report{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read credential report: %v", err)
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+
+		entry := Entry{
+			User:                field("user"),
+			ARN:                 field("arn"),
+			Created:             parseTime(field("user_creation_time")),
+			PasswordEnabled:     field("password_enabled") == "true",
+			PasswordLastUsed:    parseTime(field("password_last_used")),
+			PasswordLastChanged: parseTime(field("password_last_changed")),
+			MFAActive:           field("mfa_active") == "true",
+		}
+		for i := range entry.AccessKeys {
+			prefix := fmt.Sprintf("access_key_%d_", i+1)
+			entry.AccessKeys[i] = AccessKey{
+				Active:      field(prefix+"active") == "true",
+				LastRotated: parseTime(field(prefix + "last_rotated")),
+				LastUsed:    parseTime(field(prefix + "last_used_date")),
+			}
+		}
+		report.Entries = append(report.Entries, entry)
+	}
+	return report, nil
+}
+
+// parseTime parses a timestamp of the report; "N/A", "no_information" and "not_supported" are nil
+func parseTime(value string) *time.Time {
+	if value == "" || strings.EqualFold(value, "N/A") || value == "no_information" || value == "not_supported" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// reportPoll is the interval between the checks of the report generation
+const reportPoll = 2 * time.Second
+
+// reportTimeout is the maximum wait for the report generation
+const reportTimeout = time.Minute
+
+// Fetch generates the credential report, waits for it and parses it
+func Fetch(cfg aws.Config) (*Report, error) {
+	ctx := context.TODO()
+	client := iam.NewFromConfig(cfg)
+
+	deadline := time.Now().Add(reportTimeout)
+	for {
+		output, err := client.GenerateCredentialReport(ctx, &iam.GenerateCredentialReportInput{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate credential report: %v", err)
+		}
+		if output.State == iamtypes.ReportStateTypeComplete {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("credential report not generated after %s", reportTimeout)
+		}
+		time.Sleep(reportPoll)
+	}
+
+	output, err := client.GetCredentialReport(ctx, &iam.GetCredentialReportInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credential report: %v", err)
+	}
+	report, err := Parse(output.Content)
+	if err != nil {
+		return nil, err
+	}
+	if output.GeneratedTime != nil {
+		report.Generated = *output.GeneratedTime
+	}
+	log.Printf("Credential report with %d entries generated at %s\n", len(report.Entries), report.Generated.Format(time.RFC3339))
+	return report, nil
+}
+
+// cacheTTL is how long the credential report is reused by the checks of the same evaluation.
+// IAM regenerates the report at most every 4 hours anyway.
+const cacheTTL = 10 * time.Minute
+
+var (
+	reportMu     sync.Mutex
+	cachedReport *Report
+	reportAt     time.Time
+)
+
+// Cached returns the credential report, fetching it again when older than cacheTTL
+func Cached(cfg aws.Config) (*Report, error) {
+	reportMu.Lock()
+	defer reportMu.Unlock()
+
+	if cachedReport != nil && time.Since(reportAt) < cacheTTL {
+		return cachedReport, nil
+	}
+	report, err := Fetch(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cachedReport, reportAt = report, time.Now()
+	return report, nil
+}
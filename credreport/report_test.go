@@ -0,0 +1,38 @@
+package credreport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sampleReport = `user,arn,user_creation_time,password_enabled,password_last_used,password_last_changed,password_next_rotation,mfa_active,access_key_1_active,access_key_1_last_rotated,access_key_1_last_used_date,access_key_1_last_used_region,access_key_1_last_used_service,access_key_2_active,access_key_2_last_rotated,access_key_2_last_used_date,access_key_2_last_used_region,access_key_2_last_used_service,cert_1_active,cert_1_last_rotated,cert_2_active,cert_2_last_rotated
+<root_account>,arn:aws:iam::111111111111:root,2020-01-01T00:00:00+00:00,not_supported,2024-05-01T00:00:00+00:00,not_supported,not_supported,false,true,2020-01-01T00:00:00+00:00,N/A,N/A,N/A,false,N/A,N/A,N/A,N/A,false,N/A,false,N/A
+alice,arn:aws:iam::111111111111:user/alice,2023-01-01T00:00:00+00:00,true,2024-05-30T00:00:00+00:00,2024-05-01T00:00:00+00:00,N/A,true,true,2024-05-01T00:00:00+00:00,2024-05-30T00:00:00+00:00,us-east-1,s3,false,N/A,N/A,N/A,N/A,false,N/A,false,N/A
+bob,arn:aws:iam::111111111111:user/bob,2022-01-01T00:00:00+00:00,true,no_information,2022-01-01T00:00:00+00:00,N/A,false,true,2022-01-01T00:00:00+00:00,N/A,N/A,N/A,false,N/A,N/A,N/A,N/A,false,N/A,false,N/A
+`
+
+func TestParseAndEvaluate(t *testing.T) {
+	report, err := Parse([]byte(sampleReport))
+	assert.NoError(t, err)
+	assert.Len(t, report.Entries, 3)
+
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	thresholds := Thresholds{InactiveDays: 90, PasswordMaxAge: 90, AccessKeyMaxAge: 90, AccessKeyUnused: 90}
+
+	issues := map[string][]string{}
+	for _, f := range report.Evaluate(thresholds, now) {
+		issues[f.User] = append(issues[f.User], f.Issue)
+	}
+
+	assert.ElementsMatch(t, []string{IssueRootAccessKey, IssueNoMFA}, issues[RootUser])
+	assert.Empty(t, issues["alice"])
+	assert.ElementsMatch(t, []string{IssueNoMFA, IssuePasswordAge, IssuePasswordUnused,
+		IssueAccessKeyAge, IssueAccessKeyUnused, IssueInactiveUser}, issues["bob"])
+
+	alice, _ := report.Entry("alice")
+	bob, _ := report.Entry("bob")
+	assert.Equal(t, "active", alice.Status(90, now))
+	assert.Equal(t, "inactive", bob.Status(90, now))
+}
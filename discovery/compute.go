@@ -0,0 +1,96 @@
+package discovery
+
+import (
+	"cloud_compliance_checker/models"
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+)
+
+func discoverEC2Assets(ctx context.Context, cfg aws.Config, account string) ([]models.Asset, error) {
+	var assets []models.Asset
+
+	paginator := ec2.NewDescribeInstancesPaginator(ec2.NewFromConfig(cfg), &ec2.DescribeInstancesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return assets, fmt.Errorf("failed to describe EC2 instances: %v", err)
+		}
+
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				id := aws.ToString(instance.InstanceId)
+				details := models.EC2InstanceDetails{
+					InstanceID:   id,
+					InstanceType: string(instance.InstanceType),
+					VpcID:        aws.ToString(instance.VpcId),
+					SubnetID:     aws.ToString(instance.SubnetId),
+					PrivateIP:    aws.ToString(instance.PrivateIpAddress),
+					PublicIP:     aws.ToString(instance.PublicIpAddress),
+				}
+				if instance.State != nil {
+					details.State = string(instance.State.Name)
+				}
+				if instance.IamInstanceProfile != nil {
+					details.InstanceProfileArn = aws.ToString(instance.IamInstanceProfile.Arn)
+				}
+				for _, sg := range instance.SecurityGroups {
+					details.SecurityGroupIDs = append(details.SecurityGroupIDs, aws.ToString(sg.GroupId))
+				}
+
+				arn := fmt.Sprintf("arn:aws:ec2:%s:%s:instance/%s", cfg.Region, aws.ToString(reservation.OwnerId), id)
+				assets = append(assets, newAsset(id, arn, cfg.Region, ec2Tags(instance.Tags), details))
+			}
+		}
+	}
+
+	return assets, nil
+}
+
+func discoverLambdaFunctions(ctx context.Context, cfg aws.Config, account string) ([]models.Asset, error) {
+	var assets []models.Asset
+	client := lambda.NewFromConfig(cfg)
+
+	paginator := lambda.NewListFunctionsPaginator(client, &lambda.ListFunctionsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return assets, fmt.Errorf("failed to list Lambda functions: %v", err)
+		}
+
+		for _, function := range page.Functions {
+			arn := aws.ToString(function.FunctionArn)
+			details := models.LambdaFunctionDetails{
+				Runtime:   string(function.Runtime),
+				Role:      aws.ToString(function.Role),
+				KmsKeyArn: aws.ToString(function.KMSKeyArn),
+			}
+			if function.VpcConfig != nil {
+				details.VpcID = aws.ToString(function.VpcConfig.VpcId)
+				details.SubnetIDs = function.VpcConfig.SubnetIds
+				details.SecurityGroupIDs = function.VpcConfig.SecurityGroupIds
+			}
+
+			var tags map[string]string
+			if output, err := client.ListTags(ctx, &lambda.ListTagsInput{Resource: aws.String(arn)}); err == nil {
+				tags = output.Tags
+			}
+			assets = append(assets, newAsset(aws.ToString(function.FunctionName), arn, cfg.Region, tags, details))
+		}
+	}
+
+	return assets, nil
+}
+
+// ec2Tags converts the EC2 tags to a map
+func ec2Tags(tags []ec2types.Tag) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		m[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return m
+}
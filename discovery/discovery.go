@@ -3,73 +3,109 @@ package discovery
 import (
 	"cloud_compliance_checker/models"
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
-// DiscoverAssets discovers assets in AWS
-func DiscoverAssets(cfg aws.Config) []models.Asset {
-	ec2Client := ec2.NewFromConfig(cfg)
-	s3Client := s3.NewFromConfig(cfg)
+// cacheTTL is how long the discovered assets and the graph are reused by the checks of the same evaluation
+const cacheTTL = 10 * time.Minute
 
-	return discoverAssetsWithClients(ec2Client, s3Client)
-}
-
-func discoverAssetsWithClients(ec2Client *ec2.Client, s3Client *s3.Client) []models.Asset {
-	var assets []models.Asset
-
-	ec2Assets := discoverEC2Assets(ec2Client)
-	s3Assets := discoverS3Assets(s3Client)
-
-	assets = append(assets, ec2Assets...)
-	assets = append(assets, s3Assets...)
+var (
+	assetsMu       sync.Mutex
+	cachedAssets   []models.Asset
+	cachedAssetErr error
+	assetsRegion   string
+	assetsAt       time.Time
+)
 
-	return assets
+// discoverer lists the assets of a single resource type
+type discoverer struct {
+	name string
+	fn   func(ctx context.Context, cfg aws.Config, account string) ([]models.Asset, error)
 }
 
-func discoverEC2Assets(ec2Client *ec2.Client) []models.Asset {
-	var assets []models.Asset
+// discoverers covers every resource type used by the checks
+var discoverers = []discoverer{
+	{"EC2 instances", discoverEC2Assets},
+	{"S3 buckets", discoverS3Assets},
+	{"IAM users", discoverIAMUsers},
+	{"IAM roles", discoverIAMRoles},
+	{"KMS keys", discoverKMSKeys},
+	{"RDS instances", discoverRDSInstances},
+	{"Lambda functions", discoverLambdaFunctions},
+	{"VPCs", discoverVPCs},
+	{"subnets", discoverSubnets},
+	{"security groups", discoverSecurityGroups},
+	{"load balancers", discoverLoadBalancers},
+	{"classic load balancers", discoverClassicLoadBalancers},
+	{"CloudFront distributions", discoverCloudFrontDistributions},
+	{"API Gateway REST APIs", discoverAPIGateways},
+	{"SNS topics", discoverSNSTopics},
+	{"CloudWatch log groups", discoverLogGroups},
+}
 
-	input := &ec2.DescribeInstancesInput{}
+// DiscoverAssets discovers assets in AWS.
+// A failure on a resource type does not stop the discovery: the assets found are returned together
+// with the errors of the resource types that could not be listed.
+func DiscoverAssets(cfg aws.Config) ([]models.Asset, error) {
+	ctx := context.TODO()
 
-	result, err := ec2Client.DescribeInstances(context.TODO(), input)
+	// The account is needed to build the ARN of the resources whose API does not return it
+	var account string
+	var errs []error
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
 	if err != nil {
-		log.Fatalf("failed to describe EC2 instances, %v", err)
+		errs = append(errs, fmt.Errorf("failed to get caller identity: %v", err))
+	} else {
+		account = aws.ToString(identity.Account)
 	}
 
-	for _, reservation := range result.Reservations {
-		for _, instance := range reservation.Instances {
-			asset := models.Asset{
-				Name:  *instance.InstanceId,
-				Type:  "EC2 Instance",
-				Cloud: "AWS",
-			}
-			assets = append(assets, asset)
+	var assets []models.Asset
+	for _, d := range discoverers {
+		found, err := d.fn(ctx, cfg, account)
+		if err != nil {
+			log.Printf("Discovery of %s failed: %v\n", d.name, err)
+			errs = append(errs, fmt.Errorf("%s: %v", d.name, err))
 		}
+		assets = append(assets, found...)
 	}
 
-	return assets
+	log.Printf("Discovered %d asset(s) in %s, %d error(s)\n", len(assets), cfg.Region, len(errs))
+	return assets, errors.Join(errs...)
 }
 
-func discoverS3Assets(s3Client *s3.Client) []models.Asset {
-	var assets []models.Asset
+// CachedAssets returns the assets discovered in the last minutes for the same region, or discovers them again
+func CachedAssets(cfg aws.Config) ([]models.Asset, error) {
+	assetsMu.Lock()
+	defer assetsMu.Unlock()
 
-	result, err := s3Client.ListBuckets(context.TODO(), &s3.ListBucketsInput{})
-	if err != nil {
-		log.Fatalf("failed to list S3 buckets, %v", err)
+	if assetsRegion == cfg.Region && !assetsAt.IsZero() && time.Since(assetsAt) < cacheTTL {
+		return cachedAssets, cachedAssetErr
 	}
 
-	for _, bucket := range result.Buckets {
-		asset := models.Asset{
-			Name:  *bucket.Name,
-			Type:  "S3 Bucket",
-			Cloud: "AWS",
-		}
-		assets = append(assets, asset)
-	}
+	assets, err := DiscoverAssets(cfg)
+	cachedAssets, cachedAssetErr, assetsRegion, assetsAt = assets, err, cfg.Region, time.Now()
+	return assets, err
+}
 
-	return assets
+// newAsset creates an AWS asset with its details
+func newAsset(name, arn, region string, tags map[string]string, details models.AssetDetails) models.Asset {
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	return models.Asset{
+		Name:    name,
+		Type:    details.AssetType(),
+		Cloud:   "AWS",
+		ARN:     arn,
+		Region:  region,
+		Tags:    tags,
+		Details: details,
+	}
 }
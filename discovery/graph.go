@@ -0,0 +1,618 @@
+package discovery
+
+import (
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/s3client"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancing"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// Relations between assets
+const (
+	RelationAttachedTo      = "attached_to"         // instance -> network interface
+	RelationInSubnet        = "in_subnet"           // network interface, RDS, Lambda, load balancer -> subnet
+	RelationInVPC           = "in_vpc"              // subnet, security group -> VPC
+	RelationUsesSG          = "uses_security_group" // instance, network interface, RDS, Lambda, load balancer -> security group
+	RelationInstanceProfile = "has_instance_profile"
+	RelationAssumesRole     = "assumes_role"   // instance profile, Lambda -> role
+	RelationHasPolicy       = "has_policy"     // role -> managed or inline policy
+	RelationEncryptedWith   = "encrypted_with" // bucket, RDS, Lambda, log group -> KMS key
+	RelationRoutesTo        = "routes_to"      // load balancer -> target group
+	RelationTargets         = "targets"        // target group, classic load balancer -> instance, IP, Lambda
+	RelationFrontedBy       = "fronted_by"     // CloudFront distribution -> origin
+)
+
+// Node types that are not discovered as assets
+const (
+	NodeTypeNetworkInterface = "Network Interface"
+	NodeTypeInstanceProfile  = "Instance Profile"
+	NodeTypeIAMPolicy        = "IAM Policy"
+	NodeTypeTargetGroup      = "Target Group"
+	NodeTypeTarget           = "Target"
+	NodeTypeOrigin           = "Origin"
+	NodeTypeUnknown          = "Unknown"
+)
+
+// Node is an asset, or an intermediate resource, of the graph
+type Node struct {
+	ID         string            `json:"id"`
+	Type       string            `json:"type"`
+	Name       string            `json:"name"`
+	Region     string            `json:"region,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Asset      *models.Asset     `json:"-"`
+}
+
+// Edge is a directed relationship between two nodes
+type Edge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Relation string `json:"relation"`
+}
+
+// Graph is the relationship graph of the discovered assets.
+// Nodes are identified by ARN; short identifiers (i-, sg-, subnet-, vpc-, key IDs, role names) are resolved through aliases.
+type Graph struct {
+	Nodes map[string]*Node `json:"-"`
+	Edges []Edge           `json:"-"`
+
+	aliases map[string]string
+	out     map[string][]Edge
+	in      map[string][]Edge
+	seen    map[Edge]bool
+}
+
+// NewGraph creates an empty graph
+func NewGraph() *Graph {
+	return &Graph{
+		Nodes:   make(map[string]*Node),
+		aliases: make(map[string]string),
+		out:     make(map[string][]Edge),
+		in:      make(map[string][]Edge),
+		seen:    make(map[Edge]bool),
+	}
+}
+
+// AddAsset adds a discovered asset as a node
+func (g *Graph) AddAsset(asset models.Asset) *Node {
+	id := asset.ARN
+	if id == "" {
+		id = asset.Name
+	}
+	a := asset
+	node := g.AddNode(id, asset.Type, asset.Name)
+	node.Region = asset.Region
+	node.Asset = &a
+
+	// Short identifiers used by the other resources to reference this one
+	switch d := asset.Details.(type) {
+	case models.EC2InstanceDetails:
+		g.alias(d.InstanceID, id)
+	case models.VPCDetails:
+		g.alias(d.VpcID, id)
+	case models.SubnetDetails:
+		g.alias(d.SubnetID, id)
+	case models.SecurityGroupDetails:
+		g.alias(d.GroupID, id)
+	case models.KMSKeyDetails:
+		g.alias(d.KeyID, id)
+	}
+	return node
+}
+
+// AddNode adds a node, or returns the existing one with the same ID. A placeholder node gets its type updated.
+func (g *Graph) AddNode(id, nodeType, name string) *Node {
+	if node, ok := g.Nodes[id]; ok {
+		if node.Type == NodeTypeUnknown {
+			node.Type = nodeType
+			node.Name = name
+		}
+		return node
+	}
+	node := &Node{ID: id, Type: nodeType, Name: name, Attributes: map[string]string{}}
+	g.Nodes[id] = node
+	return node
+}
+
+// AddEdge adds a relationship. References to resources that were not discovered become placeholder nodes.
+func (g *Graph) AddEdge(from, to, relation string) {
+	if from == "" || to == "" {
+		return
+	}
+	from, to = g.Resolve(from), g.Resolve(to)
+	if _, ok := g.Nodes[from]; !ok {
+		g.AddNode(from, NodeTypeUnknown, from)
+	}
+	if _, ok := g.Nodes[to]; !ok {
+		g.AddNode(to, NodeTypeUnknown, to)
+	}
+
+	edge := Edge{From: from, To: to, Relation: relation}
+	if g.seen[edge] {
+		return
+	}
+	g.seen[edge] = true
+	g.Edges = append(g.Edges, edge)
+	g.out[from] = append(g.out[from], edge)
+	g.in[to] = append(g.in[to], edge)
+}
+
+// Resolve returns the node ID of a short identifier or ARN
+func (g *Graph) Resolve(id string) string {
+	if resolved, ok := g.aliases[id]; ok {
+		return resolved
+	}
+	return id
+}
+
+// Node returns the node with the given ID, ARN or short identifier
+func (g *Graph) Node(id string) (*Node, bool) {
+	node, ok := g.Nodes[g.Resolve(id)]
+	return node, ok
+}
+
+// Outgoing returns the nodes reached from id through the given relations (all relations when none is given)
+func (g *Graph) Outgoing(id string, relations ...string) []*Node {
+	var nodes []*Node
+	for _, edge := range g.out[g.Resolve(id)] {
+		if matchesRelation(edge.Relation, relations) {
+			nodes = append(nodes, g.Nodes[edge.To])
+		}
+	}
+	return nodes
+}
+
+// Incoming returns the nodes pointing to id through the given relations (all relations when none is given)
+func (g *Graph) Incoming(id string, relations ...string) []*Node {
+	var nodes []*Node
+	for _, edge := range g.in[g.Resolve(id)] {
+		if matchesRelation(edge.Relation, relations) {
+			nodes = append(nodes, g.Nodes[edge.From])
+		}
+	}
+	return nodes
+}
+
+// Reachable returns all the nodes reachable from id following the outgoing edges of the given relations
+func (g *Graph) Reachable(id string, relations ...string) []*Node {
+	start := g.Resolve(id)
+	visited := map[string]bool{start: true}
+	queue := []string{start}
+	var nodes []*Node
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, edge := range g.out[current] {
+			if !matchesRelation(edge.Relation, relations) || visited[edge.To] {
+				continue
+			}
+			visited[edge.To] = true
+			nodes = append(nodes, g.Nodes[edge.To])
+			queue = append(queue, edge.To)
+		}
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// BlastRadius returns what is exposed when the asset is compromised: the network interfaces, the roles
+// it can assume with their policies, and the keys it uses.
+func (g *Graph) BlastRadius(id string) []*Node {
+	return g.Reachable(id, RelationAttachedTo, RelationInstanceProfile, RelationAssumesRole, RelationHasPolicy,
+		RelationEncryptedWith, RelationRoutesTo, RelationTargets)
+}
+
+// AttachedToSecurityGroup returns the assets using a security group, directly or through their network interfaces
+func (g *Graph) AttachedToSecurityGroup(groupID string) []*Node {
+	seen := make(map[string]bool)
+	var nodes []*Node
+	for _, node := range g.Incoming(groupID, RelationUsesSG) {
+		owners := []*Node{node}
+		if node.Type == NodeTypeNetworkInterface {
+			if attached := g.Incoming(node.ID, RelationAttachedTo); len(attached) > 0 {
+				owners = attached
+			}
+		}
+		for _, owner := range owners {
+			if !seen[owner.ID] {
+				seen[owner.ID] = true
+				nodes = append(nodes, owner)
+			}
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// NodesOfType returns the nodes of a type sorted by ID
+func (g *Graph) NodesOfType(nodeType string) []*Node {
+	var nodes []*Node
+	for _, node := range g.Nodes {
+		if node.Type == nodeType {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// alias registers a short identifier for a node
+func (g *Graph) alias(short, id string) {
+	if short != "" && short != id {
+		g.aliases[short] = id
+	}
+}
+
+// matchesRelation checks if the relation is one of the requested ones
+func matchesRelation(relation string, relations []string) bool {
+	if len(relations) == 0 {
+		return true
+	}
+	for _, r := range relations {
+		if r == relation {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	graphMu        sync.Mutex
+	cachedGraph    *Graph
+	cachedGraphErr error
+	cachedRegion   string
+	cachedAt       time.Time
+)
+
+// CachedGraph returns the graph built in the last minutes for the same region, or builds a new one.
+// Checks of the same evaluation share the graph instead of discovering the account again. The error of a
+// partial graph is returned with it on every call.
+func CachedGraph(cfg aws.Config) (*Graph, error) {
+	graphMu.Lock()
+	defer graphMu.Unlock()
+
+	if cachedGraph != nil && cachedRegion == cfg.Region && time.Since(cachedAt) < cacheTTL {
+		return cachedGraph, cachedGraphErr
+	}
+
+	g, err := BuildGraph(cfg)
+	if g != nil {
+		cachedGraph, cachedGraphErr, cachedRegion, cachedAt = g, err, cfg.Region, time.Now()
+	}
+	return g, err
+}
+
+// BuildGraph discovers the assets and the relationships between them.
+// As for DiscoverAssets, errors are collected and the partial graph is returned.
+func BuildGraph(cfg aws.Config) (*Graph, error) {
+	ctx := context.TODO()
+	g := NewGraph()
+
+	assets, err := CachedAssets(cfg)
+	var errs []error
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, asset := range assets {
+		g.AddAsset(asset)
+	}
+	for _, asset := range assets {
+		g.addAssetEdges(asset)
+	}
+
+	for _, step := range []struct {
+		name string
+		fn   func(ctx context.Context, cfg aws.Config) error
+	}{
+		{"network interfaces", g.addNetworkInterfaces},
+		{"instance profiles", g.addInstanceProfiles},
+		{"role policies", g.addRolePolicies},
+		{"bucket encryption", g.addBucketKeys},
+		{"load balancer targets", g.addLoadBalancerTargets},
+	} {
+		if err := step.fn(ctx, cfg); err != nil {
+			log.Printf("Graph: %s failed: %v\n", step.name, err)
+			errs = append(errs, fmt.Errorf("%s: %v", step.name, err))
+		}
+	}
+
+	log.Printf("Asset graph built: %d node(s), %d edge(s)\n", len(g.Nodes), len(g.Edges))
+	return g, errors.Join(errs...)
+}
+
+// addAssetEdges adds the relationships already known from the asset details
+func (g *Graph) addAssetEdges(asset models.Asset) {
+	id := g.Resolve(asset.ARN)
+	if id == "" {
+		id = asset.Name
+	}
+
+	switch d := asset.Details.(type) {
+	case models.EC2InstanceDetails:
+		for _, sg := range d.SecurityGroupIDs {
+			g.AddEdge(id, sg, RelationUsesSG)
+		}
+		if d.InstanceProfileArn != "" {
+			g.AddNode(d.InstanceProfileArn, NodeTypeInstanceProfile, arnName(d.InstanceProfileArn))
+			g.AddEdge(id, d.InstanceProfileArn, RelationInstanceProfile)
+		}
+	case models.SubnetDetails:
+		g.AddEdge(id, d.VpcID, RelationInVPC)
+	case models.SecurityGroupDetails:
+		g.AddEdge(id, d.VpcID, RelationInVPC)
+	case models.RDSInstanceDetails:
+		for _, subnet := range d.SubnetIDs {
+			g.AddEdge(id, subnet, RelationInSubnet)
+		}
+		for _, sg := range d.SecurityGroupIDs {
+			g.AddEdge(id, sg, RelationUsesSG)
+		}
+		g.AddEdge(id, d.KmsKeyID, RelationEncryptedWith)
+	case models.LambdaFunctionDetails:
+		g.AddEdge(id, d.Role, RelationAssumesRole)
+		for _, subnet := range d.SubnetIDs {
+			g.AddEdge(id, subnet, RelationInSubnet)
+		}
+		for _, sg := range d.SecurityGroupIDs {
+			g.AddEdge(id, sg, RelationUsesSG)
+		}
+		g.AddEdge(id, d.KmsKeyArn, RelationEncryptedWith)
+	case models.LoadBalancerDetails:
+		for _, subnet := range d.SubnetIDs {
+			g.AddEdge(id, subnet, RelationInSubnet)
+		}
+		for _, sg := range d.SecurityGroupIDs {
+			g.AddEdge(id, sg, RelationUsesSG)
+		}
+	case models.CloudFrontDetails:
+		for _, origin := range d.Origins {
+			g.AddNode(origin, NodeTypeOrigin, origin)
+			g.AddEdge(id, origin, RelationFrontedBy)
+		}
+	case models.SNSTopicDetails:
+		g.AddEdge(id, d.KmsMasterKeyID, RelationEncryptedWith)
+	case models.LogGroupDetails:
+		g.AddEdge(id, d.KmsKeyID, RelationEncryptedWith)
+	}
+}
+
+// addNetworkInterfaces adds instance -> ENI -> subnet and ENI -> security group
+func (g *Graph) addNetworkInterfaces(ctx context.Context, cfg aws.Config) error {
+	paginator := ec2.NewDescribeNetworkInterfacesPaginator(ec2.NewFromConfig(cfg), &ec2.DescribeNetworkInterfacesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to describe network interfaces: %v", err)
+		}
+
+		for _, eni := range page.NetworkInterfaces {
+			id := aws.ToString(eni.NetworkInterfaceId)
+			arn := fmt.Sprintf("arn:aws:ec2:%s:%s:network-interface/%s", cfg.Region, aws.ToString(eni.OwnerId), id)
+			node := g.AddNode(arn, NodeTypeNetworkInterface, id)
+			node.Region = cfg.Region
+			node.Attributes["interface_type"] = string(eni.InterfaceType)
+			node.Attributes["private_ip"] = aws.ToString(eni.PrivateIpAddress)
+			if eni.Association != nil && eni.Association.PublicIp != nil {
+				node.Attributes["public_ip"] = aws.ToString(eni.Association.PublicIp)
+			}
+			if description := aws.ToString(eni.Description); description != "" {
+				node.Attributes["description"] = description
+			}
+			g.alias(id, arn)
+
+			if eni.Attachment != nil && eni.Attachment.InstanceId != nil {
+				g.AddEdge(aws.ToString(eni.Attachment.InstanceId), arn, RelationAttachedTo)
+			}
+			g.AddEdge(arn, aws.ToString(eni.SubnetId), RelationInSubnet)
+			for _, sg := range eni.Groups {
+				g.AddEdge(arn, aws.ToString(sg.GroupId), RelationUsesSG)
+			}
+		}
+	}
+	return nil
+}
+
+// addInstanceProfiles adds instance profile -> role
+func (g *Graph) addInstanceProfiles(ctx context.Context, cfg aws.Config) error {
+	paginator := iam.NewListInstanceProfilesPaginator(iam.NewFromConfig(cfg), &iam.ListInstanceProfilesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list instance profiles: %v", err)
+		}
+
+		for _, profile := range page.InstanceProfiles {
+			arn := aws.ToString(profile.Arn)
+			node := g.AddNode(arn, NodeTypeInstanceProfile, aws.ToString(profile.InstanceProfileName))
+			node.Region = models.GlobalRegion
+			for _, role := range profile.Roles {
+				g.AddEdge(arn, aws.ToString(role.Arn), RelationAssumesRole)
+			}
+		}
+	}
+	return nil
+}
+
+// addRolePolicies adds role -> managed and inline policies
+func (g *Graph) addRolePolicies(ctx context.Context, cfg aws.Config) error {
+	client := iam.NewFromConfig(cfg)
+
+	var errs []error
+	for _, role := range g.NodesOfType(models.AssetTypeIAMRole) {
+		name := role.Name
+
+		attached, err := client.ListAttachedRolePolicies(ctx, &iam.ListAttachedRolePoliciesInput{RoleName: aws.String(name)})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("role %s: %v", name, err))
+			continue
+		}
+		for _, policy := range attached.AttachedPolicies {
+			arn := aws.ToString(policy.PolicyArn)
+			node := g.AddNode(arn, NodeTypeIAMPolicy, aws.ToString(policy.PolicyName))
+			node.Attributes["kind"] = "managed"
+			g.AddEdge(role.ID, arn, RelationHasPolicy)
+		}
+
+		inline, err := client.ListRolePolicies(ctx, &iam.ListRolePoliciesInput{RoleName: aws.String(name)})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("role %s: %v", name, err))
+			continue
+		}
+		for _, policyName := range inline.PolicyNames {
+			id := role.ID + "/inline/" + policyName
+			node := g.AddNode(id, NodeTypeIAMPolicy, policyName)
+			node.Attributes["kind"] = "inline"
+			g.AddEdge(role.ID, id, RelationHasPolicy)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// addBucketKeys adds bucket -> KMS key for the buckets encrypted with SSE-KMS.
+// Each bucket is read with a client of its own region.
+func (g *Graph) addBucketKeys(ctx context.Context, cfg aws.Config) error {
+	var errs []error
+
+	for _, bucket := range g.NodesOfType(models.AssetTypeS3Bucket) {
+		client, err := s3client.ForBucket(ctx, cfg, bucket.Name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		output, err := client.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{Bucket: aws.String(bucket.Name)})
+		if err != nil {
+			var apiErr smithy.APIError
+			if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "ServerSideEncryptionConfigurationNotFoundError" {
+				errs = append(errs, fmt.Errorf("failed to get the encryption of bucket %s: %v", bucket.Name, err))
+			}
+			continue
+		}
+		if output.ServerSideEncryptionConfiguration == nil {
+			continue
+		}
+
+		for _, rule := range output.ServerSideEncryptionConfiguration.Rules {
+			sse := rule.ApplyServerSideEncryptionByDefault
+			if sse == nil {
+				continue
+			}
+			bucket.Attributes["sse_algorithm"] = string(sse.SSEAlgorithm)
+			if sse.SSEAlgorithm != s3types.ServerSideEncryptionAwsKms && sse.SSEAlgorithm != s3types.ServerSideEncryptionAwsKmsDsse {
+				continue
+			}
+
+			key := aws.ToString(sse.KMSMasterKeyID)
+			if key == "" {
+				key = "alias/aws/s3"
+			}
+			// The key can be configured as ARN or key ID, both resolve to the KMS key node
+			g.AddEdge(bucket.ID, key, RelationEncryptedWith)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// addLoadBalancerTargets adds load balancer -> target group -> target, and classic load balancer -> instance
+func (g *Graph) addLoadBalancerTargets(ctx context.Context, cfg aws.Config) error {
+	client := elasticloadbalancingv2.NewFromConfig(cfg)
+	var errs []error
+
+	paginator := elasticloadbalancingv2.NewDescribeTargetGroupsPaginator(client, &elasticloadbalancingv2.DescribeTargetGroupsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to describe target groups: %v", err))
+			break
+		}
+
+		for _, group := range page.TargetGroups {
+			arn := aws.ToString(group.TargetGroupArn)
+			node := g.AddNode(arn, NodeTypeTargetGroup, aws.ToString(group.TargetGroupName))
+			node.Region = cfg.Region
+			node.Attributes["target_type"] = string(group.TargetType)
+			for _, lb := range group.LoadBalancerArns {
+				g.AddEdge(lb, arn, RelationRoutesTo)
+			}
+
+			health, err := client.DescribeTargetHealth(ctx, &elasticloadbalancingv2.DescribeTargetHealthInput{TargetGroupArn: group.TargetGroupArn})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("target group %s: %v", aws.ToString(group.TargetGroupName), err))
+				continue
+			}
+			for _, target := range health.TargetHealthDescriptions {
+				if target.Target == nil {
+					continue
+				}
+				targetID := aws.ToString(target.Target.Id)
+				if _, ok := g.Node(targetID); !ok {
+					g.AddNode(targetID, NodeTypeTarget, targetID)
+				}
+				g.AddEdge(arn, targetID, RelationTargets)
+			}
+		}
+	}
+
+	classic := elasticloadbalancing.NewFromConfig(cfg)
+	classicPaginator := elasticloadbalancing.NewDescribeLoadBalancersPaginator(classic, &elasticloadbalancing.DescribeLoadBalancersInput{})
+	for classicPaginator.HasMorePages() {
+		page, err := classicPaginator.NextPage(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to describe classic load balancers: %v", err))
+			break
+		}
+
+		for _, lb := range page.LoadBalancerDescriptions {
+			lbNode := g.findByName(models.AssetTypeLoadBalancer, aws.ToString(lb.LoadBalancerName))
+			if lbNode == nil {
+				continue
+			}
+			for _, instance := range lb.Instances {
+				g.AddEdge(lbNode.ID, aws.ToString(instance.InstanceId), RelationTargets)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// findByName returns the node of a type with the given name
+func (g *Graph) findByName(nodeType, name string) *Node {
+	for _, node := range g.Nodes {
+		if node.Type == nodeType && node.Name == name {
+			return node
+		}
+	}
+	return nil
+}
+
+// arnName returns the last part of an ARN resource
+func arnName(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
+
+// NodeLabels returns "type name" for each node, for logs and error messages
+func NodeLabels(nodes []*Node) []string {
+	labels := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		labels = append(labels, fmt.Sprintf("%s %s", node.Type, node.Name))
+	}
+	return labels
+}
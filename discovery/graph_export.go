@@ -0,0 +1,159 @@
+package discovery
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Export formats supported by WriteGraph
+const (
+	FormatDOT     = "dot"
+	FormatGraphML = "graphml"
+	FormatJSON    = "json"
+)
+
+// WriteGraph writes the graph in the given format
+func WriteGraph(w io.Writer, g *Graph, format string) error {
+	switch strings.ToLower(format) {
+	case FormatDOT:
+		return WriteDOT(w, g)
+	case FormatGraphML:
+		return WriteGraphML(w, g)
+	case FormatJSON, "":
+		return WriteJSON(w, g)
+	default:
+		return fmt.Errorf("unsupported graph format %q (use %s, %s or %s)", format, FormatDOT, FormatGraphML, FormatJSON)
+	}
+}
+
+// sortedNodes returns the nodes sorted by ID, so that the exports are stable
+func (g *Graph) sortedNodes() []*Node {
+	nodes := make([]*Node, 0, len(g.Nodes))
+	for _, node := range g.Nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// WriteJSON writes the graph as {"nodes": [...], "edges": [...]}
+func WriteJSON(w io.Writer, g *Graph) error {
+	output := struct {
+		Nodes []*Node `json:"nodes"`
+		Edges []Edge  `json:"edges"`
+	}{Nodes: g.sortedNodes(), Edges: g.Edges}
+	if output.Edges == nil {
+		output.Edges = []Edge{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(output)
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language
+func WriteDOT(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	b.WriteString("digraph assets {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, fontsize=10];\n")
+	for _, node := range g.sortedNodes() {
+		fmt.Fprintf(&b, "  %s [label=%s];\n", dotQuote(node.ID), dotQuote(node.Type+"\n"+node.Name))
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", dotQuote(edge.From), dotQuote(edge.To), dotQuote(edge.Relation))
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotQuote quotes an identifier or label for DOT
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+// WriteGraphML writes the graph in GraphML, readable by yEd, Gephi and networkx
+func WriteGraphML(w io.Writer, g *Graph) error {
+	doc := graphMLDocument{XMLNS: "http://graphml.graphdrawing.org/xmlns"}
+	doc.Keys = []graphMLKey{
+		{ID: "type", For: "node", AttrName: "type", AttrType: "string"},
+		{ID: "name", For: "node", AttrName: "name", AttrType: "string"},
+		{ID: "region", For: "node", AttrName: "region", AttrType: "string"},
+		{ID: "relation", For: "edge", AttrName: "relation", AttrType: "string"},
+	}
+	doc.Graph.ID = "assets"
+	doc.Graph.EdgeDefault = "directed"
+
+	for _, node := range g.sortedNodes() {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: node.ID,
+			Data: []graphMLData{
+				{Key: "type", Value: node.Type},
+				{Key: "name", Value: node.Name},
+				{Key: "region", Value: node.Region},
+			},
+		})
+	}
+	for _, edge := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: edge.From,
+			Target: edge.To,
+			Data:   []graphMLData{{Key: "relation", Value: edge.Relation}},
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,118 @@
+package discovery
+
+import (
+	"bytes"
+	"cloud_compliance_checker/models"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedGraphKeepsPartialError(t *testing.T) {
+	partial := NewGraph()
+	partial.AddNode("sg-1", "SecurityGroup", "web")
+	buildErr := errors.New("network interfaces: access denied")
+
+	graphMu.Lock()
+	cachedGraph, cachedGraphErr, cachedRegion, cachedAt = partial, buildErr, "us-east-1", time.Now()
+	graphMu.Unlock()
+	defer func() { cachedGraph, cachedGraphErr = nil, nil }()
+
+	// Every call sharing the partial graph gets its error, so that missing edges are not read as no edges
+	for i := 0; i < 2; i++ {
+		g, err := CachedGraph(aws.Config{Region: "us-east-1"})
+		assert.Same(t, partial, g)
+		assert.Equal(t, buildErr, err)
+		assert.Empty(t, g.AttachedToSecurityGroup("sg-1"))
+	}
+}
+
+const (
+	instanceARN = "arn:aws:ec2:us-east-1:111111111111:instance/i-1"
+	groupARN    = "arn:aws:ec2:us-east-1:111111111111:security-group/sg-1"
+	profileARN  = "arn:aws:iam::111111111111:instance-profile/web"
+	roleARN     = "arn:aws:iam::111111111111:role/web"
+)
+
+// testGraph builds an instance with a security group and an instance profile, and a network interface using the group
+func testGraph() *Graph {
+	g := NewGraph()
+	assets := []models.Asset{
+		{Name: "web", Type: models.AssetTypeEC2Instance, ARN: instanceARN, Region: "us-east-1",
+			Details: models.EC2InstanceDetails{InstanceID: "i-1", SecurityGroupIDs: []string{"sg-1"}, InstanceProfileArn: profileARN}},
+		{Name: "web-sg", Type: models.AssetTypeSecurityGroup, ARN: groupARN, Region: "us-east-1",
+			Details: models.SecurityGroupDetails{GroupID: "sg-1", VpcID: "vpc-1"}},
+	}
+	for _, asset := range assets {
+		g.AddAsset(asset)
+	}
+	for _, asset := range assets {
+		g.addAssetEdges(asset)
+	}
+	g.AddNode("eni-1", NodeTypeNetworkInterface, "eni-1")
+	g.AddEdge("i-1", "eni-1", RelationAttachedTo)
+	g.AddEdge("eni-1", "sg-1", RelationUsesSG)
+	g.AddEdge(profileARN, roleARN, RelationAssumesRole)
+	return g
+}
+
+func TestGraphEdges(t *testing.T) {
+	g := testGraph()
+
+	// Short identifiers resolve to the ARN of the asset
+	node, ok := g.Node("sg-1")
+	if assert.True(t, ok) {
+		assert.Equal(t, groupARN, node.ID)
+	}
+	assert.Equal(t, []string{"EC2 Instance web", "Network Interface eni-1"}, NodeLabels(g.Incoming("sg-1", RelationUsesSG)))
+	assert.Len(t, g.Outgoing("i-1", RelationUsesSG), 1)
+
+	// References to resources not discovered become placeholders, and edges are not duplicated
+	vpc, ok := g.Node("vpc-1")
+	if assert.True(t, ok) {
+		assert.Equal(t, NodeTypeUnknown, vpc.Type)
+	}
+	edges := len(g.Edges)
+	g.AddEdge("i-1", "sg-1", RelationUsesSG)
+	assert.Len(t, g.Edges, edges)
+
+	// The instance uses the group directly and through its network interface
+	assert.Equal(t, []string{"EC2 Instance web"}, NodeLabels(g.AttachedToSecurityGroup("sg-1")))
+
+	var radius []string
+	for _, node := range g.BlastRadius("i-1") {
+		radius = append(radius, node.ID)
+	}
+	assert.Equal(t, []string{profileARN, roleARN, "eni-1"}, radius)
+}
+
+func TestWriteGraph(t *testing.T) {
+	g := testGraph()
+
+	var dot bytes.Buffer
+	assert.NoError(t, WriteGraph(&dot, g, FormatDOT))
+	assert.Contains(t, dot.String(), `"`+instanceARN+`" -> "`+groupARN+`" [label="uses_security_group"];`)
+	assert.Contains(t, dot.String(), `"`+groupARN+`" [label="Security Group\nweb-sg"];`)
+
+	var graphML bytes.Buffer
+	assert.NoError(t, WriteGraph(&graphML, g, FormatGraphML))
+	assert.Contains(t, graphML.String(), `<edge source="`+profileARN+`" target="`+roleARN+`">`)
+	assert.Contains(t, graphML.String(), `<data key="relation">assumes_role</data>`)
+
+	var raw bytes.Buffer
+	assert.NoError(t, WriteGraph(&raw, g, FormatJSON))
+	var decoded struct {
+		Nodes []Node `json:"nodes"`
+		Edges []Edge `json:"edges"`
+	}
+	if assert.NoError(t, json.Unmarshal(raw.Bytes(), &decoded)) {
+		assert.Len(t, decoded.Nodes, len(g.Nodes))
+		assert.ElementsMatch(t, g.Edges, decoded.Edges)
+	}
+
+	assert.Error(t, WriteGraph(&raw, g, "svg"))
+}
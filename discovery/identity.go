@@ -0,0 +1,96 @@
+package discovery
+
+import (
+	"cloud_compliance_checker/models"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func discoverIAMUsers(ctx context.Context, cfg aws.Config, account string) ([]models.Asset, error) {
+	var assets []models.Asset
+	var errs []error
+	client := iam.NewFromConfig(cfg)
+
+	paginator := iam.NewListUsersPaginator(client, &iam.ListUsersInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return assets, errors.Join(append(errs, fmt.Errorf("failed to list IAM users: %v", err))...)
+		}
+
+		for _, user := range page.Users {
+			details := models.IAMUserDetails{
+				UserID:           aws.ToString(user.UserId),
+				Path:             aws.ToString(user.Path),
+				CreateDate:       aws.ToTime(user.CreateDate),
+				PasswordLastUsed: user.PasswordLastUsed,
+			}
+
+			// ListUsers does not return the tags
+			asset := newAsset(aws.ToString(user.UserName), aws.ToString(user.Arn), models.GlobalRegion, nil, details)
+			if output, err := client.ListUserTags(ctx, &iam.ListUserTagsInput{UserName: user.UserName}); err != nil {
+				errs = append(errs, fmt.Errorf("failed to read the tags of IAM user %s: %v", aws.ToString(user.UserName), err))
+				asset.TagsUnknown = true
+			} else {
+				asset.Tags = iamTags(output.Tags)
+			}
+			assets = append(assets, asset)
+		}
+	}
+
+	return assets, errors.Join(errs...)
+}
+
+func discoverIAMRoles(ctx context.Context, cfg aws.Config, account string) ([]models.Asset, error) {
+	var assets []models.Asset
+	var errs []error
+	client := iam.NewFromConfig(cfg)
+
+	paginator := iam.NewListRolesPaginator(client, &iam.ListRolesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return assets, errors.Join(append(errs, fmt.Errorf("failed to list IAM roles: %v", err))...)
+		}
+
+		for _, role := range page.Roles {
+			// The trust policy is returned URL encoded
+			trustPolicy, err := url.QueryUnescape(aws.ToString(role.AssumeRolePolicyDocument))
+			if err != nil {
+				trustPolicy = aws.ToString(role.AssumeRolePolicyDocument)
+			}
+			details := models.IAMRoleDetails{
+				RoleID:                   aws.ToString(role.RoleId),
+				Path:                     aws.ToString(role.Path),
+				CreateDate:               aws.ToTime(role.CreateDate),
+				AssumeRolePolicyDocument: trustPolicy,
+			}
+
+			asset := newAsset(aws.ToString(role.RoleName), aws.ToString(role.Arn), models.GlobalRegion, nil, details)
+			if output, err := client.ListRoleTags(ctx, &iam.ListRoleTagsInput{RoleName: role.RoleName}); err != nil {
+				errs = append(errs, fmt.Errorf("failed to read the tags of IAM role %s: %v", aws.ToString(role.RoleName), err))
+				asset.TagsUnknown = true
+			} else {
+				asset.Tags = iamTags(output.Tags)
+			}
+			assets = append(assets, asset)
+		}
+	}
+
+	return assets, errors.Join(errs...)
+}
+
+// iamTags converts the IAM tags to a map
+func iamTags(tags []iamtypes.Tag) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		m[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return m
+}
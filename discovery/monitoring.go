@@ -0,0 +1,79 @@
+package discovery
+
+import (
+	"cloud_compliance_checker/models"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+)
+
+func discoverSNSTopics(ctx context.Context, cfg aws.Config, account string) ([]models.Asset, error) {
+	var assets []models.Asset
+	client := sns.NewFromConfig(cfg)
+
+	paginator := sns.NewListTopicsPaginator(client, &sns.ListTopicsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return assets, fmt.Errorf("failed to list SNS topics: %v", err)
+		}
+
+		for _, topic := range page.Topics {
+			arn := aws.ToString(topic.TopicArn)
+			name := arn[strings.LastIndex(arn, ":")+1:]
+
+			var details models.SNSTopicDetails
+			if output, err := client.GetTopicAttributes(ctx, &sns.GetTopicAttributesInput{TopicArn: topic.TopicArn}); err == nil {
+				details.KmsMasterKeyID = output.Attributes["KmsMasterKeyId"]
+			}
+
+			tags := map[string]string{}
+			if output, err := client.ListTagsForResource(ctx, &sns.ListTagsForResourceInput{ResourceArn: topic.TopicArn}); err == nil {
+				for _, tag := range output.Tags {
+					tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+				}
+			}
+			assets = append(assets, newAsset(name, arn, cfg.Region, tags, details))
+		}
+	}
+
+	return assets, nil
+}
+
+func discoverLogGroups(ctx context.Context, cfg aws.Config, account string) ([]models.Asset, error) {
+	var assets []models.Asset
+	client := cloudwatchlogs.NewFromConfig(cfg)
+
+	paginator := cloudwatchlogs.NewDescribeLogGroupsPaginator(client, &cloudwatchlogs.DescribeLogGroupsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return assets, fmt.Errorf("failed to describe log groups: %v", err)
+		}
+
+		for _, group := range page.LogGroups {
+			// Arn ends with ":*", LogGroupArn is the one accepted by the tagging APIs
+			arn := aws.ToString(group.LogGroupArn)
+			if arn == "" {
+				arn = strings.TrimSuffix(aws.ToString(group.Arn), ":*")
+			}
+			details := models.LogGroupDetails{
+				RetentionDays: int(aws.ToInt32(group.RetentionInDays)),
+				KmsKeyID:      aws.ToString(group.KmsKeyId),
+				StoredBytes:   aws.ToInt64(group.StoredBytes),
+			}
+
+			var tags map[string]string
+			if output, err := client.ListTagsForResource(ctx, &cloudwatchlogs.ListTagsForResourceInput{ResourceArn: aws.String(arn)}); err == nil {
+				tags = output.Tags
+			}
+			assets = append(assets, newAsset(aws.ToString(group.LogGroupName), arn, cfg.Region, tags, details))
+		}
+	}
+
+	return assets, nil
+}
@@ -0,0 +1,266 @@
+package discovery
+
+import (
+	"cloud_compliance_checker/models"
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancing"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+)
+
+// elbTagsBatch is the maximum number of load balancers accepted by DescribeTags
+const elbTagsBatch = 20
+
+func discoverVPCs(ctx context.Context, cfg aws.Config, account string) ([]models.Asset, error) {
+	var assets []models.Asset
+
+	paginator := ec2.NewDescribeVpcsPaginator(ec2.NewFromConfig(cfg), &ec2.DescribeVpcsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return assets, fmt.Errorf("failed to describe VPCs: %v", err)
+		}
+
+		for _, vpc := range page.Vpcs {
+			id := aws.ToString(vpc.VpcId)
+			details := models.VPCDetails{
+				VpcID:     id,
+				CidrBlock: aws.ToString(vpc.CidrBlock),
+				IsDefault: aws.ToBool(vpc.IsDefault),
+			}
+			arn := fmt.Sprintf("arn:aws:ec2:%s:%s:vpc/%s", cfg.Region, aws.ToString(vpc.OwnerId), id)
+			assets = append(assets, newAsset(id, arn, cfg.Region, ec2Tags(vpc.Tags), details))
+		}
+	}
+
+	return assets, nil
+}
+
+func discoverSubnets(ctx context.Context, cfg aws.Config, account string) ([]models.Asset, error) {
+	var assets []models.Asset
+
+	paginator := ec2.NewDescribeSubnetsPaginator(ec2.NewFromConfig(cfg), &ec2.DescribeSubnetsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return assets, fmt.Errorf("failed to describe subnets: %v", err)
+		}
+
+		for _, subnet := range page.Subnets {
+			id := aws.ToString(subnet.SubnetId)
+			details := models.SubnetDetails{
+				SubnetID:            id,
+				VpcID:               aws.ToString(subnet.VpcId),
+				CidrBlock:           aws.ToString(subnet.CidrBlock),
+				AvailabilityZone:    aws.ToString(subnet.AvailabilityZone),
+				MapPublicIPOnLaunch: aws.ToBool(subnet.MapPublicIpOnLaunch),
+			}
+			assets = append(assets, newAsset(id, aws.ToString(subnet.SubnetArn), cfg.Region, ec2Tags(subnet.Tags), details))
+		}
+	}
+
+	return assets, nil
+}
+
+func discoverSecurityGroups(ctx context.Context, cfg aws.Config, account string) ([]models.Asset, error) {
+	var assets []models.Asset
+
+	paginator := ec2.NewDescribeSecurityGroupsPaginator(ec2.NewFromConfig(cfg), &ec2.DescribeSecurityGroupsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return assets, fmt.Errorf("failed to describe security groups: %v", err)
+		}
+
+		for _, sg := range page.SecurityGroups {
+			id := aws.ToString(sg.GroupId)
+			details := models.SecurityGroupDetails{
+				GroupID:      id,
+				VpcID:        aws.ToString(sg.VpcId),
+				Description:  aws.ToString(sg.Description),
+				IngressRules: len(sg.IpPermissions),
+				EgressRules:  len(sg.IpPermissionsEgress),
+			}
+			arn := fmt.Sprintf("arn:aws:ec2:%s:%s:security-group/%s", cfg.Region, aws.ToString(sg.OwnerId), id)
+			tags := ec2Tags(sg.Tags)
+			if _, ok := tags["Name"]; !ok {
+				tags["Name"] = aws.ToString(sg.GroupName)
+			}
+			assets = append(assets, newAsset(id, arn, cfg.Region, tags, details))
+		}
+	}
+
+	return assets, nil
+}
+
+func discoverLoadBalancers(ctx context.Context, cfg aws.Config, account string) ([]models.Asset, error) {
+	var assets []models.Asset
+	client := elasticloadbalancingv2.NewFromConfig(cfg)
+
+	paginator := elasticloadbalancingv2.NewDescribeLoadBalancersPaginator(client, &elasticloadbalancingv2.DescribeLoadBalancersInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return assets, fmt.Errorf("failed to describe load balancers: %v", err)
+		}
+
+		var arns []string
+		for _, lb := range page.LoadBalancers {
+			arns = append(arns, aws.ToString(lb.LoadBalancerArn))
+		}
+		tags := make(map[string]map[string]string)
+		for start := 0; start < len(arns); start += elbTagsBatch {
+			end := min(start+elbTagsBatch, len(arns))
+			output, err := client.DescribeTags(ctx, &elasticloadbalancingv2.DescribeTagsInput{ResourceArns: arns[start:end]})
+			if err != nil {
+				continue
+			}
+			for _, description := range output.TagDescriptions {
+				m := map[string]string{}
+				for _, tag := range description.Tags {
+					m[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+				}
+				tags[aws.ToString(description.ResourceArn)] = m
+			}
+		}
+
+		for _, lb := range page.LoadBalancers {
+			details := models.LoadBalancerDetails{
+				LoadBalancerType: string(lb.Type),
+				Scheme:           string(lb.Scheme),
+				DNSName:          aws.ToString(lb.DNSName),
+				VpcID:            aws.ToString(lb.VpcId),
+				SecurityGroupIDs: lb.SecurityGroups,
+			}
+			for _, az := range lb.AvailabilityZones {
+				details.SubnetIDs = append(details.SubnetIDs, aws.ToString(az.SubnetId))
+			}
+			arn := aws.ToString(lb.LoadBalancerArn)
+			assets = append(assets, newAsset(aws.ToString(lb.LoadBalancerName), arn, cfg.Region, tags[arn], details))
+		}
+	}
+
+	return assets, nil
+}
+
+func discoverClassicLoadBalancers(ctx context.Context, cfg aws.Config, account string) ([]models.Asset, error) {
+	var assets []models.Asset
+	client := elasticloadbalancing.NewFromConfig(cfg)
+
+	paginator := elasticloadbalancing.NewDescribeLoadBalancersPaginator(client, &elasticloadbalancing.DescribeLoadBalancersInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return assets, fmt.Errorf("failed to describe classic load balancers: %v", err)
+		}
+
+		var names []string
+		for _, lb := range page.LoadBalancerDescriptions {
+			names = append(names, aws.ToString(lb.LoadBalancerName))
+		}
+		tags := make(map[string]map[string]string)
+		for start := 0; start < len(names); start += elbTagsBatch {
+			end := min(start+elbTagsBatch, len(names))
+			output, err := client.DescribeTags(ctx, &elasticloadbalancing.DescribeTagsInput{LoadBalancerNames: names[start:end]})
+			if err != nil {
+				continue
+			}
+			for _, description := range output.TagDescriptions {
+				m := map[string]string{}
+				for _, tag := range description.Tags {
+					m[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+				}
+				tags[aws.ToString(description.LoadBalancerName)] = m
+			}
+		}
+
+		for _, lb := range page.LoadBalancerDescriptions {
+			name := aws.ToString(lb.LoadBalancerName)
+			details := models.LoadBalancerDetails{
+				LoadBalancerType: "classic",
+				Scheme:           aws.ToString(lb.Scheme),
+				DNSName:          aws.ToString(lb.DNSName),
+				VpcID:            aws.ToString(lb.VPCId),
+				SubnetIDs:        lb.Subnets,
+				SecurityGroupIDs: lb.SecurityGroups,
+			}
+			arn := fmt.Sprintf("arn:aws:elasticloadbalancing:%s:%s:loadbalancer/%s", cfg.Region, account, name)
+			assets = append(assets, newAsset(name, arn, cfg.Region, tags[name], details))
+		}
+	}
+
+	return assets, nil
+}
+
+func discoverCloudFrontDistributions(ctx context.Context, cfg aws.Config, account string) ([]models.Asset, error) {
+	var assets []models.Asset
+	client := cloudfront.NewFromConfig(cfg)
+
+	paginator := cloudfront.NewListDistributionsPaginator(client, &cloudfront.ListDistributionsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return assets, fmt.Errorf("failed to list CloudFront distributions: %v", err)
+		}
+		if page.DistributionList == nil {
+			continue
+		}
+
+		for _, distribution := range page.DistributionList.Items {
+			arn := aws.ToString(distribution.ARN)
+			details := models.CloudFrontDetails{
+				ID:         aws.ToString(distribution.Id),
+				DomainName: aws.ToString(distribution.DomainName),
+				Enabled:    aws.ToBool(distribution.Enabled),
+				WebACLID:   aws.ToString(distribution.WebACLId),
+			}
+			if distribution.Origins != nil {
+				for _, origin := range distribution.Origins.Items {
+					details.Origins = append(details.Origins, aws.ToString(origin.DomainName))
+				}
+			}
+
+			tags := map[string]string{}
+			if output, err := client.ListTagsForResource(ctx, &cloudfront.ListTagsForResourceInput{Resource: aws.String(arn)}); err == nil && output.Tags != nil {
+				for _, tag := range output.Tags.Items {
+					tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+				}
+			}
+			assets = append(assets, newAsset(details.ID, arn, models.GlobalRegion, tags, details))
+		}
+	}
+
+	return assets, nil
+}
+
+func discoverAPIGateways(ctx context.Context, cfg aws.Config, account string) ([]models.Asset, error) {
+	var assets []models.Asset
+
+	paginator := apigateway.NewGetRestApisPaginator(apigateway.NewFromConfig(cfg), &apigateway.GetRestApisInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return assets, fmt.Errorf("failed to list API Gateway REST APIs: %v", err)
+		}
+
+		for _, api := range page.Items {
+			id := aws.ToString(api.Id)
+			details := models.APIGatewayDetails{ID: id}
+			if api.EndpointConfiguration != nil {
+				for _, endpointType := range api.EndpointConfiguration.Types {
+					details.EndpointTypes = append(details.EndpointTypes, string(endpointType))
+				}
+				details.VpcEndpoints = api.EndpointConfiguration.VpcEndpointIds
+			}
+			arn := fmt.Sprintf("arn:aws:apigateway:%s::/restapis/%s", cfg.Region, id)
+			assets = append(assets, newAsset(aws.ToString(api.Name), arn, cfg.Region, api.Tags, details))
+		}
+	}
+
+	return assets, nil
+}
@@ -0,0 +1,173 @@
+package discovery
+
+import (
+	"cloud_compliance_checker/models"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// bucketTagReader reads the tags of a bucket
+type bucketTagReader interface {
+	GetBucketTagging(ctx context.Context, params *s3.GetBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error)
+}
+
+func discoverS3Assets(ctx context.Context, cfg aws.Config, account string) ([]models.Asset, error) {
+	var assets []models.Asset
+	var errs []error
+	client := s3.NewFromConfig(cfg)
+
+	result, err := client.ListBuckets(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list S3 buckets: %v", err)
+	}
+
+	// The tags are read with a client of the region of each bucket
+	regionClients := map[string]*s3.Client{cfg.Region: client}
+	for _, bucket := range result.Buckets {
+		name := aws.ToString(bucket.Name)
+
+		// Buckets are listed globally, the region is the one of the bucket location
+		region := models.GlobalRegion
+		tagClient := client
+		if location, err := client.GetBucketLocation(ctx, &s3.GetBucketLocationInput{Bucket: bucket.Name}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to get the location of bucket %s: %v", name, err))
+		} else {
+			region = string(location.LocationConstraint)
+			if region == "" {
+				region = "us-east-1"
+			}
+			if regionClients[region] == nil {
+				regionClients[region] = s3.NewFromConfig(cfg, func(o *s3.Options) { o.Region = region })
+			}
+			tagClient = regionClients[region]
+		}
+
+		tags, err := bucketTags(ctx, tagClient, name)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		details := models.S3BucketDetails{CreationDate: aws.ToTime(bucket.CreationDate)}
+		asset := newAsset(name, "arn:aws:s3:::"+name, region, tags, details)
+		asset.TagsUnknown = err != nil
+		assets = append(assets, asset)
+	}
+
+	return assets, errors.Join(errs...)
+}
+
+// bucketTags returns the tags of a bucket. A bucket without tags returns NoSuchTagSet.
+func bucketTags(ctx context.Context, client bucketTagReader, name string) (map[string]string, error) {
+	output, err := client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String(name)})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchTagSet" {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read the tags of bucket %s: %v", name, err)
+	}
+
+	tags := map[string]string{}
+	for _, tag := range output.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return tags, nil
+}
+
+func discoverKMSKeys(ctx context.Context, cfg aws.Config, account string) ([]models.Asset, error) {
+	var assets []models.Asset
+	var errs []error
+	client := kms.NewFromConfig(cfg)
+
+	paginator := kms.NewListKeysPaginator(client, &kms.ListKeysInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return assets, errors.Join(append(errs, fmt.Errorf("failed to list KMS keys: %v", err))...)
+		}
+
+		for _, key := range page.Keys {
+			id := aws.ToString(key.KeyId)
+			details := models.KMSKeyDetails{KeyID: id}
+			// Without the metadata it is unknown whether the key is AWS managed, so its tags are unknown too
+			tags := map[string]string{}
+			tagsUnknown := false
+			output, err := client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: key.KeyId})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to describe KMS key %s: %v", id, err))
+				tagsUnknown = true
+			} else if output.KeyMetadata != nil {
+				details.KeyState = string(output.KeyMetadata.KeyState)
+				details.KeyManager = string(output.KeyMetadata.KeyManager)
+				details.KeyUsage = string(output.KeyMetadata.KeyUsage)
+			}
+
+			// AWS managed keys do not allow listing tags
+			if !tagsUnknown && details.KeyManager != "AWS" {
+				output, err := client.ListResourceTags(ctx, &kms.ListResourceTagsInput{KeyId: key.KeyId})
+				if err != nil {
+					errs = append(errs, fmt.Errorf("failed to read the tags of KMS key %s: %v", id, err))
+					tagsUnknown = true
+				} else {
+					for _, tag := range output.Tags {
+						tags[aws.ToString(tag.TagKey)] = aws.ToString(tag.TagValue)
+					}
+				}
+			}
+
+			asset := newAsset(id, aws.ToString(key.KeyArn), cfg.Region, tags, details)
+			asset.TagsUnknown = tagsUnknown
+			assets = append(assets, asset)
+		}
+	}
+
+	return assets, errors.Join(errs...)
+}
+
+func discoverRDSInstances(ctx context.Context, cfg aws.Config, account string) ([]models.Asset, error) {
+	var assets []models.Asset
+
+	paginator := rds.NewDescribeDBInstancesPaginator(rds.NewFromConfig(cfg), &rds.DescribeDBInstancesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return assets, fmt.Errorf("failed to describe RDS instances: %v", err)
+		}
+
+		for _, instance := range page.DBInstances {
+			details := models.RDSInstanceDetails{
+				Engine:             aws.ToString(instance.Engine),
+				InstanceClass:      aws.ToString(instance.DBInstanceClass),
+				StorageEncrypted:   aws.ToBool(instance.StorageEncrypted),
+				KmsKeyID:           aws.ToString(instance.KmsKeyId),
+				PubliclyAccessible: aws.ToBool(instance.PubliclyAccessible),
+				MultiAZ:            aws.ToBool(instance.MultiAZ),
+			}
+			if instance.DBSubnetGroup != nil {
+				details.VpcID = aws.ToString(instance.DBSubnetGroup.VpcId)
+				for _, subnet := range instance.DBSubnetGroup.Subnets {
+					details.SubnetIDs = append(details.SubnetIDs, aws.ToString(subnet.SubnetIdentifier))
+				}
+			}
+			for _, sg := range instance.VpcSecurityGroups {
+				details.SecurityGroupIDs = append(details.SecurityGroupIDs, aws.ToString(sg.VpcSecurityGroupId))
+			}
+
+			tags := map[string]string{}
+			for _, tag := range instance.TagList {
+				tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+
+			assets = append(assets, newAsset(aws.ToString(instance.DBInstanceIdentifier), aws.ToString(instance.DBInstanceArn), cfg.Region, tags, details))
+		}
+	}
+
+	return assets, nil
+}
@@ -0,0 +1,52 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTagReader returns the tags or the error of each bucket
+type fakeTagReader struct {
+	tags map[string][]s3types.Tag
+	errs map[string]error
+}
+
+func (f fakeTagReader) GetBucketTagging(ctx context.Context, params *s3.GetBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error) {
+	if err := f.errs[aws.ToString(params.Bucket)]; err != nil {
+		return nil, err
+	}
+	return &s3.GetBucketTaggingOutput{TagSet: f.tags[aws.ToString(params.Bucket)]}, nil
+}
+
+func TestBucketTags(t *testing.T) {
+	reader := fakeTagReader{
+		tags: map[string][]s3types.Tag{"cui": {{Key: aws.String("cui"), Value: aws.String("true")}}},
+		errs: map[string]error{
+			"untagged":  &smithy.GenericAPIError{Code: "NoSuchTagSet"},
+			"forbidden": &smithy.GenericAPIError{Code: "AccessDenied"},
+			"moved":     errors.New("PermanentRedirect"),
+		},
+	}
+
+	tags, err := bucketTags(context.TODO(), reader, "cui")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"cui": "true"}, tags)
+
+	tags, err = bucketTags(context.TODO(), reader, "untagged")
+	assert.NoError(t, err)
+	assert.Empty(t, tags)
+
+	for _, bucket := range []string{"forbidden", "moved"} {
+		_, err = bucketTags(context.TODO(), reader, bucket)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "bucket "+bucket)
+		}
+	}
+}
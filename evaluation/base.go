@@ -2,7 +2,6 @@ package evaluation
 
 import (
 	"cloud_compliance_checker/config"
-	"cloud_compliance_checker/discovery"
 	iampolicy "cloud_compliance_checker/internal/checks/access_control"
 	"cloud_compliance_checker/internal/checks/audit_and_accountability"
 	"cloud_compliance_checker/internal/checks/config_management"
@@ -15,7 +14,12 @@ import (
 	"cloud_compliance_checker/internal/checks/security_assesment"
 	"cloud_compliance_checker/internal/checks/system_services_acquisition"
 	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/notify"
+	"cloud_compliance_checker/remediation"
+	"cloud_compliance_checker/scope"
+	"errors"
 	"fmt"
+	"path/filepath"
 	"time"
 
 	"os"
@@ -26,6 +30,12 @@ import (
 	"github.com/pdfcpu/pdfcpu/pkg/api"
 )
 
+// remediationDir is the directory where the Terraform/CloudFormation remediation snippets are written
+const remediationDir = "remediation_snippets"
+
+// ReportFileName is the name of the merged PDF report
+const ReportFileName = "compliance_report.pdf"
+
 // evaluateCriteria evaluates the criteria for a given instance and returns the compliance result
 func evaluateCriteria(criteria models.Criteria,
 	cfg aws.Config) models.ComplianceResult {
@@ -109,6 +119,25 @@ func evaluateCriteria(criteria models.Criteria,
 			Response:    "Check passed",
 			Impact:      0,
 		}
+	// 03.01.03 Information Flow Enforcement
+	case "CheckCUINetworkFlow":
+		err := protection.CheckCUINetworkFlow(cfg)
+		if err != nil {
+			result = models.ComplianceResult{
+				Description: criteria.Description,
+				Status:      "NOT COMPLIANT",
+				Response:    err.Error(),
+				Impact:      criteria.Value,
+			}
+			fmt.Printf("\n[ERROR]: %v\n", err)
+			return result
+		}
+		result = models.ComplianceResult{
+			Description: criteria.Description,
+			Status:      "COMPLIANT",
+			Response:    "Check passed",
+			Impact:      0,
+		}
 	// 03.01.04 Separation of Duties
 	case "CheckSeparateDuties":
 		err := check.RunCheckSeparateDuties()
@@ -147,6 +176,42 @@ func evaluateCriteria(criteria models.Criteria,
 			Response:    "Check passed",
 			Impact:      0,
 		}
+	case "CheckUnusedPermissions":
+		err := iampolicy.RunUnusedPermissionsCheck(cfg)
+		if err != nil {
+			result = models.ComplianceResult{
+				Description: criteria.Description,
+				Status:      "NOT COMPLIANT",
+				Response:    err.Error(),
+				Impact:      criteria.Value,
+			}
+			fmt.Printf("\n[ERROR]: %v\n", err)
+			return result
+		}
+		result = models.ComplianceResult{
+			Description: criteria.Description,
+			Status:      "COMPLIANT",
+			Response:    "Check passed",
+			Impact:      0,
+		}
+	case "CheckRootAccessKeys":
+		err := iampolicy.RunRootAccessKeyCheck(cfg)
+		if err != nil {
+			result = models.ComplianceResult{
+				Description: criteria.Description,
+				Status:      "NOT COMPLIANT",
+				Response:    err.Error(),
+				Impact:      criteria.Value,
+			}
+			fmt.Printf("\n[ERROR]: %v\n", err)
+			return result
+		}
+		result = models.ComplianceResult{
+			Description: criteria.Description,
+			Status:      "COMPLIANT",
+			Response:    "Check passed",
+			Impact:      0,
+		}
 	// 03.01.06 Least Privilege Privileged Accounts
 	case "CheckPrivilegedAccounts":
 		err := check.RunPrivilegeAccountCheck()
@@ -166,6 +231,24 @@ func evaluateCriteria(criteria models.Criteria,
 			Response:    "Check passed",
 			Impact:      0,
 		}
+	case "CheckRootUsage":
+		err := iampolicy.RunRootUsageCheck(cfg)
+		if err != nil {
+			result = models.ComplianceResult{
+				Description: criteria.Description,
+				Status:      "NOT COMPLIANT",
+				Response:    err.Error(),
+				Impact:      criteria.Value,
+			}
+			fmt.Printf("\n[ERROR]: %v\n", err)
+			return result
+		}
+		result = models.ComplianceResult{
+			Description: criteria.Description,
+			Status:      "COMPLIANT",
+			Response:    "Check passed",
+			Impact:      0,
+		}
 	// 03.01.07 Least Privilege Privileged Functions
 	case "CheckPreventPrivilegedFunctions":
 		err := check.RunPrivilegedFunctionCheck()
@@ -302,6 +385,25 @@ func evaluateCriteria(criteria models.Criteria,
 			Response:    "Check passed",
 			Impact:      0,
 		}
+	// 03.03.01 Event Logging
+	case "CheckTrailCoverage":
+		err := audit_and_accountability.CheckTrailCoverage(cfg)
+		if err != nil {
+			result = models.ComplianceResult{
+				Description: criteria.Description,
+				Status:      "NOT COMPLIANT",
+				Response:    err.Error(),
+				Impact:      criteria.Value,
+			}
+			fmt.Printf("\n[ERROR]: %v\n", err)
+			return result
+		}
+		result = models.ComplianceResult{
+			Description: criteria.Description,
+			Status:      "COMPLIANT",
+			Response:    "Check passed",
+			Impact:      0,
+		}
 	// 03.03.02 Audit Record Content
 	case "CheckUserTraceability":
 		aa := audit_and_accountability.NewAuditLogCheck(cfg, 0)
@@ -342,6 +444,25 @@ func evaluateCriteria(criteria models.Criteria,
 			Response:    "Check passed",
 			Impact:      0,
 		}
+	// 03.03.03 Audit Record Generation
+	case "CheckTrailDataEvents":
+		err := audit_and_accountability.CheckTrailDataEvents(cfg)
+		if err != nil {
+			result = models.ComplianceResult{
+				Description: criteria.Description,
+				Status:      "NOT COMPLIANT",
+				Response:    err.Error(),
+				Impact:      criteria.Value,
+			}
+			fmt.Printf("\n[ERROR]: %v\n", err)
+			return result
+		}
+		result = models.ComplianceResult{
+			Description: criteria.Description,
+			Status:      "COMPLIANT",
+			Response:    "Check passed",
+			Impact:      0,
+		}
 	// 03.03.04 Audit Logging Failure
 	case "CheckLoggingFailure":
 		lfc := audit_and_accountability.NewLoggingFailureCheck(cfg, 24*time.Hour, nil, "mittente@example.com", "destinatario@example.com")
@@ -383,10 +504,51 @@ func evaluateCriteria(criteria models.Criteria,
 			Response:    "Audit log analysis check passed",
 			Impact:      0,
 		}
+	// 03.03.05 Audit Record Review, Analysis, and Reporting
+	case "CheckTrailAnalysis":
+		err := audit_and_accountability.CheckTrailAnalysis(cfg)
+		if err != nil {
+			result = models.ComplianceResult{
+				Description: criteria.Description,
+				Status:      "NOT COMPLIANT",
+				Response:    err.Error(),
+				Impact:      criteria.Value,
+			}
+			fmt.Printf("\n[ERROR]: %v\n", err)
+			return result
+		}
+		result = models.ComplianceResult{
+			Description: criteria.Description,
+			Status:      "COMPLIANT",
+			Response:    "Check passed",
+			Impact:      0,
+		}
+	case "CheckBehavioralAnomalies":
+		err := audit_and_accountability.CheckBehavioralAnomalies(cfg)
+		if err != nil {
+			result = models.ComplianceResult{
+				Description: criteria.Description,
+				Status:      "NOT COMPLIANT",
+				Response:    err.Error(),
+				Impact:      criteria.Value,
+			}
+			fmt.Printf("\n[ERROR]: %v\n", err)
+			return result
+		}
+		result = models.ComplianceResult{
+			Description: criteria.Description,
+			Status:      "COMPLIANT",
+			Response:    "Check passed",
+			Impact:      0,
+		}
 	// 03.03.06 Audit Record Reduction and Report Generation
 	case "CheckAuditRecordReduction":
 		aa := audit_and_accountability.NewAuditLogCheck(cfg, 30) // 30-day retention for this check
 		err := aa.RunAuditLogCheck()
+		if err == nil {
+			// Reports of the saved queries in audit_queries
+			err = audit_and_accountability.RunSavedQueries(cfg)
+		}
 		if err != nil {
 			result = models.ComplianceResult{
 				Description: criteria.Description,
@@ -423,6 +585,25 @@ func evaluateCriteria(criteria models.Criteria,
 			Response:    "Check passed",
 			Impact:      0,
 		}
+	// 03.03.08 Protection of Audit Information
+	case "CheckTrailProtection":
+		err := audit_and_accountability.CheckTrailProtection(cfg)
+		if err != nil {
+			result = models.ComplianceResult{
+				Description: criteria.Description,
+				Status:      "NOT COMPLIANT",
+				Response:    err.Error(),
+				Impact:      criteria.Value,
+			}
+			fmt.Printf("\n[ERROR]: %v\n", err)
+			return result
+		}
+		result = models.ComplianceResult{
+			Description: criteria.Description,
+			Status:      "COMPLIANT",
+			Response:    "Check passed",
+			Impact:      0,
+		}
 	// Configuration Management
 	// 03.04.01 Baseline Configuration
 	case "CheckBaselineConfigurations":
@@ -460,6 +641,24 @@ func evaluateCriteria(criteria models.Criteria,
 
 		}
 
+		result = models.ComplianceResult{
+			Description: criteria.Description,
+			Status:      "COMPLIANT",
+			Response:    "Check passed",
+			Impact:      0,
+		}
+	case "CheckFlowLogPorts":
+		err := integrity.CheckFlowLogPorts(cfg)
+		if err != nil {
+			result = models.ComplianceResult{
+				Description: criteria.Description,
+				Status:      "NOT COMPLIANT",
+				Response:    err.Error(),
+				Impact:      criteria.Value,
+			}
+			fmt.Printf("\n[ERROR]: %v\n", err)
+			return result
+		}
 		result = models.ComplianceResult{
 			Description: criteria.Description,
 			Status:      "COMPLIANT",
@@ -491,10 +690,7 @@ func evaluateCriteria(criteria models.Criteria,
 	// 03.04.10 System Component Inventory
 	// 03.04.11 Information Location
 	case "CheckInformationLocation":
-		assets := discovery.DiscoverAssets(cfg)
-
-		config_management.DocumentDiscoveredAssets(assets)
-		err := config_management.DisplayCUIComponents()
+		err := config_management.CheckInformationLocation(cfg)
 		if err != nil {
 			result = models.ComplianceResult{
 				Description: criteria.Description,
@@ -528,6 +724,24 @@ func evaluateCriteria(criteria models.Criteria,
 
 		}
 
+		result = models.ComplianceResult{
+			Description: criteria.Description,
+			Status:      "COMPLIANT",
+			Response:    "Check passed",
+			Impact:      0,
+		}
+	case "CheckImpossibleTravel":
+		err := config_management.CheckImpossibleTravel(cfg)
+		if err != nil {
+			result = models.ComplianceResult{
+				Description: criteria.Description,
+				Status:      "NOT COMPLIANT",
+				Response:    err.Error(),
+				Impact:      criteria.Value,
+			}
+			fmt.Printf("\n[ERROR]: %v\n", err)
+			return result
+		}
 		result = models.ComplianceResult{
 			Description: criteria.Description,
 			Status:      "COMPLIANT",
@@ -580,11 +794,7 @@ func evaluateCriteria(criteria models.Criteria,
 		}
 	// 03.05.03 Multi-Factor Authentication
 	case "CheckMFA":
-		// Create IAM client
-		iamClient := iam.NewFromConfig(cfg)
-
-		// Enforce MFA for users
-		err := id_auth.EnforceMFAForUsers(iamClient)
+		err := id_auth.CheckMFA(cfg)
 		if err != nil {
 			result = models.ComplianceResult{
 				Description: criteria.Description,
@@ -596,6 +806,31 @@ func evaluateCriteria(criteria models.Criteria,
 			return result
 
 		}
+
+		result = models.ComplianceResult{
+			Description: criteria.Description,
+			Status:      "COMPLIANT",
+			Response:    "Check passed",
+			Impact:      0,
+		}
+	case "CheckRootMFA":
+		err := iampolicy.RunRootMFACheck(cfg)
+		if err != nil {
+			result = models.ComplianceResult{
+				Description: criteria.Description,
+				Status:      "NOT COMPLIANT",
+				Response:    err.Error(),
+				Impact:      criteria.Value,
+			}
+			fmt.Printf("\n[ERROR]: %v\n", err)
+			return result
+		}
+		result = models.ComplianceResult{
+			Description: criteria.Description,
+			Status:      "COMPLIANT",
+			Response:    "Check passed",
+			Impact:      0,
+		}
 	// 03.05.04 Replay-Resistant Authentication
 	case "CheckRRA":
 		iamClient := iam.NewFromConfig(cfg)
@@ -946,6 +1181,44 @@ func evaluateCriteria(criteria models.Criteria,
 
 		}
 
+		result = models.ComplianceResult{
+			Description: criteria.Description,
+			Status:      "COMPLIANT",
+			Response:    "Check passed",
+			Impact:      0,
+		}
+	// 03.13.01 Boundary Protection
+	case "CheckInternetExposure":
+		err := protection.CheckInternetExposure(cfg)
+		if err != nil {
+			result = models.ComplianceResult{
+				Description: criteria.Description,
+				Status:      "NOT COMPLIANT",
+				Response:    err.Error(),
+				Impact:      criteria.Value,
+			}
+			fmt.Printf("\n[ERROR]: %v\n", err)
+			return result
+		}
+		result = models.ComplianceResult{
+			Description: criteria.Description,
+			Status:      "COMPLIANT",
+			Response:    "Check passed",
+			Impact:      0,
+		}
+	// 03.13.01 Boundary Protection
+	case "CheckNACLBoundary":
+		err := protection.CheckNACLBoundary(cfg)
+		if err != nil {
+			result = models.ComplianceResult{
+				Description: criteria.Description,
+				Status:      "NOT COMPLIANT",
+				Response:    err.Error(),
+				Impact:      criteria.Value,
+			}
+			fmt.Printf("\n[ERROR]: %v\n", err)
+			return result
+		}
 		result = models.ComplianceResult{
 			Description: criteria.Description,
 			Status:      "COMPLIANT",
@@ -994,6 +1267,25 @@ func evaluateCriteria(criteria models.Criteria,
 			Response:    "Check passed",
 			Impact:      0,
 		}
+	// 03.13.06 Deny by Default
+	case "CheckNACLDenyByDefault":
+		err := protection.CheckNACLDenyByDefault(cfg)
+		if err != nil {
+			result = models.ComplianceResult{
+				Description: criteria.Description,
+				Status:      "NOT COMPLIANT",
+				Response:    err.Error(),
+				Impact:      criteria.Value,
+			}
+			fmt.Printf("\n[ERROR]: %v\n", err)
+			return result
+		}
+		result = models.ComplianceResult{
+			Description: criteria.Description,
+			Status:      "COMPLIANT",
+			Response:    "Check passed",
+			Impact:      0,
+		}
 	// 03.13.08 Transmission and Storage Confidentiality
 	case "CheckTSC":
 
@@ -1203,6 +1495,44 @@ func evaluateCriteria(criteria models.Criteria,
 			Impact:      0,
 		}
 	// 03.14.06 Security Monitoring
+	case "CheckFlowLogTraffic":
+		err := integrity.CheckFlowLogTraffic(cfg)
+		if err != nil {
+			result = models.ComplianceResult{
+				Description: criteria.Description,
+				Status:      "NOT COMPLIANT",
+				Response:    err.Error(),
+				Impact:      criteria.Value,
+			}
+			fmt.Printf("\n[ERROR]: %v\n", err)
+			return result
+		}
+		result = models.ComplianceResult{
+			Description: criteria.Description,
+			Status:      "COMPLIANT",
+			Response:    "Check passed",
+			Impact:      0,
+		}
+	// 03.14.06 Security Monitoring
+	case "CheckThreatIntel":
+		err := integrity.CheckThreatIntel(cfg)
+		if err != nil {
+			result = models.ComplianceResult{
+				Description: criteria.Description,
+				Status:      "NOT COMPLIANT",
+				Response:    err.Error(),
+				Impact:      criteria.Value,
+			}
+			fmt.Printf("\n[ERROR]: %v\n", err)
+			return result
+		}
+		result = models.ComplianceResult{
+			Description: criteria.Description,
+			Status:      "COMPLIANT",
+			Response:    "Check passed",
+			Impact:      0,
+		}
+	// 03.14.06 Security Monitoring
 	case "CheckSystemMonitoring":
 
 		err := integrity.CheckSystemMonitoring(cfg)
@@ -1259,45 +1589,73 @@ func evaluateCriteria(criteria models.Criteria,
 
 // EvaluateAssets evaluates all assets and returns the compliance results
 func EvaluateAssets(controls models.NISTControls, cfg aws.Config) int {
+	report, err := RunEvaluation(controls, cfg, ".")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 0
+	}
+
+	return report.Score
+}
+
+// RunEvaluation evaluates the controls and writes the summary, detail and merged PDF reports into outputDir
+func RunEvaluation(controls models.NISTControls, cfg aws.Config, outputDir string) (models.Report, error) {
 	fmt.Println("=========================================")
 
 	// Separator for readability
 	fmt.Println("===== Compliance Evaluation Results =====")
 
-	// Variabili per contare i controlli
-	var compliantCount, nonCompliantCount, notApplicableCount, toBeImplementedCount int
-
-	// Variabile per il punteggio
-	score := 110
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return models.Report{}, fmt.Errorf("failed to create output directory %s: %v", outputDir, err)
+	}
 
 	// Genera il PDF con i dettagli dei controlli e aggiorna i contatori
-	detailPDF := "detail_report.pdf"
-	score = createDetailPDF(controls, cfg, detailPDF, &compliantCount, &nonCompliantCount, &notApplicableCount, &toBeImplementedCount)
+	detailPDF := filepath.Join(outputDir, "detail_report.pdf")
+	report := createDetailPDF(controls, cfg, detailPDF, outputDir)
+	report.TotalControls = len(controls.Controls)
 
 	// Ora che i conteggi sono stati aggiornati, genera il PDF del riepilogo
-	summaryPDF := "summary_report.pdf"
-	CreateSummaryPDF(summaryPDF, score, compliantCount, nonCompliantCount, notApplicableCount, toBeImplementedCount, len(controls.Controls))
+	summaryPDF := filepath.Join(outputDir, "summary_report.pdf")
+	CreateSummaryPDF(summaryPDF, report.Score, report.Compliant, report.NonCompliant, report.NotApplicable, report.ToBeImplemented, report.TotalControls)
 
 	// Controlla se i file PDF esistono e sono stati creati correttamente
 	if _, err := os.Stat(summaryPDF); os.IsNotExist(err) {
-		fmt.Println("Error: Summary PDF was not created.")
-		return 0
+		return report, fmt.Errorf("summary PDF was not created")
 	}
 
 	if _, err := os.Stat(detailPDF); os.IsNotExist(err) {
-		fmt.Println("Error: Detail PDF was not created.")
-		return 0
+		return report, fmt.Errorf("detail PDF was not created")
 	}
 
 	// Concatena i due PDF
-	finalPDF := "compliance_report.pdf"
-	err := mergePDFs(summaryPDF, detailPDF, finalPDF)
-	if err != nil {
-		fmt.Printf("Error merging PDF: %v\n", err)
-		return 0
+	finalPDF := filepath.Join(outputDir, ReportFileName)
+	if err := mergePDFs(summaryPDF, detailPDF, finalPDF); err != nil {
+		return report, fmt.Errorf("error merging PDF: %v", err)
+	}
+
+	return report, nil
+}
+
+// FilterControls returns only the controls whose ID is in ids. An empty list returns all the controls.
+func FilterControls(controls models.NISTControls, ids []string) (models.NISTControls, error) {
+	if len(ids) == 0 {
+		return controls, nil
 	}
 
-	return score
+	byID := make(map[string]models.Control)
+	for _, control := range controls.Controls {
+		byID[control.ID] = control
+	}
+
+	var filtered models.NISTControls
+	for _, id := range ids {
+		control, ok := byID[id]
+		if !ok {
+			return filtered, fmt.Errorf("control %s not found in the catalog", id)
+		}
+		filtered.Controls = append(filtered.Controls, control)
+	}
+	return filtered, nil
 }
 
 // CreateSummaryPDF genera un PDF con il titolo e il riepilogo
@@ -1339,15 +1697,15 @@ func CreateSummaryPDF(fileName string, score, compliantCount, nonCompliantCount,
 }
 
 // createDetailPDF genera un PDF con i dettagli dei controlli
-func createDetailPDF(controls models.NISTControls, cfg aws.Config, fileName string, compliantCount, nonCompliantCount, notApplicableCount, toBeImplementedCount *int) int {
+func createDetailPDF(controls models.NISTControls, cfg aws.Config, fileName, outputDir string) models.Report {
 	// Inizializza il PDF
 	pdf := gofpdf.New("P", "mm", "A4", "")
 
 	// Aggiungi una pagina
 	pdf.AddPage()
 
-	// Variabile per il punteggio
-	score := checkInstance(controls, cfg, pdf, compliantCount, nonCompliantCount, notApplicableCount, toBeImplementedCount)
+	// Esegue i controlli e calcola il punteggio
+	report := checkInstance(controls, cfg, pdf, outputDir)
 
 	// Salva il PDF
 	err := pdf.OutputFileAndClose(fileName)
@@ -1355,14 +1713,25 @@ func createDetailPDF(controls models.NISTControls, cfg aws.Config, fileName stri
 		fmt.Printf("Error creating detail PDF: %v\n", err)
 	}
 
-	return score
+	return report
 }
 
-// CheckInstance runs all compliance checks on the given instance (SINGLE INSTANCE) and returns the total score
-func checkInstance(controls models.NISTControls, cfg aws.Config, pdf *gofpdf.Fpdf, compliantCount, nonCompliantCount, notApplicableCount, toBeImplementedCount *int) int {
-	score := 110
+// CheckInstance runs all compliance checks on the given instance (SINGLE INSTANCE) and returns the report with the total score
+func checkInstance(controls models.NISTControls, cfg aws.Config, pdf *gofpdf.Fpdf, outputDir string) models.Report {
+	report := models.Report{Score: 110}
 	controlsPerPage := 4
 	controlCount := 0
+	var remediations []models.Remediation
+
+	// Gli asset fuori dal perimetro CUI non sono valutati e sono riportati a parte
+	scope.Drain()
+	if scope.Current().Configured() {
+		_, outOfScope, err := scope.Assets(cfg)
+		if err != nil {
+			fmt.Printf("\n[WARNING]: asset discovery incomplete: %v\n", err)
+		}
+		report.OutOfScope = outOfScope
+	}
 
 	for _, control := range controls.Controls {
 		fmt.Printf("\n")
@@ -1374,7 +1743,20 @@ func checkInstance(controls models.NISTControls, cfg aws.Config, pdf *gofpdf.Fpd
 		pdf.MultiCell(0, 10, fmt.Sprintf("Control: %s - %s", control.ID, control.Name), "", "L", false)
 
 		for _, criteria := range control.Criteria {
+			start := time.Now()
 			result := evaluateCriteria(criteria, cfg)
+			duration := time.Since(start)
+			skipped := scope.Drain()
+
+			// Genera gli snippet Terraform/CloudFormation per i controlli non conformi
+			if result.Status == "NOT COMPLIANT" && remediation.HasGenerator(criteria.CheckFunction) {
+				snippets, err := remediation.Generate(criteria.CheckFunction, cfg)
+				if err != nil {
+					fmt.Printf("\n[ERROR]: %v\n", err)
+				}
+				result.Remediation = snippets
+				remediations = append(remediations, snippets...)
+			}
 
 			// Print results for each check in a readable format
 			fmt.Printf("\n")
@@ -1389,20 +1771,51 @@ func checkInstance(controls models.NISTControls, cfg aws.Config, pdf *gofpdf.Fpd
 			pdf.MultiCell(0, 8, fmt.Sprintf("    Description: %s", criteria.Description), "", "L", false)
 			pdf.MultiCell(0, 8, fmt.Sprintf("    Result: %s", result.Status), "", "L", false)
 			pdf.MultiCell(0, 8, fmt.Sprintf("    Impact: %d", criteria.Value), "", "L", false)
+			if len(skipped) > 0 {
+				fmt.Printf("    Out of scope: %d asset(s) skipped\n", len(skipped))
+				pdf.MultiCell(0, 8, fmt.Sprintf("    Out of scope: %d asset(s) skipped", len(skipped)), "", "L", false)
+			}
+			if len(result.Remediation) > 0 {
+				fmt.Printf("    Remediation: %d snippet(s) in %s/%s.tf|.yaml\n", len(result.Remediation), remediationDir, criteria.CheckFunction)
+				pdf.MultiCell(0, 8, fmt.Sprintf("    Remediation: %d snippet(s) in %s/%s.tf|.yaml", len(result.Remediation), remediationDir, criteria.CheckFunction), "", "L", false)
+			}
 			pdf.Ln(8)
 
 			// Aggiorna i contatori in base allo stato del controllo
 			switch result.Status {
 			case "COMPLIANT":
-				*compliantCount++
+				report.Compliant++
 			case "NOT COMPLIANT":
-				*nonCompliantCount++
+				report.NonCompliant++
 			case "NOT APPLICABLE":
-				*notApplicableCount++
+				report.NotApplicable++
 			case "TO BE IMPLEMENTED":
-				*toBeImplementedCount++
+				report.ToBeImplemented++
 			}
 
+			// Notifica i controlli non conformi sui canali configurati
+			if result.Status == "NOT COMPLIANT" {
+				err := notify.Send(notify.Event{
+					Title:         fmt.Sprintf("%s %s not compliant", control.ID, criteria.CheckFunction),
+					Message:       fmt.Sprintf("%s - %s: %s", control.ID, control.Name, result.Response),
+					Severity:      notify.SeverityForImpact(criteria.Value),
+					ControlID:     control.ID,
+					CheckFunction: criteria.CheckFunction,
+				})
+				if err != nil && !errors.Is(err, notify.ErrNotConfigured) {
+					fmt.Printf("\n[ERROR]: %v\n", err)
+				}
+			}
+
+			report.Results = append(report.Results, models.ControlResult{
+				ControlID:     control.ID,
+				ControlName:   control.Name,
+				CheckFunction: criteria.CheckFunction,
+				Result:        result,
+				Duration:      duration.Seconds(),
+				OutOfScope:    skipped,
+			})
+
 			// Controlla il numero di controlli per pagina
 			controlCount++
 			if controlCount >= controlsPerPage {
@@ -1411,11 +1824,34 @@ func checkInstance(controls models.NISTControls, cfg aws.Config, pdf *gofpdf.Fpd
 				controlCount = 0
 			}
 
-			score -= result.Impact
+			report.Score -= result.Impact
 		}
 	}
 
-	return score
+	if len(report.OutOfScope) > 0 {
+		writeOutOfScope(pdf, report.OutOfScope)
+	}
+
+	if err := remediation.WriteSnippets(filepath.Join(outputDir, remediationDir), remediations); err != nil {
+		fmt.Printf("Error writing remediation snippets: %v\n", err)
+	}
+
+	return report
+}
+
+// writeOutOfScope aggiunge al PDF l'elenco degli asset fuori dal perimetro CUI
+func writeOutOfScope(pdf *gofpdf.Fpdf, assets []models.OutOfScopeAsset) {
+	fmt.Printf("\n===== Out-of-Scope Assets (%d) =====\n", len(assets))
+
+	pdf.AddPage()
+	pdf.SetFont("Arial", "B", 14)
+	pdf.MultiCell(0, 10, fmt.Sprintf("Out-of-Scope Assets (%d)", len(assets)), "", "L", false)
+	pdf.SetFont("Arial", "", 10)
+	for _, asset := range assets {
+		line := fmt.Sprintf("%s %s (%s): %s", asset.Type, asset.Name, asset.Region, asset.Reason)
+		fmt.Printf("  %s\n", line)
+		pdf.MultiCell(0, 6, line, "", "L", false)
+	}
 }
 
 func mergePDFs(summaryReport, detailReport, outputFile string) error {
@@ -0,0 +1,367 @@
+package flowlogs
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/reachability"
+)
+
+// Defaults of the analysis
+const (
+	defaultEgressThresholdMB = 100
+	defaultSpikeWindow       = 5 * time.Minute
+	defaultSpikeFactor       = 5
+	defaultSpikeMinimum      = 100
+)
+
+// transportProtocols are the IANA numbers of the transport protocols
+var transportProtocols = map[string]int{"ICMP": 1, "TCP": 6, "UDP": 17, "GRE": 47, "ESP": 50, "AH": 51, "ICMPV6": 58}
+
+// applicationProtocols are the transport and port of the application protocols
+var applicationProtocols = map[string]struct {
+	transport int
+	port      int32
+}{
+	"HTTP": {6, 80}, "HTTPS": {6, 443}, "SSH": {6, 22}, "RDP": {6, 3389}, "SMTP": {6, 25}, "DNS": {17, 53},
+	"NTP": {17, 123}, "LDAP": {6, 389}, "LDAPS": {6, 636}, "SMB": {6, 445}, "NFS": {6, 2049},
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, not routed on the internet
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Options are the expected traffic and the thresholds of the analysis
+type Options struct {
+	EssentialPorts     reachability.Ports
+	EssentialProtocols map[int]bool // empty when the protocols are not checked
+	KnownDestinations  []netip.Prefix
+	EgressThreshold    int64 // bytes to a single destination
+	SpikeWindow        time.Duration
+	SpikeFactor        float64
+	SpikeMinimum       int
+}
+
+// NewOptions builds the options from the mission-essential ports and protocols and the flow log settings.
+// Application protocols such as HTTPS add their transport protocol and port.
+func NewOptions(essential config.MissionEssentialConfig, flowCfg config.FlowLogConfig) (Options, error) {
+	opts := Options{
+		EssentialProtocols: map[int]bool{},
+		EgressThreshold:    int64(flowCfg.EgressThresholdMB) << 20,
+		SpikeWindow:        time.Duration(flowCfg.RejectWindowMinutes) * time.Minute,
+		SpikeFactor:        flowCfg.RejectSpikeFactor,
+		SpikeMinimum:       flowCfg.RejectSpikeMinimum,
+	}
+	if opts.EgressThreshold <= 0 {
+		opts.EgressThreshold = defaultEgressThresholdMB << 20
+	}
+	if opts.SpikeWindow <= 0 {
+		opts.SpikeWindow = defaultSpikeWindow
+	}
+	if opts.SpikeFactor <= 0 {
+		opts.SpikeFactor = defaultSpikeFactor
+	}
+	if opts.SpikeMinimum <= 0 {
+		opts.SpikeMinimum = defaultSpikeMinimum
+	}
+
+	var ranges []reachability.PortRange
+	for _, port := range essential.Ports {
+		r, err := parsePorts(port)
+		if err != nil {
+			return opts, err
+		}
+		ranges = append(ranges, r)
+	}
+	for _, name := range essential.Protocols {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if number, ok := transportProtocols[name]; ok {
+			opts.EssentialProtocols[number] = true
+		} else if app, ok := applicationProtocols[name]; ok {
+			opts.EssentialProtocols[app.transport] = true
+			ranges = append(ranges, reachability.PortRange{From: app.port, To: app.port})
+		} else if number, err := strconv.Atoi(name); err == nil {
+			opts.EssentialProtocols[number] = true
+		} else {
+			return opts, fmt.Errorf("unknown mission-essential protocol %q", name)
+		}
+	}
+	opts.EssentialPorts = reachability.NewPorts(ranges...)
+
+	for _, cidr := range flowCfg.KnownDestinations {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return opts, fmt.Errorf("invalid known destination %q: %v", cidr, err)
+		}
+		opts.KnownDestinations = append(opts.KnownDestinations, prefix.Masked())
+	}
+	return opts, nil
+}
+
+// PortUsage is the accepted traffic on a port, or on a protocol without ports
+type PortUsage struct {
+	Protocol int
+	Port     int32
+	Flows    int
+	Bytes    int64
+	Sample   string
+}
+
+// String formats the usage as "tcp/8080: 12 flows, 3.4 MB (10.0.1.5 -> 10.0.2.7)"
+func (p PortUsage) String() string {
+	name := protocolName(p.Protocol)
+	if p.Port != 0 {
+		name = fmt.Sprintf("%s/%d", name, p.Port)
+	}
+	return fmt.Sprintf("%s: %d flows, %s (%s)", name, p.Flows, formatBytes(p.Bytes), p.Sample)
+}
+
+// Spike is a window with an unusual number of rejected flows
+type Spike struct {
+	Start    time.Time
+	Rejected int
+	Baseline float64 // median of the rejected flows per window
+	Sources  []string
+}
+
+// String formats the spike as "2024-05-01 10:05 UTC: 540 rejected flows (baseline 12), top sources ..."
+func (s Spike) String() string {
+	return fmt.Sprintf("%s: %d rejected flows (baseline %.0f), top sources %s",
+		s.Start.Format("2006-01-02 15:04 MST"), s.Rejected, s.Baseline, strings.Join(s.Sources, ", "))
+}
+
+// Egress is the accepted traffic from internal addresses to an unknown external destination
+type Egress struct {
+	Destination netip.Addr
+	Bytes       int64
+	Flows       int
+	Sources     []string
+}
+
+// String formats the transfer as "203.0.113.9: 1.2 GB in 40 flows from 10.0.1.5"
+func (e Egress) String() string {
+	return fmt.Sprintf("%s: %s in %d flows from %s", e.Destination, formatBytes(e.Bytes), e.Flows, strings.Join(e.Sources, ", "))
+}
+
+// Report is the outcome of the analysis
+type Report struct {
+	Records      int
+	From, To     time.Time
+	NonEssential []PortUsage
+	Spikes       []Spike
+	Egress       []Egress
+}
+
+// Analyze compares the records with the options: accepted flows on ports or protocols that are not
+// mission-essential, windows with spikes of rejected flows and large transfers to unknown destinations
+func Analyze(records []Record, opts Options) Report {
+	report := Report{Records: len(records)}
+	for _, r := range records {
+		if r.Start.IsZero() {
+			continue
+		}
+		if report.From.IsZero() || r.Start.Before(report.From) {
+			report.From = r.Start
+		}
+		if r.Start.After(report.To) {
+			report.To = r.Start
+		}
+	}
+	report.NonEssential = nonEssential(records, opts)
+	report.Spikes = rejectSpikes(records, opts, report.From, report.To)
+	report.Egress = unknownEgress(records, opts)
+	return report
+}
+
+// nonEssential aggregates the accepted flows by service port and protocol
+func nonEssential(records []Record, opts Options) []PortUsage {
+	usage := map[[2]int32]*PortUsage{}
+	for _, r := range records {
+		if r.Action != ActionAccept {
+			continue
+		}
+		var port int32
+		switch {
+		case len(opts.EssentialProtocols) > 0 && !opts.EssentialProtocols[r.Protocol]:
+			// The whole protocol is not essential
+		case !opts.EssentialPorts.Empty() && r.ServicePort() != 0 && !opts.EssentialPorts.Contains(r.ServicePort()):
+			port = r.ServicePort()
+		default:
+			continue
+		}
+		key := [2]int32{int32(r.Protocol), port}
+		if usage[key] == nil {
+			usage[key] = &PortUsage{Protocol: r.Protocol, Port: port, Sample: fmt.Sprintf("%s -> %s", r.Source, r.Dest)}
+		}
+		usage[key].Flows++
+		usage[key].Bytes += r.Bytes
+	}
+
+	list := make([]PortUsage, 0, len(usage))
+	for _, u := range usage {
+		list = append(list, *u)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Flows != list[j].Flows {
+			return list[i].Flows > list[j].Flows
+		}
+		return list[i].Port < list[j].Port
+	})
+	return list
+}
+
+// rejectSpikes counts the rejected flows per window and reports the windows above both the minimum and
+// the spike factor times the median of every window, including the quiet ones
+func rejectSpikes(records []Record, opts Options, from, to time.Time) []Spike {
+	if from.IsZero() {
+		return nil
+	}
+	start := from.Truncate(opts.SpikeWindow)
+	windows := int(to.Sub(start)/opts.SpikeWindow) + 1
+	counts := make([]int, windows)
+	sources := make([]map[string]int, windows)
+	for _, r := range records {
+		if r.Action != ActionReject || r.Start.IsZero() {
+			continue
+		}
+		i := int(r.Start.Sub(start) / opts.SpikeWindow)
+		counts[i]++
+		if sources[i] == nil {
+			sources[i] = map[string]int{}
+		}
+		sources[i][r.Source.String()]++
+	}
+
+	sorted := append([]int{}, counts...)
+	sort.Ints(sorted)
+	baseline := float64(sorted[len(sorted)/2])
+	if len(sorted)%2 == 0 {
+		baseline = float64(sorted[len(sorted)/2-1]+sorted[len(sorted)/2]) / 2
+	}
+
+	var spikes []Spike
+	for i, count := range counts {
+		if count < opts.SpikeMinimum || float64(count) < opts.SpikeFactor*max(baseline, 1) {
+			continue
+		}
+		spikes = append(spikes, Spike{
+			Start:    start.Add(time.Duration(i) * opts.SpikeWindow),
+			Rejected: count,
+			Baseline: baseline,
+			Sources:  topKeys(sources[i], 3),
+		})
+	}
+	return spikes
+}
+
+// unknownEgress sums the accepted bytes from internal addresses to each external destination outside
+// the known destinations and reports those above the threshold
+func unknownEgress(records []Record, opts Options) []Egress {
+	transfers := map[netip.Addr]*Egress{}
+	sources := map[netip.Addr]map[string]int{}
+	for _, r := range records {
+		if r.Action != ActionAccept || isInternal(r.Dest) || isKnown(r.Dest, opts.KnownDestinations) {
+			continue
+		}
+		if r.Direction == "ingress" || (r.Direction == "" && !isInternal(r.Source)) {
+			continue
+		}
+		if transfers[r.Dest] == nil {
+			transfers[r.Dest] = &Egress{Destination: r.Dest}
+			sources[r.Dest] = map[string]int{}
+		}
+		transfers[r.Dest].Bytes += r.Bytes
+		transfers[r.Dest].Flows++
+		sources[r.Dest][r.Source.String()] += int(r.Bytes)
+	}
+
+	var list []Egress
+	for dest, e := range transfers {
+		if e.Bytes < opts.EgressThreshold {
+			continue
+		}
+		e.Sources = topKeys(sources[dest], 5)
+		list = append(list, *e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Bytes > list[j].Bytes })
+	return list
+}
+
+// isInternal checks if the address is private, loopback, link-local or shared
+func isInternal(addr netip.Addr) bool {
+	return addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() || sharedAddressSpace.Contains(addr)
+}
+
+// isKnown checks if the address is in one of the known destinations
+func isKnown(addr netip.Addr, known []netip.Prefix) bool {
+	for _, prefix := range known {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// topKeys returns the keys with the highest counts
+func topKeys(counts map[string]int, n int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// parsePorts parses a port or a range as "1024-65535"
+func parsePorts(value string) (reachability.PortRange, error) {
+	from, to, found := strings.Cut(strings.TrimSpace(value), "-")
+	if !found {
+		to = from
+	}
+	start, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil {
+		return reachability.PortRange{}, fmt.Errorf("invalid mission-essential port %q", value)
+	}
+	end, err := strconv.Atoi(strings.TrimSpace(to))
+	if err != nil || start > end || start < 0 || end > 65535 {
+		return reachability.PortRange{}, fmt.Errorf("invalid mission-essential port %q", value)
+	}
+	return reachability.PortRange{From: int32(start), To: int32(end)}, nil
+}
+
+// protocolName returns the name of a protocol number
+func protocolName(number int) string {
+	for name, n := range transportProtocols {
+		if n == number {
+			return strings.ToLower(name)
+		}
+	}
+	return fmt.Sprintf("protocol %d", number)
+}
+
+// formatBytes formats a size as "3.4 MB"
+func formatBytes(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size := float64(n)
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", size, units[i])
+}
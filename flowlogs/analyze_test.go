@@ -0,0 +1,63 @@
+package flowlogs
+
+import (
+	"fmt"
+	"testing"
+
+	"cloud_compliance_checker/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyze(t *testing.T) {
+	format := ParseFormat("${version} ${interface-id} ${srcaddr} ${dstaddr} ${srcport} ${dstport} ${protocol} ${packets} ${bytes} ${start} ${end} ${action} ${log-status}")
+	lines := []string{
+		// HTTPS from the internet and its reply
+		"2 eni-1 198.51.100.7 10.0.1.5 50000 443 6 10 5000 1714557600 1714557660 ACCEPT OK",
+		"2 eni-1 10.0.1.5 198.51.100.7 443 50000 6 10 8000 1714557600 1714557660 ACCEPT OK",
+		// Non-essential port and protocol
+		"2 eni-1 10.0.1.5 10.0.2.9 41000 8080 6 5 700 1714557600 1714557660 ACCEPT OK",
+		"2 eni-1 10.0.1.5 10.0.2.9 0 0 1 1 84 1714557600 1714557660 ACCEPT OK",
+		// 200 MB to an unknown destination, 300 MB to a known one
+		"2 eni-1 10.0.1.5 203.0.113.9 40000 443 6 1000 209715200 1714557600 1714557660 ACCEPT OK",
+		"2 eni-1 10.0.1.5 52.94.1.1 40001 443 6 1000 314572800 1714557600 1714557660 ACCEPT OK",
+		"2 eni-1 - - - - - - - 1714557600 1714557660 - NODATA",
+	}
+	// One rejected flow per window for an hour, then a scan
+	for i := 0; i < 12; i++ {
+		lines = append(lines, fmt.Sprintf("2 eni-1 192.0.2.1 10.0.1.5 1234 22 6 1 40 %d %d REJECT OK", 1714557600+i*300, 1714557660+i*300))
+	}
+	for i := 0; i < 150; i++ {
+		lines = append(lines, fmt.Sprintf("2 eni-1 192.0.2.66 10.0.1.5 1234 %d 6 1 40 1714561200 1714561260 REJECT OK", 1000+i))
+	}
+
+	var records []Record
+	for _, line := range lines {
+		record, ok, err := ParseRecord(line, format)
+		if assert.NoError(t, err, line) && ok {
+			records = append(records, record)
+		}
+	}
+	assert.Len(t, records, len(lines)-1)
+
+	opts, err := NewOptions(
+		config.MissionEssentialConfig{Ports: []string{"22", "443"}, Protocols: []string{"TCP", "HTTPS"}},
+		config.FlowLogConfig{KnownDestinations: []string{"52.94.0.0/16"}},
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	report := Analyze(records, opts)
+
+	if assert.Len(t, report.NonEssential, 2) {
+		assert.Equal(t, "icmp: 1 flows, 84 B (10.0.1.5 -> 10.0.2.9)", report.NonEssential[0].String())
+		assert.Equal(t, "tcp/8080: 1 flows, 700 B (10.0.1.5 -> 10.0.2.9)", report.NonEssential[1].String())
+	}
+	if assert.Len(t, report.Spikes, 1) {
+		assert.Equal(t, 150, report.Spikes[0].Rejected)
+		assert.Equal(t, []string{"192.0.2.66"}, report.Spikes[0].Sources)
+	}
+	if assert.Len(t, report.Egress, 1) {
+		assert.Equal(t, "203.0.113.9: 200.0 MB in 1 flows from 10.0.1.5", report.Egress[0].String())
+	}
+}
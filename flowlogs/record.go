@@ -0,0 +1,126 @@
+// Package flowlogs reads VPC Flow Log records from CloudWatch Logs or from local exports and compares the
+// observed traffic with the mission-essential ports and protocols: flows on other ports, spikes of rejected
+// traffic and large transfers to unknown destinations.
+package flowlogs
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions of a record
+const (
+	ActionAccept = "ACCEPT"
+	ActionReject = "REJECT"
+)
+
+// DefaultFormat are the fields of the default (version 2) flow log format
+var DefaultFormat = []string{
+	"version", "account-id", "interface-id", "srcaddr", "dstaddr", "srcport", "dstport",
+	"protocol", "packets", "bytes", "start", "end", "action", "log-status",
+}
+
+// Record is a flow log record
+type Record struct {
+	Interface string
+	Source    netip.Addr
+	Dest      netip.Addr
+	SrcPort   int32
+	DstPort   int32
+	Protocol  int
+	Packets   int64
+	Bytes     int64
+	Start     time.Time
+	End       time.Time
+	Action    string
+	Direction string // ingress or egress, only with the flow-direction field
+}
+
+// ServicePort returns the port of the service of the flow, the lower of the two ports, or 0 for
+// protocols without ports
+func (r Record) ServicePort() int32 {
+	if r.SrcPort == 0 || r.DstPort == 0 {
+		return max(r.SrcPort, r.DstPort)
+	}
+	return min(r.SrcPort, r.DstPort)
+}
+
+// ParseFormat parses a custom log format as "${version} ${srcaddr} ..." or the header of an export
+// as "version srcaddr ..."
+func ParseFormat(format string) []string {
+	var fields []string
+	for _, field := range strings.Fields(format) {
+		field = strings.TrimSuffix(strings.TrimPrefix(field, "${"), "}")
+		fields = append(fields, strings.ReplaceAll(field, "_", "-"))
+	}
+	if len(fields) == 0 {
+		return DefaultFormat
+	}
+	return fields
+}
+
+// ParseRecord parses a line with the given fields. Lines without data (NODATA, SKIPDATA) return false.
+func ParseRecord(line string, format []string) (Record, bool, error) {
+	values := strings.Fields(line)
+	if len(values) != len(format) {
+		return Record{}, false, fmt.Errorf("expected %d fields, found %d", len(format), len(values))
+	}
+
+	var r Record
+	for i, field := range format {
+		value := values[i]
+		if value == "-" {
+			continue
+		}
+		var err error
+		switch field {
+		case "interface-id":
+			r.Interface = value
+		case "srcaddr":
+			r.Source, err = netip.ParseAddr(value)
+		case "dstaddr":
+			r.Dest, err = netip.ParseAddr(value)
+		case "srcport":
+			r.SrcPort, err = parseInt32(value)
+		case "dstport":
+			r.DstPort, err = parseInt32(value)
+		case "protocol":
+			r.Protocol, err = strconv.Atoi(value)
+		case "packets":
+			r.Packets, err = strconv.ParseInt(value, 10, 64)
+		case "bytes":
+			r.Bytes, err = strconv.ParseInt(value, 10, 64)
+		case "start":
+			r.Start, err = parseUnix(value)
+		case "end":
+			r.End, err = parseUnix(value)
+		case "action":
+			r.Action = value
+		case "flow-direction":
+			r.Direction = value
+		}
+		if err != nil {
+			return Record{}, false, fmt.Errorf("invalid %s %q: %v", field, value, err)
+		}
+	}
+	if r.Action == "" || !r.Source.IsValid() || !r.Dest.IsValid() {
+		return Record{}, false, nil
+	}
+	return r, true, nil
+}
+
+func parseInt32(value string) (int32, error) {
+	n, err := strconv.ParseInt(value, 10, 32)
+	return int32(n), err
+}
+
+func parseUnix(value string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
@@ -0,0 +1,260 @@
+package flowlogs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud_compliance_checker/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Defaults of the flow log sources
+const (
+	defaultHours      = 24
+	defaultMaxRecords = 100000
+)
+
+// Load reads the records of the configured local exports and of the CloudWatch Logs groups of the last
+// flow_logs.hours. Without configured log groups it reads the CloudWatch Logs destinations of the flow logs.
+// Sources that fail are skipped and reported in the error.
+func Load(cfg aws.Config) ([]Record, error) {
+	flowCfg := config.AppConfig.AWS.FlowLogs
+	hours := flowCfg.Hours
+	if hours <= 0 {
+		hours = defaultHours
+	}
+	maxRecords := flowCfg.MaxRecords
+	if maxRecords <= 0 {
+		maxRecords = defaultMaxRecords
+	}
+
+	var records []Record
+	var errs []error
+	for _, path := range flowCfg.Files {
+		found, err := ReadFile(path)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		records = append(records, found...)
+	}
+
+	groups, err := logGroups(cfg, flowCfg.LogGroups)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	for group, format := range groups {
+		found, err := readLogGroup(cfg, group, format, since, maxRecords)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		records = append(records, found...)
+	}
+
+	if len(records) == 0 && len(errs) == 0 {
+		return nil, fmt.Errorf("no flow log records found")
+	}
+	return records, errors.Join(errs...)
+}
+
+// logGroups returns the CloudWatch Logs groups to read with their log format
+func logGroups(cfg aws.Config, configured []string) (map[string][]string, error) {
+	formats := map[string][]string{}
+	var err error
+	paginator := ec2.NewDescribeFlowLogsPaginator(ec2.NewFromConfig(cfg), &ec2.DescribeFlowLogsInput{})
+	for paginator.HasMorePages() {
+		page, pageErr := paginator.NextPage(context.TODO())
+		if pageErr != nil {
+			err = fmt.Errorf("failed to describe flow logs: %v", pageErr)
+			break
+		}
+		for _, flowLog := range page.FlowLogs {
+			if flowLog.LogDestinationType != ec2types.LogDestinationTypeCloudWatchLogs || flowLog.LogGroupName == nil {
+				continue
+			}
+			formats[aws.ToString(flowLog.LogGroupName)] = ParseFormat(aws.ToString(flowLog.LogFormat))
+		}
+	}
+
+	if len(configured) == 0 {
+		return formats, err
+	}
+	groups := map[string][]string{}
+	for _, group := range configured {
+		format, ok := formats[group]
+		if !ok {
+			format = DefaultFormat
+		}
+		groups[group] = format
+	}
+	// The configured groups can be read with the default format even if the flow logs can't be described
+	return groups, nil
+}
+
+// logGroupWindow is the period of a log group read at a time, from the newest to the oldest
+const logGroupWindow = time.Hour
+
+// logEventFilter is the part of the CloudWatch Logs client used to read the log groups
+type logEventFilter interface {
+	FilterLogEvents(ctx context.Context, params *cloudwatchlogs.FilterLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.FilterLogEventsOutput, error)
+}
+
+// readLogGroup reads the newest maxRecords records of a log group since the given time
+func readLogGroup(cfg aws.Config, group string, format []string, since time.Time, maxRecords int) ([]Record, error) {
+	return readNewest(context.TODO(), cloudwatchlogs.NewFromConfig(cfg), group, format, since, time.Now(), maxRecords)
+}
+
+// readNewest reads a log group one window at a time going back from until, so that the records kept
+// when there are more than maxRecords are the newest ones. Records are returned oldest first.
+func readNewest(ctx context.Context, client logEventFilter, group string, format []string, since, until time.Time, maxRecords int) ([]Record, error) {
+	var records []Record
+	invalid := 0
+	for end := until; end.After(since) && len(records) < maxRecords; end = end.Add(-logGroupWindow) {
+		start := end.Add(-logGroupWindow)
+		if start.Before(since) {
+			start = since
+		}
+		window, skipped, err := readWindow(ctx, client, group, format, start, end, maxRecords-len(records))
+		invalid += skipped
+		records = append(window, records...)
+		if err != nil {
+			return records, err
+		}
+	}
+	if invalid > 0 {
+		log.Printf("Skipped %d invalid flow log records in %s\n", invalid, group)
+	}
+	log.Printf("Read %d flow log records from %s\n", len(records), group)
+	return records, nil
+}
+
+// readWindow reads the records of a log group from start to end, excluded, and keeps the newest limit ones.
+// It returns the number of invalid records skipped.
+func readWindow(ctx context.Context, client logEventFilter, group string, format []string, start, end time.Time, limit int) ([]Record, int, error) {
+	var records []Record
+	invalid := 0
+	paginator := cloudwatchlogs.NewFilterLogEventsPaginator(client, &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName: aws.String(group),
+		StartTime:    aws.Int64(start.UnixMilli()),
+		EndTime:      aws.Int64(end.UnixMilli() - 1),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return keepNewest(records, limit), invalid, fmt.Errorf("failed to read log group %s: %v", group, err)
+		}
+		for _, event := range page.Events {
+			record, ok, err := ParseRecord(aws.ToString(event.Message), format)
+			if err != nil {
+				invalid++
+				continue
+			}
+			if ok {
+				records = append(records, record)
+			}
+		}
+		// Events come oldest first: drop the older ones as the window is read
+		if len(records) > 2*limit {
+			records = keepNewest(records, limit)
+		}
+	}
+	return keepNewest(records, limit), invalid, nil
+}
+
+// keepNewest returns the last limit records
+func keepNewest(records []Record, limit int) []Record {
+	if len(records) <= limit {
+		return records
+	}
+	return append([]Record(nil), records[len(records)-limit:]...)
+}
+
+// ReadFile reads a local export, plain text or gzip. A first line starting with a field name is the
+// header of the export, otherwise the records use the default format.
+func ReadFile(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var input io.Reader = reader
+	if magic, err := reader.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		defer gz.Close()
+		input = gz
+	}
+
+	var records []Record
+	format := DefaultFormat
+	invalid := 0
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for first := true; scanner.Scan(); first = false {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if first && (line[0] < '0' || line[0] > '9') {
+			format = ParseFormat(line)
+			continue
+		}
+		record, ok, err := ParseRecord(line, format)
+		if err != nil {
+			invalid++
+			continue
+		}
+		if ok {
+			records = append(records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return records, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if invalid > 0 {
+		log.Printf("Skipped %d invalid flow log records in %s\n", invalid, path)
+	}
+	log.Printf("Read %d flow log records from %s\n", len(records), path)
+	return records, nil
+}
+
+// cacheTTL is how long the records are reused by the checks of the same evaluation
+const cacheTTL = 10 * time.Minute
+
+var (
+	recordsMu     sync.Mutex
+	cachedRecords []Record
+	cachedErr     error
+	recordsAt     time.Time
+)
+
+// Cached returns the records loaded in the last cacheTTL, or loads them
+func Cached(cfg aws.Config) ([]Record, error) {
+	recordsMu.Lock()
+	defer recordsMu.Unlock()
+
+	if !recordsAt.IsZero() && time.Since(recordsAt) < cacheTTL {
+		return cachedRecords, cachedErr
+	}
+	cachedRecords, cachedErr = Load(cfg)
+	recordsAt = time.Now()
+	return cachedRecords, cachedErr
+}
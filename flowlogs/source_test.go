@@ -0,0 +1,69 @@
+package flowlogs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	logtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLogGroup returns the events between StartTime and EndTime, oldest first, two per page
+type fakeLogGroup struct {
+	events []logtypes.FilteredLogEvent
+}
+
+func (f fakeLogGroup) FilterLogEvents(ctx context.Context, params *cloudwatchlogs.FilterLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	var matching []logtypes.FilteredLogEvent
+	for _, event := range f.events {
+		if ts := aws.ToInt64(event.Timestamp); ts >= aws.ToInt64(params.StartTime) && ts <= aws.ToInt64(params.EndTime) {
+			matching = append(matching, event)
+		}
+	}
+
+	offset := 0
+	if params.NextToken != nil {
+		offset, _ = strconv.Atoi(*params.NextToken)
+	}
+	end := offset + 2
+	output := &cloudwatchlogs.FilterLogEventsOutput{}
+	if end < len(matching) {
+		output.NextToken = aws.String(strconv.Itoa(end))
+	} else {
+		end = len(matching)
+	}
+	output.Events = matching[offset:end]
+	return output, nil
+}
+
+func TestReadNewest(t *testing.T) {
+	until := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	since := until.Add(-6 * time.Hour)
+
+	// One record every 20 minutes for 6 hours, the destination port is the minute from since
+	var group fakeLogGroup
+	for minutes := 0; minutes < 360; minutes += 20 {
+		at := since.Add(time.Duration(minutes) * time.Minute)
+		group.events = append(group.events, logtypes.FilteredLogEvent{
+			Timestamp: aws.Int64(at.UnixMilli()),
+			Message:   aws.String(fmt.Sprintf("2 123456789012 eni-1 10.0.1.5 10.0.2.9 40000 %d 6 1 40 %d %d ACCEPT OK", minutes, at.Unix(), at.Unix()+60)),
+		})
+	}
+
+	records, err := readNewest(context.TODO(), group, "flows", DefaultFormat, since, until, 5)
+	assert.NoError(t, err)
+	var ports []int32
+	for _, record := range records {
+		ports = append(ports, record.DstPort)
+	}
+	assert.Equal(t, []int32{260, 280, 300, 320, 340}, ports)
+
+	records, err = readNewest(context.TODO(), group, "flows", DefaultFormat, since, until, 1000)
+	assert.NoError(t, err)
+	assert.Len(t, records, 18)
+}
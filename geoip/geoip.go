@@ -0,0 +1,189 @@
+// Package geoip geolocates IP addresses with an offline database: a CSV file of networks with their
+// country, autonomous system and coordinates, such as the free IPinfo, DB-IP or MaxMind exports.
+package geoip
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Location is the location and the network owner of an IP address
+type Location struct {
+	Country        string  // ISO 3166 code
+	ASN            string  // such as AS16509
+	Organization   string  // name of the autonomous system
+	Latitude       float64 // valid when HasCoordinates
+	Longitude      float64
+	HasCoordinates bool
+}
+
+// network is a range of addresses of the database
+type network struct {
+	first, last netip.Addr
+	location    Location
+}
+
+// DB is a GeoIP database
+type DB struct {
+	networks []network // sorted by first address
+}
+
+// columns are the accepted names of the columns of the CSV header
+var columns = map[string][]string{
+	"network":   {"network", "cidr", "prefix"},
+	"first":     {"start_ip", "ip_start", "first_ip", "range_start"},
+	"last":      {"end_ip", "ip_end", "last_ip", "range_end"},
+	"country":   {"country_code", "country", "country_iso_code"},
+	"asn":       {"asn", "autonomous_system_number"},
+	"org":       {"as_name", "organization", "org", "autonomous_system_organization"},
+	"latitude":  {"latitude", "lat"},
+	"longitude": {"longitude", "lon", "lng"},
+}
+
+// Load reads a CSV database with a header. Each row has a network in CIDR notation, or its first and
+// last address, and any of country, ASN, organization, latitude and longitude.
+func Load(path string) (*DB, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database: %v", err)
+	}
+	defer file.Close()
+	db, err := Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GeoIP database %s: %v", path, err)
+	}
+	return db, nil
+}
+
+// Read reads a CSV database
+func Read(r io.Reader) (*DB, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for name, aliases := range columns {
+		index[name] = -1
+		for i, column := range header {
+			column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+			for _, alias := range aliases {
+				if column == alias && index[name] < 0 {
+					index[name] = i
+				}
+			}
+		}
+	}
+	if index["network"] < 0 && (index["first"] < 0 || index["last"] < 0) {
+		return nil, fmt.Errorf("the header has neither a network column nor start_ip and end_ip")
+	}
+
+	db := &DB{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i := index[name]; i >= 0 && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		var n network
+		if cidr := field("network"); cidr != "" {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid network %s", line, cidr)
+			}
+			n.first, n.last = prefix.Masked().Addr(), lastAddr(prefix.Masked())
+		} else {
+			if n.first, err = netip.ParseAddr(field("first")); err != nil {
+				return nil, fmt.Errorf("line %d: invalid start address %s", line, field("first"))
+			}
+			if n.last, err = netip.ParseAddr(field("last")); err != nil {
+				return nil, fmt.Errorf("line %d: invalid end address %s", line, field("last"))
+			}
+		}
+		n.first, n.last = n.first.Unmap(), n.last.Unmap()
+
+		n.location = Location{Country: strings.ToUpper(field("country")), Organization: field("org")}
+		if asn := field("asn"); asn != "" {
+			n.location.ASN = "AS" + strings.TrimPrefix(strings.ToUpper(asn), "AS")
+		}
+		lat, latErr := strconv.ParseFloat(field("latitude"), 64)
+		lon, lonErr := strconv.ParseFloat(field("longitude"), 64)
+		if latErr == nil && lonErr == nil {
+			n.location.Latitude, n.location.Longitude, n.location.HasCoordinates = lat, lon, true
+		}
+		db.networks = append(db.networks, n)
+	}
+	sort.SliceStable(db.networks, func(i, j int) bool { return db.networks[i].first.Less(db.networks[j].first) })
+	return db, nil
+}
+
+// lastAddr returns the last address of a network
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	bytes := prefix.Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(bytes)*8; bit++ {
+		bytes[bit/8] |= 0x80 >> (bit % 8)
+	}
+	addr, _ := netip.AddrFromSlice(bytes)
+	return addr
+}
+
+// Lookup returns the location of an IP address. Service names, such as the source of the requests made
+// by AWS services, are not found.
+func (db *DB) Lookup(ip string) (Location, bool) {
+	if db == nil {
+		return Location{}, false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Location{}, false
+	}
+	addr = addr.Unmap()
+	// The last network starting at or before the address
+	i := sort.Search(len(db.networks), func(i int) bool { return addr.Less(db.networks[i].first) }) - 1
+	if i < 0 || db.networks[i].last.Less(addr) || db.networks[i].first.BitLen() != addr.BitLen() {
+		return Location{}, false
+	}
+	return db.networks[i].location, true
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = map[string]*DB{}
+)
+
+// Cached returns the database of a file, loading it on the first call. An empty path returns a nil
+// database, whose lookups find nothing.
+func Cached(path string) (*DB, error) {
+	if path == "" {
+		return nil, nil
+	}
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if db, ok := cache[path]; ok {
+		return db, nil
+	}
+	db, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	cache[path] = db
+	return db, nil
+}
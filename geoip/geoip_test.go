@@ -0,0 +1,35 @@
+package geoip
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookup(t *testing.T) {
+	db, err := Read(strings.NewReader("start_ip,end_ip,country,asn,organization,lat,lon\n" +
+		"198.51.100.0,198.51.100.127,us,AS64500,Example Telecom,38.9,-77.0\n" +
+		"2001:db8::,2001:db8::ffff,DE,64501,,,\n"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	location, ok := db.Lookup("198.51.100.42")
+	assert.True(t, ok)
+	assert.Equal(t, Location{Country: "US", ASN: "AS64500", Organization: "Example Telecom", Latitude: 38.9, Longitude: -77, HasCoordinates: true}, location)
+
+	location, ok = db.Lookup("2001:db8::1")
+	assert.True(t, ok)
+	assert.Equal(t, Location{Country: "DE", ASN: "AS64501"}, location)
+
+	for _, ip := range []string{"198.51.100.200", "203.0.113.1", "::ffff:198.51.100.255", "ec2.amazonaws.com"} {
+		_, ok = db.Lookup(ip)
+		assert.False(t, ok, ip)
+	}
+	_, ok = (*DB)(nil).Lookup("198.51.100.42")
+	assert.False(t, ok)
+
+	_, err = Read(strings.NewReader("country,asn\nUS,64500\n"))
+	assert.Error(t, err)
+}
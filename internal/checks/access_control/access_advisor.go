@@ -0,0 +1,198 @@
+package iampolicy
+
+import (
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/policy"
+	"cloud_compliance_checker/scope"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// Defaults of the unused permissions analysis
+const (
+	defaultUnusedDays = 90
+	defaultPolicyDir  = "right_sized_policies"
+)
+
+// accessAdvisorPoll is the interval between the polls of an access advisor job
+const accessAdvisorPoll = 2 * time.Second
+
+// accessAdvisorTimeout is the maximum wait for an access advisor job
+const accessAdvisorTimeout = 2 * time.Minute
+
+// RunUnusedPermissionsCheck uses the IAM access advisor (service and action last accessed) to find the
+// permissions of every user and role not used in the configured number of days, and writes a right-sized
+// replacement policy for each principal with unused permissions.
+// 03.01.05 Least Privilege
+func RunUnusedPermissionsCheck(cfg aws.Config) error {
+	lp := config.AppConfig.AWS.LeastPrivilege
+	days := lp.UnusedDays
+	if days <= 0 {
+		days = defaultUnusedDays
+	}
+	dir := lp.PolicyDir
+	if dir == "" {
+		dir = defaultPolicyDir
+	}
+
+	account, err := policy.CachedAccount(cfg)
+	if err != nil {
+		return LogAndReturnError("unable to load the IAM policies of the account", err)
+	}
+
+	ctx := context.TODO()
+	client := iam.NewFromConfig(cfg)
+	since := time.Now().AddDate(0, 0, -days)
+
+	var findings []string
+	for _, entity := range account.Entities {
+		if isExcludedPrincipal(entity, lp.Exclude) || !scope.Includes(cfg, entityAssetType(entity), entity.Name) {
+			continue
+		}
+		if entity.Created != nil && entity.Created.After(since) {
+			log.Printf("Skipping %s %s: created less than %d days ago\n", entity.Type, entity.Name, days)
+			continue
+		}
+
+		usage, err := lastAccessed(ctx, client, entity.ARN, since)
+		if err != nil {
+			return fmt.Errorf("unable to read the access advisor data of %s: %v", entity.Name, err)
+		}
+
+		set := account.PolicySet(entity, "")
+		rightSized, unused := policy.DefaultCatalog().RightSize(entity.Name, set.Identity, usage)
+		if len(unused) == 0 {
+			log.Printf("%s %s uses all its permissions\n", entity.Type, entity.Name)
+			continue
+		}
+
+		finding := fmt.Sprintf("%s %s: %d permission(s) unused for %d days (%s)",
+			entity.Type, entity.Name, len(unused), days, summarizeActions(unused, 5))
+		if rightSized == nil {
+			finding += ", no permission used: the identity policies can be detached"
+		} else {
+			path, err := writeRightSizedPolicy(dir, entity, rightSized)
+			if err != nil {
+				return err
+			}
+			finding += ", right-sized policy " + path
+		}
+		log.Println(finding)
+		findings = append(findings, finding)
+	}
+
+	if len(findings) > 0 {
+		return fmt.Errorf("unused permissions found:\n%s", strings.Join(findings, "\n"))
+	}
+	log.Println("No unused permissions found")
+	return nil
+}
+
+// isExcludedPrincipal checks if a principal is excluded from the analysis
+func isExcludedPrincipal(entity *policy.Entity, exclude []string) bool {
+	// Service-linked roles are managed by AWS
+	if entity.ServiceLinked() {
+		return true
+	}
+	return ContainsString(exclude, entity.Name)
+}
+
+// entityAssetType returns the asset type of a principal
+func entityAssetType(entity *policy.Entity) string {
+	if entity.Type == policy.EntityRole {
+		return models.AssetTypeIAMRole
+	}
+	return models.AssetTypeIAMUser
+}
+
+// lastAccessed runs an action-level access advisor job for the principal and returns its results
+func lastAccessed(ctx context.Context, client *iam.Client, arn string, since time.Time) (policy.AccessData, error) {
+	usage := policy.AccessData{Since: since, Services: make(map[string]*policy.ServiceAccess)}
+
+	job, err := client.GenerateServiceLastAccessedDetails(ctx, &iam.GenerateServiceLastAccessedDetailsInput{
+		Arn:         aws.String(arn),
+		Granularity: iamtypes.AccessAdvisorUsageGranularityTypeActionLevel,
+	})
+	if err != nil {
+		return usage, fmt.Errorf("failed to start access advisor job: %v", err)
+	}
+
+	deadline := time.Now().Add(accessAdvisorTimeout)
+	var marker *string
+	for {
+		output, err := client.GetServiceLastAccessedDetails(ctx, &iam.GetServiceLastAccessedDetailsInput{
+			JobId:  job.JobId,
+			Marker: marker,
+		})
+		if err != nil {
+			return usage, fmt.Errorf("failed to get access advisor job: %v", err)
+		}
+
+		switch output.JobStatus {
+		case iamtypes.JobStatusTypeInProgress:
+			if time.Now().After(deadline) {
+				return usage, fmt.Errorf("access advisor job %s timed out", aws.ToString(job.JobId))
+			}
+			time.Sleep(accessAdvisorPoll)
+			continue
+		case iamtypes.JobStatusTypeFailed:
+			message := "unknown error"
+			if output.Error != nil {
+				message = aws.ToString(output.Error.Message)
+			}
+			return usage, fmt.Errorf("access advisor job failed: %s", message)
+		}
+
+		for _, service := range output.ServicesLastAccessed {
+			namespace := strings.ToLower(aws.ToString(service.ServiceNamespace))
+			access := &policy.ServiceAccess{Namespace: namespace, LastAccessed: service.LastAuthenticated}
+			if len(service.TrackedActionsLastAccessed) > 0 {
+				access.Actions = make(map[string]*time.Time)
+				for _, action := range service.TrackedActionsLastAccessed {
+					access.Actions[strings.ToLower(aws.ToString(action.ActionName))] = action.LastAccessedTime
+				}
+			}
+			usage.Services[namespace] = access
+		}
+
+		if !output.IsTruncated {
+			return usage, nil
+		}
+		marker = output.Marker
+	}
+}
+
+// writeRightSizedPolicy writes the right-sized policy of a principal and returns its path
+func writeRightSizedPolicy(dir string, entity *policy.Entity, doc *policy.Document) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", dir, err)
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode right-sized policy of %s: %v", entity.Name, err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s_%s.json", entity.Type, entity.Name))
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return path, nil
+}
+
+// summarizeActions lists the first actions and the number of the others
+func summarizeActions(actions []string, max int) string {
+	if len(actions) <= max {
+		return strings.Join(actions, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(actions[:max], ", "), len(actions)-max)
+}
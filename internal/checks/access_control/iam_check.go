@@ -2,9 +2,15 @@ package iampolicy
 
 import (
 	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/credreport"
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/policy"
+	"cloud_compliance_checker/scope"
 	"context"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
@@ -19,6 +25,7 @@ type IAMCheck struct {
 	S3Client         *s3.Client
 	IAMClient        *iam.Client
 	CloudTrailClient *cloudtrail.Client
+	Config           *aws.Config
 }
 
 // NewIAMCheck initializes a new IAMCheck struct with the provided AWS configuration
@@ -27,6 +34,7 @@ func NewIAMCheck(cfg aws.Config) *IAMCheck {
 		EC2Client: ec2.NewFromConfig(cfg),
 		S3Client:  s3.NewFromConfig(cfg),
 		IAMClient: iam.NewFromConfig(cfg),
+		Config:    &cfg,
 	}
 }
 
@@ -45,6 +53,9 @@ func RunCheckPolicies(cfg aws.Config) error {
 	var nonConformingUsers []string
 
 	for _, awsUser := range listUsersOutput.Users {
+		if !scope.Includes(cfg, models.AssetTypeIAMUser, *awsUser.UserName) {
+			continue
+		}
 		log.Printf("=======> Check for AWS user: %s\n", *awsUser.UserName)
 		attachedPoliciesOutput, err := iamclient.ListAttachedUserPolicies(context.TODO(), &iam.ListAttachedUserPoliciesInput{
 			UserName: awsUser.UserName,
@@ -98,14 +109,65 @@ func RunCheckPolicies(cfg aws.Config) error {
 		}
 	}
 
-	// If there are non-conforming users, return an error
+	// Check the credentials of the accounts with the IAM credential report
+	issues, err := credentialIssues(cfg, usersFromConfig)
+	if err != nil {
+		return LogAndReturnError("unable to analyze the credential report", err)
+	}
+
+	// Report the policy and the credential issues together
+	var problems []string
 	if len(nonConformingUsers) > 0 {
-		return fmt.Errorf("non-conforming users found: %v", nonConformingUsers)
+		problems = append(problems, fmt.Sprintf("non-conforming users found: %v", nonConformingUsers))
+	}
+	if len(issues) > 0 {
+		problems = append(problems, fmt.Sprintf("account credential issues found:\n%s", strings.Join(issues, "\n")))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "\n"))
 	}
 
 	return nil
 }
 
+// credentialIssues evaluates the credential report: password and access key age and use, root access keys,
+// console access without MFA and inactive users. The identifier_status declared in the configuration
+// is compared with the status derived from the report.
+func credentialIssues(cfg aws.Config, usersFromConfig []config.User) ([]string, error) {
+	report, err := credreport.Cached(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	thresholds := credreport.ConfiguredThresholds()
+
+	var issues []string
+	for _, finding := range report.Evaluate(thresholds, now) {
+		if finding.User != credreport.RootUser && !scope.Includes(cfg, models.AssetTypeIAMUser, finding.User) {
+			continue
+		}
+		log.Printf("ERROR: %s\n", finding)
+		issues = append(issues, finding.String())
+	}
+
+	for _, user := range usersFromConfig {
+		if user.IdentifierStatus == "" || !scope.Includes(cfg, models.AssetTypeIAMUser, user.Name) {
+			continue
+		}
+		entry, ok := report.Entry(user.Name)
+		if !ok {
+			continue
+		}
+		if status := entry.Status(thresholds.InactiveDays, now); !strings.EqualFold(status, user.IdentifierStatus) {
+			issue := fmt.Sprintf("%s: declared %s in the configuration but %s according to the credential report", user.Name, user.IdentifierStatus, status)
+			log.Printf("ERROR: %s\n", issue)
+			issues = append(issues, issue)
+		}
+	}
+	return issues, nil
+}
+
 // RunCheckAcceptedPolicies checks if the accepted policies are present on AWS
 // 03.01.02 Access Enforcement
 func (c *IAMCheck) RunCheckAcceptedPolicies() error {
@@ -153,7 +215,7 @@ func RunCheckCUIFlow(cfg aws.Config) error {
 	}
 
 	// Pass the loaded data to the RunSecurityGroupCheck function
-	if err := RunSecurityGroupCheck(securityGroupsFromConfig, describeSGOutput.SecurityGroups); err != nil {
+	if err := RunSecurityGroupCheck(securityGroupsFromConfig, inScopeSecurityGroups(cfg, describeSGOutput.SecurityGroups)); err != nil {
 		return LogAndReturnError("error during security group check", err)
 	}
 
@@ -172,12 +234,12 @@ func RunCheckCUIFlow(cfg aws.Config) error {
 func (c *IAMCheck) RunCheckSeparateDuties() error {
 	criticalRoles := config.AppConfig.AWS.CriticalRoles
 
-	listRolesOutput, err := c.IAMClient.ListRoles(context.TODO(), &iam.ListRolesInput{})
+	account, err := policy.CachedAccount(*c.Config)
 	if err != nil {
-		return LogAndReturnError("unable to list IAM roles on AWS", err)
+		return LogAndReturnError("unable to load the IAM policies of the account", err)
 	}
 
-	roleFunctionMap := MapRolesToFunctions(listRolesOutput.Roles, c.IAMClient)
+	roleFunctionMap := MapRolesToFunctions(account)
 
 	for _, criticalRole := range criticalRoles {
 		if err := VerifyCriticalRoleCompliance(criticalRole, roleFunctionMap); err != nil {
@@ -189,40 +251,53 @@ func (c *IAMCheck) RunCheckSeparateDuties() error {
 	return nil
 }
 
-// RunPrivilegeCheck performs the check for privileges
+// RunPrivilegeCheck performs the check for privileges: the security functions declared for each user
+// must be granted by its effective permissions, and no other security function must be granted (least privilege)
 // 3.0.5
 func (c *IAMCheck) RunPrivilegeCheck() error {
 	// Load the users and their policies from the configuration
 	usersFromConfig := config.AppConfig.AWS.Users
 
+	account, err := policy.CachedAccount(*c.Config)
+	if err != nil {
+		return LogAndReturnError("unable to load the IAM policies of the account", err)
+	}
+
 	// Check privileges and security functions for each user
 	for _, user := range usersFromConfig {
 		log.Printf("Checking privileges for user: %s\n", user.Name)
 
-		// Check that each security function corresponds to an assigned policy
-		for _, sf := range user.SecurityFunctions {
-			log.Printf("Checking security function %s for user %s\n", sf, user.Name)
-
-			// Variable to determine if a corresponding policy was found
-			found := false
-
-			// Check if there is a policy that covers the security function
-			for _, policy := range user.Policies {
-				log.Printf("Checking policy %s for security function %s\n", policy, sf)
+		entity := account.Entity(user.Name)
+		if entity == nil {
+			log.Printf("ERROR: User %s not found on AWS\n", user.Name)
+			return fmt.Errorf("user %s not found on AWS", user.Name)
+		}
+		held := account.Functions(entity)
+		log.Printf("Security functions granted to user %s: %v\n", user.Name, held)
 
-				if policy == sf {
-					found = true
-					break
-				}
+		// Check that each declared security function is granted by the effective permissions
+		for _, sf := range user.SecurityFunctions {
+			if _, err := policy.FunctionActions(sf); err != nil {
+				return fmt.Errorf("user %s: %v", user.Name, err)
 			}
-
-			// If no corresponding policy is found for the security function, log the error
-			if !found {
+			if !ContainsString(held, sf) {
 				log.Printf("ERROR: Security function %s for user %s is not covered by any policy\n", sf, user.Name)
-				return fmt.Errorf("security functions not compliant for user %s", user.Name)
+				return fmt.Errorf("security function %s declared for user %s is not granted by its policies", sf, user.Name)
 			}
 		}
 
+		// Check that no undeclared security function is granted. The SSM agent channel (SSMCoreAccess)
+		// is not a privilege and doesn't need to be declared.
+		var undeclared []string
+		for _, sf := range held {
+			if !policy.Covers(user.SecurityFunctions, sf) && policy.Privileged(sf) {
+				undeclared = append(undeclared, sf)
+			}
+		}
+		if len(undeclared) > 0 {
+			log.Printf("ERROR: User %s holds undeclared security functions: %v\n", user.Name, undeclared)
+			return fmt.Errorf("least privilege violated: user %s holds undeclared security functions %v", user.Name, undeclared)
+		}
 	}
 
 	return nil
@@ -1,6 +1,9 @@
 package iampolicy
 
 import (
+	"cloud_compliance_checker/discovery"
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/scope"
 	"context"
 	"fmt"
 	"log"
@@ -18,6 +21,7 @@ type RemoteAccessCheck struct {
 	EC2Client *ec2.Client
 	SSMClient *ssm.Client
 	IAMClient *iam.Client
+	Config    *aws.Config
 }
 
 // NewRemoteAccessCheck inizializza un nuovo controllo di accesso remoto.
@@ -26,6 +30,7 @@ func NewRemoteAccessCheck(cfg aws.Config) *RemoteAccessCheck {
 		EC2Client: ec2.NewFromConfig(cfg),
 		SSMClient: ssm.NewFromConfig(cfg),
 		IAMClient: iam.NewFromConfig(cfg),
+		Config:    &cfg,
 	}
 }
 
@@ -44,6 +49,9 @@ func (c *RemoteAccessCheck) RunRemoteAccessCheck() error {
 
 	for _, reservation := range describeInstancesOutput.Reservations {
 		for _, instance := range reservation.Instances {
+			if c.Config != nil && !scope.Includes(*c.Config, models.AssetTypeEC2Instance, *instance.InstanceId) {
+				continue
+			}
 			log.Printf("Verifica istanza: %s\n", *instance.InstanceId)
 
 			securityGroups := instance.SecurityGroups
@@ -59,7 +67,7 @@ func (c *RemoteAccessCheck) RunRemoteAccessCheck() error {
 					log.Printf("Accesso remoto autorizzato per l'istanza %s\n", *instance.InstanceId)
 				} else {
 					log.Printf("ERRORE: Accesso remoto non autorizzato per l'istanza %s\n", *instance.InstanceId)
-					return fmt.Errorf("istanza %s non conforme per l'accesso remoto", *instance.InstanceId)
+					return fmt.Errorf("istanza %s non conforme per l'accesso remoto%s", *instance.InstanceId, c.blastRadius(*instance.InstanceId))
 				}
 			}
 
@@ -89,6 +97,26 @@ func (c *RemoteAccessCheck) RunRemoteAccessCheck() error {
 	return nil
 }
 
+// blastRadius descrive le risorse raggiungibili da un'istanza compromessa (ruoli, policy, chiavi),
+// usando il grafo degli asset. Restituisce una stringa vuota se il grafo non è disponibile.
+func (c *RemoteAccessCheck) blastRadius(instanceID string) string {
+	if c.Config == nil {
+		return ""
+	}
+	graph, err := discovery.CachedGraph(*c.Config)
+	if graph == nil {
+		log.Printf("Impossibile costruire il grafo degli asset: %v\n", err)
+		return ""
+	}
+
+	radius := graph.BlastRadius(instanceID)
+	if len(radius) == 0 {
+		return ""
+	}
+	log.Printf("Blast radius dell'istanza %s: %v\n", instanceID, discovery.NodeLabels(radius))
+	return fmt.Sprintf(" (blast radius: %v)", discovery.NodeLabels(radius))
+}
+
 // isBastionHostUsed verifica se un'istanza utilizza un bastion host per l'accesso remoto.
 func isBastionHostUsed(instance ec2types.Instance) bool {
 	// Verifica se la subnet dell'istanza è associata a un bastion host
@@ -0,0 +1,355 @@
+package iampolicy
+
+import (
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/credreport"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/account"
+	accounttypes "github.com/aws/aws-sdk-go-v2/service/account/types"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	cloudtrailtypes "github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// Defaults of the root account assessment
+const (
+	defaultRootUsageDays = 90
+	// maxLookupDays is the history kept by CloudTrail event history
+	maxLookupDays = 90
+	// globalRegion receives the console sign-in and IAM events of the root account
+	globalRegion = "us-east-1"
+)
+
+// defaultAlternateContacts are the alternate contacts required when none is configured
+var defaultAlternateContacts = []string{"SECURITY", "OPERATIONS", "BILLING"}
+
+// RootEvent is a use of the root account recorded by CloudTrail
+type RootEvent struct {
+	ID       string
+	Name     string
+	Source   string
+	SourceIP string
+	Region   string
+	Time     time.Time
+}
+
+// IsConsoleLogin checks if the event is a sign-in to the console
+func (e RootEvent) IsConsoleLogin() bool {
+	return e.Name == "ConsoleLogin"
+}
+
+// String formats the event for the check responses
+func (e RootEvent) String() string {
+	return fmt.Sprintf("%s %s (%s) from %s in %s", e.Time.Format(time.RFC3339), e.Name, e.Source, e.SourceIP, e.Region)
+}
+
+// RunRootAccessKeyCheck fails when the root account has active access keys.
+// 03.01.05 Least Privilege
+func RunRootAccessKeyCheck(cfg aws.Config) error {
+	report, err := credreport.Cached(cfg)
+	if err != nil {
+		return LogAndReturnError("unable to analyze the credential report", err)
+	}
+	root, ok := report.Entry(credreport.RootUser)
+	if !ok {
+		return fmt.Errorf("root account not found in the credential report")
+	}
+
+	var issues []string
+	for i, key := range root.AccessKeys {
+		if !key.Active {
+			continue
+		}
+		lastUsed := "never used"
+		if key.LastUsed != nil {
+			lastUsed = "last used " + key.LastUsed.Format("2006-01-02")
+		}
+		issue := fmt.Sprintf("root account has active access key %d (%s)", i+1, lastUsed)
+		log.Printf("ERROR: %s\n", issue)
+		issues = append(issues, issue)
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("root account access keys found:\n%s", strings.Join(issues, "\n"))
+	}
+
+	log.Println("The root account has no access keys")
+	return nil
+}
+
+// RunRootUsageCheck fails when the root account was used in the configured number of days (console
+// sign-ins and API calls), when the alternate contacts are not configured or when no alarm is raised
+// on the use of the root account.
+// 03.01.06 Least Privilege Privileged Accounts
+func RunRootUsageCheck(cfg aws.Config) error {
+	rc := config.AppConfig.AWS.RootAccount
+	days := rc.UsageDays
+	if days <= 0 {
+		days = defaultRootUsageDays
+	}
+	since := time.Now().AddDate(0, 0, -days)
+
+	var issues []string
+
+	// Console sign-ins known to the credential report, also older than the CloudTrail history
+	if report, err := credreport.Cached(cfg); err != nil {
+		log.Printf("Unable to analyze the credential report: %v\n", err)
+	} else if root, ok := report.Entry(credreport.RootUser); ok && root.PasswordLastUsed != nil && root.PasswordLastUsed.After(since) {
+		issues = append(issues, fmt.Sprintf("root password used on %s", root.PasswordLastUsed.Format("2006-01-02")))
+	}
+
+	// Console sign-ins and API calls recorded by CloudTrail
+	events, err := RootEvents(cfg, since)
+	if err != nil {
+		return LogAndReturnError("unable to look up the root account events", err)
+	}
+	for _, event := range events {
+		if event.IsConsoleLogin() {
+			issues = append(issues, "root console sign-in: "+event.String())
+		} else {
+			issues = append(issues, "root API call: "+event.String())
+		}
+	}
+
+	// Alternate contacts
+	missing, err := missingAlternateContacts(cfg, rc.AlternateContacts)
+	if err != nil {
+		return LogAndReturnError("unable to read the alternate contacts", err)
+	}
+	for _, contact := range missing {
+		issues = append(issues, fmt.Sprintf("%s alternate contact not configured", contact))
+	}
+
+	// Alarm on the use of the root account
+	alarms, err := RootUsageAlarms(cfg)
+	if err != nil {
+		return LogAndReturnError("unable to check the root usage alarms", err)
+	}
+	if len(alarms) == 0 {
+		issues = append(issues, "no CloudWatch alarm with actions on a root usage metric filter")
+	} else {
+		log.Printf("Root usage alarms: %s\n", strings.Join(alarms, ", "))
+	}
+
+	if len(issues) > 0 {
+		for _, issue := range issues {
+			log.Printf("ERROR: %s\n", issue)
+		}
+		return fmt.Errorf("root account issues found in the last %d days:\n%s", days, strings.Join(issues, "\n"))
+	}
+
+	log.Printf("The root account was not used in the last %d days\n", days)
+	return nil
+}
+
+// RunRootMFACheck fails when the root account has no MFA device, or only a virtual one when a
+// hardware device is required.
+// 03.05.03 Multi-Factor Authentication
+func RunRootMFACheck(cfg aws.Config) error {
+	ctx := context.TODO()
+	client := iam.NewFromConfig(cfg)
+
+	summary, err := client.GetAccountSummary(ctx, &iam.GetAccountSummaryInput{})
+	if err != nil {
+		return LogAndReturnError("unable to get the account summary", err)
+	}
+	if summary.SummaryMap["AccountMFAEnabled"] != 1 {
+		return fmt.Errorf("root account without MFA")
+	}
+
+	virtual, err := rootVirtualMFA(ctx, client)
+	if err != nil {
+		return LogAndReturnError("unable to list the virtual MFA devices", err)
+	}
+	if virtual != "" {
+		if !config.AppConfig.AWS.RootAccount.AllowVirtualMFA {
+			return fmt.Errorf("root account uses the virtual MFA device %s, a hardware MFA device is required", virtual)
+		}
+		log.Printf("The root account uses the virtual MFA device %s\n", virtual)
+		return nil
+	}
+
+	log.Println("The root account uses a hardware MFA device")
+	return nil
+}
+
+// rootVirtualMFA returns the serial number of the virtual MFA device of the root account, if any.
+// The MFA devices of the root account are not listed by ListMFADevices: a root account with MFA
+// enabled and no virtual device uses a hardware device or a security key.
+func rootVirtualMFA(ctx context.Context, client *iam.Client) (string, error) {
+	paginator := iam.NewListVirtualMFADevicesPaginator(client, &iam.ListVirtualMFADevicesInput{
+		AssignmentStatus: iamtypes.AssignmentStatusTypeAssigned,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", err
+		}
+		for _, device := range page.VirtualMFADevices {
+			if device.User != nil && strings.HasSuffix(aws.ToString(device.User.Arn), ":root") {
+				return aws.ToString(device.SerialNumber), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// RootEvents returns the console sign-ins and API calls of the root account since the given time,
+// from the CloudTrail event history of the configured region and of us-east-1
+func RootEvents(cfg aws.Config, since time.Time) ([]RootEvent, error) {
+	if oldest := time.Now().AddDate(0, 0, -maxLookupDays); since.Before(oldest) {
+		since = oldest
+	}
+
+	regions := []string{globalRegion}
+	if cfg.Region != "" && cfg.Region != globalRegion {
+		regions = append(regions, cfg.Region)
+	}
+
+	seen := map[string]bool{}
+	var events []RootEvent
+	for _, region := range regions {
+		client := cloudtrail.NewFromConfig(cfg, func(o *cloudtrail.Options) {
+			o.Region = region
+		})
+		paginator := cloudtrail.NewLookupEventsPaginator(client, &cloudtrail.LookupEventsInput{
+			LookupAttributes: []cloudtrailtypes.LookupAttribute{{
+				AttributeKey:   cloudtrailtypes.LookupAttributeKeyUsername,
+				AttributeValue: aws.String("root"),
+			}},
+			StartTime: aws.Time(since),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(context.TODO())
+			if err != nil {
+				return nil, fmt.Errorf("failed to look up events in %s: %v", region, err)
+			}
+			for _, e := range page.Events {
+				event, ok := ParseRootEvent(aws.ToString(e.CloudTrailEvent))
+				if !ok || seen[event.ID] {
+					continue
+				}
+				seen[event.ID] = true
+				events = append(events, event)
+			}
+		}
+	}
+	return events, nil
+}
+
+// cloudTrailRecord holds the fields of a CloudTrail record used to recognize the root usage
+type cloudTrailRecord struct {
+	EventID         string    `json:"eventID"`
+	EventName       string    `json:"eventName"`
+	EventSource     string    `json:"eventSource"`
+	EventType       string    `json:"eventType"`
+	EventTime       time.Time `json:"eventTime"`
+	AWSRegion       string    `json:"awsRegion"`
+	SourceIPAddress string    `json:"sourceIPAddress"`
+	UserIdentity    struct {
+		Type      string `json:"type"`
+		InvokedBy string `json:"invokedBy"`
+	} `json:"userIdentity"`
+}
+
+// ParseRootEvent parses a CloudTrail record and checks if it is a direct use of the root account.
+// Calls made by AWS services on behalf of the root account and service events are not.
+func ParseRootEvent(raw string) (RootEvent, bool) {
+	var record cloudTrailRecord
+	if err := json.Unmarshal([]byte(raw), &record); err != nil {
+		return RootEvent{}, false
+	}
+	if record.UserIdentity.Type != "Root" || record.UserIdentity.InvokedBy != "" || record.EventType == "AwsServiceEvent" {
+		return RootEvent{}, false
+	}
+	return RootEvent{
+		ID:       record.EventID,
+		Name:     record.EventName,
+		Source:   record.EventSource,
+		SourceIP: record.SourceIPAddress,
+		Region:   record.AWSRegion,
+		Time:     record.EventTime,
+	}, true
+}
+
+// missingAlternateContacts returns the required alternate contacts that are not configured
+func missingAlternateContacts(cfg aws.Config, required []string) ([]string, error) {
+	if len(required) == 0 {
+		required = defaultAlternateContacts
+	}
+	client := account.NewFromConfig(cfg)
+
+	var missing []string
+	for _, contact := range required {
+		contactType := accounttypes.AlternateContactType(strings.ToUpper(contact))
+		output, err := client.GetAlternateContact(context.TODO(), &account.GetAlternateContactInput{
+			AlternateContactType: contactType,
+		})
+		if err != nil {
+			var notFound *accounttypes.ResourceNotFoundException
+			if errors.As(err, &notFound) {
+				missing = append(missing, string(contactType))
+				continue
+			}
+			return nil, fmt.Errorf("failed to get the %s alternate contact: %v", contactType, err)
+		}
+		if output.AlternateContact == nil || aws.ToString(output.AlternateContact.EmailAddress) == "" {
+			missing = append(missing, string(contactType))
+		}
+	}
+	return missing, nil
+}
+
+// RootUsageAlarms returns the CloudWatch alarms with actions on the metrics of the log metric filters
+// that match the use of the root account
+func RootUsageAlarms(cfg aws.Config) ([]string, error) {
+	ctx := context.TODO()
+	logsClient := cloudwatchlogs.NewFromConfig(cfg)
+	cwClient := cloudwatch.NewFromConfig(cfg)
+
+	var alarms []string
+	paginator := cloudwatchlogs.NewDescribeMetricFiltersPaginator(logsClient, &cloudwatchlogs.DescribeMetricFiltersInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe the metric filters: %v", err)
+		}
+		for _, filter := range page.MetricFilters {
+			if !IsRootUsagePattern(aws.ToString(filter.FilterPattern)) {
+				continue
+			}
+			for _, transformation := range filter.MetricTransformations {
+				output, err := cwClient.DescribeAlarmsForMetric(ctx, &cloudwatch.DescribeAlarmsForMetricInput{
+					MetricName: transformation.MetricName,
+					Namespace:  transformation.MetricNamespace,
+				})
+				if err != nil {
+					return nil, fmt.Errorf("failed to describe the alarms of %s: %v", aws.ToString(transformation.MetricName), err)
+				}
+				for _, alarm := range output.MetricAlarms {
+					if aws.ToBool(alarm.ActionsEnabled) && len(alarm.AlarmActions) > 0 {
+						alarms = append(alarms, aws.ToString(alarm.AlarmName))
+					}
+				}
+			}
+		}
+	}
+	return alarms, nil
+}
+
+// IsRootUsagePattern checks if a metric filter pattern matches the CloudTrail records of the root account,
+// as in { $.userIdentity.type = "Root" && $.userIdentity.invokedBy NOT EXISTS && $.eventType != "AwsServiceEvent" }
+func IsRootUsagePattern(pattern string) bool {
+	compact := strings.Join(strings.Fields(pattern), "")
+	return strings.Contains(compact, `$.userIdentity.type="Root"`) || strings.Contains(compact, `$.userIdentity.type=Root`)
+}
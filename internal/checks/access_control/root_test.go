@@ -0,0 +1,34 @@
+package iampolicy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRootEvent(t *testing.T) {
+	login := `{"eventID":"e1","eventName":"ConsoleLogin","eventSource":"signin.amazonaws.com","eventType":"AwsConsoleSignIn",
+		"eventTime":"2024-05-01T10:00:00Z","awsRegion":"us-east-1","sourceIPAddress":"203.0.113.10",
+		"userIdentity":{"type":"Root","arn":"arn:aws:iam::111111111111:root"}}`
+	event, ok := ParseRootEvent(login)
+	assert.True(t, ok)
+	assert.True(t, event.IsConsoleLogin())
+	assert.Equal(t, "203.0.113.10", event.SourceIP)
+
+	// Calls of AWS services on behalf of the root account and service events are not root usage
+	invoked := `{"eventID":"e2","eventName":"AssumeRole","eventType":"AwsApiCall","userIdentity":{"type":"Root","invokedBy":"cloudformation.amazonaws.com"}}`
+	_, ok = ParseRootEvent(invoked)
+	assert.False(t, ok)
+	service := `{"eventID":"e3","eventName":"SharedSnapshotCopyInitiated","eventType":"AwsServiceEvent","userIdentity":{"type":"Root"}}`
+	_, ok = ParseRootEvent(service)
+	assert.False(t, ok)
+	user := `{"eventID":"e4","eventName":"ListBuckets","eventType":"AwsApiCall","userIdentity":{"type":"IAMUser"}}`
+	_, ok = ParseRootEvent(user)
+	assert.False(t, ok)
+}
+
+func TestIsRootUsagePattern(t *testing.T) {
+	assert.True(t, IsRootUsagePattern(`{ $.userIdentity.type = "Root" && $.userIdentity.invokedBy NOT EXISTS && $.eventType != "AwsServiceEvent" }`))
+	assert.True(t, IsRootUsagePattern(`{$.userIdentity.type=Root}`))
+	assert.False(t, IsRootUsagePattern(`{ $.errorCode = "AccessDenied" }`))
+}
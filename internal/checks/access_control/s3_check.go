@@ -2,6 +2,8 @@ package iampolicy
 
 import (
 	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/scope"
 	"context"
 	"errors"
 	"fmt"
@@ -41,6 +43,9 @@ func RunS3BucketCheck(cfg aws.Config) error {
 		if awsBucket.Name == nil {
 			continue
 		}
+		if !scope.Includes(cfg, models.AssetTypeS3Bucket, *awsBucket.Name) {
+			continue
+		}
 		log.Printf("Check for S3 bucket: %s\n", *awsBucket.Name)
 
 		_, ok := bucketMap[*awsBucket.Name]
@@ -2,6 +2,8 @@ package iampolicy
 
 import (
 	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/scope"
 	"context"
 	"fmt"
 	"log"
@@ -66,6 +68,17 @@ func RunSecurityGroupCheck(securityGroupsFromConfig []config.SecurityGroup, secu
 	return nil
 }
 
+// inScopeSecurityGroups returns the security groups inside the CUI scope
+func inScopeSecurityGroups(cfg aws.Config, groups []ec2types.SecurityGroup) []ec2types.SecurityGroup {
+	var inScope []ec2types.SecurityGroup
+	for _, group := range groups {
+		if scope.Includes(cfg, models.AssetTypeSecurityGroup, aws.ToString(group.GroupId)) {
+			inScope = append(inScope, group)
+		}
+	}
+	return inScope
+}
+
 // RunCheckCUIFlow performs the compliance checks required for NIST SP 800-171 3.1.3
 func (c *IAMCheck) RunCheckCUIFlow(cfg aws.Config) error {
 
@@ -78,7 +91,7 @@ func (c *IAMCheck) RunCheckCUIFlow(cfg aws.Config) error {
 	}
 
 	// Pass the loaded data to the RunSecurityGroupCheck function
-	if err := RunSecurityGroupCheck(securityGroupsFromConfig, describeSGOutput.SecurityGroups); err != nil {
+	if err := RunSecurityGroupCheck(securityGroupsFromConfig, inScopeSecurityGroups(cfg, describeSGOutput.SecurityGroups)); err != nil {
 		return LogAndReturnError("error during security group check", err)
 	}
 
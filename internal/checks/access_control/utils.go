@@ -2,11 +2,11 @@ package iampolicy
 
 import (
 	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/policy"
 	"context"
 	"fmt"
 	"log"
 
-	"github.com/aws/aws-sdk-go-v2/service/iam"
 	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
@@ -39,18 +39,6 @@ func Contains(list []int, elem int) bool {
 	return false
 }
 
-// mapPolicyToFunction mappa una policy AWS a una funzione sensibile
-func mapPolicyToFunction(policyName string) string {
-	switch policyName {
-	case "IAMFullAccess":
-		return "ManageIAM"
-	case "AmazonEC2FullAccess":
-		return "ManageEC2"
-	default:
-		return ""
-	}
-}
-
 func MapAWSManagedPolicies(policies []iamtypes.Policy) map[string]bool {
 	policiesMap := make(map[string]bool)
 	for _, policy := range policies {
@@ -68,26 +56,14 @@ func MapUsers(usersConfig []config.User) map[string]config.User {
 	return usersMap
 }
 
-// MapRolesToFunctions mappa i ruoli IAM alle funzioni sensibili
-func MapRolesToFunctions(roles []iamtypes.Role, iamClient *iam.Client) map[string][]string {
+// MapRolesToFunctions mappa i ruoli IAM alle funzioni sensibili consentite dai loro permessi effettivi
+func MapRolesToFunctions(account *policy.Account) map[string][]string {
 	roleFunctionMap := make(map[string][]string)
-	for _, role := range roles {
-		listAttachedRolePoliciesOutput, err := iamClient.ListAttachedRolePolicies(context.TODO(), &iam.ListAttachedRolePoliciesInput{
-			RoleName: role.RoleName,
-		})
-		if err != nil {
-			log.Printf("ERRORE: impossibile elencare le policy per il ruolo %s: %v\n", *role.RoleName, err)
+	for _, entity := range account.Entities {
+		if entity.Type != policy.EntityRole {
 			continue
 		}
-
-		var policies []string
-		for _, policy := range listAttachedRolePoliciesOutput.AttachedPolicies {
-			function := mapPolicyToFunction(*policy.PolicyName)
-			if function != "" {
-				policies = append(policies, function)
-			}
-		}
-		roleFunctionMap[*role.RoleName] = policies
+		roleFunctionMap[entity.Name] = account.Functions(entity)
 	}
 	return roleFunctionMap
 }
@@ -106,6 +82,9 @@ func VerifyCriticalRoleCompliance(criticalRole config.CriticalRole, roleFunction
 	log.Printf("INFO: Funzioni sensibili attese per il ruolo %s: %+v\n", criticalRole.RoleName, criticalRole.SensitiveFunctions)
 
 	for _, sensitiveFunction := range criticalRole.SensitiveFunctions {
+		if _, err := policy.FunctionActions(sensitiveFunction); err != nil {
+			return fmt.Errorf("ruolo critico %s: %v", criticalRole.RoleName, err)
+		}
 		log.Printf("INFO: Controllo della funzione sensibile %s per il ruolo critico %s\n", sensitiveFunction, criticalRole.RoleName)
 		if !ContainsString(policies, sensitiveFunction) {
 			log.Printf("ERRORE: Funzione sensibile %s non assegnata al ruolo critico %s\n", sensitiveFunction, criticalRole.RoleName)
@@ -1,7 +1,6 @@
 package audit_and_accountability
 
 import (
-	"context"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
@@ -9,6 +8,8 @@ import (
 	"os"
 	"time"
 
+	"cloud_compliance_checker/trailstore"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
 	"github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
@@ -38,12 +39,8 @@ func (c *AuditLogCheck) RunAuditLogCheck() error {
 	startTime := time.Now().Add(-c.RetentionPeriod)
 	endTime := time.Now()
 
-	input := &cloudtrail.LookupEventsInput{
-		StartTime: &startTime,
-		EndTime:   &endTime,
-	}
-
-	eventsOutput, err := c.CloudTrailClient.LookupEvents(context.TODO(), input)
+	// Legge gli eventi dallo store locale quando configurato, altrimenti da LookupEvents
+	events, err := trailstore.LookupEvents(c.CloudTrailClient, startTime, endTime)
 	if err != nil {
 		errorMessage := fmt.Sprintf("Errore durante il recupero degli eventi di CloudTrail: %v", err)
 		log.Println(errorMessage)
@@ -51,14 +48,14 @@ func (c *AuditLogCheck) RunAuditLogCheck() error {
 	}
 
 	// Se nessun evento è stato trovato, restituisci un errore
-	if len(eventsOutput.Events) == 0 {
+	if len(events) == 0 {
 		errorMessage := "ERRORE: Nessun evento trovato nei record di audit"
 		log.Println(errorMessage)
 		return fmt.Errorf(errorMessage)
 	}
 
 	// Riduzione dei record di audit per l'analisi
-	reducedEvents := c.ReduceAuditRecords(eventsOutput.Events)
+	reducedEvents := c.ReduceAuditRecords(events)
 
 	// Generazione del report
 	err = c.GenerateAuditReport(reducedEvents)
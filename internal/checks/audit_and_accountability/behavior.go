@@ -0,0 +1,38 @@
+package audit_and_accountability
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"cloud_compliance_checker/anomaly"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// maxReportedAnomalies caps the anomalies listed in the result of the check
+const maxReportedAnomalies = 20
+
+// CheckBehavioralAnomalies scores the recent CloudTrail events of each principal against its behavioral
+// baseline and fails with the anomalies and what deviated
+// 03.03.05
+func CheckBehavioralAnomalies(cfg aws.Config) error {
+	anomalies, err := anomaly.Detect(cfg)
+	if err != nil {
+		return err
+	}
+	if len(anomalies) == 0 {
+		log.Println("No behavioral anomaly in the CloudTrail events.")
+		return nil
+	}
+
+	lines := make([]string, 0, maxReportedAnomalies+1)
+	for i, found := range anomalies {
+		if i == maxReportedAnomalies {
+			lines = append(lines, fmt.Sprintf("... and %d more", len(anomalies)-maxReportedAnomalies))
+			break
+		}
+		lines = append(lines, found.String())
+	}
+	return fmt.Errorf("%d CloudTrail events deviate from the behavioral baseline of their principal:\n%s", len(anomalies), strings.Join(lines, "\n"))
+}
@@ -1,7 +1,9 @@
 package audit_and_accountability
 
 import (
+	"cloud_compliance_checker/notify"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -77,8 +79,21 @@ func (c *LoggingFailureCheck) RunLoggingFailureCheck() error {
 	return nil
 }
 
-// SendEmail invia una email utilizzando Amazon SES
+// SendEmail invia la notifica tramite i canali configurati in notifications,
+// oppure una email utilizzando Amazon SES se nessun canale è configurato
 func (c *LoggingFailureCheck) SendEmail(message string) error {
+	err := notify.Send(notify.Event{
+		Title:         "Allarme di fallimento del logging",
+		Message:       message,
+		Severity:      notify.SeverityHigh,
+		ControlID:     "03.03.04",
+		CheckFunction: "CheckLoggingFailure",
+		Resource:      "management-events",
+	})
+	if !errors.Is(err, notify.ErrNotConfigured) {
+		return err
+	}
+
 	log.Println("Invio di un'email di notifica...")
 
 	input := &ses.SendEmailInput{
@@ -100,7 +115,7 @@ func (c *LoggingFailureCheck) SendEmail(message string) error {
 		Source: aws.String(c.FromEmail), // Email mittente
 	}
 
-	_, err := c.SESClient.SendEmail(context.TODO(), input)
+	_, err = c.SESClient.SendEmail(context.TODO(), input)
 	if err != nil {
 		errorMessage := fmt.Sprintf("Errore durante l'invio dell'email: %v", err)
 		log.Println(errorMessage)
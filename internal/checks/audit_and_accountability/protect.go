@@ -1,13 +1,13 @@
 package audit_and_accountability
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"os"
 	"time"
 
 	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/trailstore"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
@@ -52,22 +52,17 @@ func (c *AuditProtectionCheck) RunAuditProtectionCheck() error {
 	startTime := time.Now().Add(-24 * time.Hour)
 	endTime := time.Now()
 
-	input := &cloudtrail.LookupEventsInput{
-		StartTime: &startTime,
-		EndTime:   &endTime,
-	}
-
-	eventsOutput, err := c.CloudTrailClient.LookupEvents(context.TODO(), input)
+	events, err := trailstore.LookupEvents(c.CloudTrailClient, startTime, endTime)
 	if err != nil {
 		errorMessage := fmt.Sprintf("Errore durante il recupero degli eventi di CloudTrail: %v", err)
 		log.Println(errorMessage)
 		return fmt.Errorf(errorMessage)
 	}
 
-	log.Printf("Recuperati %d eventi di CloudTrail per l'ispezione\n", len(eventsOutput.Events))
+	log.Printf("Recuperati %d eventi di CloudTrail per l'ispezione\n", len(events))
 
 	// Itera sugli eventi e verifica se ci sono state modifiche o eliminazioni non autorizzate
-	for _, event := range eventsOutput.Events {
+	for _, event := range events {
 		if c.isSensitiveAction(event) {
 			log.Printf("Azione sensibile rilevata: %s eseguita da %s\n", *event.EventName, *event.Username)
 			if !c.isActionAuthorized(event.Username) {
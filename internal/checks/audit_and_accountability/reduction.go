@@ -0,0 +1,72 @@
+package audit_and_accountability
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"cloud_compliance_checker/auditquery"
+	"cloud_compliance_checker/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+)
+
+// defaultQueryDays is the range of the saved queries without days
+const defaultQueryDays = 30
+
+// RunSavedQueries runs the reduction queries of audit_queries and writes their reports
+// 03.03.06 Audit Record Reduction and Report Generation
+func RunSavedQueries(cfg aws.Config) error {
+	client := cloudtrail.NewFromConfig(cfg)
+	for _, saved := range config.AppConfig.AWS.AuditQueries {
+		if err := RunSavedQuery(client, saved); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunSavedQuery runs a saved query on the events of its last days and writes the report
+func RunSavedQuery(client *cloudtrail.Client, saved config.AuditQuery) error {
+	q, err := auditquery.Parse(saved.Query)
+	if err != nil {
+		return fmt.Errorf("audit query %s: %v", saved.Name, err)
+	}
+	days := saved.Days
+	if days <= 0 {
+		days = defaultQueryDays
+	}
+	format := saved.Format
+	if format == "" {
+		format = auditquery.FormatCSV
+	}
+	output := saved.Output
+	if output == "" {
+		output = fmt.Sprintf("audit_query_%s.%s", saved.Name, format)
+	}
+
+	end := time.Now()
+	table, err := auditquery.Execute(client, q, end.AddDate(0, 0, -days), end)
+	if err != nil {
+		return fmt.Errorf("audit query %s: failed to read the events: %v", saved.Name, err)
+	}
+
+	if dir := filepath.Dir(output); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("audit query %s: %v", saved.Name, err)
+		}
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("audit query %s: %v", saved.Name, err)
+	}
+	defer file.Close()
+	if err := auditquery.Write(file, table, format); err != nil {
+		return fmt.Errorf("audit query %s: %v", saved.Name, err)
+	}
+	log.Printf("Report della query di audit %s generato: %s (%d righe)\n", saved.Name, output, len(table.Rows))
+	return nil
+}
@@ -8,6 +8,8 @@ import (
 	"strings"
 	"time"
 
+	"cloud_compliance_checker/trailstore"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
 	"github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
@@ -65,22 +67,17 @@ func (a *AuditLogAnalysis) analyzeCloudTrailLogs() error {
 
 	log.Printf("Recupero eventi di CloudTrail tra %s e %s\n", startTime, endTime)
 
-	input := &cloudtrail.LookupEventsInput{
-		StartTime: &startTime,
-		EndTime:   &endTime,
-	}
-
-	eventsOutput, err := a.CloudTrailClient.LookupEvents(context.TODO(), input)
+	events, err := trailstore.LookupEvents(a.CloudTrailClient, startTime, endTime)
 	if err != nil {
 		errorMessage := fmt.Sprintf("Errore durante il recupero degli eventi di CloudTrail: %v", err)
 		log.Println(errorMessage)
 		return fmt.Errorf(errorMessage)
 	}
 
-	log.Printf("Numero di eventi recuperati da CloudTrail: %d\n", len(eventsOutput.Events))
+	log.Printf("Numero di eventi recuperati da CloudTrail: %d\n", len(events))
 
 	// Itera sugli eventi e verifica il contenuto di ciascun record
-	for _, event := range eventsOutput.Events {
+	for _, event := range events {
 		log.Printf("\n[CloudTrail] Evento ID: %s\n", *event.EventId)
 		log.Printf("  Tipo di evento: %s\n", *event.EventName)
 		log.Printf("  Fonte dell'evento: %s\n", *event.EventSource)
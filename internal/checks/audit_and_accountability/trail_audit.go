@@ -0,0 +1,530 @@
+package audit_and_accountability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/policy"
+	"cloud_compliance_checker/s3client"
+	"cloud_compliance_checker/scope"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Requirements affected by the gaps of the CloudTrail configuration
+const (
+	ReqEventLogging     = "03.03.01"
+	ReqRecordGeneration = "03.03.03"
+	ReqRecordAnalysis   = "03.03.05"
+	ReqAuditProtection  = "03.03.08"
+)
+
+// TrailGap is a gap of the CloudTrail configuration with the requirement it affects
+type TrailGap struct {
+	Requirement string
+	Trail       string // empty for the gaps of the account
+	Detail      string
+}
+
+// String formats the gap as "trail management-events: log file validation disabled"
+func (g TrailGap) String() string {
+	if g.Trail == "" {
+		return g.Detail
+	}
+	return fmt.Sprintf("trail %s: %s", g.Trail, g.Detail)
+}
+
+// auditedTrail is a trail with its status and event selectors. The events of a trail whose selectors
+// can't be read are unverified: it doesn't count for the management or data event coverage.
+type auditedTrail struct {
+	types.Trail
+	logging    bool
+	unverified bool
+	basic      []types.EventSelector
+	advanced   []types.AdvancedEventSelector
+}
+
+// AuditTrails audits the CloudTrail configuration of the account: multi-region and organization trails,
+// log file validation, KMS encryption, the policy, public access and deletion protection of the log
+// buckets, the CloudWatch Logs integration and the management and data events of the CUI buckets
+func AuditTrails(cfg aws.Config) ([]TrailGap, error) {
+	ctx := context.TODO()
+	described, err := cloudtrail.NewFromConfig(cfg).DescribeTrails(ctx, &cloudtrail.DescribeTrailsInput{IncludeShadowTrails: aws.Bool(true)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe trails: %v", err)
+	}
+
+	var trails []auditedTrail
+	var gaps []TrailGap
+	seen := map[string]bool{}
+	for _, trail := range described.TrailList {
+		arn := aws.ToString(trail.TrailARN)
+		if seen[arn] {
+			continue
+		}
+		seen[arn] = true
+
+		// Status and selectors are read in the home region of the trail
+		regional := cfg.Copy()
+		if home := aws.ToString(trail.HomeRegion); home != "" {
+			regional.Region = home
+		}
+		client := cloudtrail.NewFromConfig(regional)
+		audited := auditedTrail{Trail: trail}
+
+		status, err := client.GetTrailStatus(ctx, &cloudtrail.GetTrailStatusInput{Name: trail.TrailARN})
+		if err != nil {
+			log.Printf("Unable to get the status of trail %s: %v\n", arn, err)
+		} else {
+			audited.logging = aws.ToBool(status.IsLogging)
+			if e := aws.ToString(status.LatestCloudWatchLogsDeliveryError); e != "" && trail.CloudWatchLogsLogGroupArn != nil {
+				gaps = append(gaps, TrailGap{ReqRecordAnalysis, aws.ToString(trail.Name), fmt.Sprintf("CloudWatch Logs delivery failing: %s", e)})
+			}
+		}
+		if !audited.logging {
+			gaps = append(gaps, TrailGap{ReqEventLogging, aws.ToString(trail.Name), "not logging"})
+			continue
+		}
+
+		selectors, err := client.GetEventSelectors(ctx, &cloudtrail.GetEventSelectorsInput{TrailName: trail.TrailARN})
+		if err != nil {
+			audited.unverified = true
+			gaps = append(gaps, TrailGap{ReqEventLogging, aws.ToString(trail.Name), fmt.Sprintf("unable to read the event selectors, logged events not verified: %v", err)})
+		} else {
+			audited.basic, audited.advanced = selectors.EventSelectors, selectors.AdvancedEventSelectors
+		}
+		trails = append(trails, audited)
+	}
+
+	gaps = append(gaps, coverageGaps(cfg, trails)...)
+	for _, trail := range trails {
+		gaps = append(gaps, trailGaps(trail)...)
+	}
+	gaps = append(gaps, bucketGaps(cfg, trails)...)
+	gaps = append(gaps, dataEventGaps(cfg, trails)...)
+	return gaps, nil
+}
+
+// coverageGaps checks that a logging trail covers every region with the global service events and the
+// read and write management events, and that an organization trail exists in an organization
+func coverageGaps(cfg aws.Config, trails []auditedTrail) []TrailGap {
+	var gaps []TrailGap
+	multiRegion, management, organization := false, false, false
+	for _, trail := range trails {
+		if aws.ToBool(trail.IsMultiRegionTrail) && aws.ToBool(trail.IncludeGlobalServiceEvents) {
+			multiRegion = true
+			if read, write := ManagementCoverage(trail.basic, trail.advanced); read && write && !trail.unverified {
+				management = true
+			}
+		}
+		if aws.ToBool(trail.IsOrganizationTrail) {
+			organization = true
+		}
+	}
+
+	if !multiRegion {
+		gaps = append(gaps, TrailGap{ReqEventLogging, "", "no logging multi-region trail with global service events"})
+	}
+	if !management {
+		gaps = append(gaps, TrailGap{ReqEventLogging, "", "no multi-region trail logs both read and write management events"})
+	}
+	if !organization && inOrganization(cfg) {
+		gaps = append(gaps, TrailGap{ReqEventLogging, "", "the account is in an organization but no organization trail logs it"})
+	}
+	return gaps
+}
+
+// inOrganization checks if the account belongs to an AWS Organization
+func inOrganization(cfg aws.Config) bool {
+	_, err := organizations.NewFromConfig(cfg).DescribeOrganization(context.TODO(), &organizations.DescribeOrganizationInput{})
+	if err == nil {
+		return true
+	}
+	var notInUse *orgtypes.AWSOrganizationsNotInUseException
+	if !errors.As(err, &notInUse) {
+		log.Printf("Unable to describe the organization, organization trail not checked: %v\n", err)
+	}
+	return false
+}
+
+// trailGaps checks the integrity, encryption and analysis settings of a trail
+func trailGaps(trail auditedTrail) []TrailGap {
+	name := aws.ToString(trail.Name)
+	var gaps []TrailGap
+	if !aws.ToBool(trail.LogFileValidationEnabled) {
+		gaps = append(gaps, TrailGap{ReqAuditProtection, name, "log file validation disabled"})
+	}
+	if aws.ToString(trail.KmsKeyId) == "" {
+		gaps = append(gaps, TrailGap{ReqAuditProtection, name, "log files not encrypted with a KMS key"})
+	}
+	if aws.ToString(trail.CloudWatchLogsLogGroupArn) == "" {
+		gaps = append(gaps, TrailGap{ReqRecordAnalysis, name, "not delivered to CloudWatch Logs"})
+	}
+	return gaps
+}
+
+// bucketGaps checks the policy, public access and deletion protection of the log buckets. Buckets of
+// other accounts, such as those of organization trails, are skipped when they can't be read.
+func bucketGaps(cfg aws.Config, trails []auditedTrail) []TrailGap {
+	ctx := context.TODO()
+	var gaps []TrailGap
+	checked := map[string]bool{}
+	for _, trail := range trails {
+		bucket := aws.ToString(trail.S3BucketName)
+		if bucket == "" || checked[bucket] {
+			continue
+		}
+		checked[bucket] = true
+		gap := func(detail string) {
+			gaps = append(gaps, TrailGap{ReqAuditProtection, aws.ToString(trail.Name), fmt.Sprintf("log bucket %s %s", bucket, detail)})
+		}
+
+		// The bucket can be in another region than the client
+		bucketClient, err := s3client.ForBucket(ctx, cfg, bucket)
+		if err != nil {
+			log.Printf("Unable to read log bucket %s, bucket checks skipped: %v\n", bucket, err)
+			continue
+		}
+
+		if status, err := bucketClient.GetBucketPolicyStatus(ctx, &s3.GetBucketPolicyStatusInput{Bucket: aws.String(bucket)}); err == nil &&
+			status.PolicyStatus != nil && aws.ToBool(status.PolicyStatus.IsPublic) {
+			gap("is public")
+		}
+
+		pab, err := bucketClient.GetPublicAccessBlock(ctx, &s3.GetPublicAccessBlockInput{Bucket: aws.String(bucket)})
+		if err != nil || !publicAccessBlocked(pab.PublicAccessBlockConfiguration) {
+			gap("does not block all public access")
+		}
+
+		if bucketPolicy, err := bucketClient.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(bucket)}); err != nil {
+			gap("has no bucket policy")
+		} else {
+			for _, issue := range BucketPolicyIssues(aws.ToString(bucketPolicy.Policy)) {
+				gap("policy " + issue)
+			}
+		}
+
+		mfaDelete := false
+		if versioning, err := bucketClient.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{Bucket: aws.String(bucket)}); err == nil {
+			mfaDelete = versioning.MFADelete == s3types.MFADeleteStatusEnabled
+		}
+		objectLock := false
+		if lock, err := bucketClient.GetObjectLockConfiguration(ctx, &s3.GetObjectLockConfigurationInput{Bucket: aws.String(bucket)}); err == nil &&
+			lock.ObjectLockConfiguration != nil {
+			objectLock = lock.ObjectLockConfiguration.ObjectLockEnabled == s3types.ObjectLockEnabledEnabled
+		}
+		if !mfaDelete && !objectLock {
+			gap("has neither MFA delete nor object lock")
+		}
+	}
+	return gaps
+}
+
+// publicAccessBlocked checks that the four public access block settings are enabled
+func publicAccessBlocked(pab *s3types.PublicAccessBlockConfiguration) bool {
+	return pab != nil && aws.ToBool(pab.BlockPublicAcls) && aws.ToBool(pab.IgnorePublicAcls) &&
+		aws.ToBool(pab.BlockPublicPolicy) && aws.ToBool(pab.RestrictPublicBuckets)
+}
+
+// BucketPolicyIssues checks the policy of a log bucket: no unconditional access for any principal, writes
+// of CloudTrail bound to the source trail or account, and a deny of the requests without TLS
+func BucketPolicyIssues(document string) []string {
+	doc, err := policy.Parse(document)
+	if err != nil {
+		return []string{fmt.Sprintf("can't be parsed: %v", err)}
+	}
+
+	var issues []string
+	secureTransport := false
+	for _, st := range doc.Statement {
+		if st.Effect == policy.EffectDeny {
+			if values, ok := st.Condition["Bool"]["aws:SecureTransport"]; ok && len(values) == 1 && values[0] == "false" {
+				secureTransport = true
+			}
+			continue
+		}
+		if st.Principal == nil {
+			continue
+		}
+		id := st.Sid
+		if id == "" {
+			id = strings.Join(st.Action, ", ")
+		}
+		if (st.Principal.Wildcard || containsValue(st.Principal.Values["AWS"], "*")) && len(st.Condition) == 0 {
+			issues = append(issues, fmt.Sprintf("statement %s allows any principal without conditions", id))
+		}
+		if containsValue(st.Principal.Values["Service"], "cloudtrail.amazonaws.com") && !hasConditionKey(st, "aws:SourceArn", "aws:SourceAccount") {
+			issues = append(issues, fmt.Sprintf("statement %s allows CloudTrail without aws:SourceArn or aws:SourceAccount", id))
+		}
+	}
+	if !secureTransport {
+		issues = append(issues, "does not deny requests without TLS (aws:SecureTransport)")
+	}
+	return issues
+}
+
+// hasConditionKey checks if a statement has a condition on one of the keys, with any operator
+func hasConditionKey(st policy.Statement, keys ...string) bool {
+	for _, conditions := range st.Condition {
+		for key := range conditions {
+			for _, k := range keys {
+				if strings.EqualFold(key, k) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// dataEventGaps checks that the read and write S3 data events of each in-scope bucket are logged by a trail
+// of its region or a multi-region trail. The log buckets are excluded.
+func dataEventGaps(cfg aws.Config, trails []auditedTrail) []TrailGap {
+	in, _, err := scope.Assets(cfg)
+	if err != nil && len(in) == 0 {
+		log.Printf("Unable to list the CUI buckets, data events not checked: %v\n", err)
+		return nil
+	}
+	logBuckets := map[string]bool{}
+	for _, trail := range trails {
+		logBuckets[aws.ToString(trail.S3BucketName)] = true
+	}
+
+	var gaps []TrailGap
+	for _, asset := range in {
+		if asset.Type != models.AssetTypeS3Bucket || logBuckets[asset.Name] {
+			continue
+		}
+		read, write := false, false
+		for _, trail := range trails {
+			if trail.unverified || (!aws.ToBool(trail.IsMultiRegionTrail) && aws.ToString(trail.HomeRegion) != asset.Region) {
+				continue
+			}
+			r, w := DataEventCoverage(trail.basic, trail.advanced, asset.Name)
+			read, write = read || r, write || w
+		}
+		switch {
+		case !read && !write:
+			gaps = append(gaps, TrailGap{ReqRecordGeneration, "", fmt.Sprintf("no trail logs the S3 data events of CUI bucket %s", asset.Name)})
+		case !read:
+			gaps = append(gaps, TrailGap{ReqRecordGeneration, "", fmt.Sprintf("no trail logs the read data events of CUI bucket %s", asset.Name)})
+		case !write:
+			gaps = append(gaps, TrailGap{ReqRecordGeneration, "", fmt.Sprintf("no trail logs the write data events of CUI bucket %s", asset.Name)})
+		}
+	}
+	return gaps
+}
+
+// ManagementCoverage reports if the event selectors log the read and the write management events
+func ManagementCoverage(basic []types.EventSelector, advanced []types.AdvancedEventSelector) (read, write bool) {
+	// A trail without selectors logs every management event
+	if len(basic) == 0 && len(advanced) == 0 {
+		return true, true
+	}
+	for _, selector := range basic {
+		if aws.ToBool(selector.IncludeManagementEvents) {
+			r, w := readWrite(selector.ReadWriteType)
+			read, write = read || r, write || w
+		}
+	}
+	for _, selector := range advanced {
+		fields := selectorFields(selector)
+		if !fieldMatches(fields, "eventCategory", "Management") {
+			continue
+		}
+		r, w := advancedReadWrite(fields)
+		read, write = read || r, write || w
+	}
+	return read, write
+}
+
+// DataEventCoverage reports if the event selectors log the read and the write data events of every
+// object of the bucket
+func DataEventCoverage(basic []types.EventSelector, advanced []types.AdvancedEventSelector, bucket string) (read, write bool) {
+	objects := fmt.Sprintf("arn:aws:s3:::%s/", bucket)
+	for _, selector := range basic {
+		for _, resource := range selector.DataResources {
+			if aws.ToString(resource.Type) != "AWS::S3::Object" {
+				continue
+			}
+			for _, value := range resource.Values {
+				// "arn:aws:s3" (every bucket), "arn:aws:s3:::bucket" or "arn:aws:s3:::bucket/"
+				if value == "arn:aws:s3" || value == "arn:aws:s3:::" || strings.TrimSuffix(value, "/")+"/" == objects {
+					r, w := readWrite(selector.ReadWriteType)
+					read, write = read || r, write || w
+				}
+			}
+		}
+	}
+	for _, selector := range advanced {
+		fields := selectorFields(selector)
+		if !fieldMatches(fields, "eventCategory", "Data") || !fieldMatches(fields, "resources.type", "AWS::S3::Object") {
+			continue
+		}
+		// Selectors restricted to some event names don't log every access
+		if _, ok := fields["eventName"]; ok {
+			continue
+		}
+		if arn, ok := fields["resources.ARN"]; ok && !arnSelectorCovers(arn, objects) {
+			continue
+		}
+		r, w := advancedReadWrite(fields)
+		read, write = read || r, write || w
+	}
+	return read, write
+}
+
+// readWrite converts the read/write type of a basic selector
+func readWrite(t types.ReadWriteType) (bool, bool) {
+	switch t {
+	case types.ReadWriteTypeReadOnly:
+		return true, false
+	case types.ReadWriteTypeWriteOnly:
+		return false, true
+	}
+	return true, true
+}
+
+// advancedReadWrite converts the readOnly field of an advanced selector
+func advancedReadWrite(fields map[string]types.AdvancedFieldSelector) (bool, bool) {
+	field, ok := fields["readOnly"]
+	if !ok {
+		return true, true
+	}
+	if containsValue(field.Equals, "true") {
+		return true, false
+	}
+	if containsValue(field.Equals, "false") {
+		return false, true
+	}
+	return true, true
+}
+
+// selectorFields indexes the field selectors by field name
+func selectorFields(selector types.AdvancedEventSelector) map[string]types.AdvancedFieldSelector {
+	fields := map[string]types.AdvancedFieldSelector{}
+	for _, field := range selector.FieldSelectors {
+		fields[aws.ToString(field.Field)] = field
+	}
+	return fields
+}
+
+// fieldMatches checks if the field selects the value with Equals
+func fieldMatches(fields map[string]types.AdvancedFieldSelector, name, value string) bool {
+	field, ok := fields[name]
+	return ok && containsValue(field.Equals, value)
+}
+
+// arnSelectorCovers checks if a resources.ARN field selects every object of the bucket
+func arnSelectorCovers(field types.AdvancedFieldSelector, objects string) bool {
+	for _, excluded := range field.NotStartsWith {
+		if strings.HasPrefix(objects, excluded) || strings.HasPrefix(excluded, objects) {
+			return false
+		}
+	}
+	for _, excluded := range field.NotEquals {
+		if strings.HasPrefix(excluded, objects) {
+			return false
+		}
+	}
+	if len(field.Equals) == 0 && len(field.StartsWith) == 0 {
+		return len(field.NotStartsWith) > 0 || len(field.NotEquals) > 0
+	}
+	for _, prefix := range field.StartsWith {
+		if strings.HasPrefix(objects, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheTTL is how long the audit is reused by the checks of the same evaluation
+const cacheTTL = 10 * time.Minute
+
+var (
+	trailMu    sync.Mutex
+	cachedGaps []TrailGap
+	trailErr   error
+	trailAt    time.Time
+)
+
+// CachedTrailAudit returns the audit of the last cacheTTL, or runs it
+func CachedTrailAudit(cfg aws.Config) ([]TrailGap, error) {
+	trailMu.Lock()
+	defer trailMu.Unlock()
+
+	if !trailAt.IsZero() && time.Since(trailAt) < cacheTTL {
+		return cachedGaps, trailErr
+	}
+	cachedGaps, trailErr = AuditTrails(cfg)
+	trailAt = time.Now()
+	return cachedGaps, trailErr
+}
+
+// checkTrailRequirement fails with the gaps of the CloudTrail configuration affecting the requirement
+func checkTrailRequirement(cfg aws.Config, requirement, summary string) error {
+	gaps, err := CachedTrailAudit(cfg)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	for _, gap := range gaps {
+		if gap.Requirement == requirement {
+			lines = append(lines, gap.String())
+		}
+	}
+	if len(lines) > 0 {
+		sort.Strings(lines)
+		return fmt.Errorf("%s:\n%s", summary, strings.Join(lines, "\n"))
+	}
+	log.Printf("No CloudTrail gap for %s.\n", requirement)
+	return nil
+}
+
+// CheckTrailCoverage checks that the trails log every region, the global service events, the read and
+// write management events and, in an organization, that an organization trail exists
+// 03.03.01
+func CheckTrailCoverage(cfg aws.Config) error {
+	return checkTrailRequirement(cfg, ReqEventLogging, "CloudTrail does not log every event")
+}
+
+// CheckTrailDataEvents checks that the read and write S3 data events of the CUI buckets are logged
+// 03.03.03
+func CheckTrailDataEvents(cfg aws.Config) error {
+	return checkTrailRequirement(cfg, ReqRecordGeneration, "CloudTrail does not log the data events of the CUI buckets")
+}
+
+// CheckTrailAnalysis checks that the trails are delivered to CloudWatch Logs for analysis and alerting
+// 03.03.05
+func CheckTrailAnalysis(cfg aws.Config) error {
+	return checkTrailRequirement(cfg, ReqRecordAnalysis, "CloudTrail events are not available for analysis")
+}
+
+// CheckTrailProtection checks the log file validation and encryption of the trails and the policy, public
+// access and deletion protection of their buckets
+// 03.03.08
+func CheckTrailProtection(cfg aws.Config) error {
+	return checkTrailRequirement(cfg, ReqAuditProtection, "CloudTrail logs are not protected")
+}
@@ -0,0 +1,66 @@
+package audit_and_accountability
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventSelectorCoverage(t *testing.T) {
+	// Basic selectors: write management events, all data events of one bucket
+	basic := []types.EventSelector{
+		{ReadWriteType: types.ReadWriteTypeWriteOnly, IncludeManagementEvents: aws.Bool(true)},
+		{ReadWriteType: types.ReadWriteTypeAll, IncludeManagementEvents: aws.Bool(false), DataResources: []types.DataResource{
+			{Type: aws.String("AWS::S3::Object"), Values: []string{"arn:aws:s3:::cui-data/"}},
+		}},
+	}
+	read, write := ManagementCoverage(basic, nil)
+	assert.False(t, read)
+	assert.True(t, write)
+	read, write = DataEventCoverage(basic, nil, "cui-data")
+	assert.True(t, read && write)
+	read, write = DataEventCoverage(basic, nil, "cui-data-archive")
+	assert.False(t, read || write)
+
+	// Advanced selectors: management events, read data events of every bucket except the logs
+	field := func(name string, equals ...string) types.AdvancedFieldSelector {
+		return types.AdvancedFieldSelector{Field: aws.String(name), Equals: equals}
+	}
+	advanced := []types.AdvancedEventSelector{
+		{FieldSelectors: []types.AdvancedFieldSelector{field("eventCategory", "Management")}},
+		{FieldSelectors: []types.AdvancedFieldSelector{
+			field("eventCategory", "Data"), field("resources.type", "AWS::S3::Object"), field("readOnly", "true"),
+			{Field: aws.String("resources.ARN"), NotStartsWith: []string{"arn:aws:s3:::trail-logs/"}},
+		}},
+	}
+	read, write = ManagementCoverage(nil, advanced)
+	assert.True(t, read && write)
+	read, write = DataEventCoverage(nil, advanced, "cui-data")
+	assert.True(t, read)
+	assert.False(t, write)
+	read, _ = DataEventCoverage(nil, advanced, "trail-logs")
+	assert.False(t, read)
+}
+
+func TestBucketPolicyIssues(t *testing.T) {
+	issues := BucketPolicyIssues(`{"Statement": [
+		{"Sid": "AWSCloudTrailWrite", "Effect": "Allow", "Principal": {"Service": "cloudtrail.amazonaws.com"},
+		 "Action": "s3:PutObject", "Resource": "arn:aws:s3:::trail-logs/AWSLogs/*"},
+		{"Sid": "PublicRead", "Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::trail-logs/*"}
+	]}`)
+	assert.Equal(t, []string{
+		"statement AWSCloudTrailWrite allows CloudTrail without aws:SourceArn or aws:SourceAccount",
+		"statement PublicRead allows any principal without conditions",
+		"does not deny requests without TLS (aws:SecureTransport)",
+	}, issues)
+
+	issues = BucketPolicyIssues(`{"Statement": [
+		{"Effect": "Allow", "Principal": {"Service": "cloudtrail.amazonaws.com"}, "Action": "s3:PutObject",
+		 "Resource": "arn:aws:s3:::trail-logs/AWSLogs/*", "Condition": {"StringEquals": {"aws:SourceArn": "arn:aws:cloudtrail:us-east-1:111111111111:trail/main"}}},
+		{"Effect": "Deny", "Principal": "*", "Action": "s3:*", "Resource": "arn:aws:s3:::trail-logs/*",
+		 "Condition": {"Bool": {"aws:SecureTransport": "false"}}}
+	]}`)
+	assert.Empty(t, issues)
+}
@@ -1,10 +1,17 @@
 package config_management
 
 import (
+	"cloud_compliance_checker/config"
 	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/scope"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
 )
 
 // CUIComponent represents AWS resources where CUI is processed or stored
@@ -20,27 +27,152 @@ type CUIComponent struct {
 // Global list to store AWS resources that store/process CUI
 var cuiComponents []CUIComponent
 
-// Function to document AWS resources (EC2/S3) that store/process CUI from discovered assets
-func DocumentDiscoveredAssets(assets []models.Asset) {
+// CheckInformationLocation documents where CUI is stored and processed, using the Macie findings and bucket
+// sensitivity scores to locate the sensitive data, and fails when sensitive data is found outside the declared CUI buckets.
+// Without Macie the in-scope assets are documented and the location of the sensitive data is not verified.
+// 03.04.11
+func CheckInformationLocation(cfg aws.Config) error {
+	assets, _, err := scope.Assets(cfg)
+	if err != nil {
+		log.Printf("Asset discovery incomplete: %v\n", err)
+	}
+
+	sensitive, err := DiscoverSensitiveData(cfg)
+	if errors.Is(err, ErrMacieNotEnabled) {
+		log.Printf("WARNING: %v, the location of the sensitive data is not verified\n", err)
+		DocumentScopeAssets(assets)
+		return DisplayCUIComponents()
+	}
+	if err != nil {
+		return fmt.Errorf("unable to locate sensitive data: %v", err)
+	}
+
+	DocumentDiscoveredAssets(assets, sensitive)
+	if err := DisplayCUIComponents(); err != nil {
+		return err
+	}
+
+	declared := declaredCUIBuckets(assets)
+	var undeclared []string
+	for name, location := range sensitive {
+		if declared[name] {
+			continue
+		}
+		log.Printf("ERROR: Sensitive data (%s) found in bucket %s (%s), which is not a declared CUI bucket\n",
+			strings.Join(location.Categories, ", "), name, location.Region)
+		undeclared = append(undeclared, fmt.Sprintf("%s (%s)", name, location.Region))
+	}
+	if len(undeclared) > 0 {
+		sort.Strings(undeclared)
+		return fmt.Errorf("sensitive data found outside the declared CUI buckets: %s", strings.Join(undeclared, ", "))
+	}
+
+	log.Println("All the sensitive data found by Macie is stored in the declared CUI buckets.")
+	return nil
+}
+
+// declaredCUIBuckets returns the buckets declared to store CUI: s3_buckets, integrity.bucket_names and,
+// when a CUI scope is configured, the in-scope buckets
+func declaredCUIBuckets(assets []models.Asset) map[string]bool {
+	declared := make(map[string]bool)
+	for _, bucket := range config.AppConfig.AWS.S3Buckets {
+		declared[bucket.Name] = true
+	}
+	for _, name := range config.AppConfig.AWS.Integrity.BucketNames {
+		declared[name] = true
+	}
+	if scope.Current().Configured() {
+		for _, asset := range assets {
+			if asset.Type == models.AssetTypeS3Bucket {
+				declared[asset.Name] = true
+			}
+		}
+	}
+	return declared
+}
+
+// Function to document the AWS resources that store/process CUI.
+// Buckets are documented when Macie found sensitive data in them, with the data categories and the real region,
+// or when they are declared CUI buckets. The other assets are documented only when a CUI scope is configured,
+// with the category read from their category tag.
+func DocumentDiscoveredAssets(assets []models.Asset, sensitive map[string]*SensitiveDataLocation) {
+	cuiScope := scope.Current()
+	accessUsers := cuiScope.AccessUsers()
+	declared := declaredCUIBuckets(assets)
+
+	// Each evaluation documents the assets found at that time
+	cuiComponents = nil
+	documented := make(map[string]bool)
+	for _, asset := range assets {
+		cuiType := cuiScope.Category(asset)
+		location := asset.Region // Region of the asset, "global" for global services
+
+		if asset.Type == models.AssetTypeS3Bucket {
+			if data, ok := sensitive[asset.Name]; ok {
+				cuiType, location = sensitiveDataType(data), data.Region
+			} else if !declared[asset.Name] {
+				continue
+			}
+			documented[asset.Name] = true
+		} else if !cuiScope.Configured() {
+			continue
+		}
+
+		instanceID := asset.ARN
+		if instanceID == "" {
+			instanceID = asset.Name
+		}
+		addCUIComponent(asset.Name, instanceID, cuiType, location, accessUsers)
+	}
+
+	// Buckets reported by Macie but not discovered (e.g. discovery failures)
+	for name, data := range sensitive {
+		if !documented[name] {
+			addCUIComponent(name, "arn:aws:s3:::"+name, sensitiveDataType(data), data.Region, accessUsers)
+		}
+	}
+}
+
+// DocumentScopeAssets documents every in-scope asset as a CUI component, with the category read from its
+// category tag. It is used when Macie is not available to locate the sensitive data.
+func DocumentScopeAssets(assets []models.Asset) {
+	cuiScope := scope.Current()
+	accessUsers := cuiScope.AccessUsers()
+
+	cuiComponents = nil
 	for _, asset := range assets {
-		// Assuming all discovered assets involve CUI. Customize this logic as needed.
-		cuiType := "Confidential"                 // Replace with actual CUI classification logic
-		location := asset.Name                    // You may customize location extraction logic based on asset type
-		accessUsers := []string{"user1", "user2"} // Replace with actual access users
-
-		// Document each asset as a CUI component
-		cuiComponent := CUIComponent{
-			ComponentName: asset.Name,
-			InstanceID:    asset.Name, // Reusing name as ID, customize this if needed
-			CUIType:       cuiType,
-			Location:      location,
-			AccessUsers:   accessUsers,
-			LastModified:  time.Now(),
+		instanceID := asset.ARN
+		if instanceID == "" {
+			instanceID = asset.Name
 		}
+		addCUIComponent(asset.Name, instanceID, cuiScope.Category(asset), asset.Region, accessUsers)
+	}
+}
 
-		cuiComponents = append(cuiComponents, cuiComponent)
-		log.Printf("CUI Component Added: Component Name: %s, InstanceID: %s, CUI Type: %s, Location: %s\n", asset.Name, asset.Name, cuiType, location)
+// addCUIComponent documents an AWS resource as a CUI component
+func addCUIComponent(name, instanceID, cuiType, location string, accessUsers []string) {
+	cuiComponent := CUIComponent{
+		ComponentName: name,
+		InstanceID:    instanceID,
+		CUIType:       cuiType,
+		Location:      location,
+		AccessUsers:   accessUsers,
+		LastModified:  time.Now(),
+	}
+
+	cuiComponents = append(cuiComponents, cuiComponent)
+	log.Printf("CUI Component Added: Component Name: %s, InstanceID: %s, CUI Type: %s, Location: %s\n", name, instanceID, cuiType, location)
+}
+
+// sensitiveDataType describes the sensitive data found by Macie in a bucket
+func sensitiveDataType(data *SensitiveDataLocation) string {
+	if len(data.Categories) == 0 {
+		return fmt.Sprintf("SENSITIVE (sensitivity score %d)", data.SensitivityScore)
+	}
+	if len(data.DataTypes) == 0 {
+		return strings.Join(data.Categories, ", ")
 	}
+	return fmt.Sprintf("%s (%s)", strings.Join(data.Categories, ", "), strings.Join(data.DataTypes, ", "))
 }
 
 // Function to display current AWS resources that store/process CUI
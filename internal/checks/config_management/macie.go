@@ -0,0 +1,206 @@
+package config_management
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/macie2"
+	macietypes "github.com/aws/aws-sdk-go-v2/service/macie2/types"
+	"github.com/aws/smithy-go"
+)
+
+// sensitivityThreshold is the Macie sensitivity score from which a bucket is considered to store sensitive data
+const sensitivityThreshold = 50
+
+// getFindingsBatch is the maximum number of findings accepted by GetFindings
+const getFindingsBatch = 50
+
+// ErrMacieNotEnabled is returned by DiscoverSensitiveData when Macie is not enabled in the region
+var ErrMacieNotEnabled = errors.New("Macie is not enabled")
+
+// SensitiveDataLocation is an S3 bucket where Macie found sensitive data
+type SensitiveDataLocation struct {
+	Bucket           string
+	Region           string
+	Categories       []string // FINANCIAL_INFORMATION, PERSONAL_INFORMATION, CREDENTIALS, CUSTOM_IDENTIFIER
+	DataTypes        []string // managed and custom data identifiers that matched
+	Findings         int
+	SensitivityScore int
+	MaxSeverity      string
+}
+
+// DiscoverSensitiveData reads the Macie sensitive data findings and the bucket sensitivity scores
+// and returns the buckets storing sensitive data, by name.
+func DiscoverSensitiveData(cfg aws.Config) (map[string]*SensitiveDataLocation, error) {
+	ctx := context.TODO()
+	client := macie2.NewFromConfig(cfg)
+
+	session, err := client.GetMacieSession(ctx, &macie2.GetMacieSessionInput{})
+	if err != nil {
+		if macieNotEnabled(err) {
+			return nil, fmt.Errorf("%w: %v", ErrMacieNotEnabled, err)
+		}
+		return nil, fmt.Errorf("failed to get the Macie session: %v", err)
+	}
+	if session.Status != macietypes.MacieStatusEnabled {
+		return nil, fmt.Errorf("%w: status %s", ErrMacieNotEnabled, session.Status)
+	}
+
+	locations := make(map[string]*SensitiveDataLocation)
+	if err := addFindings(ctx, client, locations); err != nil {
+		return locations, err
+	}
+	if err := addBucketScores(ctx, client, locations); err != nil {
+		return locations, err
+	}
+
+	for _, location := range locations {
+		sort.Strings(location.Categories)
+		sort.Strings(location.DataTypes)
+	}
+	log.Printf("Macie found sensitive data in %d bucket(s)\n", len(locations))
+	return locations, nil
+}
+
+// macieNotEnabled checks if an error of the Macie API means that Macie is not enabled in the region.
+// Any other access denied error is a missing permission of the checker.
+func macieNotEnabled(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "AccessDeniedException" &&
+		strings.Contains(apiErr.ErrorMessage(), "Macie is not enabled")
+}
+
+// addFindings adds the buckets of the sensitive data findings that are not archived
+func addFindings(ctx context.Context, client *macie2.Client, locations map[string]*SensitiveDataLocation) error {
+	criteria := &macietypes.FindingCriteria{
+		Criterion: map[string]macietypes.CriterionAdditionalProperties{
+			"category": {Eq: []string{string(macietypes.FindingCategoryClassification)}},
+			"archived": {Eq: []string{"false"}},
+		},
+	}
+
+	var ids []string
+	paginator := macie2.NewListFindingsPaginator(client, &macie2.ListFindingsInput{FindingCriteria: criteria})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list Macie findings: %v", err)
+		}
+		ids = append(ids, page.FindingIds...)
+	}
+
+	for start := 0; start < len(ids); start += getFindingsBatch {
+		end := min(start+getFindingsBatch, len(ids))
+		output, err := client.GetFindings(ctx, &macie2.GetFindingsInput{FindingIds: ids[start:end]})
+		if err != nil {
+			return fmt.Errorf("failed to get Macie findings: %v", err)
+		}
+		for _, finding := range output.Findings {
+			addFinding(locations, finding)
+		}
+	}
+
+	return nil
+}
+
+// addFinding adds the categories and the data types of a finding to the location of its bucket
+func addFinding(locations map[string]*SensitiveDataLocation, finding macietypes.Finding) {
+	if finding.ResourcesAffected == nil || finding.ResourcesAffected.S3Bucket == nil {
+		return
+	}
+	location := locationFor(locations, aws.ToString(finding.ResourcesAffected.S3Bucket.Name), aws.ToString(finding.Region))
+	location.Findings++
+
+	if finding.Severity != nil && severityRank(string(finding.Severity.Description)) > severityRank(location.MaxSeverity) {
+		location.MaxSeverity = string(finding.Severity.Description)
+	}
+
+	if finding.ClassificationDetails == nil || finding.ClassificationDetails.Result == nil {
+		return
+	}
+	result := finding.ClassificationDetails.Result
+	for _, item := range result.SensitiveData {
+		location.Categories = appendUnique(location.Categories, string(item.Category))
+		for _, detection := range item.Detections {
+			location.DataTypes = appendUnique(location.DataTypes, aws.ToString(detection.Type))
+		}
+	}
+	if result.CustomDataIdentifiers != nil && len(result.CustomDataIdentifiers.Detections) > 0 {
+		location.Categories = appendUnique(location.Categories, string(macietypes.SensitiveDataItemCategoryCustomIdentifier))
+		for _, detection := range result.CustomDataIdentifiers.Detections {
+			location.DataTypes = appendUnique(location.DataTypes, aws.ToString(detection.Name))
+		}
+	}
+}
+
+// addBucketScores adds the buckets whose sensitivity score, computed by the automated sensitive data discovery, is over the threshold
+func addBucketScores(ctx context.Context, client macie2.DescribeBucketsAPIClient, locations map[string]*SensitiveDataLocation) error {
+	paginator := macie2.NewDescribeBucketsPaginator(client, &macie2.DescribeBucketsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to describe Macie buckets: %v", err)
+		}
+
+		for _, bucket := range page.Buckets {
+			name := aws.ToString(bucket.BucketName)
+			score := int(aws.ToInt32(bucket.SensitivityScore))
+			if location, ok := locations[name]; ok {
+				location.SensitivityScore = score
+				if location.Region == "" {
+					location.Region = aws.ToString(bucket.Region)
+				}
+				continue
+			}
+			if score >= sensitivityThreshold {
+				location := locationFor(locations, name, aws.ToString(bucket.Region))
+				location.SensitivityScore = score
+			}
+		}
+	}
+	return nil
+}
+
+// locationFor returns the location of a bucket, creating it when missing
+func locationFor(locations map[string]*SensitiveDataLocation, bucket, region string) *SensitiveDataLocation {
+	location, ok := locations[bucket]
+	if !ok {
+		location = &SensitiveDataLocation{Bucket: bucket, Region: region}
+		locations[bucket] = location
+	}
+	if location.Region == "" {
+		location.Region = region
+	}
+	return location
+}
+
+// severityRank orders the Macie severities
+func severityRank(severity string) int {
+	switch severity {
+	case string(macietypes.SeverityDescriptionHigh):
+		return 3
+	case string(macietypes.SeverityDescriptionMedium):
+		return 2
+	case string(macietypes.SeverityDescriptionLow):
+		return 1
+	}
+	return 0
+}
+
+// appendUnique appends a value if it is not empty and not already in the list
+func appendUnique(values []string, value string) []string {
+	if value == "" {
+		return values
+	}
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,99 @@
+package config_management
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/macie2"
+	macietypes "github.com/aws/aws-sdk-go-v2/service/macie2/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBucketDescriber returns the buckets in pages
+type fakeBucketDescriber struct {
+	pages [][]macietypes.BucketMetadata
+}
+
+func (f fakeBucketDescriber) DescribeBuckets(ctx context.Context, params *macie2.DescribeBucketsInput, optFns ...func(*macie2.Options)) (*macie2.DescribeBucketsOutput, error) {
+	page := 0
+	if params.NextToken != nil {
+		page = 1
+	}
+	output := &macie2.DescribeBucketsOutput{Buckets: f.pages[page]}
+	if page+1 < len(f.pages) {
+		output.NextToken = aws.String("next")
+	}
+	return output, nil
+}
+
+func classificationFinding(bucket, region string, severity macietypes.SeverityDescription, items []macietypes.SensitiveDataItem, custom []macietypes.CustomDetection) macietypes.Finding {
+	result := &macietypes.ClassificationResult{SensitiveData: items}
+	if custom != nil {
+		result.CustomDataIdentifiers = &macietypes.CustomDataIdentifiers{Detections: custom}
+	}
+	return macietypes.Finding{
+		Region:                aws.String(region),
+		Severity:              &macietypes.Severity{Description: severity},
+		ResourcesAffected:     &macietypes.ResourcesAffected{S3Bucket: &macietypes.S3Bucket{Name: aws.String(bucket)}},
+		ClassificationDetails: &macietypes.ClassificationDetails{Result: result},
+	}
+}
+
+func TestAddFinding(t *testing.T) {
+	locations := map[string]*SensitiveDataLocation{}
+
+	addFinding(locations, classificationFinding("hr", "eu-west-1", macietypes.SeverityDescriptionLow, []macietypes.SensitiveDataItem{{
+		Category:   macietypes.SensitiveDataItemCategoryPersonalInformation,
+		Detections: []macietypes.DefaultDetection{{Type: aws.String("USA_SOCIAL_SECURITY_NUMBER")}},
+	}}, nil))
+	addFinding(locations, classificationFinding("hr", "eu-west-1", macietypes.SeverityDescriptionHigh, []macietypes.SensitiveDataItem{{
+		Category:   macietypes.SensitiveDataItemCategoryPersonalInformation,
+		Detections: []macietypes.DefaultDetection{{Type: aws.String("USA_SOCIAL_SECURITY_NUMBER")}, {Type: aws.String("NAME")}},
+	}}, []macietypes.CustomDetection{{Name: aws.String("cui-marking")}}))
+	addFinding(locations, classificationFinding("hr", "eu-west-1", macietypes.SeverityDescriptionMedium, nil, nil))
+
+	// Findings without a bucket are ignored
+	addFinding(locations, macietypes.Finding{Region: aws.String("eu-west-1")})
+
+	assert.Len(t, locations, 1)
+	assert.Equal(t, &SensitiveDataLocation{
+		Bucket:      "hr",
+		Region:      "eu-west-1",
+		Categories:  []string{"PERSONAL_INFORMATION", "CUSTOM_IDENTIFIER"},
+		DataTypes:   []string{"USA_SOCIAL_SECURITY_NUMBER", "NAME", "cui-marking"},
+		Findings:    3,
+		MaxSeverity: "High",
+	}, locations["hr"])
+	assert.Equal(t, "PERSONAL_INFORMATION, CUSTOM_IDENTIFIER (USA_SOCIAL_SECURITY_NUMBER, NAME, cui-marking)", sensitiveDataType(locations["hr"]))
+}
+
+func TestAddBucketScores(t *testing.T) {
+	locations := map[string]*SensitiveDataLocation{"hr": {Bucket: "hr", Findings: 1}}
+	client := fakeBucketDescriber{pages: [][]macietypes.BucketMetadata{
+		{
+			{BucketName: aws.String("hr"), Region: aws.String("eu-west-1"), SensitivityScore: aws.Int32(10)},
+			{BucketName: aws.String("finance"), Region: aws.String("us-east-1"), SensitivityScore: aws.Int32(50)},
+		},
+		{
+			{BucketName: aws.String("logs"), Region: aws.String("us-east-1"), SensitivityScore: aws.Int32(49)},
+		},
+	}}
+
+	assert.NoError(t, addBucketScores(context.TODO(), client, locations))
+	assert.Len(t, locations, 2)
+
+	// A bucket with findings keeps them and gets its score and region
+	assert.Equal(t, &SensitiveDataLocation{Bucket: "hr", Region: "eu-west-1", Findings: 1, SensitivityScore: 10}, locations["hr"])
+	// A bucket without findings is added from the threshold
+	assert.Equal(t, &SensitiveDataLocation{Bucket: "finance", Region: "us-east-1", SensitivityScore: 50}, locations["finance"])
+	assert.Equal(t, "SENSITIVE (sensitivity score 50)", sensitiveDataType(locations["finance"]))
+}
+
+func TestMacieNotEnabled(t *testing.T) {
+	assert.True(t, macieNotEnabled(&smithy.GenericAPIError{Code: "AccessDeniedException", Message: "Macie is not enabled."}))
+	assert.False(t, macieNotEnabled(&smithy.GenericAPIError{Code: "AccessDeniedException", Message: "User is not authorized to perform: macie2:GetMacieSession"}))
+	assert.False(t, macieNotEnabled(errors.New("connection reset")))
+}
@@ -1,11 +1,14 @@
 package config_management
 
 import (
+	"cloud_compliance_checker/anomaly"
 	"cloud_compliance_checker/config"
-	"cloud_compliance_checker/discovery"
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/scope"
 	"context"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -296,7 +299,16 @@ func checkS3PostTravel(cfg aws.Config, bucketName string) {
 
 func CheckHighRiskTravelCompliance(awsCfg aws.Config) error {
 	// Discover assets (EC2, S3) assigned for high-risk travel
-	assets := discovery.DiscoverAssets(awsCfg)
+	discovered, _, err := scope.Assets(awsCfg)
+	if err != nil {
+		log.Printf("Asset discovery incomplete: %v\n", err)
+	}
+	var assets []models.Asset
+	for _, asset := range discovered {
+		if asset.Type == models.AssetTypeEC2Instance || asset.Type == models.AssetTypeS3Bucket {
+			assets = append(assets, asset)
+		}
+	}
 
 	// Check if we have any users defined for high-risk travel
 	users := config.AppConfig.AWS.HighRiskTravelConfig.Users
@@ -316,3 +328,26 @@ func CheckHighRiskTravelCompliance(awsCfg aws.Config) error {
 
 	return nil
 }
+
+// CheckImpossibleTravel checks the console logins for travels faster than impossible_travel.max_speed_kmh.
+// The travels to a destination of a trip of a high-risk traveler in progress are logged but do not fail the check.
+func CheckImpossibleTravel(awsCfg aws.Config) error {
+	findings, err := anomaly.DetectTravel(awsCfg)
+	if err != nil {
+		return err
+	}
+
+	var impossible []string
+	for _, finding := range findings {
+		if finding.Declared {
+			log.Printf("Travel declared by %s: %s\n", finding.Traveler, finding)
+			continue
+		}
+		impossible = append(impossible, finding.String())
+	}
+	if len(impossible) > 0 {
+		return fmt.Errorf("%d impossible travels between console logins:\n%s", len(impossible), strings.Join(impossible, "\n"))
+	}
+	log.Printf("No impossible travel in %d travels between console logins.\n", len(findings))
+	return nil
+}
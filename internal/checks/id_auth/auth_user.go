@@ -1,6 +1,8 @@
 package id_auth
 
 import (
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/scope"
 	"context"
 	"fmt"
 	"log"
@@ -28,18 +30,22 @@ func CheckAWSUserCompliance(cfg aws.Config, iamClient IAMServiceInterface) error
 	}
 
 	for _, user := range usersOutput.Users {
-		// For each user, check if MFA is enabled
-		mfaOutput, err := iamClient.ListMFADevices(ctx, &iam.ListMFADevicesInput{
-			UserName: user.UserName,
-		})
+		if !scope.Includes(cfg, models.AssetTypeIAMUser, *user.UserName) {
+			continue
+		}
+		// For each user, check if MFA is enabled with a device strong enough
+		devices, err := ListMFADeviceTypes(*user.UserName, iamClient)
 		if err != nil {
-			return fmt.Errorf("failed to list MFA devices for user %s: %v", *user.UserName, err)
+			return err
 		}
 
-		if len(mfaOutput.MFADevices) == 0 {
+		if len(devices) == 0 {
 			return fmt.Errorf("MFA is not enabled for user %s", *user.UserName)
 
 		}
+		if required := RequiredMFADevice(IsPrivilegedUser(*user.UserName)); !MeetsMFARequirement(devices, required) {
+			return fmt.Errorf("user %s has only %v MFA devices, %s required", *user.UserName, devices, required)
+		}
 		log.Printf("User %s is compliant\n", *user.UserName)
 
 	}
@@ -1,6 +1,8 @@
 package id_auth
 
 import (
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/scope"
 	"context"
 	"errors"
 	"fmt"
@@ -10,6 +12,7 @@ import (
 	"time"
 
 	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/credreport"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
@@ -60,12 +63,18 @@ func isIdentifierReusable(createDate time.Time, reusePreventionPeriod string) (b
 	return true, nil
 }
 
-// Function to check if a user's status matches the required status
-func checkIdentifierStatus(user *types.User, requiredStatus string) error {
-	for _, tag := range user.Tags {
-		if aws.ToString(tag.Key) == "Status" && aws.ToString(tag.Value) != requiredStatus {
-			return fmt.Errorf("user %s has status %s, expected %s", aws.ToString(user.UserName), aws.ToString(tag.Value), requiredStatus)
+// Function to check that an identifier is disabled after the inactivity period, from the credential report
+func checkIdentifierStatus(user *types.User, report *credreport.Report, inactiveDays int) error {
+	entry, ok := report.Entry(aws.ToString(user.UserName))
+	if !ok {
+		return fmt.Errorf("user %s not found in the credential report", aws.ToString(user.UserName))
+	}
+	if entry.IsInactive(inactiveDays, time.Now()) {
+		last := "never"
+		if activity := entry.LastActivity(); activity != nil {
+			last = activity.Format("2006-01-02")
 		}
+		return fmt.Errorf("user %s is inactive for more than %d days (last activity %s) but its identifier is still enabled", aws.ToString(user.UserName), inactiveDays, last)
 	}
 	return nil
 }
@@ -83,6 +92,13 @@ func CheckIAM(cfg aws.Config) error {
 		return err
 	}
 
+	// The status of the identifiers comes from the credential report
+	report, err := credreport.Cached(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to get the credential report: %v", err)
+	}
+	inactiveDays := credreport.ConfiguredThresholds().InactiveDays
+
 	// Variable to store errors for non-compliant users
 	var errorMessages []string
 
@@ -92,6 +108,9 @@ func CheckIAM(cfg aws.Config) error {
 
 	// Loop through the IAM users and perform the necessary checks
 	for _, user := range result.Users {
+		if !scope.Includes(cfg, models.AssetTypeIAMUser, aws.ToString(user.UserName)) {
+			continue
+		}
 		log.Printf("\n\n--- Checking user: %s ---\n", aws.ToString(user.UserName))
 
 		// 1. Check if the role assigning this identifier is authorized
@@ -139,9 +158,9 @@ func CheckIAM(cfg aws.Config) error {
 		}
 		log.Printf("Identifier for user %s is reusable.\n", aws.ToString(user.UserName))
 
-		// 3. Check if the user has the correct status (active/inactive)
+		// 3. Check that the identifier is disabled if inactive
 		log.Printf("Checking status for user %s...\n", aws.ToString(user.UserName))
-		err = checkIdentifierStatus(&user, config.AppConfig.AWS.IdentifierManagement.IdentifierCharacteristics)
+		err = checkIdentifierStatus(&user, report, inactiveDays)
 		if err != nil {
 			errorMessages = append(errorMessages, err.Error())
 			log.Println(err.Error())
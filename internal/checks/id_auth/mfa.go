@@ -1,12 +1,18 @@
 package id_auth
 
 import (
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/scope"
 	"context"
 	"fmt"
 	"log"
+	"strings"
 
 	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/credreport"
+	"cloud_compliance_checker/policy"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 )
 
@@ -14,9 +20,79 @@ import (
 type IAMUser struct {
 	UserName     string
 	MFAEnabled   bool
+	MFADevices   []MFADeviceType
 	IsPrivileged bool
 }
 
+// MFADeviceType is the kind of an MFA device, from the weakest to the strongest
+type MFADeviceType string
+
+// MFA device types
+const (
+	MFADeviceVirtual  MFADeviceType = "virtual"  // authenticator app (TOTP)
+	MFADeviceHardware MFADeviceType = "hardware" // hardware TOTP token
+	MFADeviceFIDO     MFADeviceType = "fido"     // FIDO security key or passkey, phishing-resistant
+)
+
+// mfaStrength orders the device types
+var mfaStrength = map[MFADeviceType]int{
+	MFADeviceVirtual:  1,
+	MFADeviceHardware: 2,
+	MFADeviceFIDO:     3,
+}
+
+// Default device requirements
+const (
+	defaultUserDevice       = MFADeviceVirtual
+	defaultPrivilegedDevice = MFADeviceHardware
+)
+
+// ClassifyMFADevice returns the type of an IAM MFA device from its serial number: FIDO security keys
+// are arn:aws:iam::<account>:u2f/..., virtual devices arn:aws:iam::<account>:mfa/... and hardware
+// tokens have the serial number printed on the token.
+func ClassifyMFADevice(serial string) MFADeviceType {
+	switch {
+	case strings.Contains(serial, ":u2f/"):
+		return MFADeviceFIDO
+	case strings.HasPrefix(serial, "arn:") && strings.Contains(serial, ":mfa/"):
+		return MFADeviceVirtual
+	default:
+		return MFADeviceHardware
+	}
+}
+
+// MeetsMFARequirement checks if one of the devices is at least as strong as the required type
+func MeetsMFARequirement(devices []MFADeviceType, required MFADeviceType) bool {
+	for _, device := range devices {
+		if mfaStrength[device] >= mfaStrength[required] {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiredMFADevice returns the minimum MFA device of a user: privileged_device for the privileged
+// users (is_privileged), user_device for the others
+func RequiredMFADevice(privileged bool) MFADeviceType {
+	c := config.AppConfig.AWS.MFA
+	if privileged {
+		return parseDeviceType(c.PrivilegedDevice, defaultPrivilegedDevice)
+	}
+	return parseDeviceType(c.UserDevice, defaultUserDevice)
+}
+
+// parseDeviceType parses a device type of the configuration, def when not set or unknown
+func parseDeviceType(value string, def MFADeviceType) MFADeviceType {
+	device := MFADeviceType(strings.ToLower(value))
+	if _, ok := mfaStrength[device]; !ok {
+		if value != "" {
+			log.Printf("Unknown MFA device type %q, using %s\n", value, def)
+		}
+		return def
+	}
+	return device
+}
+
 // ListIAMUsers fetches all IAM users in the AWS account.
 func ListIAMUsers(iamClient *iam.Client) ([]IAMUser, error) {
 	var iamUsers []IAMUser
@@ -34,15 +110,15 @@ func ListIAMUsers(iamClient *iam.Client) ([]IAMUser, error) {
 
 		// For each IAM user, check their MFA status and add to the list.
 		for _, user := range page.Users {
-			isMFAEnabled, err := CheckMFAEnabled(*user.UserName, iamClient)
+			devices, err := ListMFADeviceTypes(*user.UserName, iamClient)
 			if err != nil {
-				log.Printf("Failed to check MFA for user %s: %v\n", *user.UserName, err)
-				continue
+				return nil, err
 			}
 
 			iamUsers = append(iamUsers, IAMUser{
 				UserName:     *user.UserName,
-				MFAEnabled:   isMFAEnabled,
+				MFAEnabled:   len(devices) > 0,
+				MFADevices:   devices,
 				IsPrivileged: IsPrivilegedUser(*user.UserName),
 			})
 		}
@@ -53,19 +129,30 @@ func ListIAMUsers(iamClient *iam.Client) ([]IAMUser, error) {
 
 // CheckMFAEnabled checks if the given user has MFA enabled.
 func CheckMFAEnabled(userName string, iamClient *iam.Client) (bool, error) {
-	// Get the MFA devices associated with the user.
-	input := &iam.ListMFADevicesInput{
-		UserName: &userName,
+	devices, err := ListMFADeviceTypes(userName, iamClient)
+	if err != nil {
+		return false, err
 	}
 
+	// If the user has at least one MFA device, return true.
+	return len(devices) > 0, nil
+}
+
+// ListMFADeviceTypes returns the types of the MFA devices of the given user.
+func ListMFADeviceTypes(userName string, iamClient IAMServiceInterface) ([]MFADeviceType, error) {
 	// Fetch the MFA devices for the user.
-	result, err := iamClient.ListMFADevices(context.TODO(), input)
+	result, err := iamClient.ListMFADevices(context.TODO(), &iam.ListMFADevicesInput{
+		UserName: &userName,
+	})
 	if err != nil {
-		return false, fmt.Errorf("failed to list MFA devices for user %s: %w", userName, err)
+		return nil, fmt.Errorf("failed to list MFA devices for user %s: %w", userName, err)
 	}
 
-	// If the user has at least one MFA device, return true.
-	return len(result.MFADevices) > 0, nil
+	var devices []MFADeviceType
+	for _, device := range result.MFADevices {
+		devices = append(devices, ClassifyMFADevice(aws.ToString(device.SerialNumber)))
+	}
+	return devices, nil
 }
 
 // IsPrivilegedUser checks if a user is considered privileged based on their attached policies or roles in the config.
@@ -157,3 +244,110 @@ func EnforceMFAForUsers(iamClient *iam.Client) error {
 
 	return nil
 }
+
+// CheckMFA checks the MFA of the IAM users and of the IAM Identity Center users:
+//   - users with console access, or with mfa_required, have an MFA device at least as strong as
+//     user_device, or privileged_device for the privileged users
+//   - the policies of the IAM users deny the privileged actions without MFA, to the access keys and to the console
+//   - the IAM Identity Center users sign in with an MFA device at least as strong as required
+func CheckMFA(cfg aws.Config) error {
+	log.Println("Starting MFA check...")
+	iamClient := iam.NewFromConfig(cfg)
+
+	var issues []string
+
+	// MFA devices of the IAM users
+	report, err := credreport.Cached(cfg)
+	if err != nil {
+		return fmt.Errorf("unable to analyze the credential report: %v", err)
+	}
+	users, err := ListIAMUsers(iamClient)
+	if err != nil {
+		return fmt.Errorf("failed to list IAM users: %w", err)
+	}
+	for _, user := range users {
+		if !scope.Includes(cfg, models.AssetTypeIAMUser, user.UserName) {
+			continue
+		}
+		entry, _ := report.Entry(user.UserName)
+		if !entry.PasswordEnabled && !isMFARequired(user.UserName) {
+			continue
+		}
+		required := RequiredMFADevice(user.IsPrivileged)
+		switch {
+		case !user.MFAEnabled:
+			issues = append(issues, fmt.Sprintf("%s: no MFA device", user.UserName))
+		case !MeetsMFARequirement(user.MFADevices, required):
+			issues = append(issues, fmt.Sprintf("%s: %v MFA devices, %s required", user.UserName, user.MFADevices, required))
+		default:
+			log.Printf("User %s has the required MFA devices %v\n", user.UserName, user.MFADevices)
+		}
+	}
+
+	// MFA enforced by the policies for the privileged actions
+	policyIssues, err := mfaPolicyIssues(cfg)
+	if err != nil {
+		return fmt.Errorf("unable to evaluate the MFA policies: %v", err)
+	}
+	issues = append(issues, policyIssues...)
+
+	// IAM Identity Center sign-ins
+	signInIssues, err := identityCenterMFAIssues(cfg)
+	if err != nil {
+		return fmt.Errorf("unable to check the IAM Identity Center sign-ins: %v", err)
+	}
+	issues = append(issues, signInIssues...)
+
+	if len(issues) > 0 {
+		for _, issue := range issues {
+			log.Printf("ERROR: %s\n", issue)
+		}
+		return fmt.Errorf("MFA issues found:\n%s", strings.Join(issues, "\n"))
+	}
+
+	log.Println("\n--- MFA check completed ---")
+	return nil
+}
+
+// isMFARequired checks if the configuration requires MFA for the user even without console access
+func isMFARequired(userName string) bool {
+	for _, user := range config.AppConfig.AWS.Users {
+		if user.Name == userName && user.MFARequired {
+			return true
+		}
+	}
+	return false
+}
+
+// mfaPolicyIssues evaluates the policies of every IAM user and reports the privileged actions
+// allowed without MFA, with the sessions (access keys, console) that can use them
+func mfaPolicyIssues(cfg aws.Config) ([]string, error) {
+	account, err := policy.CachedAccount(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []string
+	for _, user := range account.Users() {
+		if !scope.Includes(cfg, models.AssetTypeIAMUser, user.Name) {
+			continue
+		}
+		set := account.PolicySet(user, "")
+		withoutMFA := map[string][]string{}
+		for _, action := range policy.PrivilegedActions() {
+			if !policy.Evaluate(policy.Request{Principal: user.ARN, Action: action}, set).Allowed() {
+				continue
+			}
+			for _, session := range policy.SessionsWithoutMFA(user.ARN, action, set) {
+				withoutMFA[session] = append(withoutMFA[session], action)
+			}
+		}
+		for _, session := range []string{policy.SessionAccessKeys, policy.SessionConsole} {
+			if actions := withoutMFA[session]; len(actions) > 0 {
+				issues = append(issues, fmt.Sprintf("%s: privileged actions allowed without MFA with %s: %s",
+					user.Name, session, strings.Join(actions, ", ")))
+			}
+		}
+	}
+	return issues, nil
+}
@@ -0,0 +1,215 @@
+package id_auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud_compliance_checker/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	cloudtrailtypes "github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssoadmin"
+)
+
+// Sign-in history analyzed, in days
+const (
+	defaultSignInDays = 30
+	maxSignInDays     = 90
+)
+
+// signInEvents are the CloudTrail events of the IAM Identity Center sign-in workflow
+var signInEvents = map[string]bool{
+	"CredentialChallenge":    true,
+	"CredentialVerification": true,
+	"UserAuthentication":     true,
+}
+
+// mfaCredentialTypes maps the credential types of the sign-in events to the MFA device types.
+// Hardware TOTP tokens can't be told apart from authenticator apps.
+var mfaCredentialTypes = map[string]MFADeviceType{
+	"TOTP":      MFADeviceVirtual,
+	"EMAIL_OTP": MFADeviceVirtual,
+	"WEBAUTHN":  MFADeviceFIDO,
+}
+
+// IdentityCenterSignIn is a sign-in of an IAM Identity Center user, built from the events of its workflow
+type IdentityCenterSignIn struct {
+	Workflow    string
+	User        string
+	Time        time.Time
+	Credentials []string // PASSWORD, TOTP, WEBAUTHN, EXTERNAL_IDP, ...
+	Success     bool
+}
+
+// Device returns the strongest MFA device used by the sign-in, empty without MFA
+func (s IdentityCenterSignIn) Device() MFADeviceType {
+	var device MFADeviceType
+	for _, credential := range s.Credentials {
+		if d, ok := mfaCredentialTypes[credential]; ok && mfaStrength[d] > mfaStrength[device] {
+			device = d
+		}
+	}
+	return device
+}
+
+// UsesPassword checks if the user signed in with the password of the Identity Center directory
+func (s IdentityCenterSignIn) UsesPassword() bool {
+	for _, credential := range s.Credentials {
+		if credential == "PASSWORD" {
+			return true
+		}
+	}
+	return false
+}
+
+// signInRecord holds the fields of the sign-in events
+type signInRecord struct {
+	EventName    string    `json:"eventName"`
+	EventTime    time.Time `json:"eventTime"`
+	UserIdentity struct {
+		UserName string `json:"userName"`
+	} `json:"userIdentity"`
+	ServiceEventDetails map[string]interface{} `json:"serviceEventDetails"`
+	AdditionalEventData struct {
+		AuthWorkflowID string `json:"AuthWorkflowID"`
+		CredentialType string `json:"CredentialType"`
+	} `json:"additionalEventData"`
+}
+
+// ParseSignInEvents groups the CloudTrail sign-in events by workflow. A sign-in is successful when
+// one of its events succeeded; only the credentials verified successfully are kept.
+func ParseSignInEvents(raw []string) []IdentityCenterSignIn {
+	workflows := map[string]*IdentityCenterSignIn{}
+	for _, event := range raw {
+		var record signInRecord
+		if err := json.Unmarshal([]byte(event), &record); err != nil || !signInEvents[record.EventName] {
+			continue
+		}
+		id := record.AdditionalEventData.AuthWorkflowID
+		if id == "" {
+			continue
+		}
+		signIn, ok := workflows[id]
+		if !ok {
+			signIn = &IdentityCenterSignIn{Workflow: id}
+			workflows[id] = signIn
+		}
+		if record.UserIdentity.UserName != "" {
+			signIn.User = record.UserIdentity.UserName
+		}
+		if record.EventTime.After(signIn.Time) {
+			signIn.Time = record.EventTime
+		}
+
+		if outcome, _ := record.ServiceEventDetails[record.EventName].(string); outcome != "Success" {
+			continue
+		}
+		signIn.Success = true
+		for _, credential := range strings.Split(record.AdditionalEventData.CredentialType, ",") {
+			if credential = strings.TrimSpace(credential); credential != "" && !containsString(signIn.Credentials, credential) {
+				signIn.Credentials = append(signIn.Credentials, credential)
+			}
+		}
+	}
+
+	signIns := make([]IdentityCenterSignIn, 0, len(workflows))
+	for _, signIn := range workflows {
+		signIns = append(signIns, *signIn)
+	}
+	sort.Slice(signIns, func(i, j int) bool { return signIns[i].Time.Before(signIns[j].Time) })
+	return signIns
+}
+
+// EvaluateSignIns reports, for each user whose last password sign-in used no MFA or a device weaker than
+// required, that sign-in. Sign-ins through an external identity provider are not evaluated.
+func EvaluateSignIns(signIns []IdentityCenterSignIn) []string {
+	weak := map[string]string{}
+	for _, signIn := range signIns {
+		if !signIn.Success || !signIn.UsesPassword() || signIn.User == "" {
+			continue
+		}
+		required := RequiredMFADevice(IsPrivilegedUser(signIn.User))
+		device := signIn.Device()
+		switch {
+		case device == "":
+			weak[signIn.User] = fmt.Sprintf("%s: IAM Identity Center sign-in without MFA on %s", signIn.User, signIn.Time.Format(time.RFC3339))
+		case mfaStrength[device] < mfaStrength[required]:
+			weak[signIn.User] = fmt.Sprintf("%s: IAM Identity Center sign-in with a %s MFA device on %s, %s required",
+				signIn.User, device, signIn.Time.Format(time.RFC3339), required)
+		default:
+			delete(weak, signIn.User)
+		}
+	}
+
+	issues := make([]string, 0, len(weak))
+	for _, issue := range weak {
+		issues = append(issues, issue)
+	}
+	sort.Strings(issues)
+	return issues
+}
+
+// identityCenterMFAIssues evaluates the sign-ins of the IAM Identity Center users recorded by CloudTrail.
+// The MFA settings of Identity Center can't be read with the API: the sign-ins show how they are applied.
+func identityCenterMFAIssues(cfg aws.Config) ([]string, error) {
+	if config.AppConfig.AWS.PasswordPolicy.IdentityCenterExternalIdP {
+		log.Println("IAM Identity Center uses an external IdP: MFA is enforced by the IdP")
+		return nil, nil
+	}
+	ctx := context.TODO()
+	instances, err := identityCenterInstances(ctx, ssoadmin.NewFromConfig(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list IAM Identity Center instances: %v", err)
+	}
+	if len(instances) == 0 {
+		return nil, nil
+	}
+
+	days := config.AppConfig.AWS.MFA.SignInDays
+	if days <= 0 {
+		days = defaultSignInDays
+	}
+	if days > maxSignInDays {
+		days = maxSignInDays
+	}
+
+	var raw []string
+	paginator := cloudtrail.NewLookupEventsPaginator(cloudtrail.NewFromConfig(cfg), &cloudtrail.LookupEventsInput{
+		LookupAttributes: []cloudtrailtypes.LookupAttribute{{
+			AttributeKey:   cloudtrailtypes.LookupAttributeKeyEventSource,
+			AttributeValue: aws.String("signin.amazonaws.com"),
+		}},
+		StartTime: aws.Time(time.Now().AddDate(0, 0, -days)),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up the sign-in events: %v", err)
+		}
+		for _, event := range page.Events {
+			if signInEvents[aws.ToString(event.EventName)] {
+				raw = append(raw, aws.ToString(event.CloudTrailEvent))
+			}
+		}
+	}
+
+	signIns := ParseSignInEvents(raw)
+	log.Printf("%d IAM Identity Center sign-ins in the last %d days\n", len(signIns), days)
+	return EvaluateSignIns(signIns), nil
+}
+
+// containsString checks if the list contains the value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package id_auth
+
+import (
+	"testing"
+
+	"cloud_compliance_checker/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyMFADevice(t *testing.T) {
+	assert.Equal(t, MFADeviceFIDO, ClassifyMFADevice("arn:aws:iam::111111111111:u2f/user/alice/fidosecuritykey-ABCDEFGHIJ"))
+	assert.Equal(t, MFADeviceVirtual, ClassifyMFADevice("arn:aws:iam::111111111111:mfa/alice"))
+	assert.Equal(t, MFADeviceHardware, ClassifyMFADevice("GAHT12345678"))
+
+	assert.True(t, MeetsMFARequirement([]MFADeviceType{MFADeviceVirtual, MFADeviceFIDO}, MFADeviceHardware))
+	assert.False(t, MeetsMFARequirement([]MFADeviceType{MFADeviceVirtual}, MFADeviceHardware))
+	assert.False(t, MeetsMFARequirement(nil, MFADeviceVirtual))
+}
+
+func TestEvaluateSignIns(t *testing.T) {
+	config.AppConfig.AWS.Users = []config.User{{Name: "admin", IsPrivileged: true}}
+	config.AppConfig.AWS.MFA = config.MFAConfig{}
+	defer func() { config.AppConfig.AWS.Users = nil }()
+
+	events := []string{
+		// alice: password and authenticator app
+		`{"eventName":"CredentialVerification","eventTime":"2024-05-01T10:00:00Z","userIdentity":{"userName":"alice"},
+			"serviceEventDetails":{"CredentialVerification":"Success"},"additionalEventData":{"AuthWorkflowID":"w1","CredentialType":"PASSWORD"}}`,
+		`{"eventName":"CredentialVerification","eventTime":"2024-05-01T10:00:10Z","userIdentity":{"userName":"alice"},
+			"serviceEventDetails":{"CredentialVerification":"Success"},"additionalEventData":{"AuthWorkflowID":"w1","CredentialType":"TOTP"}}`,
+		// admin: privileged with an authenticator app only
+		`{"eventName":"UserAuthentication","eventTime":"2024-05-02T10:00:00Z","userIdentity":{"userName":"admin"},
+			"serviceEventDetails":{"UserAuthentication":"Success"},"additionalEventData":{"AuthWorkflowID":"w2","CredentialType":"PASSWORD,TOTP"}}`,
+		// bob: password only
+		`{"eventName":"UserAuthentication","eventTime":"2024-05-03T10:00:00Z","userIdentity":{"userName":"bob"},
+			"serviceEventDetails":{"UserAuthentication":"Success"},"additionalEventData":{"AuthWorkflowID":"w3","CredentialType":"PASSWORD"}}`,
+		// carol: failed security key, not a sign-in
+		`{"eventName":"CredentialVerification","eventTime":"2024-05-04T10:00:00Z","userIdentity":{"userName":"carol"},
+			"serviceEventDetails":{"CredentialVerification":"Failure"},"additionalEventData":{"AuthWorkflowID":"w4","CredentialType":"PASSWORD"}}`,
+		// dave: password only, then password and authenticator app
+		`{"eventName":"UserAuthentication","eventTime":"2024-05-05T10:00:00Z","userIdentity":{"userName":"dave"},
+			"serviceEventDetails":{"UserAuthentication":"Success"},"additionalEventData":{"AuthWorkflowID":"w5","CredentialType":"PASSWORD"}}`,
+		`{"eventName":"UserAuthentication","eventTime":"2024-05-06T10:00:00Z","userIdentity":{"userName":"dave"},
+			"serviceEventDetails":{"UserAuthentication":"Success"},"additionalEventData":{"AuthWorkflowID":"w6","CredentialType":"PASSWORD,TOTP"}}`,
+	}
+
+	signIns := ParseSignInEvents(events)
+	if assert.Len(t, signIns, 6) {
+		assert.Equal(t, []string{"PASSWORD", "TOTP"}, signIns[0].Credentials)
+		assert.Equal(t, MFADeviceVirtual, signIns[0].Device())
+		assert.False(t, signIns[3].Success)
+	}
+
+	issues := EvaluateSignIns(signIns)
+	if assert.Len(t, issues, 2) {
+		assert.Contains(t, issues[0], "admin: IAM Identity Center sign-in with a virtual MFA device")
+		assert.Contains(t, issues[1], "bob: IAM Identity Center sign-in without MFA")
+	}
+}
@@ -2,12 +2,18 @@ package id_auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+
+	"cloud_compliance_checker/config"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssoadmin"
 )
 
 /*
@@ -17,99 +23,290 @@ aws iam update-account-password-policy \
   --require-numbers \
   --require-uppercase-characters \
   --require-lowercase-characters \
+  --max-password-age 90 \
+  --password-reuse-prevention 24 \
   --allow-users-to-change-password
 
 */
-// Function to check password policy enforcement on AWS
+
+// Sources of the password policies
+const (
+	PasswordSourceIAM            = "IAM"
+	PasswordSourceIdentityCenter = "IAM Identity Center"
+	PasswordSourceCognito        = "Cognito"
+)
+
+// PasswordRules is a password policy normalized across IAM, Identity Center and Cognito.
+// Settings a source can't enforce are left unsupported: they are limitations of the source, not findings.
+type PasswordRules struct {
+	MinLength        int
+	RequireNumbers   bool
+	RequireSymbols   bool
+	RequireUppercase bool
+	RequireLowercase bool
+	MaxAgeDays       int // 0 = passwords never expire
+	ReusePrevention  int // 0 = reuse allowed
+	HardExpiry       bool
+
+	MaxAgeSupported     bool
+	HardExpirySupported bool
+}
+
+// PasswordPolicyFinding is a setting of a password policy missing or weaker than the configuration
+type PasswordPolicyFinding struct {
+	Source   string // IAM, IAM Identity Center, Cognito
+	Resource string // account, instance or user pool
+	Setting  string
+	Expected string
+	Actual   string
+}
+
+// String formats the finding for the check response
+func (f PasswordPolicyFinding) String() string {
+	return fmt.Sprintf("%s %s: %s is %s, expected %s", f.Source, f.Resource, f.Setting, f.Actual, f.Expected)
+}
+
+// identityCenterRules is the fixed password policy of the IAM Identity Center directory
+var identityCenterRules = PasswordRules{
+	MinLength:        8,
+	RequireNumbers:   true,
+	RequireSymbols:   true,
+	RequireUppercase: true,
+	RequireLowercase: true,
+	ReusePrevention:  3,
+}
+
+// CheckPasswordPolicyEnforcement checks the IAM account password policy and, where present, the password
+// policies of IAM Identity Center and of the Cognito user pools against the configured password policy.
+// It fails when a policy is missing or weaker than the configuration. Settings a source can't enforce
+// are logged once as limitations.
 func CheckPasswordPolicyEnforcement(cfg aws.Config) error {
-	iamClient := iam.NewFromConfig(cfg)
+	findings, limitations, err := EvaluatePasswordPolicies(cfg)
+	if err != nil {
+		return err
+	}
+	for _, limitation := range limitations {
+		log.Printf("Limitation: %s\n", limitation)
+	}
+	if len(findings) > 0 {
+		var messages []string
+		for _, finding := range findings {
+			messages = append(messages, finding.String())
+		}
+		return fmt.Errorf("password policies weaker than required:\n%s", strings.Join(messages, "\n"))
+	}
 
-	// Get the account password policy from AWS
-	log.Println("Retrieving AWS IAM password policy...")
-	passwordPolicyInput := &iam.GetAccountPasswordPolicyInput{}
-	policy, err := iamClient.GetAccountPasswordPolicy(context.TODO(), passwordPolicyInput)
+	log.Println("\n--- Password policy check completed ---")
+	return nil
+}
+
+// EvaluatePasswordPolicies compares the password policies of the account with the configuration. It also
+// returns the configured settings that IAM Identity Center or Cognito can't enforce, once per source.
+func EvaluatePasswordPolicies(cfg aws.Config) ([]PasswordPolicyFinding, []string, error) {
+	expected := config.AppConfig.AWS.PasswordPolicy
+	ctx := context.TODO()
 
-	// Handle the case when no password policy is set using type assertion
+	// IAM account password policy
+	log.Println("Retrieving AWS IAM password policy...")
+	findings, err := iamPasswordFindings(ctx, iam.NewFromConfig(cfg), expected)
 	if err != nil {
-		if _, ok := err.(*types.NoSuchEntityException); ok {
-			// If no password policy is set, print a friendly message and return
-			log.Println("No password policy is set for the AWS account. Please configure a password policy to enforce complexity.")
-			return nil // No need to return an error since this might be expected
+		return nil, nil, err
+	}
+	var limitations []string
+
+	// IAM Identity Center directory
+	if expected.IdentityCenterExternalIdP {
+		log.Println("IAM Identity Center uses an external IdP: password policy not checked")
+	} else {
+		instances, err := identityCenterInstances(ctx, ssoadmin.NewFromConfig(cfg))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list the IAM Identity Center instances: %v", err)
 		}
-		// If there's any other error, print it
-		log.Printf("Error retrieving password policy: %v\n", err)
-		return fmt.Errorf("failed to get password policy: %v", err)
+		for _, instance := range instances {
+			findings = append(findings, ComparePasswordPolicy(PasswordSourceIdentityCenter, instance, expected, identityCenterRules)...)
+		}
+		if len(instances) > 0 {
+			limitations = append(limitations, PasswordLimitations(PasswordSourceIdentityCenter, expected, identityCenterRules)...)
+		}
+	}
+
+	// Cognito user pools of the configured regions
+	pools := 0
+	for _, region := range cognitoRegions(cfg) {
+		client := cognitoidentityprovider.NewFromConfig(cfg, func(o *cognitoidentityprovider.Options) {
+			o.Region = region
+		})
+		found, n, err := cognitoPasswordFindings(ctx, client, expected)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to check the Cognito user pools of %s: %v", region, err)
+		}
+		findings = append(findings, found...)
+		pools += n
+	}
+	if pools > 0 {
+		limitations = append(limitations, PasswordLimitations(PasswordSourceCognito, expected, PasswordRules{})...)
+	}
+
+	for _, finding := range findings {
+		log.Printf("NOT COMPLIANT: %s\n", finding)
 	}
+	return findings, limitations, nil
+}
 
-	// If the password policy is nil (which should not happen after the above check)
-	if policy.PasswordPolicy == nil {
-		log.Println("No password policy found in the AWS account.")
-		return fmt.Errorf("no password policy found in the AWS account")
+// cognitoRegions returns the region of the configuration and the regions of the CUI scope
+func cognitoRegions(cfg aws.Config) []string {
+	var regions []string
+	seen := map[string]bool{}
+	for _, region := range append([]string{cfg.Region}, config.AppConfig.AWS.CUIScope.Regions...) {
+		if region != "" && !seen[region] {
+			seen[region] = true
+			regions = append(regions, region)
+		}
 	}
+	return regions
+}
 
-	// Start comparing the fetched AWS password policy with expected settings
-	log.Printf("\n--- AWS Password Policy Retrieved ---\n")
-	log.Printf("Minimum Password Length: %d\n", *policy.PasswordPolicy.MinimumPasswordLength)
-	log.Printf("Require Numbers: %t\n", policy.PasswordPolicy.RequireNumbers)
-	log.Printf("Require Symbols: %t\n", policy.PasswordPolicy.RequireSymbols)
-	log.Printf("Require Uppercase Characters: %t\n", policy.PasswordPolicy.RequireUppercaseCharacters)
-	log.Printf("Require Lowercase Characters: %t\n", policy.PasswordPolicy.RequireLowercaseCharacters)
-	log.Println("--------------------------------------")
+// iamPasswordFindings compares the IAM account password policy; a missing policy is a finding
+// AccountPasswordFindings returns the settings of the IAM account password policy that are weaker than
+// password_policy in config.yaml
+func AccountPasswordFindings(cfg aws.Config) ([]PasswordPolicyFinding, error) {
+	return iamPasswordFindings(context.TODO(), iam.NewFromConfig(cfg), config.AppConfig.AWS.PasswordPolicy)
+}
 
-	// Checking AWS policy with expected values
-	log.Printf("\nChecking AWS password policy against expected values...\n")
+func iamPasswordFindings(ctx context.Context, client *iam.Client, expected config.PasswordPolicy) ([]PasswordPolicyFinding, error) {
+	output, err := client.GetAccountPasswordPolicy(ctx, &iam.GetAccountPasswordPolicyInput{})
+	if err != nil {
+		var noSuchEntity *types.NoSuchEntityException
+		if errors.As(err, &noSuchEntity) {
+			log.Println("No password policy is set for the AWS account.")
+			return []PasswordPolicyFinding{{Source: PasswordSourceIAM, Resource: "account", Setting: "password policy", Expected: "configured", Actual: "missing"}}, nil
+		}
+		log.Printf("Error retrieving password policy: %v\n", err)
+		return nil, fmt.Errorf("failed to get password policy: %v", err)
+	}
+	if output.PasswordPolicy == nil {
+		return []PasswordPolicyFinding{{Source: PasswordSourceIAM, Resource: "account", Setting: "password policy", Expected: "configured", Actual: "missing"}}, nil
+	}
 
-	// Check minimum password length (expected: 12)
-	expectedMinLength := 12
-	log.Printf("Checking minimum password length... AWS: %d, Expected: %d\n", *policy.PasswordPolicy.MinimumPasswordLength, expectedMinLength)
-	if *policy.PasswordPolicy.MinimumPasswordLength != int32(expectedMinLength) {
-		log.Printf("Result: NOT COMPLIANT\n")
-		log.Printf("Mismatch: Minimum password length. AWS: %d, Expected: %d\n", *policy.PasswordPolicy.MinimumPasswordLength, expectedMinLength)
-	} else {
-		log.Println("Minimum password length matches.")
+	p := output.PasswordPolicy
+	actual := PasswordRules{
+		MinLength:           int(aws.ToInt32(p.MinimumPasswordLength)),
+		RequireNumbers:      p.RequireNumbers,
+		RequireSymbols:      p.RequireSymbols,
+		RequireUppercase:    p.RequireUppercaseCharacters,
+		RequireLowercase:    p.RequireLowercaseCharacters,
+		ReusePrevention:     int(aws.ToInt32(p.PasswordReusePrevention)),
+		HardExpiry:          aws.ToBool(p.HardExpiry),
+		MaxAgeSupported:     true,
+		HardExpirySupported: true,
+	}
+	if p.ExpirePasswords {
+		actual.MaxAgeDays = int(aws.ToInt32(p.MaxPasswordAge))
 	}
+	return ComparePasswordPolicy(PasswordSourceIAM, "account", expected, actual), nil
+}
 
-	// Check if numbers are required (expected: true)
-	expectedRequireNumbers := true
-	log.Printf("Checking if numbers are required... AWS: %t, Expected: %t\n", policy.PasswordPolicy.RequireNumbers, expectedRequireNumbers)
-	if policy.PasswordPolicy.RequireNumbers != expectedRequireNumbers {
-		log.Printf("Result: NOT COMPLIANT\n")
-		log.Printf("Mismatch: Require numbers. AWS: %t, Expected: %t\n", policy.PasswordPolicy.RequireNumbers, expectedRequireNumbers)
-	} else {
-		log.Println("Number requirement matches.")
+// identityCenterInstances returns the ARNs of the IAM Identity Center instances
+func identityCenterInstances(ctx context.Context, client *ssoadmin.Client) ([]string, error) {
+	var instances []string
+	paginator := ssoadmin.NewListInstancesPaginator(client, &ssoadmin.ListInstancesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return instances, err
+		}
+		for _, instance := range page.Instances {
+			instances = append(instances, aws.ToString(instance.InstanceArn))
+		}
 	}
+	return instances, nil
+}
 
-	// Check if symbols are required (expected: true)
-	expectedRequireSymbols := true
-	log.Printf("Checking if symbols are required... AWS: %t, Expected: %t\n", policy.PasswordPolicy.RequireSymbols, expectedRequireSymbols)
-	if policy.PasswordPolicy.RequireSymbols != expectedRequireSymbols {
-		log.Printf("Result: NOT COMPLIANT\n")
-		log.Printf("Mismatch: Require symbols. AWS: %t, Expected: %t\n", policy.PasswordPolicy.RequireSymbols, expectedRequireSymbols)
-	} else {
-		log.Println("Symbol requirement matches.")
+// cognitoPasswordFindings compares the password policy of every Cognito user pool of the client region
+// and returns the number of pools
+func cognitoPasswordFindings(ctx context.Context, client *cognitoidentityprovider.Client, expected config.PasswordPolicy) ([]PasswordPolicyFinding, int, error) {
+	var findings []PasswordPolicyFinding
+	pools := 0
+	paginator := cognitoidentityprovider.NewListUserPoolsPaginator(client, &cognitoidentityprovider.ListUserPoolsInput{MaxResults: aws.Int32(60)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, pool := range page.UserPools {
+			pools++
+			resource := fmt.Sprintf("%s (%s)", aws.ToString(pool.Name), aws.ToString(pool.Id))
+			described, err := client.DescribeUserPool(ctx, &cognitoidentityprovider.DescribeUserPoolInput{UserPoolId: pool.Id})
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to describe user pool %s: %v", resource, err)
+			}
+
+			var actual PasswordRules
+			if up := described.UserPool; up != nil && up.Policies != nil && up.Policies.PasswordPolicy != nil {
+				p := up.Policies.PasswordPolicy
+				actual = PasswordRules{
+					MinLength:        int(aws.ToInt32(p.MinimumLength)),
+					RequireNumbers:   p.RequireNumbers,
+					RequireSymbols:   p.RequireSymbols,
+					RequireUppercase: p.RequireUppercase,
+					RequireLowercase: p.RequireLowercase,
+					ReusePrevention:  int(aws.ToInt32(p.PasswordHistorySize)),
+				}
+			}
+			findings = append(findings, ComparePasswordPolicy(PasswordSourceCognito, resource, expected, actual)...)
+		}
 	}
+	return findings, pools, nil
+}
 
-	// Check if uppercase characters are required (expected: true)
-	expectedRequireUppercase := true
-	log.Printf("Checking if uppercase characters are required... AWS: %t, Expected: %t\n", policy.PasswordPolicy.RequireUppercaseCharacters, expectedRequireUppercase)
-	if policy.PasswordPolicy.RequireUppercaseCharacters != expectedRequireUppercase {
-		log.Printf("Result: NOT COMPLIANT\n")
-		log.Printf("Mismatch: Require uppercase characters. AWS: %t, Expected: %t\n", policy.PasswordPolicy.RequireUppercaseCharacters, expectedRequireUppercase)
-	} else {
-		log.Println("Uppercase character requirement matches.")
+// PasswordLimitations returns the configured settings that a source can't enforce
+func PasswordLimitations(source string, expected config.PasswordPolicy, rules PasswordRules) []string {
+	var limitations []string
+	if expected.MaxAgeDays > 0 && !rules.MaxAgeSupported {
+		limitations = append(limitations, fmt.Sprintf("%s can't enforce a maximum password age of %d days", source, expected.MaxAgeDays))
 	}
+	if expected.HardExpiry && !rules.HardExpirySupported {
+		limitations = append(limitations, fmt.Sprintf("%s can't enforce the hard expiry of the passwords", source))
+	}
+	return limitations
+}
 
-	// Check if lowercase characters are required (expected: true)
-	expectedRequireLowercase := true
-	log.Printf("Checking if lowercase characters are required... AWS: %t, Expected: %t\n", policy.PasswordPolicy.RequireLowercaseCharacters, expectedRequireLowercase)
-	if policy.PasswordPolicy.RequireLowercaseCharacters != expectedRequireLowercase {
-		log.Printf("Result: NOT COMPLIANT\n")
-		log.Printf("Mismatch: Require lowercase characters. AWS: %t, Expected: %t\n", policy.PasswordPolicy.RequireLowercaseCharacters, expectedRequireLowercase)
-	} else {
-		log.Println("Lowercase character requirement matches.")
+// ComparePasswordPolicy returns the settings of the actual policy that are weaker than the expected one.
+// Settings the source doesn't support are left to PasswordLimitations.
+func ComparePasswordPolicy(source, resource string, expected config.PasswordPolicy, actual PasswordRules) []PasswordPolicyFinding {
+	var findings []PasswordPolicyFinding
+	add := func(setting, want, got string) {
+		findings = append(findings, PasswordPolicyFinding{Source: source, Resource: resource, Setting: setting, Expected: want, Actual: got})
+	}
+	required := func(setting string, want, got bool) {
+		if want && !got {
+			add(setting, "required", "not required")
+		}
 	}
 
-	log.Println("\n--- Password policy check completed ---")
+	if actual.MinLength < expected.MinLength {
+		add("minimum length", fmt.Sprintf("at least %d", expected.MinLength), fmt.Sprint(actual.MinLength))
+	}
+	required("numbers", expected.RequireNumbers, actual.RequireNumbers)
+	required("symbols", expected.RequireSymbols, actual.RequireSymbols)
+	required("uppercase characters", expected.RequireUppercase, actual.RequireUppercase)
+	required("lowercase characters", expected.RequireLowercase, actual.RequireLowercase)
 
-	return nil
+	if expected.MaxAgeDays > 0 {
+		switch {
+		case !actual.MaxAgeSupported:
+			// A limitation of the source
+		case actual.MaxAgeDays == 0:
+			add("maximum age", fmt.Sprintf("at most %d days", expected.MaxAgeDays), "never expires")
+		case actual.MaxAgeDays > expected.MaxAgeDays:
+			add("maximum age", fmt.Sprintf("at most %d days", expected.MaxAgeDays), fmt.Sprintf("%d days", actual.MaxAgeDays))
+		}
+	}
+	if actual.ReusePrevention < expected.ReusePrevention {
+		add("reuse prevention", fmt.Sprintf("at least %d passwords", expected.ReusePrevention), fmt.Sprintf("%d passwords", actual.ReusePrevention))
+	}
+	if expected.HardExpiry && actual.HardExpirySupported && !actual.HardExpiry {
+		add("hard expiry", "enabled", "disabled")
+	}
+	return findings
 }
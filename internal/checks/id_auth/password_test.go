@@ -0,0 +1,44 @@
+package id_auth
+
+import (
+	"testing"
+
+	"cloud_compliance_checker/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComparePasswordPolicy(t *testing.T) {
+	expected := config.PasswordPolicy{
+		MinLength:        14,
+		RequireNumbers:   true,
+		RequireSymbols:   true,
+		RequireUppercase: true,
+		RequireLowercase: true,
+		MaxAgeDays:       90,
+		ReusePrevention:  24,
+	}
+
+	strong := PasswordRules{MinLength: 16, RequireNumbers: true, RequireSymbols: true, RequireUppercase: true,
+		RequireLowercase: true, MaxAgeDays: 60, ReusePrevention: 24, MaxAgeSupported: true, HardExpirySupported: true}
+	assert.Empty(t, ComparePasswordPolicy(PasswordSourceIAM, "account", expected, strong))
+
+	weak := strong
+	weak.MinLength, weak.RequireSymbols, weak.MaxAgeDays, weak.ReusePrevention = 8, false, 0, 5
+	settings := func(findings []PasswordPolicyFinding) []string {
+		var s []string
+		for _, f := range findings {
+			s = append(s, f.Setting)
+		}
+		return s
+	}
+	assert.Equal(t, []string{"minimum length", "symbols", "maximum age", "reuse prevention"},
+		settings(ComparePasswordPolicy(PasswordSourceIAM, "account", expected, weak)))
+
+	// Identity Center can't enforce a maximum age: a limitation, not a finding
+	findings := ComparePasswordPolicy(PasswordSourceIdentityCenter, "ssoins-1", expected, identityCenterRules)
+	assert.Equal(t, []string{"minimum length", "reuse prevention"}, settings(findings))
+	assert.Equal(t, []string{"IAM Identity Center can't enforce a maximum password age of 90 days"},
+		PasswordLimitations(PasswordSourceIdentityCenter, expected, identityCenterRules))
+	assert.Empty(t, PasswordLimitations(PasswordSourceIAM, expected, strong))
+}
@@ -1,8 +1,11 @@
 package inc
 
 import (
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/notify"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -65,12 +68,10 @@ func RunCheck(awsCfg aws.Config) error {
 	// Step 7: Analisi degli incidenti e notifica
 	if len(incidents) > 0 {
 		AnalyzeIncidents(incidents)
-		arn := "arn:aws:sns:us-east-1:682033472444:IncidentAlert"
 		for _, incident := range incidents {
-			err = NotifyViaSNS(snsClient, arn, incident)
-			if err != nil {
-				log.Fatalf("Errore nell'invio della notifica SNS: %v", err)
-				return err
+			// Una notifica non inviata non deve fermare il contenimento dell'incidente
+			if err := NotifyIncident(snsClient, incident); err != nil {
+				log.Printf("Errore nell'invio della notifica dell'incidente %s: %v\n", incident.EventName, err)
 			}
 		}
 		// Step 8: Contenimento degli incidenti (Isoliamo l'istanza mettendola nel gruppo di quarantena)
@@ -254,6 +255,27 @@ func AnalyzeIncidents(incidents []IncidentReport) {
 	}
 }
 
+// NotifyIncident invia la notifica dell'incidente tramite i canali configurati in notifications,
+// oppure al topic SNS sns_topic_arn se nessun canale è configurato.
+func NotifyIncident(snsClient *sns.Client, incident IncidentReport) error {
+	err := notify.Send(notify.Event{
+		Title:     fmt.Sprintf("Incidente rilevato: %s", incident.EventName),
+		Message:   fmt.Sprintf("Evento %s eseguito da %s sulla risorsa %s", incident.EventName, incident.User, incident.Resource),
+		Severity:  notify.SeverityCritical,
+		ControlID: "03.06.01",
+		Resource:  incident.Resource,
+		Time:      incident.Timestamp,
+	})
+	if !errors.Is(err, notify.ErrNotConfigured) {
+		return err
+	}
+
+	if config.AppConfig.AWS.SnsTopicArn == "" {
+		return fmt.Errorf("nessun canale di notifica configurato e sns_topic_arn mancante")
+	}
+	return NotifyViaSNS(snsClient, config.AppConfig.AWS.SnsTopicArn, incident)
+}
+
 // NotifyViaSNS invia una notifica SNS ai responsabili di sicurezza.
 func NotifyViaSNS(snsClient *sns.Client, topicARN string, incident IncidentReport) error {
 	message, err := json.Marshal(incident)
@@ -2,7 +2,9 @@ package incident_response
 
 import (
 	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/notify"
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -85,6 +87,17 @@ func CheckIncidentHandlingNoUpload(cfg aws.Config) error {
 
 // Send an SNS alert with the incident response status
 func SendAlert(cfg aws.Config, message string) error {
+	err := notify.Send(notify.Event{
+		Title:         "Incident handling",
+		Message:       message,
+		Severity:      notify.SeverityHigh,
+		ControlID:     "03.06.01",
+		CheckFunction: "CheckIRHandling",
+	})
+	if !errors.Is(err, notify.ErrNotConfigured) {
+		return err
+	}
+
 	topicArn := config.AppConfig.AWS.SnsTopicArn
 	fmt.Printf("Sending SNS alert with message: %s\n", message)
 	fmt.Printf("SNS topic ARN: %s\n", topicArn)
@@ -93,7 +106,7 @@ func SendAlert(cfg aws.Config, message string) error {
 	}
 	snsClient := sns.NewFromConfig(cfg)
 
-	_, err := snsClient.Publish(context.TODO(), &sns.PublishInput{
+	_, err = snsClient.Publish(context.TODO(), &sns.PublishInput{
 		Message:  &message,
 		TopicArn: &topicArn,
 	})
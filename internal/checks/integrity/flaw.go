@@ -1,6 +1,8 @@
 package integrity
 
 import (
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/scope"
 	"context"
 	"fmt"
 	"log"
@@ -57,6 +59,9 @@ func checkEC2OutdatedInstances(ctx context.Context, cfg aws.Config) error {
 
 	for _, reservation := range output.Reservations {
 		for _, instance := range reservation.Instances {
+			if !scope.Includes(cfg, models.AssetTypeEC2Instance, *instance.InstanceId) {
+				continue
+			}
 			log.Printf("Checking EC2 instance: %s (Instance Type: %s, State: %s)\n", *instance.InstanceId, instance.InstanceType, instance.State.Name)
 
 			// Check if instance has the latest kernel or OS version (simplified logic)
@@ -111,6 +116,9 @@ func checkEC2MissingPatches(ctx context.Context, cfg aws.Config) error {
 
 	// Step 3: Check for missing patches
 	for _, patchState := range patchStatesOutput.InstancePatchStates {
+		if !scope.Includes(cfg, models.AssetTypeEC2Instance, *patchState.InstanceId) {
+			continue
+		}
 		log.Printf("Checking EC2 instance patch state: %s\n", *patchState.InstanceId)
 
 		// Check if instance has missing patches
@@ -135,6 +143,9 @@ func checkRDSUpdates(ctx context.Context, cfg aws.Config) error {
 	}
 
 	for _, instance := range output.DBInstances {
+		if !scope.Includes(cfg, models.AssetTypeRDSInstance, *instance.DBInstanceIdentifier) {
+			continue
+		}
 		log.Printf("Checking RDS instance: %s (Engine: %s, Version: %s)\n", *instance.DBInstanceIdentifier, *instance.Engine, *instance.EngineVersion)
 
 		// Check if instance has pending security updates
@@ -159,6 +170,9 @@ func checkLambdaRuntimes(ctx context.Context, cfg aws.Config) error {
 	}
 
 	for _, function := range output.Functions {
+		if !scope.Includes(cfg, models.AssetTypeLambdaFunction, *function.FunctionName) {
+			continue
+		}
 		log.Printf("Checking Lambda function: %s (Runtime: %s)\n", *function.FunctionName, function.Runtime)
 
 		// Check if runtime is deprecated (simplified logic)
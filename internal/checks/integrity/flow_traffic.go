@@ -0,0 +1,77 @@
+package integrity
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/flowlogs"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// FlowLogReport analyzes the VPC Flow Log records of the configured sources
+func FlowLogReport(cfg aws.Config) (flowlogs.Report, error) {
+	opts, err := flowlogs.NewOptions(config.AppConfig.AWS.MissionEssentialConfig, config.AppConfig.AWS.FlowLogs)
+	if err != nil {
+		return flowlogs.Report{}, err
+	}
+	records, err := flowlogs.Cached(cfg)
+	if len(records) == 0 {
+		return flowlogs.Report{}, fmt.Errorf("failed to read VPC Flow Log records: %v", err)
+	}
+	if err != nil {
+		log.Printf("Some flow log sources were not read: %v\n", err)
+	}
+	return flowlogs.Analyze(records, opts), nil
+}
+
+// CheckFlowLogPorts checks that the accepted traffic of the VPC Flow Logs only uses the mission-essential
+// ports and protocols
+// 03.04.06
+func CheckFlowLogPorts(cfg aws.Config) error {
+	essential := config.AppConfig.AWS.MissionEssentialConfig
+	if len(essential.Ports) == 0 && len(essential.Protocols) == 0 {
+		log.Println("No mission-essential ports or protocols configured, flow log traffic not compared")
+		return nil
+	}
+
+	report, err := FlowLogReport(cfg)
+	if err != nil {
+		return err
+	}
+	if len(report.NonEssential) > 0 {
+		lines := make([]string, 0, len(report.NonEssential))
+		for _, usage := range report.NonEssential {
+			lines = append(lines, usage.String())
+		}
+		return fmt.Errorf("accepted traffic on non-essential ports or protocols in %d flow log records:\n%s",
+			report.Records, strings.Join(lines, "\n"))
+	}
+	log.Printf("All accepted traffic in %d flow log records uses mission-essential ports and protocols.\n", report.Records)
+	return nil
+}
+
+// CheckFlowLogTraffic checks the VPC Flow Logs for spikes of rejected traffic and for large transfers to
+// destinations outside flow_logs.known_destinations
+// 03.14.06
+func CheckFlowLogTraffic(cfg aws.Config) error {
+	report, err := FlowLogReport(cfg)
+	if err != nil {
+		return err
+	}
+
+	var issues []string
+	for _, spike := range report.Spikes {
+		issues = append(issues, "Rejected traffic spike at "+spike.String())
+	}
+	for _, egress := range report.Egress {
+		issues = append(issues, "Large egress to unknown destination "+egress.String())
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("unusual traffic in %d flow log records:\n%s", report.Records, strings.Join(issues, "\n"))
+	}
+	log.Printf("No unusual traffic in %d flow log records.\n", report.Records)
+	return nil
+}
@@ -1,6 +1,8 @@
 package integrity
 
 import (
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/scope"
 	"context"
 	"fmt"
 	"log"
@@ -124,6 +126,9 @@ func checkS3MalwareScanning(ctx context.Context, cfg aws.Config) error {
 	}
 
 	for _, bucket := range result.Buckets {
+		if !scope.Includes(cfg, models.AssetTypeS3Bucket, *bucket.Name) {
+			continue
+		}
 		log.Printf("Checking S3 bucket: %s for malware scanning mechanisms...\n", *bucket.Name)
 
 		// In a real implementation, you would check for Lambda functions triggered by S3 events
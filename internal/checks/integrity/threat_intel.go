@@ -0,0 +1,53 @@
+package integrity
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"cloud_compliance_checker/threatintel"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// maxReportedMatches caps the threat-intel findings listed in the result of the check
+const maxReportedMatches = 50
+
+// CheckThreatIntel matches the indicators of the threat-intel feeds against the CloudTrail source IPs, the
+// VPC Flow Log destinations and the Route 53 resolver queries. A feed or an audit source that was not
+// read fails the check, since its indicators or its records were not evaluated.
+// 03.14.06
+func CheckThreatIntel(cfg aws.Config) error {
+	report, err := threatintel.Match(cfg)
+	if report.Events+report.Flows+report.Queries == 0 {
+		if err == nil {
+			err = fmt.Errorf("no CloudTrail events, flow log records or resolver queries found")
+		}
+		return fmt.Errorf("failed to match the threat-intel indicators: %v", err)
+	}
+	var notEvaluated string
+	if err != nil {
+		notEvaluated = fmt.Sprintf("feeds or audit sources not evaluated: %v", err)
+	}
+
+	if len(report.Findings) > 0 {
+		lines := make([]string, 0, maxReportedMatches+1)
+		for i, finding := range report.Findings {
+			if i == maxReportedMatches {
+				lines = append(lines, fmt.Sprintf("... and %d more", len(report.Findings)-maxReportedMatches))
+				break
+			}
+			lines = append(lines, finding.String())
+		}
+		if notEvaluated != "" {
+			lines = append(lines, notEvaluated)
+		}
+		return fmt.Errorf("%d threat-intel matches (%s):\n%s", len(report.Findings), threatintel.Summary(report.Findings), strings.Join(lines, "\n"))
+	}
+	if notEvaluated != "" {
+		return fmt.Errorf("no threat-intel match in the sources read, %s", notEvaluated)
+	}
+	log.Printf("No match of %d threat-intel indicators in %d CloudTrail events, %d flow log records and %d resolver queries.\n",
+		report.Indicators, report.Events, report.Flows, report.Queries)
+	return nil
+}
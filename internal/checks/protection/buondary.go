@@ -2,14 +2,19 @@ package protection
 
 import (
 	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/discovery"
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/scope"
 	"context"
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/aws-sdk-go-v2/service/wafv2"
 )
 
@@ -163,6 +168,9 @@ func verifyLogging(ctx context.Context, cfg aws.Config, logGroupName string) err
 
 // CheckBoundaryProtection checks if the network boundaries are properly protected
 // by examining the security group configurations. Returns an error if open access is found.
+// For the security groups open to 0.0.0.0/0 the exposed assets and their blast radius are reported.
+// The groups not attached to any resource are reported separately: they expose nothing yet, but any
+// resource attached to them later is open to the Internet.
 func CheckBoundaryProtection(ctx context.Context, cfg aws.Config) error {
 	ec2Svc := ec2.NewFromConfig(cfg)
 
@@ -172,16 +180,70 @@ func CheckBoundaryProtection(ctx context.Context, cfg aws.Config) error {
 		return fmt.Errorf("error describing security groups: %v", err)
 	}
 
+	graph, graphErr := discovery.CachedGraph(cfg)
+	if graphErr != nil {
+		log.Printf("Asset graph incomplete: %v\n", graphErr)
+	}
+
+	var exposures, unattached []string
 	for _, group := range result.SecurityGroups {
-		for _, permission := range group.IpPermissions {
-			for _, ipRange := range permission.IpRanges {
-				if ipRange.CidrIp != nil && *ipRange.CidrIp == "0.0.0.0/0" {
-					return fmt.Errorf("security group %s has open access (0.0.0.0/0)", *group.GroupId)
-				}
-			}
+		if !isOpenToWorld(group) {
+			continue
+		}
+		groupID := aws.ToString(group.GroupId)
+		if !scope.Includes(cfg, models.AssetTypeSecurityGroup, groupID) {
+			continue
+		}
+
+		// Without the graph every open group is reported, as it cannot be said what it exposes
+		if graph == nil {
+			return fmt.Errorf("security group %s has open access (0.0.0.0/0)", groupID)
+		}
+
+		attached := graph.AttachedToSecurityGroup(groupID)
+		if len(attached) == 0 && graphErr != nil {
+			// With a partial graph an unattached group may just be one whose resources were not discovered
+			exposures = append(exposures, fmt.Sprintf("%s (attached resources unknown)", groupID))
+			continue
+		}
+		if len(attached) == 0 {
+			log.Printf("Security group %s has open access (0.0.0.0/0) but is not attached to any resource\n", groupID)
+			unattached = append(unattached, groupID)
+			continue
+		}
+
+		var radius []*discovery.Node
+		for _, node := range attached {
+			radius = append(radius, graph.BlastRadius(node.ID)...)
 		}
+		log.Printf("Security group %s has open access (0.0.0.0/0) and exposes %v, blast radius: %v\n",
+			groupID, discovery.NodeLabels(attached), discovery.NodeLabels(radius))
+		exposures = append(exposures, fmt.Sprintf("%s exposes %v (blast radius: %d resource(s))", groupID, discovery.NodeLabels(attached), len(radius)))
+	}
+
+	var problems []string
+	if len(exposures) > 0 {
+		problems = append(problems, fmt.Sprintf("security groups with open access (0.0.0.0/0): %s", strings.Join(exposures, "; ")))
+	}
+	if len(unattached) > 0 {
+		problems = append(problems, fmt.Sprintf("unattached security groups with open access (0.0.0.0/0): %s", strings.Join(unattached, ", ")))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "\n"))
 	}
 
 	// If no open access found, return nil indicating all security groups are properly configured.
 	return nil
 }
+
+// isOpenToWorld checks if a security group allows inbound traffic from 0.0.0.0/0
+func isOpenToWorld(group ec2types.SecurityGroup) bool {
+	for _, permission := range group.IpPermissions {
+		for _, ipRange := range permission.IpRanges {
+			if ipRange.CidrIp != nil && *ipRange.CidrIp == "0.0.0.0/0" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -1,6 +1,8 @@
 package protection
 
 import (
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/scope"
 	"context"
 	"fmt"
 	"log"
@@ -24,6 +26,9 @@ func CheckKeyManagement(cfg aws.Config) error {
 
 	// Check each key for proper management practices
 	for _, key := range listKeysOutput.Keys {
+		if !scope.Includes(cfg, models.AssetTypeKMSKey, *key.KeyId) {
+			continue
+		}
 		if err := checkKMSKeyManagement(ctx, kmsSvc, *key.KeyId); err != nil {
 			log.Printf("Warning: KMS Key %s failed key management check: %v\n", *key.KeyId, err)
 		} else {
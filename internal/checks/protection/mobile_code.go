@@ -2,8 +2,8 @@ package protection
 
 import (
 	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/policy"
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/url"
@@ -144,36 +144,21 @@ func checkCloudFrontForMobileCode(ctx context.Context, cfg aws.Config) error {
 	return nil
 }
 
-// containsMobileCodePermissions checks if an IAM policy document contains permissions related to mobile code uploads.
+// mobileCodeActions are the actions that allow uploading or distributing mobile code
+var mobileCodeActions = []string{"s3:PutObject", "cloudfront:CreateDistribution"}
+
+// containsMobileCodePermissions checks if an IAM policy document allows actions related to mobile code uploads.
 func containsMobileCodePermissions(policyDocument string) bool {
 	log.Println("Checking IAM policy document for mobile code permissions...")
-	// Simulate checking for permissions that allow uploading mobile code, e.g., S3 PutObject
-	var policyMap map[string]interface{}
-	if err := json.Unmarshal([]byte(policyDocument), &policyMap); err != nil {
+	doc, err := policy.Parse(policyDocument)
+	if err != nil {
 		log.Printf("Error parsing policy document: %v\n", err)
 		return false
 	}
 
-	statements, ok := policyMap["Statement"].([]interface{})
-	if !ok {
-		return false
-	}
-
-	for _, stmt := range statements {
-		statement, ok := stmt.(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		actions, ok := statement["Action"].([]interface{})
-		if !ok {
-			continue
-		}
-
-		for _, action := range actions {
-			if actionStr, ok := action.(string); ok && (strings.Contains(actionStr, "s3:PutObject") || strings.Contains(actionStr, "cloudfront:CreateDistribution")) {
-				return true
-			}
+	for _, action := range mobileCodeActions {
+		if doc.AllowsAction(action) {
+			return true
 		}
 	}
 	return false
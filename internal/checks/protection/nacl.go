@@ -0,0 +1,357 @@
+package protection
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/reachability"
+	"cloud_compliance_checker/scope"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Kinds of network ACL issues
+const (
+	NACLAllowAll  = "allow-all"
+	NACLPort      = "port"
+	NACLEphemeral = "ephemeral"
+	NACLShadowed  = "shadowed"
+	NACLAdmin     = "admin"
+)
+
+// Rule numbers of the final IPv4 and IPv6 denies of every network ACL
+const (
+	defaultACLRule     = 32767
+	defaultIPv6ACLRule = 32768
+)
+
+// worldCIDRs are the CIDRs matching every IPv4 and IPv6 address
+var worldCIDRs = []string{"0.0.0.0/0", "::/0"}
+
+// adminPorts are the administrative ports that must not be open to the world
+var adminPorts = map[int32]string{22: "SSH", 3389: "RDP"}
+
+// NACLIssue is a finding on a rule of the network ACL of a subnet
+type NACLIssue struct {
+	Subnet string
+	ACL    string
+	Rule   int32
+	Egress bool
+	Kind   string
+	Detail string
+}
+
+// String formats the issue as "subnet-1 (acl-1) inbound rule 100: allows ..."
+func (i NACLIssue) String() string {
+	direction := "inbound"
+	if i.Egress {
+		direction = "outbound"
+	}
+	return fmt.Sprintf("%s (%s) %s rule %d: %s", i.Subnet, i.ACL, direction, i.Rule, i.Detail)
+}
+
+// EvaluateNACL checks the rules of the network ACL of a subnet against the rules allowed for it: allow-all
+// rules, rules open to the world on ports not allowed, port ranges wider than the ephemeral ports, deny
+// rules shadowed by the allow rules before them and administrative ports open to the world
+func EvaluateNACL(acl *reachability.NetworkACL, subnet string, rules config.NetworkACL) ([]NACLIssue, error) {
+	ephemeral, err := parsePortRange(rules.EphemeralPorts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral_ports for subnet %s: %v", subnet, err)
+	}
+	ephemeralPorts := reachability.NewPorts(ephemeral)
+
+	var issues []NACLIssue
+	for _, egress := range []bool{false, true} {
+		entries := directionEntries(acl, egress)
+		allowed := allowedPorts(rules.AllowedIngressPorts)
+		if egress {
+			allowed = allowedPorts(rules.AllowedEgressPorts)
+		}
+		effective := worldEffective(entries)
+		issue := func(entry reachability.ACLEntry, kind, detail string) {
+			issues = append(issues, NACLIssue{Subnet: subnet, ACL: acl.ID, Rule: entry.RuleNumber, Egress: egress, Kind: kind, Detail: detail})
+		}
+
+		for _, entry := range entries {
+			if !entry.Allow {
+				if shadowed, by := shadowingRules(entries, entry); !shadowed.Empty() {
+					issue(entry, NACLShadowed, fmt.Sprintf("deny %s is shadowed by allow rule %s for ports %s",
+						describeEntry(entry), joinRuleNumbers(by), shadowed))
+				}
+				continue
+			}
+			if !isWorld(entry.CIDR) {
+				continue
+			}
+
+			tcp, udp := effective[reachability.ProtocolTCP][entry.RuleNumber], effective[reachability.ProtocolUDP][entry.RuleNumber]
+			ports := tcp.Union(udp)
+			if ports.Empty() {
+				// Every port is decided by the rules before
+				continue
+			}
+			if entry.Protocol == reachability.ProtocolAll || (entry.Ports.From == 0 && entry.Ports.To == 65535) {
+				issue(entry, NACLAllowAll, fmt.Sprintf("allows %s, deny-by-default not enforced", describeEntry(entry)))
+				continue
+			}
+
+			unexpected := ports.Subtract(allowed).Subtract(ephemeralPorts)
+			if !egress {
+				// Administrative ports are reported for boundary protection
+				for port := range adminPorts {
+					unexpected = unexpected.Subtract(reachability.NewPorts(reachability.PortRange{From: port, To: port}))
+				}
+			}
+			if unexpected.Empty() {
+				continue
+			}
+			if entry.Ports.From != entry.Ports.To && !reachability.NewPorts(entry.Ports).Intersect(ephemeralPorts).Empty() {
+				issue(entry, NACLEphemeral, fmt.Sprintf("allows %s, ports %s are outside the ephemeral ports %s",
+					describeEntry(entry), unexpected, ephemeralPorts))
+				continue
+			}
+			issue(entry, NACLPort, fmt.Sprintf("allows %s, ports %s not allowed for the subnet", describeEntry(entry), unexpected))
+		}
+
+		if egress {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.Allow || !isWorld(entry.CIDR) {
+				continue
+			}
+			for _, port := range sortedAdminPorts() {
+				if effective[reachability.ProtocolTCP][entry.RuleNumber].Contains(port) && !allowed.Contains(port) {
+					issue(entry, NACLAdmin, fmt.Sprintf("allows %s (port %d) from %s", adminPorts[port], port, entry.CIDR))
+				}
+			}
+		}
+	}
+	return issues, nil
+}
+
+// directionEntries returns the inbound or outbound rules in evaluation order
+func directionEntries(acl *reachability.NetworkACL, egress bool) []reachability.ACLEntry {
+	var entries []reachability.ACLEntry
+	for _, entry := range acl.Entries {
+		if entry.Egress == egress {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].RuleNumber < entries[j].RuleNumber })
+	return entries
+}
+
+// worldEffective evaluates the rules in order for the traffic of any address and returns, for TCP and UDP,
+// the ports each allow rule decides
+func worldEffective(entries []reachability.ACLEntry) map[string]map[int32]reachability.Ports {
+	effective := map[string]map[int32]reachability.Ports{}
+	for _, protocol := range []string{reachability.ProtocolTCP, reachability.ProtocolUDP} {
+		effective[protocol] = map[int32]reachability.Ports{}
+		for _, world := range worldCIDRs {
+			undecided := reachability.AllPorts
+			for _, entry := range entries {
+				if entry.CIDR != world || (entry.Protocol != reachability.ProtocolAll && entry.Protocol != protocol) {
+					continue
+				}
+				matched := undecided.Intersect(reachability.NewPorts(entry.Ports))
+				if entry.Allow {
+					effective[protocol][entry.RuleNumber] = effective[protocol][entry.RuleNumber].Union(matched)
+				}
+				undecided = undecided.Subtract(matched)
+			}
+		}
+	}
+	return effective
+}
+
+// shadowingRules returns the ports of a deny rule that are already allowed by the rules before it for every
+// address of its CIDR, with the allowing rules
+func shadowingRules(entries []reachability.ACLEntry, deny reachability.ACLEntry) (reachability.Ports, []int32) {
+	if deny.RuleNumber == defaultACLRule || deny.RuleNumber == defaultIPv6ACLRule {
+		return nil, nil
+	}
+	denyCIDR, err := netip.ParsePrefix(deny.CIDR)
+	if err != nil {
+		return nil, nil
+	}
+
+	undecided := reachability.NewPorts(deny.Ports)
+	var shadowed reachability.Ports
+	var rules []int32
+	for _, entry := range entries {
+		if entry.RuleNumber >= deny.RuleNumber {
+			break
+		}
+		if entry.Protocol != reachability.ProtocolAll && entry.Protocol != deny.Protocol {
+			continue
+		}
+		cidr, err := netip.ParsePrefix(entry.CIDR)
+		if err != nil || cidr.Bits() > denyCIDR.Bits() || !cidr.Masked().Contains(denyCIDR.Addr()) {
+			continue
+		}
+		matched := undecided.Intersect(reachability.NewPorts(entry.Ports))
+		if matched.Empty() {
+			continue
+		}
+		if entry.Allow {
+			shadowed = shadowed.Union(matched)
+			rules = append(rules, entry.RuleNumber)
+		}
+		undecided = undecided.Subtract(matched)
+	}
+	return shadowed, rules
+}
+
+// isWorld checks if the CIDR matches every address
+func isWorld(cidr string) bool {
+	for _, world := range worldCIDRs {
+		if cidr == world {
+			return true
+		}
+	}
+	return false
+}
+
+// describeEntry formats a rule as "tcp 22 from 0.0.0.0/0"
+func describeEntry(entry reachability.ACLEntry) string {
+	direction := "from"
+	if entry.Egress {
+		direction = "to"
+	}
+	if entry.Protocol == reachability.ProtocolAll {
+		return fmt.Sprintf("all traffic %s %s", direction, entry.CIDR)
+	}
+	return fmt.Sprintf("%s %s %s %s", entry.Protocol, reachability.NewPorts(entry.Ports), direction, entry.CIDR)
+}
+
+// joinRuleNumbers formats rule numbers as "100, 110"
+func joinRuleNumbers(rules []int32) string {
+	parts := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		parts = append(parts, fmt.Sprint(rule))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sortedAdminPorts returns the administrative ports in order
+func sortedAdminPorts() []int32 {
+	ports := make([]int32, 0, len(adminPorts))
+	for port := range adminPorts {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+	return ports
+}
+
+// parsePortRange parses a range as "1024-65535", by default the ephemeral ports of most clients
+func parsePortRange(value string) (reachability.PortRange, error) {
+	if value == "" {
+		return reachability.PortRange{From: 1024, To: 65535}, nil
+	}
+	from, to, found := strings.Cut(value, "-")
+	if !found {
+		to = from
+	}
+	start, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil {
+		return reachability.PortRange{}, fmt.Errorf("invalid port range %q", value)
+	}
+	end, err := strconv.Atoi(strings.TrimSpace(to))
+	if err != nil || start > end || start < 0 || end > 65535 {
+		return reachability.PortRange{}, fmt.Errorf("invalid port range %q", value)
+	}
+	return reachability.PortRange{From: int32(start), To: int32(end)}, nil
+}
+
+// naclRules returns the rules allowed for a subnet, by ID or Name tag, falling back to "*"
+func naclRules(subnet *reachability.Subnet) config.NetworkACL {
+	var fallback config.NetworkACL
+	for _, rules := range config.AppConfig.AWS.NetworkACLs {
+		if rules.Subnet == subnet.ID || (subnet.Name != "" && rules.Subnet == subnet.Name) {
+			return rules
+		}
+		if rules.Subnet == "*" {
+			fallback = rules
+		}
+	}
+	return fallback
+}
+
+// naclIssues evaluates the network ACLs of the in-scope subnets
+func naclIssues(cfg aws.Config) ([]NACLIssue, error) {
+	// A partial snapshot may miss network ACLs or the subnets they protect
+	network, err := reachability.Cached(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the network ACLs: %v", err)
+	}
+
+	var issues []NACLIssue
+	for _, acl := range network.ACLs {
+		for _, id := range acl.Subnets {
+			if !scope.Includes(cfg, models.AssetTypeSubnet, id) {
+				continue
+			}
+			subnet := network.Subnets[id]
+			if subnet == nil {
+				subnet = &reachability.Subnet{ID: id}
+			}
+			found, err := EvaluateNACL(acl, id, naclRules(subnet))
+			if err != nil {
+				return nil, err
+			}
+			issues = append(issues, found...)
+		}
+	}
+	return issues, nil
+}
+
+// naclReport returns the issues of the given kinds, one per line
+func naclReport(issues []NACLIssue, kinds ...string) []string {
+	var lines []string
+	for _, issue := range issues {
+		for _, kind := range kinds {
+			if issue.Kind == kind {
+				lines = append(lines, issue.String())
+			}
+		}
+	}
+	return lines
+}
+
+// CheckNACLDenyByDefault checks that the network ACLs of the subnets deny traffic by default: no allow-all
+// rule, no rule open to the world on ports not allowed for the subnet, no range beyond the ephemeral ports
+// and no deny rule shadowed by an allow rule before it
+// 03.13.06
+func CheckNACLDenyByDefault(cfg aws.Config) error {
+	issues, err := naclIssues(cfg)
+	if err != nil {
+		return err
+	}
+	if lines := naclReport(issues, NACLAllowAll, NACLPort, NACLEphemeral, NACLShadowed); len(lines) > 0 {
+		return fmt.Errorf("network ACLs do not enforce deny-by-default:\n%s", strings.Join(lines, "\n"))
+	}
+	log.Println("All network ACLs enforce deny-by-default.")
+	return nil
+}
+
+// CheckNACLBoundary checks that the network ACLs of the subnets don't open the administrative ports
+// (SSH and RDP) to the world
+// 03.13.01
+func CheckNACLBoundary(cfg aws.Config) error {
+	issues, err := naclIssues(cfg)
+	if err != nil {
+		return err
+	}
+	if lines := naclReport(issues, NACLAdmin); len(lines) > 0 {
+		return fmt.Errorf("network ACLs open administrative ports to the world:\n%s", strings.Join(lines, "\n"))
+	}
+	log.Println("No network ACL opens administrative ports to the world.")
+	return nil
+}
@@ -0,0 +1,50 @@
+package protection
+
+import (
+	"testing"
+
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/reachability"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateNACL(t *testing.T) {
+	acl := &reachability.NetworkACL{ID: "acl-1", Entries: []reachability.ACLEntry{
+		{RuleNumber: 100, Protocol: reachability.ProtocolTCP, Ports: reachability.PortRange{From: 443, To: 443}, CIDR: "0.0.0.0/0", Allow: true},
+		{RuleNumber: 110, Protocol: reachability.ProtocolTCP, Ports: reachability.PortRange{From: 1024, To: 65535}, CIDR: "0.0.0.0/0", Allow: true},
+		{RuleNumber: 120, Protocol: reachability.ProtocolTCP, Ports: reachability.PortRange{From: 8080, To: 8080}, CIDR: "0.0.0.0/0", Allow: true},
+		// The deny comes after the allow of the ephemeral ports
+		{RuleNumber: 130, Protocol: reachability.ProtocolTCP, Ports: reachability.PortRange{From: 3389, To: 3389}, CIDR: "0.0.0.0/0"},
+		{RuleNumber: 140, Protocol: reachability.ProtocolUDP, Ports: reachability.PortRange{From: 0, To: 2000}, CIDR: "0.0.0.0/0", Allow: true},
+		{RuleNumber: 32767, Protocol: reachability.ProtocolAll, Ports: reachability.PortRange{From: 0, To: 65535}, CIDR: "0.0.0.0/0"},
+		{RuleNumber: 100, Egress: true, Protocol: reachability.ProtocolAll, Ports: reachability.PortRange{From: 0, To: 65535}, CIDR: "::/0", Allow: true},
+		{RuleNumber: 32767, Egress: true, Protocol: reachability.ProtocolAll, Ports: reachability.PortRange{From: 0, To: 65535}, CIDR: "0.0.0.0/0"},
+		{RuleNumber: 32768, Egress: true, Protocol: reachability.ProtocolAll, Ports: reachability.PortRange{From: 0, To: 65535}, CIDR: "::/0"},
+	}}
+
+	issues, err := EvaluateNACL(acl, "subnet-1", config.NetworkACL{AllowedIngressPorts: []int{443, 8080}})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	kinds := map[int32]string{}
+	for _, issue := range issues {
+		// The final IPv6 deny is not shadowed by the allow of ::/0
+		assert.NotEqual(t, int32(32768), issue.Rule)
+		if !issue.Egress && issue.Kind != NACLAdmin {
+			kinds[issue.Rule] = issue.Kind
+		}
+	}
+	assert.Equal(t, map[int32]string{130: NACLShadowed, 140: NACLEphemeral}, kinds)
+	assert.Contains(t, naclReport(issues, NACLAdmin), "subnet-1 (acl-1) inbound rule 110: allows RDP (port 3389) from 0.0.0.0/0")
+	assert.Contains(t, naclReport(issues, NACLAllowAll), "subnet-1 (acl-1) outbound rule 100: allows all traffic to ::/0, deny-by-default not enforced")
+
+	// Moving the deny before the ephemeral ports closes RDP
+	acl.Entries[3].RuleNumber = 105
+	issues, _ = EvaluateNACL(acl, "subnet-1", config.NetworkACL{AllowedIngressPorts: []int{443, 8080}})
+	assert.Empty(t, naclReport(issues, NACLAdmin, NACLShadowed))
+
+	_, err = EvaluateNACL(acl, "subnet-1", config.NetworkACL{EphemeralPorts: "65535-1024"})
+	assert.Error(t, err)
+}
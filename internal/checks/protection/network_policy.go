@@ -6,6 +6,8 @@ import (
 	"log"
 
 	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/scope"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
@@ -26,6 +28,9 @@ func CheckDenyByDefaultSecurityGroup(cfg aws.Config) error {
 	}
 
 	for _, sg := range result.SecurityGroups {
+		if !scope.Includes(cfg, models.AssetTypeSecurityGroup, *sg.GroupId) {
+			continue
+		}
 		log.Printf("Checking Security Group: %s (%s)\n", *sg.GroupName, *sg.GroupId)
 
 		// Get allowed ports from the config for the security group
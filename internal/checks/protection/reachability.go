@@ -0,0 +1,136 @@
+package protection
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/reachability"
+	"cloud_compliance_checker/scope"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// InternetPaths returns the paths from the internet to the in-scope instances
+func InternetPaths(cfg aws.Config) ([]reachability.Path, error) {
+	// Without the security groups or the routes no path would be found: a partial snapshot is an error
+	network, err := reachability.Cached(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("incomplete network snapshot: %v", err)
+	}
+
+	var paths []reachability.Path
+	for _, path := range network.FromInternet() {
+		if scope.Includes(cfg, models.AssetTypeEC2Instance, path.Instance) {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// NonCUIPaths returns the paths from the subnets outside the CUI scope to the in-scope instances.
+// Without a CUI scope there is no such subnet.
+func NonCUIPaths(cfg aws.Config) ([]reachability.Path, error) {
+	if !scope.Current().Configured() {
+		return nil, nil
+	}
+
+	in, out, err := scope.Assets(cfg)
+	if err != nil && len(in) == 0 && len(out) == 0 {
+		return nil, fmt.Errorf("failed to list the CUI assets: %v", err)
+	}
+	// Without the security groups or the routes no path would be found: a partial snapshot is an error
+	network, err := reachability.Cached(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("incomplete network snapshot: %v", err)
+	}
+
+	var instances []*reachability.Instance
+	for _, asset := range in {
+		if asset.Type != models.AssetTypeEC2Instance {
+			continue
+		}
+		if instance := network.Instance(asset.Name); instance != nil {
+			instances = append(instances, instance)
+		}
+	}
+
+	var paths []reachability.Path
+	for _, asset := range out {
+		if asset.Type != models.AssetTypeSubnet || asset.Region != network.Region {
+			continue
+		}
+		paths = append(paths, network.FromSubnet(asset.Name, instances)...)
+	}
+	return paths, nil
+}
+
+// CheckInternetExposure checks that the in-scope instances are reachable from the internet only on the
+// allowed ports, following the routes, network ACLs, security groups and load balancers
+// 03.13.01
+func CheckInternetExposure(cfg aws.Config) error {
+	paths, err := InternetPaths(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to analyze the network reachability: %v", err)
+	}
+
+	allowed := allowedPorts(config.AppConfig.AWS.Reachability.AllowedInternetPorts)
+	var issues []string
+	for _, path := range paths {
+		// The internet reaches the listener of a load balancer, not the instance port
+		exposed := path.Ports
+		if path.LoadBalancer != "" {
+			exposed = reachability.NewPorts(reachability.PortRange{From: path.EntryPort, To: path.EntryPort})
+		}
+		if exposed.Subtract(allowed).Empty() {
+			continue
+		}
+		issues = append(issues, path.String())
+	}
+
+	if len(issues) > 0 {
+		return fmt.Errorf("instances reachable from the internet on ports not allowed:\n%s", strings.Join(issues, "\n"))
+	}
+	log.Printf("Checked %d internet paths to in-scope instances\n", len(paths))
+	return nil
+}
+
+// CheckCUINetworkFlow checks that the subnets outside the CUI scope reach the in-scope instances only on
+// the allowed ports
+// 03.01.03
+func CheckCUINetworkFlow(cfg aws.Config) error {
+	if !scope.Current().Configured() {
+		log.Println("No CUI scope configured, network flow between CUI and non-CUI subnets not analyzed")
+		return nil
+	}
+
+	paths, err := NonCUIPaths(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to analyze the network reachability: %v", err)
+	}
+
+	allowed := allowedPorts(config.AppConfig.AWS.Reachability.AllowedInternalPorts)
+	var issues []string
+	for _, path := range paths {
+		if !path.Ports.Subtract(allowed).Empty() {
+			issues = append(issues, path.String())
+		}
+	}
+
+	if len(issues) > 0 {
+		return fmt.Errorf("in-scope instances reachable from non-CUI subnets on ports not allowed:\n%s", strings.Join(issues, "\n"))
+	}
+	log.Printf("Checked %d paths from non-CUI subnets to in-scope instances\n", len(paths))
+	return nil
+}
+
+// allowedPorts converts the configured ports to a set
+func allowedPorts(ports []int) reachability.Ports {
+	ranges := make([]reachability.PortRange, 0, len(ports))
+	for _, port := range ports {
+		ranges = append(ranges, reachability.PortRange{From: int32(port), To: int32(port)})
+	}
+	return reachability.NewPorts(ranges...)
+}
@@ -1,6 +1,8 @@
 package protection
 
 import (
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/scope"
 	"context"
 	"fmt"
 	"log"
@@ -50,6 +52,9 @@ func SecureAllS3Buckets(cfg aws.Config) error {
 
 	// Check each bucket for security
 	for _, bucket := range result.Buckets {
+		if !scope.Includes(cfg, models.AssetTypeS3Bucket, *bucket.Name) {
+			continue
+		}
 		if err := CheckSecureS3Bucket(ctx, cfg, *bucket.Name); err != nil {
 			log.Printf("Warning: Bucket %s is not secure: %v\n", *bucket.Name, err)
 		} else {
@@ -204,6 +209,9 @@ func CheckS3Confidentiality(cfg aws.Config) error {
 	}
 
 	for _, bucket := range result.Buckets {
+		if !scope.Includes(cfg, models.AssetTypeS3Bucket, *bucket.Name) {
+			continue
+		}
 		log.Printf("Checking S3 Bucket: %s\n", *bucket.Name)
 
 		// Check if encryption is enabled
@@ -258,6 +266,9 @@ func checkRDSConfidentiality(ctx context.Context, cfg aws.Config) error {
 	}
 
 	for _, dbInstance := range result.DBInstances {
+		if !scope.Includes(cfg, models.AssetTypeRDSInstance, *dbInstance.DBInstanceIdentifier) {
+			continue
+		}
 		if !*dbInstance.StorageEncrypted {
 			return fmt.Errorf("RDS instance %s does not have encryption enabled", *dbInstance.DBInstanceIdentifier)
 		}
@@ -2,6 +2,7 @@ package risk_assesment
 
 import (
 	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/scheduler"
 	"context"
 	"fmt"
 	"log"
@@ -118,16 +119,19 @@ func RemediateVulnerability(finding types.Finding) {
 	// Example: Automatically patch or reconfigure the resource
 }
 
-// getFrequencyDuration converts frequency string to time.Duration
+// getFrequencyDuration converts frequency string to time.Duration.
+// Keywords (daily, weekly, monthly), ISO-8601 durations (P1M) and cron expressions are accepted;
+// for cron expressions the interval between two consecutive runs is returned.
 func getFrequencyDuration(frequency string) time.Duration {
-	switch frequency {
-	case "daily":
+	schedule, err := scheduler.ParseSchedule(frequency)
+	if err != nil {
+		log.Printf("Invalid frequency %q, defaulting to daily: %v", frequency, err)
 		return 24 * time.Hour
-	case "weekly":
-		return 7 * 24 * time.Hour
-	case "monthly":
-		return 30 * 24 * time.Hour
-	default:
+	}
+	interval := scheduler.Interval(schedule, time.Now())
+	if interval <= 0 {
+		log.Printf("Frequency %q has no next run, defaulting to daily", frequency)
 		return 24 * time.Hour
 	}
+	return interval
 }
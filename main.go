@@ -2,20 +2,42 @@ package main
 
 import (
 	"bufio"
+	"cloud_compliance_checker/anomaly"
+	"cloud_compliance_checker/auditquery"
 	configure "cloud_compliance_checker/config"
 	"cloud_compliance_checker/discovery"
 	"cloud_compliance_checker/evaluation"
+	"cloud_compliance_checker/flowlogs"
+	"cloud_compliance_checker/internal/checks/integrity"
+	"cloud_compliance_checker/internal/checks/protection"
+	"cloud_compliance_checker/metrics"
 	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/notify"
+	"cloud_compliance_checker/policy"
+	"cloud_compliance_checker/scheduler"
+	"cloud_compliance_checker/scope"
+	"cloud_compliance_checker/server"
+	"cloud_compliance_checker/threatintel"
+	"cloud_compliance_checker/trailstore"
+	"cloud_compliance_checker/trailvalidation"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
 )
 
 // loadControls carica i controlli di conformità da un file JSON
@@ -36,18 +58,16 @@ func loadControls(filePath string) (models.NISTControls, error) {
 	return controls, nil
 }
 
-func main() {
-	// Definisce un flag --config per specificare il file di configurazione
-	configFile := flag.String("config", "", "path to the config file")
-	flag.Parse()
-
-	if *configFile == "" {
+// setup carica la configurazione, i controlli di conformità e la configurazione AWS
+func setup(configFile string) (models.NISTControls, aws.Config) {
+	if configFile == "" {
 		log.Fatalf("Please provide a config file using the --config flag")
 	}
 
 	// Carica il file di configurazione
-	configure.LoadConfig(*configFile)
-	log.Printf("Configurazione caricata con successo: %+v", configure.AppConfig)
+	configure.LoadConfig(configFile)
+	// La configurazione contiene credenziali e segreti dei canali di notifica: non viene stampata
+	log.Printf("Configurazione caricata con successo da %s", configFile)
 
 	// Carica i controlli di conformità dal file JSON
 	controls, err := loadControls("config/control.json")
@@ -70,8 +90,660 @@ func main() {
 		log.Fatalf("Unable to load AWS SDK config, %v", err)
 	}
 
+	// Imposta il perimetro CUI valutato dai controlli
+	scope.Setup(configure.AppConfig.AWS.CUIScope)
+
+	// Configura i canali di notifica
+	if err := notify.Setup(configure.AppConfig.AWS.Notifications, awsCfg); err != nil {
+		log.Fatalf("Invalid notifications configuration: %v", err)
+	}
+
+	return controls, awsCfg
+}
+
+// serve avvia il server HTTP per le scansioni on-demand
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	configFile := flags.String("config", "", "path to the config file")
+	addr := flags.String("addr", "127.0.0.1:8080", "address the API server listens on")
+	dataDir := flags.String("data-dir", "scans", "directory where scan results are stored")
+	flags.Parse(args)
+
+	controls, awsCfg := setup(*configFile)
+
+	srv, err := server.NewServer(controls, awsCfg, *dataDir, apiToken())
+	if err != nil {
+		log.Fatalf("Unable to start API server: %v", err)
+	}
+	log.Fatal(srv.ListenAndServe(*addr))
+}
+
+// apiToken restituisce il token delle API: la variabile d'ambiente COMPLIANCE_API_TOKEN o api_server.token
+func apiToken() string {
+	if token := os.Getenv("COMPLIANCE_API_TOKEN"); token != "" {
+		return token
+	}
+	return configure.AppConfig.AWS.APIServer.Token
+}
+
+// daemon esegue ciascun gruppo di controlli alla frequenza configurata
+func daemon(args []string) {
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	configFile := flags.String("config", "", "path to the config file")
+	metricsAddr := flags.String("metrics-addr", "127.0.0.1:9108", "address of the /metrics endpoint, empty to disable it")
+	flags.Parse(args)
+
+	controls, awsCfg := setup(*configFile)
+
+	schedulerCfg := configure.AppConfig.AWS.Scheduler
+	if schedulerCfg.StateFile == "" {
+		schedulerCfg.StateFile = "scheduler_state.json"
+	}
+	if schedulerCfg.OutputDir == "" {
+		schedulerCfg.OutputDir = "scheduled_scans"
+	}
+
+	jobs, err := scheduler.JobsFromConfig(configure.AppConfig.AWS, controls)
+	if err != nil {
+		log.Fatalf("Invalid scheduler configuration: %v", err)
+	}
+
+	// Ogni job aggiorna le metriche dei controlli che valuta; il punteggio solo se valuta tutto il catalogo
+	exporter := metrics.NewExporter()
+	run := func(job scheduler.Job) (int, error) {
+		selected, err := evaluation.FilterControls(controls, job.Controls)
+		if err != nil {
+			exporter.Observe(nil, 0, false, err)
+			return 0, err
+		}
+		start := time.Now()
+		outputDir := filepath.Join(schedulerCfg.OutputDir, job.Name, start.UTC().Format("20060102-150405"))
+		report, err := evaluation.RunEvaluation(selected, awsCfg, outputDir)
+		exporter.Observe(&report, time.Since(start), len(job.Controls) == 0, err)
+		return report.Score, err
+	}
+
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		// Con un token configurato anche le metriche del daemon lo richiedono
+		var handler http.Handler = exporter
+		if token := apiToken(); token != "" {
+			handler = server.RequireToken(token, exporter)
+		}
+		mux.Handle("/metrics", handler)
+		go func() {
+			log.Printf("Metrics available at http://%s/metrics\n", *metricsAddr)
+			if err := server.NewHTTPServer(*metricsAddr, mux).ListenAndServe(); err != nil {
+				log.Fatalf("Unable to serve metrics: %v", err)
+			}
+		}()
+	}
+
+	sched, err := scheduler.New(jobs, schedulerCfg.StateFile, run)
+	if err != nil {
+		log.Fatalf("Unable to start scheduler: %v", err)
+	}
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	sched.Run(stop)
+}
+
+// graph esporta il grafo delle relazioni tra gli asset
+func graph(args []string) {
+	flags := flag.NewFlagSet("graph", flag.ExitOnError)
+	configFile := flags.String("config", "", "path to the config file")
+	format := flags.String("format", discovery.FormatDOT, "output format: dot, graphml or json")
+	output := flags.String("output", "", "output file (default stdout)")
+	flags.Parse(args)
+
+	_, awsCfg := setup(*configFile)
+
+	g, err := discovery.BuildGraph(awsCfg)
+	if err != nil {
+		log.Printf("Asset graph incomplete: %v", err)
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatalf("Unable to create %s: %v", *output, err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if err := discovery.WriteGraph(out, g, *format); err != nil {
+		log.Fatalf("Unable to export asset graph: %v", err)
+	}
+}
+
+// reachabilityCommand stampa i percorsi di rete dall'internet e dalle subnet non CUI verso le istanze in scope
+func reachabilityCommand(args []string) {
+	flags := flag.NewFlagSet("reachability", flag.ExitOnError)
+	configFile := flags.String("config", "", "path to the config file")
+	format := flags.String("format", "text", "output format: text or json")
+	output := flags.String("output", "", "output file (default stdout)")
+	flags.Parse(args)
+
+	_, awsCfg := setup(*configFile)
+
+	internet, err := protection.InternetPaths(awsCfg)
+	if err != nil {
+		log.Fatalf("Unable to analyze the network reachability: %v", err)
+	}
+	nonCUI, err := protection.NonCUIPaths(awsCfg)
+	if err != nil {
+		log.Fatalf("Unable to analyze the network reachability: %v", err)
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatalf("Unable to create %s: %v", *output, err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	switch *format {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(map[string]interface{}{"internet": internet, "non_cui": nonCUI})
+	case "text":
+		fmt.Fprintf(out, "Paths from the internet: %d\n", len(internet))
+		for _, path := range internet {
+			fmt.Fprintln(out, path)
+		}
+		fmt.Fprintf(out, "\nPaths from non-CUI subnets: %d\n", len(nonCUI))
+		for _, path := range nonCUI {
+			fmt.Fprintln(out, path)
+		}
+	default:
+		log.Fatalf("Unknown format %q, expected text or json", *format)
+	}
+	if err != nil {
+		log.Fatalf("Unable to write the paths: %v", err)
+	}
+}
+
+// flowLogsCommand analizza i VPC Flow Log dalle esportazioni locali o da CloudWatch Logs
+func flowLogsCommand(args []string) {
+	flags := flag.NewFlagSet("flowlogs", flag.ExitOnError)
+	configFile := flags.String("config", "", "path to the config file")
+	var files multiFlag
+	flags.Var(&files, "file", "local export, plain text or gzip, repeatable (default the flow_logs sources)")
+	flags.Parse(args)
+
+	_, awsCfg := setup(*configFile)
+
+	var report flowlogs.Report
+	if len(files) > 0 {
+		opts, err := flowlogs.NewOptions(configure.AppConfig.AWS.MissionEssentialConfig, configure.AppConfig.AWS.FlowLogs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var records []flowlogs.Record
+		for _, file := range files {
+			found, err := flowlogs.ReadFile(file)
+			if err != nil {
+				log.Fatal(err)
+			}
+			records = append(records, found...)
+		}
+		report = flowlogs.Analyze(records, opts)
+	} else {
+		var err error
+		if report, err = integrity.FlowLogReport(awsCfg); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fmt.Printf("Flow log records: %d (%s - %s)\n", report.Records, report.From.Format(time.RFC3339), report.To.Format(time.RFC3339))
+	fmt.Printf("\nNon-essential ports and protocols: %d\n", len(report.NonEssential))
+	for _, usage := range report.NonEssential {
+		fmt.Println(usage)
+	}
+	fmt.Printf("\nRejected traffic spikes: %d\n", len(report.Spikes))
+	for _, spike := range report.Spikes {
+		fmt.Println(spike)
+	}
+	fmt.Printf("\nLarge egress to unknown destinations: %d\n", len(report.Egress))
+	for _, egress := range report.Egress {
+		fmt.Println(egress)
+	}
+}
+
+// validateLogsCommand scarica i digest di CloudTrail e verifica la catena delle firme e gli hash dei log
+func validateLogsCommand(args []string) {
+	flags := flag.NewFlagSet("validate-logs", flag.ExitOnError)
+	configFile := flags.String("config", "", "path to the config file, required with --download")
+	dir := flags.String("dir", "", "local directory of the trail bucket copy")
+	download := flags.Bool("download", false, "download the public keys, digests and log files of the range before the validation")
+	trail := flags.String("trail", "", "name or ARN of the trail to download")
+	startFlag := flags.String("start", "", "start of the range, RFC 3339 (default 24 hours before the end)")
+	endFlag := flags.String("end", "", "end of the range, RFC 3339 (default now)")
+	flags.Parse(args)
+
+	if *dir == "" {
+		log.Fatalf("Please provide the local directory using the --dir flag")
+	}
+	end := time.Now().UTC()
+	if *endFlag != "" {
+		parsed, err := time.Parse(time.RFC3339, *endFlag)
+		if err != nil {
+			log.Fatalf("Invalid --end: %v", err)
+		}
+		end = parsed
+	}
+	start := end.Add(-24 * time.Hour)
+	if *startFlag != "" {
+		parsed, err := time.Parse(time.RFC3339, *startFlag)
+		if err != nil {
+			log.Fatalf("Invalid --start: %v", err)
+		}
+		start = parsed
+	}
+
+	// Senza --download la validazione lavora solo sulla copia locale
+	if *download {
+		if *trail == "" {
+			log.Fatalf("Please provide the trail using the --trail flag")
+		}
+		_, awsCfg := setup(*configFile)
+		if _, err := trailvalidation.Download(awsCfg, *trail, start, end, *dir); err != nil {
+			log.Fatalf("Unable to download the trail logs: %v", err)
+		}
+	}
+
+	report, err := trailvalidation.Validate(*dir, start, end)
+	if err != nil {
+		log.Fatalf("Unable to validate the trail logs: %v", err)
+	}
+	fmt.Printf("Digests: %d valid of %d\n", report.ValidDigests, report.Digests)
+	fmt.Printf("Log files: %d valid of %d\n", report.ValidLogFiles, report.LogFiles)
+	fmt.Printf("\nChains started: %d\n", len(report.ChainsStarted))
+	for _, digest := range report.ChainsStarted {
+		fmt.Println(digest)
+	}
+	fmt.Printf("\nProblems: %d\n", len(report.Problems))
+	for _, problem := range report.Problems {
+		fmt.Println(problem)
+	}
+	if !report.Valid() {
+		os.Exit(1)
+	}
+}
+
+// ingestCommand importa i file di log di CloudTrail nello store locale degli eventi
+func ingestCommand(args []string) {
+	flags := flag.NewFlagSet("ingest", flag.ExitOnError)
+	configFile := flags.String("config", "", "path to the config file")
+	var dirs multiFlag
+	flags.Var(&dirs, "dir", "local directory of log files, repeatable (default the trail_store sources)")
+	flags.Parse(args)
+
+	_, awsCfg := setup(*configFile)
+
+	store, err := trailstore.Default()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if store == nil {
+		log.Fatalf("Please configure trail_store.dir")
+	}
+
+	added := 0
+	if len(dirs) > 0 {
+		for _, dir := range dirs {
+			n, err := store.IngestDir(dir)
+			added += n
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	} else if added, err = store.IngestConfigured(awsCfg); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Events added: %d\n", added)
+}
+
+// eventsCommand cerca gli eventi nello store locale di CloudTrail
+func eventsCommand(args []string) {
+	flags := flag.NewFlagSet("events", flag.ExitOnError)
+	configFile := flags.String("config", "", "path to the config file")
+	user := flags.String("user", "", "user name or ARN")
+	eventName := flags.String("event", "", "event name, e.g. DeleteBucket")
+	sourceIP := flags.String("ip", "", "source IP address")
+	resource := flags.String("resource", "", "resource name or ARN")
+	startFlag := flags.String("start", "", "start of the range, RFC 3339")
+	endFlag := flags.String("end", "", "end of the range, RFC 3339")
+	format := flags.String("format", "text", "output format: text or json")
+	flags.Parse(args)
+
+	setup(*configFile)
+
+	query := trailstore.Query{User: *user, EventName: *eventName, SourceIP: *sourceIP, Resource: *resource}
+	var err error
+	if *startFlag != "" {
+		if query.Start, err = time.Parse(time.RFC3339, *startFlag); err != nil {
+			log.Fatalf("Invalid --start: %v", err)
+		}
+	}
+	if *endFlag != "" {
+		if query.End, err = time.Parse(time.RFC3339, *endFlag); err != nil {
+			log.Fatalf("Invalid --end: %v", err)
+		}
+	}
+
+	store, err := trailstore.Default()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if store == nil {
+		log.Fatalf("Please configure trail_store.dir")
+	}
+	events, err := store.Query(query)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch *format {
+	case "json":
+		fmt.Println("[")
+		for i, event := range events {
+			separator := ","
+			if i == len(events)-1 {
+				separator = ""
+			}
+			fmt.Printf("  %s%s\n", event.Raw, separator)
+		}
+		fmt.Println("]")
+	case "text":
+		for _, event := range events {
+			var resources []string
+			for _, resource := range event.Resources {
+				resources = append(resources, resource.ARN)
+			}
+			fmt.Printf("%s %-30s %-20s %-15s %s\n", event.EventTime.Format(time.RFC3339), event.EventName, event.User(), event.SourceIP, strings.Join(resources, ","))
+		}
+		fmt.Printf("\nEvents: %d\n", len(events))
+	default:
+		log.Fatalf("Unknown format %q, expected text or json", *format)
+	}
+}
+
+// queryCommand esegue una query di riduzione sugli eventi di audit, scritta sulla riga di comando o salvata
+func queryCommand(args []string) {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	configFile := flags.String("config", "", "path to the config file")
+	saved := flags.String("saved", "", "name of a query of audit_queries")
+	days := flags.Int("days", 0, "events of the last days (default the days of the saved query, or 30)")
+	format := flags.String("format", "", "output format: table, csv or json (default table, or the format of the saved query)")
+	output := flags.String("output", "", "output file (default stdout)")
+	flags.Parse(args)
+
+	_, awsCfg := setup(*configFile)
+
+	text := strings.Join(flags.Args(), " ")
+	if *saved != "" {
+		savedQuery, ok := auditquery.Saved(*saved)
+		if !ok {
+			log.Fatalf("Query %s not found in audit_queries", *saved)
+		}
+		text = savedQuery.Query
+		if *days == 0 {
+			*days = savedQuery.Days
+		}
+		if *format == "" {
+			*format = savedQuery.Format
+		}
+	}
+	if *days <= 0 {
+		*days = 30
+	}
+	if *format == "" {
+		*format = auditquery.FormatTable
+	}
+
+	query, err := auditquery.Parse(text)
+	if err != nil {
+		log.Fatal(err)
+	}
+	end := time.Now()
+	table, err := auditquery.Execute(cloudtrail.NewFromConfig(awsCfg), query, end.AddDate(0, 0, -*days), end)
+	if errors.Is(err, trailstore.ErrTruncated) {
+		// Il report parziale viene scritto comunque, segnalando gli eventi non letti
+		log.Printf("Warning: the report is incomplete: %v\n", err)
+	} else if err != nil {
+		log.Fatalf("Unable to read the audit events: %v", err)
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatalf("Unable to create %s: %v", *output, err)
+		}
+		defer file.Close()
+		out = file
+	}
+	if err := auditquery.Write(out, table, *format); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// anomaliesCommand confronta gli eventi recenti di CloudTrail con la baseline di comportamento di ogni principal
+func anomaliesCommand(args []string) {
+	flags := flag.NewFlagSet("anomalies", flag.ExitOnError)
+	configFile := flags.String("config", "", "path to the config file")
+	flags.Parse(args)
+
+	_, awsCfg := setup(*configFile)
+
+	anomalies, err := anomaly.Detect(awsCfg)
+	if err != nil {
+		log.Fatalf("Unable to detect the behavioral anomalies: %v", err)
+	}
+	fmt.Printf("Anomalies: %d\n", len(anomalies))
+	for _, found := range anomalies {
+		fmt.Println(found)
+	}
+	if len(anomalies) > 0 {
+		os.Exit(1)
+	}
+}
+
+// travelCommand cerca i viaggi impossibili tra i login alla console dello stesso utente
+func travelCommand(args []string) {
+	flags := flag.NewFlagSet("travel", flag.ExitOnError)
+	configFile := flags.String("config", "", "path to the config file")
+	flags.Parse(args)
+
+	_, awsCfg := setup(*configFile)
+
+	findings, err := anomaly.DetectTravel(awsCfg)
+	if err != nil {
+		log.Fatalf("Unable to analyze the console logins: %v", err)
+	}
+	impossible := 0
+	for _, finding := range findings {
+		// I login dalle destinazioni dichiarate durante il viaggio non sono viaggi impossibili
+		if finding.Declared {
+			fmt.Printf("[DECLARED] %s\n", finding)
+			continue
+		}
+		impossible++
+		fmt.Printf("[IMPOSSIBLE] %s\n", finding)
+	}
+	fmt.Printf("Impossible travels: %d\n", impossible)
+	if impossible > 0 {
+		os.Exit(1)
+	}
+}
+
+// threatIntelCommand confronta gli indicatori dei feed di threat intelligence con le sorgenti di audit
+func threatIntelCommand(args []string) {
+	flags := flag.NewFlagSet("threatintel", flag.ExitOnError)
+	configFile := flags.String("config", "", "path to the config file")
+	flags.Parse(args)
+
+	_, awsCfg := setup(*configFile)
+
+	report, err := threatintel.Match(awsCfg)
+	if err != nil {
+		log.Printf("Some threat-intel feeds or audit sources were not read: %v", err)
+	}
+	fmt.Printf("Indicators: %d\n", report.Indicators)
+	fmt.Printf("CloudTrail events: %d, flow log records: %d, resolver queries: %d\n", report.Events, report.Flows, report.Queries)
+	fmt.Printf("\nMatches: %d\n", len(report.Findings))
+	for _, finding := range report.Findings {
+		fmt.Println(finding)
+	}
+	if len(report.Findings) > 0 {
+		os.Exit(1)
+	}
+}
+
+// policyCommand salva uno snapshot delle policy dell'account o valuta una richiesta offline
+func policyCommand(args []string) {
+	flags := flag.NewFlagSet("policy", flag.ExitOnError)
+	configFile := flags.String("config", "", "path to the config file")
+	snapshot := flags.String("snapshot", "", "account snapshot file: written when --action is empty, read otherwise")
+	resources := flags.Bool("resources", false, "include the resource-based policies in the snapshot")
+	principal := flags.String("principal", "", "name or ARN of the IAM user or role")
+	action := flags.String("action", "", "action to evaluate, e.g. s3:GetObject")
+	resource := flags.String("resource", "", "ARN of the resource (default any resource)")
+	var conditions multiFlag
+	flags.Var(&conditions, "context", "condition key of the request as key=value, repeatable")
+	flags.Parse(args)
+
+	// Without an action the command only takes the snapshot
+	if *action == "" {
+		if *snapshot == "" {
+			log.Fatal("--snapshot is required")
+		}
+		_, awsCfg := setup(*configFile)
+		account, err := policy.FetchAccount(awsCfg)
+		if err != nil {
+			log.Fatalf("Unable to load the account policies: %v", err)
+		}
+		if *resources {
+			account.FetchResourcePolicies(awsCfg)
+		}
+		if err := account.Save(*snapshot); err != nil {
+			log.Fatalf("Unable to save %s: %v", *snapshot, err)
+		}
+		fmt.Printf("Account snapshot saved to %s\n", *snapshot)
+		return
+	}
+
+	var account *policy.Account
+	var err error
+	if *snapshot != "" {
+		account, err = policy.LoadAccount(*snapshot)
+	} else {
+		_, awsCfg := setup(*configFile)
+		account, err = policy.FetchAccount(awsCfg)
+	}
+	if err != nil {
+		log.Fatalf("Unable to load the account policies: %v", err)
+	}
+
+	ctx := policy.Context{}
+	for _, condition := range conditions {
+		key, value, ok := strings.Cut(condition, "=")
+		if !ok {
+			log.Fatalf("Invalid context %q, expected key=value", condition)
+		}
+		ctx.Set(key, append(ctx.Get(key), value)...)
+	}
+
+	result, err := account.Evaluate(*principal, *action, *resource, ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s: %s\n", result.Decision, result.Reason)
+	if result.Decision != policy.Allowed {
+		os.Exit(1)
+	}
+}
+
+// multiFlag è un flag ripetibile
+type multiFlag []string
+
+func (m *multiFlag) String() string { return strings.Join(*m, ",") }
+
+func (m *multiFlag) Set(value string) error {
+	*m = append(*m, value)
+	return nil
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			serve(os.Args[2:])
+			return
+		case "daemon":
+			daemon(os.Args[2:])
+			return
+		case "graph":
+			graph(os.Args[2:])
+			return
+		case "policy":
+			policyCommand(os.Args[2:])
+			return
+		case "reachability":
+			reachabilityCommand(os.Args[2:])
+			return
+		case "flowlogs":
+			flowLogsCommand(os.Args[2:])
+			return
+		case "ingest":
+			ingestCommand(os.Args[2:])
+			return
+		case "events":
+			eventsCommand(os.Args[2:])
+			return
+		case "query":
+			queryCommand(os.Args[2:])
+			return
+		case "validate-logs":
+			validateLogsCommand(os.Args[2:])
+			return
+		case "anomalies":
+			anomaliesCommand(os.Args[2:])
+			return
+		case "travel":
+			travelCommand(os.Args[2:])
+			return
+		case "threatintel":
+			threatIntelCommand(os.Args[2:])
+			return
+		}
+	}
+
+	// Definisce un flag --config per specificare il file di configurazione
+	configFile := flag.String("config", "", "path to the config file")
+	flag.Parse()
+
+	controls, awsCfg := setup(*configFile)
+
 	// Scopre gli asset AWS
-	assets := discovery.DiscoverAssets(awsCfg)
+	assets, err := discovery.DiscoverAssets(awsCfg)
+	if err != nil {
+		log.Printf("Asset discovery incomplete: %v", err)
+	}
 
 	// Valuta solo gli asset che non sono bucket S3
 	results := evaluation.EvaluateAssets(controls, awsCfg)
@@ -81,7 +753,7 @@ func main() {
 	fmt.Printf("Total Score: %d\n", results)
 	fmt.Println("Asset List:")
 	for _, asset := range assets {
-		fmt.Printf("Name: %s, Type: %s, Cloud: %s\n", asset.Name, asset.Type, asset.Cloud)
+		fmt.Printf("Name: %s, Type: %s, Cloud: %s, Region: %s, ARN: %s\n", asset.Name, asset.Type, asset.Cloud, asset.Region, asset.ARN)
 	}
 
 }
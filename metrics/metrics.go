@@ -0,0 +1,240 @@
+package metrics
+
+import (
+	"cloud_compliance_checker/models"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statuses exported as a state set for every criterion
+var statuses = []string{"COMPLIANT", "NOT COMPLIANT", "NOT APPLICABLE", "TO BE IMPLEMENTED", "NO ASSET"}
+
+// Exporter keeps the compliance posture built from the scans and exposes it in the Prometheus text format.
+// Each check keeps the result of the last scan that evaluated it, so a scan of a subset of the controls
+// does not drop the series of the others; the score is the one of the last full scan.
+type Exporter struct {
+	mu sync.Mutex
+
+	results      map[string]observedResult // by control and check function
+	score        *int
+	scoreAt      time.Time
+	lastSuccess  time.Time
+	lastDuration time.Duration
+	scans        map[string]int
+	nonCompliant map[string]int
+}
+
+// observedResult is the last result of a check with the time of the scan that produced it
+type observedResult struct {
+	result models.ControlResult
+	at     time.Time
+}
+
+// NewExporter creates an empty Exporter
+func NewExporter() *Exporter {
+	return &Exporter{
+		results:      make(map[string]observedResult),
+		scans:        make(map[string]int),
+		nonCompliant: make(map[string]int),
+	}
+}
+
+// Observe records the outcome of a scan. full is false for the scans of a subset of the controls, which
+// update only the checks they evaluated. A failed scan keeps the posture of the previous ones.
+func (e *Exporter) Observe(report *models.Report, duration time.Duration, full bool, scanErr error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if scanErr != nil || report == nil {
+		e.scans["failed"]++
+		return
+	}
+
+	e.scans["completed"]++
+	e.lastSuccess = time.Now()
+	e.lastDuration = duration
+	e.merge(report, e.lastSuccess, full)
+
+	for _, result := range report.Results {
+		if result.Result.Status == "NOT COMPLIANT" {
+			e.nonCompliant[result.CheckFunction]++
+		}
+	}
+}
+
+// Restore loads the posture of a scan completed before the exporter started, without counting it as a new
+// scan. Checks already updated by a more recent scan are kept.
+func (e *Exporter) Restore(report *models.Report, finishedAt time.Time, full bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if finishedAt.After(e.lastSuccess) {
+		e.lastSuccess = finishedAt
+	}
+	e.merge(report, finishedAt, full)
+}
+
+// merge replaces the results of the checks evaluated by a scan, and the score for a full scan, unless a
+// more recent scan already updated them
+func (e *Exporter) merge(report *models.Report, at time.Time, full bool) {
+	for _, result := range report.Results {
+		key := result.ControlID + "\x00" + result.CheckFunction
+		if previous, ok := e.results[key]; ok && previous.at.After(at) {
+			continue
+		}
+		e.results[key] = observedResult{result: result, at: at}
+	}
+
+	if full && (e.score == nil || !e.scoreAt.After(at)) {
+		score := report.Score
+		e.score, e.scoreAt = &score, at
+	}
+}
+
+// sortedResults returns the last result of every check by control and check function
+func (e *Exporter) sortedResults() []models.ControlResult {
+	keys := make([]string, 0, len(e.results))
+	for key := range e.results {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	results := make([]models.ControlResult, 0, len(keys))
+	for _, key := range keys {
+		results = append(results, e.results[key].result)
+	}
+	return results
+}
+
+// ServeHTTP implements the /metrics endpoint
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := e.Write(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Write writes all the metrics in the Prometheus text exposition format
+func (e *Exporter) Write(w io.Writer) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var b strings.Builder
+
+	writeHeader(&b, "compliance_scans_total", "counter", "Number of scans run by this process, by outcome.")
+	for _, outcome := range []string{"completed", "failed"} {
+		writeSample(&b, "compliance_scans_total", labels("outcome", outcome), float64(e.scans[outcome]))
+	}
+
+	writeHeader(&b, "compliance_check_non_compliant_total", "counter", "Number of non compliant results per check.")
+	for _, check := range sortedKeys(e.nonCompliant) {
+		writeSample(&b, "compliance_check_non_compliant_total", labels("check_function", check), float64(e.nonCompliant[check]))
+	}
+
+	if len(e.results) == 0 {
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	results := e.sortedResults()
+
+	if e.score != nil {
+		writeHeader(&b, "compliance_score", "gauge", "Overall NIST SP 800-171 score of the last successful full scan.")
+		writeSample(&b, "compliance_score", "", float64(*e.score))
+	}
+
+	writeHeader(&b, "compliance_last_successful_scan_timestamp_seconds", "gauge", "Unix time of the last successful scan.")
+	writeSample(&b, "compliance_last_successful_scan_timestamp_seconds", "", float64(e.lastSuccess.Unix()))
+
+	if e.lastDuration > 0 {
+		writeHeader(&b, "compliance_scan_duration_seconds", "gauge", "Duration of the last successful scan.")
+		writeSample(&b, "compliance_scan_duration_seconds", "", e.lastDuration.Seconds())
+	}
+
+	// Per-family counters
+	type familyCount struct{ compliant, nonCompliant int }
+	families := make(map[string]*familyCount)
+	for _, result := range results {
+		family := models.ControlFamily(result.ControlID)
+		if families[family] == nil {
+			families[family] = &familyCount{}
+		}
+		switch result.Result.Status {
+		case "COMPLIANT":
+			families[family].compliant++
+		case "NOT COMPLIANT":
+			families[family].nonCompliant++
+		}
+	}
+	familyIDs := make([]string, 0, len(families))
+	for family := range families {
+		familyIDs = append(familyIDs, family)
+	}
+	sort.Strings(familyIDs)
+
+	writeHeader(&b, "compliance_family_checks", "gauge", "Number of checks per control family and status in the last scan evaluating each check.")
+	for _, family := range familyIDs {
+		name := models.ControlFamilyName(family)
+		writeSample(&b, "compliance_family_checks", labels("family", family, "family_name", name, "status", "compliant"), float64(families[family].compliant))
+		writeSample(&b, "compliance_family_checks", labels("family", family, "family_name", name, "status", "non_compliant"), float64(families[family].nonCompliant))
+	}
+
+	// Per-criterion state set and duration
+	writeHeader(&b, "compliance_check_status", "gauge", "Status of each check in the last scan evaluating it (1 for the current status).")
+	for _, result := range results {
+		for _, status := range statuses {
+			value := 0.0
+			if result.Result.Status == status {
+				value = 1
+			}
+			writeSample(&b, "compliance_check_status", labels("control_id", result.ControlID, "check_function", result.CheckFunction, "status", status), value)
+		}
+	}
+
+	writeHeader(&b, "compliance_check_duration_seconds", "gauge", "Duration of each check in the last scan evaluating it.")
+	for _, result := range results {
+		writeSample(&b, "compliance_check_duration_seconds", labels("control_id", result.ControlID, "check_function", result.CheckFunction), result.Duration)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric
+func writeHeader(b *strings.Builder, name, metricType, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, metricType)
+}
+
+// writeSample writes a single sample line
+func writeSample(b *strings.Builder, name, labels string, value float64) {
+	fmt.Fprintf(b, "%s%s %g\n", name, labels, value)
+}
+
+// labels formats label pairs (name, value, name, value, ...) as {name="value",...}
+func labels(pairs ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=%q", pairs[i], escapeLabel(pairs[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// escapeLabel escapes the characters not allowed in a label value. %q already escapes quotes and backslashes.
+func escapeLabel(value string) string {
+	return strings.ReplaceAll(value, "\n", " ")
+}
+
+// sortedKeys returns the keys of the map in alphabetical order
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
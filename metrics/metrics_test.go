@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud_compliance_checker/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func result(controlID, checkFunction, status string) models.ControlResult {
+	return models.ControlResult{ControlID: controlID, CheckFunction: checkFunction, Result: models.ComplianceResult{Status: status}}
+}
+
+func output(t *testing.T, e *Exporter) string {
+	var b strings.Builder
+	assert.NoError(t, e.Write(&b))
+	return b.String()
+}
+
+func TestObserveMergesSubsetScans(t *testing.T) {
+	e := NewExporter()
+	e.Observe(&models.Report{Score: 80, Results: []models.ControlResult{
+		result("03.01.01", "CheckUsersPolicies", "COMPLIANT"),
+		result("03.03.01", "CheckAuditLogs", "COMPLIANT"),
+	}}, time.Minute, true, nil)
+
+	// A scan of one control updates its check only and keeps the score of the full scan
+	e.Observe(&models.Report{Score: 0, Results: []models.ControlResult{
+		result("03.03.01", "CheckAuditLogs", "NOT COMPLIANT"),
+	}}, time.Second, false, nil)
+
+	text := output(t, e)
+	assert.Contains(t, text, "compliance_score 80\n")
+	assert.Contains(t, text, `compliance_check_status{control_id="03.01.01",check_function="CheckUsersPolicies",status="COMPLIANT"} 1`)
+	assert.Contains(t, text, `compliance_check_status{control_id="03.03.01",check_function="CheckAuditLogs",status="NOT COMPLIANT"} 1`)
+	assert.Contains(t, text, `compliance_check_status{control_id="03.03.01",check_function="CheckAuditLogs",status="COMPLIANT"} 0`)
+	assert.Contains(t, text, `compliance_family_checks{family="03.01",family_name=`)
+	assert.Contains(t, text, `compliance_check_non_compliant_total{check_function="CheckAuditLogs"} 1`)
+
+	// A failed scan keeps the posture
+	e.Observe(nil, 0, true, errors.New("failed"))
+	text = output(t, e)
+	assert.Contains(t, text, "compliance_score 80\n")
+	assert.Contains(t, text, `compliance_scans_total{outcome="failed"} 1`)
+	assert.Contains(t, text, `compliance_scans_total{outcome="completed"} 2`)
+}
+
+func TestRestore(t *testing.T) {
+	e := NewExporter()
+	old := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	// Only subset scans: no score
+	e.Restore(&models.Report{Score: 10, Results: []models.ControlResult{result("03.03.01", "CheckAuditLogs", "COMPLIANT")}}, old.Add(time.Hour), false)
+	assert.NotContains(t, output(t, e), "compliance_score ")
+
+	// An older full scan does not replace the more recent result of a check
+	e.Restore(&models.Report{Score: 70, Results: []models.ControlResult{
+		result("03.01.01", "CheckUsersPolicies", "COMPLIANT"),
+		result("03.03.01", "CheckAuditLogs", "NOT COMPLIANT"),
+	}}, old, true)
+
+	text := output(t, e)
+	assert.Contains(t, text, "compliance_score 70\n")
+	assert.Contains(t, text, `compliance_check_status{control_id="03.03.01",check_function="CheckAuditLogs",status="COMPLIANT"} 1`)
+	assert.Contains(t, text, `compliance_check_status{control_id="03.01.01",check_function="CheckUsersPolicies",status="COMPLIANT"} 1`)
+	assert.Contains(t, text, "compliance_last_successful_scan_timestamp_seconds 1.7145252e+09\n")
+	assert.NotContains(t, text, "compliance_check_non_compliant_total{")
+
+	// The score is the one of the most recent full scan
+	e.Restore(&models.Report{Score: 60}, old.Add(-time.Hour), true)
+	assert.Contains(t, output(t, e), "compliance_score 70\n")
+}
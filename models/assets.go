@@ -0,0 +1,188 @@
+package models
+
+import "time"
+
+// Asset types
+const (
+	AssetTypeEC2Instance    = "EC2 Instance"
+	AssetTypeS3Bucket       = "S3 Bucket"
+	AssetTypeIAMUser        = "IAM User"
+	AssetTypeIAMRole        = "IAM Role"
+	AssetTypeKMSKey         = "KMS Key"
+	AssetTypeRDSInstance    = "RDS Instance"
+	AssetTypeLambdaFunction = "Lambda Function"
+	AssetTypeVPC            = "VPC"
+	AssetTypeSubnet         = "Subnet"
+	AssetTypeSecurityGroup  = "Security Group"
+	AssetTypeLoadBalancer   = "Load Balancer"
+	AssetTypeCloudFront     = "CloudFront Distribution"
+	AssetTypeAPIGateway     = "API Gateway"
+	AssetTypeSNSTopic       = "SNS Topic"
+	AssetTypeLogGroup       = "CloudWatch Log Group"
+)
+
+// GlobalRegion is the region of the assets of global services (IAM, CloudFront, S3 namespace)
+const GlobalRegion = "global"
+
+// AssetDetails is the type specific payload of an asset. Every asset type has its own struct.
+type AssetDetails interface {
+	AssetType() string
+}
+
+// EC2InstanceDetails describes an EC2 instance
+type EC2InstanceDetails struct {
+	InstanceID         string   `json:"instance_id"`
+	InstanceType       string   `json:"instance_type"`
+	State              string   `json:"state"`
+	VpcID              string   `json:"vpc_id,omitempty"`
+	SubnetID           string   `json:"subnet_id,omitempty"`
+	PrivateIP          string   `json:"private_ip,omitempty"`
+	PublicIP           string   `json:"public_ip,omitempty"`
+	SecurityGroupIDs   []string `json:"security_group_ids,omitempty"`
+	InstanceProfileArn string   `json:"instance_profile_arn,omitempty"`
+}
+
+func (EC2InstanceDetails) AssetType() string { return AssetTypeEC2Instance }
+
+// S3BucketDetails describes an S3 bucket
+type S3BucketDetails struct {
+	CreationDate time.Time `json:"creation_date"`
+}
+
+func (S3BucketDetails) AssetType() string { return AssetTypeS3Bucket }
+
+// IAMUserDetails describes an IAM user
+type IAMUserDetails struct {
+	UserID           string     `json:"user_id"`
+	Path             string     `json:"path"`
+	CreateDate       time.Time  `json:"create_date"`
+	PasswordLastUsed *time.Time `json:"password_last_used,omitempty"`
+}
+
+func (IAMUserDetails) AssetType() string { return AssetTypeIAMUser }
+
+// IAMRoleDetails describes an IAM role
+type IAMRoleDetails struct {
+	RoleID                   string    `json:"role_id"`
+	Path                     string    `json:"path"`
+	CreateDate               time.Time `json:"create_date"`
+	AssumeRolePolicyDocument string    `json:"assume_role_policy_document,omitempty"`
+}
+
+func (IAMRoleDetails) AssetType() string { return AssetTypeIAMRole }
+
+// KMSKeyDetails describes a KMS key
+type KMSKeyDetails struct {
+	KeyID      string `json:"key_id"`
+	KeyState   string `json:"key_state"`
+	KeyManager string `json:"key_manager"`
+	KeyUsage   string `json:"key_usage"`
+}
+
+func (KMSKeyDetails) AssetType() string { return AssetTypeKMSKey }
+
+// RDSInstanceDetails describes an RDS DB instance
+type RDSInstanceDetails struct {
+	Engine             string   `json:"engine"`
+	InstanceClass      string   `json:"instance_class"`
+	StorageEncrypted   bool     `json:"storage_encrypted"`
+	KmsKeyID           string   `json:"kms_key_id,omitempty"`
+	PubliclyAccessible bool     `json:"publicly_accessible"`
+	MultiAZ            bool     `json:"multi_az"`
+	VpcID              string   `json:"vpc_id,omitempty"`
+	SubnetIDs          []string `json:"subnet_ids,omitempty"`
+	SecurityGroupIDs   []string `json:"security_group_ids,omitempty"`
+}
+
+func (RDSInstanceDetails) AssetType() string { return AssetTypeRDSInstance }
+
+// LambdaFunctionDetails describes a Lambda function
+type LambdaFunctionDetails struct {
+	Runtime          string   `json:"runtime,omitempty"`
+	Role             string   `json:"role"`
+	KmsKeyArn        string   `json:"kms_key_arn,omitempty"`
+	VpcID            string   `json:"vpc_id,omitempty"`
+	SubnetIDs        []string `json:"subnet_ids,omitempty"`
+	SecurityGroupIDs []string `json:"security_group_ids,omitempty"`
+}
+
+func (LambdaFunctionDetails) AssetType() string { return AssetTypeLambdaFunction }
+
+// VPCDetails describes a VPC
+type VPCDetails struct {
+	VpcID     string `json:"vpc_id"`
+	CidrBlock string `json:"cidr_block"`
+	IsDefault bool   `json:"is_default"`
+}
+
+func (VPCDetails) AssetType() string { return AssetTypeVPC }
+
+// SubnetDetails describes a subnet
+type SubnetDetails struct {
+	SubnetID            string `json:"subnet_id"`
+	VpcID               string `json:"vpc_id"`
+	CidrBlock           string `json:"cidr_block"`
+	AvailabilityZone    string `json:"availability_zone"`
+	MapPublicIPOnLaunch bool   `json:"map_public_ip_on_launch"`
+}
+
+func (SubnetDetails) AssetType() string { return AssetTypeSubnet }
+
+// SecurityGroupDetails describes a security group
+type SecurityGroupDetails struct {
+	GroupID      string `json:"group_id"`
+	VpcID        string `json:"vpc_id,omitempty"`
+	Description  string `json:"description,omitempty"`
+	IngressRules int    `json:"ingress_rules"`
+	EgressRules  int    `json:"egress_rules"`
+}
+
+func (SecurityGroupDetails) AssetType() string { return AssetTypeSecurityGroup }
+
+// LoadBalancerDetails describes a classic, application, network or gateway load balancer
+type LoadBalancerDetails struct {
+	LoadBalancerType string   `json:"load_balancer_type"`
+	Scheme           string   `json:"scheme"`
+	DNSName          string   `json:"dns_name"`
+	VpcID            string   `json:"vpc_id,omitempty"`
+	SubnetIDs        []string `json:"subnet_ids,omitempty"`
+	SecurityGroupIDs []string `json:"security_group_ids,omitempty"`
+}
+
+func (LoadBalancerDetails) AssetType() string { return AssetTypeLoadBalancer }
+
+// CloudFrontDetails describes a CloudFront distribution
+type CloudFrontDetails struct {
+	ID         string   `json:"id"`
+	DomainName string   `json:"domain_name"`
+	Enabled    bool     `json:"enabled"`
+	Origins    []string `json:"origins,omitempty"`
+	WebACLID   string   `json:"web_acl_id,omitempty"`
+}
+
+func (CloudFrontDetails) AssetType() string { return AssetTypeCloudFront }
+
+// APIGatewayDetails describes an API Gateway REST API
+type APIGatewayDetails struct {
+	ID            string   `json:"id"`
+	EndpointTypes []string `json:"endpoint_types,omitempty"`
+	VpcEndpoints  []string `json:"vpc_endpoints,omitempty"`
+}
+
+func (APIGatewayDetails) AssetType() string { return AssetTypeAPIGateway }
+
+// SNSTopicDetails describes an SNS topic
+type SNSTopicDetails struct {
+	KmsMasterKeyID string `json:"kms_master_key_id,omitempty"`
+}
+
+func (SNSTopicDetails) AssetType() string { return AssetTypeSNSTopic }
+
+// LogGroupDetails describes a CloudWatch log group
+type LogGroupDetails struct {
+	RetentionDays int    `json:"retention_days,omitempty"`
+	KmsKeyID      string `json:"kms_key_id,omitempty"`
+	StoredBytes   int64  `json:"stored_bytes"`
+}
+
+func (LogGroupDetails) AssetType() string { return AssetTypeLogGroup }
@@ -0,0 +1,41 @@
+package models
+
+import "strings"
+
+// controlFamilies maps the NIST SP 800-171 r3 family prefix to its name
+var controlFamilies = map[string]string{
+	"03.01": "Access Control",
+	"03.02": "Awareness and Training",
+	"03.03": "Audit and Accountability",
+	"03.04": "Configuration Management",
+	"03.05": "Identification and Authentication",
+	"03.06": "Incident Response",
+	"03.07": "Maintenance",
+	"03.08": "Media Protection",
+	"03.09": "Personnel Security",
+	"03.10": "Physical Protection",
+	"03.11": "Risk Assessment",
+	"03.12": "Security Assessment and Monitoring",
+	"03.13": "System and Communications Protection",
+	"03.14": "System and Information Integrity",
+	"03.15": "Planning",
+	"03.16": "System and Services Acquisition",
+	"03.17": "Supply Chain Risk Management",
+}
+
+// ControlFamily returns the family prefix of a control ID (e.g. "03.01" for "03.01.05")
+func ControlFamily(controlID string) string {
+	parts := strings.Split(controlID, ".")
+	if len(parts) < 2 {
+		return controlID
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// ControlFamilyName returns the name of the family a control ID belongs to
+func ControlFamilyName(controlID string) string {
+	if name, ok := controlFamilies[ControlFamily(controlID)]; ok {
+		return name
+	}
+	return "Unknown"
+}
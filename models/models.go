@@ -5,15 +5,63 @@ type Asset struct {
 	Name    string
 	Type    string
 	Cloud   string
-	Details interface{}
+	ARN     string
+	Region  string
+	Tags    map[string]string
+	Details AssetDetails
+	// TagsUnknown is set when the tags of the asset could not be read
+	TagsUnknown bool
 }
 
 // ComplianceResult represents the result of a compliance check
 type ComplianceResult struct {
-	Description string
-	Status      string
-	Response    string
-	Impact      int
+	Description string        `json:"description"`
+	Status      string        `json:"status"`
+	Response    string        `json:"response"`
+	Impact      int           `json:"impact"`
+	Remediation []Remediation `json:"remediation,omitempty"`
+}
+
+// Remediation represents the infrastructure-as-code fix for a non compliant resource
+type Remediation struct {
+	CheckFunction  string `json:"check_function"`
+	Resource       string `json:"resource"`
+	Description    string `json:"description"`
+	Terraform      string `json:"terraform"`
+	CloudFormation string `json:"cloudformation"`
+}
+
+// ControlResult represents the result of a single criteria of a control
+type ControlResult struct {
+	ControlID     string           `json:"control_id"`
+	ControlName   string           `json:"control_name"`
+	CheckFunction string           `json:"check_function"`
+	Result        ComplianceResult `json:"result"`
+	Duration      float64          `json:"duration_seconds"`
+	// Assets skipped by the check because they are outside the CUI scope
+	OutOfScope []OutOfScopeAsset `json:"out_of_scope,omitempty"`
+}
+
+// OutOfScopeAsset is an asset outside the CUI enclave, with the reason of the exclusion
+type OutOfScopeAsset struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	ARN    string `json:"arn"`
+	Region string `json:"region"`
+	Reason string `json:"reason"`
+}
+
+// Report represents the outcome of a compliance evaluation
+type Report struct {
+	Score           int             `json:"score"`
+	TotalControls   int             `json:"total_controls"`
+	Compliant       int             `json:"compliant"`
+	NonCompliant    int             `json:"non_compliant"`
+	NotApplicable   int             `json:"not_applicable"`
+	ToBeImplemented int             `json:"to_be_implemented"`
+	Results         []ControlResult `json:"results"`
+	// Discovered assets outside the CUI scope, not evaluated by the checks
+	OutOfScope []OutOfScopeAsset `json:"out_of_scope,omitempty"`
 }
 
 // Score represents the compliance score of an asset
@@ -39,5 +87,5 @@ type Control struct {
 
 // NISTControls represents a collection of NIST controls
 type NISTControls struct {
-	Controls []Control
+	Controls []Control `json:"controls"`
 }
@@ -0,0 +1,387 @@
+package notify
+
+import (
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/models"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// Severity levels, from the lowest to the highest
+const (
+	SeverityInfo     = "info"
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+var severityRank = map[string]int{
+	SeverityInfo:     0,
+	SeverityLow:      1,
+	SeverityMedium:   2,
+	SeverityHigh:     3,
+	SeverityCritical: 4,
+}
+
+const (
+	defaultDedupWindow     = time.Hour
+	defaultRateLimitPeriod = time.Hour
+)
+
+// ErrNotConfigured is returned by Send when no notification channel is configured,
+// so callers can fall back to their own delivery
+var ErrNotConfigured = errors.New("no notification channel configured")
+
+// Event is a notification about a check or an incident
+type Event struct {
+	Title         string    `json:"title"`
+	Message       string    `json:"message"`
+	Severity      string    `json:"severity"`
+	ControlID     string    `json:"control_id,omitempty"`
+	CheckFunction string    `json:"check_function,omitempty"`
+	Family        string    `json:"family,omitempty"`
+	Account       string    `json:"account,omitempty"`
+	Resource      string    `json:"resource,omitempty"`
+	Time          time.Time `json:"time"`
+	// Key identifies repeated notifications of the same problem; when empty it is derived from the other fields
+	Key string `json:"-"`
+}
+
+// Notifier is a notification backend
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, event Event) error
+}
+
+// Route sends the events matching the filters to a set of channels
+type Route struct {
+	Channels    []string
+	MinSeverity string
+	Families    []string
+	Accounts    []string
+}
+
+// Dispatcher routes the events to the notifiers, dropping duplicates and events over the rate limit
+type Dispatcher struct {
+	notifiers   map[string]Notifier
+	order       []string
+	routes      []Route
+	account     string
+	dedupWindow time.Duration
+	rateMax     int
+	ratePeriod  time.Duration
+
+	mu   sync.Mutex
+	sent map[string]time.Time   // channel + event key -> last delivery
+	rate map[string][]time.Time // channel -> deliveries in the current period
+}
+
+// NewDispatcher creates a Dispatcher. With no routes every event goes to every notifier.
+func NewDispatcher(notifiers []Notifier, routes []Route, dedupWindow time.Duration, rateMax int, ratePeriod time.Duration) (*Dispatcher, error) {
+	d := &Dispatcher{
+		notifiers:   make(map[string]Notifier),
+		routes:      routes,
+		dedupWindow: dedupWindow,
+		rateMax:     rateMax,
+		ratePeriod:  ratePeriod,
+		sent:        make(map[string]time.Time),
+		rate:        make(map[string][]time.Time),
+	}
+
+	for _, n := range notifiers {
+		if _, ok := d.notifiers[n.Name()]; ok {
+			return nil, fmt.Errorf("duplicate notification channel %s", n.Name())
+		}
+		d.notifiers[n.Name()] = n
+		d.order = append(d.order, n.Name())
+	}
+
+	for _, route := range routes {
+		if route.MinSeverity != "" {
+			if _, ok := severityRank[strings.ToLower(route.MinSeverity)]; !ok {
+				return nil, fmt.Errorf("unknown severity %s", route.MinSeverity)
+			}
+		}
+		for _, channel := range route.Channels {
+			if _, ok := d.notifiers[channel]; !ok {
+				return nil, fmt.Errorf("route references unknown channel %s", channel)
+			}
+		}
+	}
+	return d, nil
+}
+
+// Send delivers the event to the channels of the matching routes.
+// The event is dropped for a channel that already received it within the dedup window or that is over its rate limit.
+func (d *Dispatcher) Send(event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.Severity == "" {
+		event.Severity = SeverityMedium
+	}
+	if event.Family == "" && event.ControlID != "" {
+		event.Family = models.ControlFamily(event.ControlID)
+	}
+	if event.Account == "" {
+		event.Account = d.account
+	}
+	key := event.Key
+	if key == "" {
+		key = eventKey(event)
+	}
+
+	var errs []string
+	for _, channel := range d.channelsFor(event) {
+		if !d.allow(channel, key, event.Time) {
+			continue
+		}
+
+		if err := d.notifiers[channel].Notify(context.TODO(), event); err != nil {
+			log.Printf("Notification to %s failed: %v\n", channel, err)
+			errs = append(errs, fmt.Sprintf("%s: %v", channel, err))
+			d.forget(channel, key)
+			continue
+		}
+		log.Printf("Notification %q sent to %s\n", event.Title, channel)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to send notification: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// channelsFor returns the channels of all the routes matching the event
+func (d *Dispatcher) channelsFor(event Event) []string {
+	if len(d.routes) == 0 {
+		return d.order
+	}
+
+	selected := make(map[string]bool)
+	for _, route := range d.routes {
+		if route.matches(event) {
+			for _, channel := range route.Channels {
+				selected[channel] = true
+			}
+		}
+	}
+
+	var channels []string
+	for _, channel := range d.order {
+		if selected[channel] {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// matches checks the severity, family and account filters of the route
+func (r Route) matches(event Event) bool {
+	if r.MinSeverity != "" && severityRank[strings.ToLower(event.Severity)] < severityRank[strings.ToLower(r.MinSeverity)] {
+		return false
+	}
+	if len(r.Families) > 0 && !matchesFamily(r.Families, event.Family) {
+		return false
+	}
+	if len(r.Accounts) > 0 && !contains(r.Accounts, event.Account) {
+		return false
+	}
+	return true
+}
+
+// matchesFamily accepts both the family ID (03.03) and its name (Audit and Accountability)
+func matchesFamily(families []string, family string) bool {
+	if family == "" {
+		return false
+	}
+	for _, f := range families {
+		if f == family || strings.EqualFold(f, models.ControlFamilyName(family)) {
+			return true
+		}
+	}
+	return false
+}
+
+// allow applies deduplication and rate limiting, and records the delivery
+func (d *Dispatcher) allow(channel, key string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sentKey := channel + "|" + key
+	if last, ok := d.sent[sentKey]; ok && d.dedupWindow > 0 && now.Sub(last) < d.dedupWindow {
+		log.Printf("Notification to %s suppressed: duplicate within %v\n", channel, d.dedupWindow)
+		return false
+	}
+
+	if d.rateMax > 0 {
+		var recent []time.Time
+		for _, t := range d.rate[channel] {
+			if now.Sub(t) < d.ratePeriod {
+				recent = append(recent, t)
+			}
+		}
+		if len(recent) >= d.rateMax {
+			d.rate[channel] = recent
+			log.Printf("Notification to %s suppressed: rate limit of %d per %v reached\n", channel, d.rateMax, d.ratePeriod)
+			return false
+		}
+		d.rate[channel] = append(recent, now)
+	}
+
+	d.sent[sentKey] = now
+	return true
+}
+
+// forget removes a failed delivery from the dedup cache so that it can be retried
+func (d *Dispatcher) forget(channel, key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.sent, channel+"|"+key)
+}
+
+// eventKey identifies an event by what it is about, ignoring the time and the message,
+// which often embeds timestamps or counters
+func eventKey(event Event) string {
+	h := sha256.Sum256([]byte(strings.Join([]string{
+		event.Title, event.Severity, event.ControlID, event.CheckFunction, event.Account, event.Resource,
+	}, "\x00")))
+	return hex.EncodeToString(h[:])
+}
+
+// contains checks if a string is present in the list
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// SeverityForImpact maps the impact of a failed criteria to a severity
+func SeverityForImpact(impact int) string {
+	switch {
+	case impact >= 5:
+		return SeverityHigh
+	case impact >= 3:
+		return SeverityMedium
+	default:
+		return SeverityLow
+	}
+}
+
+var (
+	defaultMu         sync.RWMutex
+	defaultDispatcher *Dispatcher
+)
+
+// Setup creates the global dispatcher from the configuration. Nothing is done when no channel is configured.
+func Setup(cfg config.NotificationsConfig, awsCfg aws.Config) error {
+	if len(cfg.Channels) == 0 {
+		return nil
+	}
+
+	var notifiers []Notifier
+	for _, channel := range cfg.Channels {
+		n, err := newNotifier(channel, awsCfg)
+		if err != nil {
+			return err
+		}
+		notifiers = append(notifiers, n)
+	}
+
+	var routes []Route
+	for _, r := range cfg.Routes {
+		routes = append(routes, Route{Channels: r.Channels, MinSeverity: r.MinSeverity, Families: r.Families, Accounts: r.Accounts})
+	}
+
+	dedupWindow, err := parseDuration(cfg.DedupWindow, defaultDedupWindow)
+	if err != nil {
+		return fmt.Errorf("invalid dedup_window: %v", err)
+	}
+	ratePeriod, err := parseDuration(cfg.RateLimit.Period, defaultRateLimitPeriod)
+	if err != nil {
+		return fmt.Errorf("invalid rate_limit.period: %v", err)
+	}
+
+	d, err := NewDispatcher(notifiers, routes, dedupWindow, cfg.RateLimit.Max, ratePeriod)
+	if err != nil {
+		return err
+	}
+
+	// The account is used by the routing rules for events that do not carry their own
+	identity, err := sts.NewFromConfig(awsCfg).GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+	if err != nil {
+		log.Printf("Unable to determine the AWS account for notifications: %v\n", err)
+	} else {
+		d.account = aws.ToString(identity.Account)
+	}
+
+	defaultMu.Lock()
+	defaultDispatcher = d
+	defaultMu.Unlock()
+
+	log.Printf("Notifications configured: %d channel(s), %d route(s)\n", len(notifiers), len(routes))
+	return nil
+}
+
+// Enabled reports whether the global dispatcher is configured
+func Enabled() bool {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultDispatcher != nil
+}
+
+// Send delivers the event through the global dispatcher
+func Send(event Event) error {
+	defaultMu.RLock()
+	d := defaultDispatcher
+	defaultMu.RUnlock()
+
+	if d == nil {
+		return ErrNotConfigured
+	}
+	return d.Send(event)
+}
+
+// newNotifier creates the backend of a configured channel
+func newNotifier(channel config.NotificationChannel, awsCfg aws.Config) (Notifier, error) {
+	if channel.Name == "" {
+		return nil, fmt.Errorf("notification channel without a name")
+	}
+
+	switch strings.ToLower(channel.Type) {
+	case "slack":
+		return NewSlackNotifier(channel.Name, channel.URL)
+	case "teams":
+		return NewTeamsNotifier(channel.Name, channel.URL)
+	case "webhook":
+		return NewWebhookNotifier(channel.Name, channel.URL, channel.Secret)
+	case "smtp":
+		return NewSMTPNotifier(channel.Name, channel.Host, channel.Port, channel.Username, channel.Password, channel.From, channel.To)
+	case "sns":
+		return NewSNSNotifier(channel.Name, awsCfg, channel.TopicArn)
+	default:
+		return nil, fmt.Errorf("channel %s: unknown type %q", channel.Name, channel.Type)
+	}
+}
+
+// parseDuration parses a Go duration, returning def for an empty string
+func parseDuration(value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	return time.ParseDuration(value)
+}
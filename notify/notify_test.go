@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeNotifier records the events it receives
+type fakeNotifier struct {
+	name   string
+	events []Event
+	err    error
+}
+
+func (f *fakeNotifier) Name() string { return f.name }
+
+func (f *fakeNotifier) Notify(ctx context.Context, event Event) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.events = append(f.events, event)
+	return nil
+}
+
+func TestNewDispatcher(t *testing.T) {
+	a, b := &fakeNotifier{name: "a"}, &fakeNotifier{name: "a"}
+	_, err := NewDispatcher([]Notifier{a, b}, nil, 0, 0, 0)
+	assert.Error(t, err)
+
+	_, err = NewDispatcher([]Notifier{a}, []Route{{Channels: []string{"missing"}}}, 0, 0, 0)
+	assert.Error(t, err)
+
+	_, err = NewDispatcher([]Notifier{a}, []Route{{Channels: []string{"a"}, MinSeverity: "urgent"}}, 0, 0, 0)
+	assert.Error(t, err)
+}
+
+func TestRoutes(t *testing.T) {
+	slack, mail, sns := &fakeNotifier{name: "slack"}, &fakeNotifier{name: "mail"}, &fakeNotifier{name: "sns"}
+	d, err := NewDispatcher([]Notifier{slack, mail, sns}, []Route{
+		{Channels: []string{"mail"}, MinSeverity: "HIGH"},
+		{Channels: []string{"slack"}, Families: []string{"audit and accountability"}},
+		{Channels: []string{"sns"}, Families: []string{"03.01"}, Accounts: []string{"111111111111"}},
+	}, 0, 0, 0)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"slack", "mail"}, d.channelsFor(Event{Severity: SeverityCritical, Family: "03.03"}))
+	assert.Empty(t, d.channelsFor(Event{Severity: SeverityMedium, Family: "03.05"}))
+	assert.Equal(t, []string{"sns"}, d.channelsFor(Event{Severity: SeverityLow, Family: "03.01", Account: "111111111111"}))
+	assert.Empty(t, d.channelsFor(Event{Severity: SeverityLow, Family: "03.01", Account: "222222222222"}))
+
+	// The family is derived from the control and the severity defaults to medium
+	assert.NoError(t, d.Send(Event{Title: "Audit logs", ControlID: "03.03.01"}))
+	assert.Len(t, slack.events, 1)
+	assert.Empty(t, mail.events)
+	assert.Equal(t, SeverityMedium, slack.events[0].Severity)
+	assert.Equal(t, "03.03", slack.events[0].Family)
+
+	// Without routes every event goes to every channel
+	d, err = NewDispatcher([]Notifier{slack, mail}, nil, 0, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"slack", "mail"}, d.channelsFor(Event{}))
+	assert.False(t, Route{Families: []string{"03.03"}}.matches(Event{}))
+}
+
+func TestDedupAndRateLimit(t *testing.T) {
+	n := &fakeNotifier{name: "n"}
+	d, err := NewDispatcher([]Notifier{n}, nil, time.Hour, 0, 0)
+	assert.NoError(t, err)
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	// The message is not part of the key: the same problem is sent once per dedup window
+	assert.NoError(t, d.Send(Event{Title: "Root login", Message: "1 login", Time: at}))
+	assert.NoError(t, d.Send(Event{Title: "Root login", Message: "2 logins", Time: at.Add(30 * time.Minute)}))
+	assert.Len(t, n.events, 1)
+	assert.NoError(t, d.Send(Event{Title: "Root login", Time: at.Add(61 * time.Minute)}))
+	assert.Len(t, n.events, 2)
+
+	// An explicit key groups different events
+	assert.NoError(t, d.Send(Event{Title: "A", Key: "same", Time: at}))
+	assert.NoError(t, d.Send(Event{Title: "B", Key: "same", Time: at.Add(time.Minute)}))
+	assert.Len(t, n.events, 3)
+
+	// At most 2 notifications per hour, whatever the event
+	n = &fakeNotifier{name: "n"}
+	d, err = NewDispatcher([]Notifier{n}, nil, 0, 2, time.Hour)
+	assert.NoError(t, err)
+	for i, title := range []string{"A", "B", "C"} {
+		assert.NoError(t, d.Send(Event{Title: title, Time: at.Add(time.Duration(i) * time.Minute)}))
+	}
+	assert.Len(t, n.events, 2)
+	assert.NoError(t, d.Send(Event{Title: "C", Time: at.Add(61 * time.Minute)}))
+	assert.Len(t, n.events, 3)
+}
+
+func TestFailedDeliveryIsRetried(t *testing.T) {
+	n := &fakeNotifier{name: "n", err: errors.New("unavailable")}
+	d, err := NewDispatcher([]Notifier{n}, nil, time.Hour, 0, 0)
+	assert.NoError(t, err)
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	assert.Error(t, d.Send(Event{Title: "Root login", Time: at}))
+	n.err = nil
+	assert.NoError(t, d.Send(Event{Title: "Root login", Time: at.Add(time.Minute)}))
+	assert.Len(t, n.events, 1)
+}
+
+func TestHeaderValue(t *testing.T) {
+	assert.Equal(t, "Root login Bcc: attacker@example.com", headerValue("Root login\r\nBcc: attacker@example.com"))
+	assert.Equal(t, "a b c", headerValue("a\rb\nc"))
+}
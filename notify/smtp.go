@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPNotifier sends the event by email. STARTTLS is used when the server supports it.
+type SMTPNotifier struct {
+	name     string
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+// NewSMTPNotifier creates an SMTP notifier. The port defaults to 587.
+func NewSMTPNotifier(name, host string, port int, username, password, from string, to []string) (*SMTPNotifier, error) {
+	if host == "" || from == "" || len(to) == 0 {
+		return nil, fmt.Errorf("channel %s: smtp requires host, from and to", name)
+	}
+	if port == 0 {
+		port = 587
+	}
+	return &SMTPNotifier{
+		name:     name,
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		host:     host,
+		username: username,
+		password: password,
+		from:     from,
+		to:       to,
+	}, nil
+}
+
+// headerValue removes the line breaks from a header value, so that it can't add headers to the message
+func headerValue(s string) string {
+	return strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(s)
+}
+
+// Name returns the channel name
+func (n *SMTPNotifier) Name() string { return n.name }
+
+// Notify sends the event as a plain text email
+func (n *SMTPNotifier) Notify(ctx context.Context, event Event) error {
+	var auth smtp.Auth
+	if n.username != "" {
+		auth = smtp.PlainAuth("", n.username, n.password, n.host)
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", n.from)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&body, "Subject: [%s] %s\r\n", strings.ToUpper(event.Severity), headerValue(event.Title))
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	body.WriteString(event.Message + "\r\n\r\n")
+	for _, fact := range eventFacts(event) {
+		fmt.Fprintf(&body, "%s: %s\r\n", fact[0], fact[1])
+	}
+
+	if err := smtp.SendMail(n.addr, auth, n.from, n.to, []byte(body.String())); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+	return nil
+}
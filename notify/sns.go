@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// SNSNotifier publishes the event to an SNS topic. The severity and the family are set as message
+// attributes so that subscriptions can use filter policies.
+type SNSNotifier struct {
+	name     string
+	topicArn string
+	client   *sns.Client
+}
+
+// NewSNSNotifier creates an SNS notifier
+func NewSNSNotifier(name string, cfg aws.Config, topicArn string) (*SNSNotifier, error) {
+	if topicArn == "" {
+		return nil, fmt.Errorf("channel %s: sns requires topic_arn", name)
+	}
+	return &SNSNotifier{name: name, topicArn: topicArn, client: sns.NewFromConfig(cfg)}, nil
+}
+
+// Name returns the channel name
+func (n *SNSNotifier) Name() string { return n.name }
+
+// Notify publishes the event as JSON
+func (n *SNSNotifier) Notify(ctx context.Context, event Event) error {
+	message, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %v", err)
+	}
+
+	// The subject is limited to 100 characters
+	subject := fmt.Sprintf("[%s] %s", strings.ToUpper(event.Severity), event.Title)
+	if len(subject) > 100 {
+		subject = subject[:100]
+	}
+
+	attributes := map[string]types.MessageAttributeValue{
+		"severity": {DataType: aws.String("String"), StringValue: aws.String(event.Severity)},
+	}
+	if event.Family != "" {
+		attributes["family"] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(event.Family)}
+	}
+
+	_, err = n.client.Publish(ctx, &sns.PublishInput{
+		TopicArn:          aws.String(n.topicArn),
+		Subject:           aws.String(subject),
+		Message:           aws.String(string(message)),
+		MessageAttributes: attributes,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish to %s: %v", n.topicArn, err)
+	}
+	return nil
+}
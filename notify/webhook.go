@@ -0,0 +1,192 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// SlackNotifier posts to a Slack incoming webhook
+type SlackNotifier struct {
+	name string
+	url  string
+}
+
+// NewSlackNotifier creates a Slack incoming webhook notifier
+func NewSlackNotifier(name, url string) (*SlackNotifier, error) {
+	if url == "" {
+		return nil, fmt.Errorf("channel %s: slack requires url", name)
+	}
+	return &SlackNotifier{name: name, url: url}, nil
+}
+
+// Name returns the channel name
+func (n *SlackNotifier) Name() string { return n.name }
+
+// Notify posts the event as a Slack message
+func (n *SlackNotifier) Notify(ctx context.Context, event Event) error {
+	payload := map[string]interface{}{
+		"text": fmt.Sprintf("*[%s] %s*\n%s\n%s", strings.ToUpper(event.Severity), event.Title, event.Message, eventContext(event)),
+	}
+	return postJSON(ctx, n.url, payload, nil)
+}
+
+// TeamsNotifier posts to a Microsoft Teams incoming webhook
+type TeamsNotifier struct {
+	name string
+	url  string
+}
+
+// NewTeamsNotifier creates a Teams incoming webhook notifier
+func NewTeamsNotifier(name, url string) (*TeamsNotifier, error) {
+	if url == "" {
+		return nil, fmt.Errorf("channel %s: teams requires url", name)
+	}
+	return &TeamsNotifier{name: name, url: url}, nil
+}
+
+// Name returns the channel name
+func (n *TeamsNotifier) Name() string { return n.name }
+
+var teamsColors = map[string]string{
+	SeverityInfo:     "0076D7",
+	SeverityLow:      "2EB886",
+	SeverityMedium:   "DAA038",
+	SeverityHigh:     "E8710A",
+	SeverityCritical: "D40E0D",
+}
+
+// Notify posts the event as a Teams message card
+func (n *TeamsNotifier) Notify(ctx context.Context, event Event) error {
+	var facts []map[string]string
+	for _, fact := range eventFacts(event) {
+		facts = append(facts, map[string]string{"name": fact[0], "value": fact[1]})
+	}
+
+	payload := map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    event.Title,
+		"themeColor": teamsColors[event.Severity],
+		"title":      fmt.Sprintf("[%s] %s", strings.ToUpper(event.Severity), event.Title),
+		"text":       event.Message,
+		"sections":   []map[string]interface{}{{"facts": facts}},
+	}
+	return postJSON(ctx, n.url, payload, nil)
+}
+
+// WebhookNotifier posts the event as JSON to a generic endpoint.
+// When a secret is configured the body is signed with HMAC-SHA256: the receiver computes
+// hex(HMAC(secret, timestamp + "." + body)) and compares it with the X-Signature header.
+type WebhookNotifier struct {
+	name   string
+	url    string
+	secret string
+}
+
+// NewWebhookNotifier creates a generic JSON webhook notifier
+func NewWebhookNotifier(name, url, secret string) (*WebhookNotifier, error) {
+	if url == "" {
+		return nil, fmt.Errorf("channel %s: webhook requires url", name)
+	}
+	return &WebhookNotifier{name: name, url: url, secret: secret}, nil
+}
+
+// Name returns the channel name
+func (n *WebhookNotifier) Name() string { return n.name }
+
+// Notify posts the event as JSON
+func (n *WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %v", err)
+	}
+
+	headers := map[string]string{}
+	if n.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		headers["X-Timestamp"] = timestamp
+		headers["X-Signature"] = "sha256=" + Sign(n.secret, timestamp, body)
+	}
+	return post(ctx, n.url, body, headers)
+}
+
+// Sign computes the HMAC-SHA256 signature of a webhook body
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// postJSON encodes the payload and posts it
+func postJSON(ctx context.Context, url string, payload interface{}, headers map[string]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %v", err)
+	}
+	return post(ctx, url, body, headers)
+}
+
+// post sends a JSON body and checks the response status
+func post(ctx context.Context, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// eventFacts returns the non empty attributes of the event as name/value pairs
+func eventFacts(event Event) [][2]string {
+	var facts [][2]string
+	for _, fact := range [][2]string{
+		{"Control", event.ControlID},
+		{"Check", event.CheckFunction},
+		{"Family", event.Family},
+		{"Account", event.Account},
+		{"Resource", event.Resource},
+		{"Time", event.Time.Format(time.RFC3339)},
+	} {
+		if fact[1] != "" {
+			facts = append(facts, fact)
+		}
+	}
+	return facts
+}
+
+// eventContext formats the attributes of the event on a single line
+func eventContext(event Event) string {
+	var parts []string
+	for _, fact := range eventFacts(event) {
+		parts = append(parts, fact[0]+": "+fact[1])
+	}
+	return strings.Join(parts, " | ")
+}
@@ -0,0 +1,470 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// Types of the IAM principals
+const (
+	EntityUser = "user"
+	EntityRole = "role"
+)
+
+// Entity is an IAM user or role with the names of the policies that apply to it
+type Entity struct {
+	Name     string   `json:"name"`
+	ARN      string   `json:"arn"`
+	Type     string   `json:"type"`
+	Groups   []string `json:"groups,omitempty"`
+	Policies []string `json:"policies"` // identity policies, including the ones of the groups
+	Boundary string   `json:"boundary,omitempty"`
+
+	Created *time.Time `json:"created,omitempty"`
+	Path    string     `json:"path,omitempty"`
+}
+
+// ServiceLinked checks if the principal is a service-linked role, managed by AWS
+func (e *Entity) ServiceLinked() bool {
+	return strings.HasPrefix(e.Path, "/aws-service-role/") || strings.Contains(e.ARN, ":role/aws-service-role/")
+}
+
+// Account is a snapshot of the policies of an AWS account, that can be saved and evaluated offline
+type Account struct {
+	ID       string               `json:"account_id"`
+	Entities []*Entity            `json:"principals"`
+	Policies map[string]*Document `json:"policies"`
+
+	// SCPs are the names of the service control policies per level, from the root to the account
+	SCPs [][]string `json:"scps,omitempty"`
+	// Management is set for the management account of the organization, where SCPs don't apply
+	Management bool `json:"management_account,omitempty"`
+
+	// ResourcePolicies maps a resource ARN to the name of its resource-based policy
+	ResourcePolicies map[string]string `json:"resource_policies,omitempty"`
+}
+
+// NewAccount creates an empty snapshot
+func NewAccount(id string) *Account {
+	return &Account{
+		ID:               id,
+		Policies:         make(map[string]*Document),
+		ResourcePolicies: make(map[string]string),
+	}
+}
+
+// AddPolicy adds a policy document to the snapshot under its name
+func (a *Account) AddPolicy(doc *Document) {
+	a.Policies[doc.Name] = doc
+}
+
+// Entity returns the principal with the given name or ARN
+func (a *Account) Entity(nameOrARN string) *Entity {
+	for _, e := range a.Entities {
+		if e.ARN == nameOrARN || e.Name == nameOrARN {
+			return e
+		}
+	}
+	return nil
+}
+
+// Users returns the IAM users of the snapshot
+func (a *Account) Users() []*Entity {
+	var users []*Entity
+	for _, e := range a.Entities {
+		if e.Type == EntityUser {
+			users = append(users, e)
+		}
+	}
+	return users
+}
+
+// PolicySet builds the policy set of a principal for a request on a resource (empty for any resource)
+func (a *Account) PolicySet(e *Entity, resource string) PolicySet {
+	set := PolicySet{}
+	for _, name := range e.Policies {
+		if doc, ok := a.Policies[name]; ok {
+			set.Identity = append(set.Identity, doc)
+		}
+	}
+	if e.Boundary != "" {
+		set.Boundary = a.Policies[e.Boundary]
+	}
+	// SCPs don't apply to the management account and to the service-linked roles
+	for _, level := range a.SCPs {
+		if a.Management || e.ServiceLinked() {
+			break
+		}
+		var docs []*Document
+		for _, name := range level {
+			if doc, ok := a.Policies[name]; ok {
+				docs = append(docs, doc)
+			}
+		}
+		set.SCPs = append(set.SCPs, docs)
+	}
+	if name, ok := a.ResourcePolicies[resourcePolicyKey(resource)]; ok && resource != "" {
+		set.Resource = a.Policies[name]
+	}
+	return set
+}
+
+// Evaluate answers "can principal do action on resource" with the policies of the snapshot
+func (a *Account) Evaluate(principal, action, resource string, ctx Context) (Result, error) {
+	e := a.Entity(principal)
+	if e == nil {
+		return Result{}, fmt.Errorf("principal %s not found in account %s", principal, a.ID)
+	}
+	req := Request{Principal: e.ARN, Action: action, Resource: resource, Context: ctx}
+	return Evaluate(req, a.PolicySet(e, resource)), nil
+}
+
+// resourcePolicyKey returns the ARN holding the resource policy: S3 objects use the policy of their bucket
+func resourcePolicyKey(resource string) string {
+	if bucket, ok := strings.CutPrefix(resource, "arn:aws:s3:::"); ok {
+		return "arn:aws:s3:::" + strings.SplitN(bucket, "/", 2)[0]
+	}
+	return resource
+}
+
+// Save writes the snapshot as JSON
+func (a *Account) Save(path string) error {
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode account snapshot: %v", err)
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// LoadAccount reads a snapshot saved with Save
+func LoadAccount(path string) (*Account, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account snapshot: %v", err)
+	}
+	account := NewAccount("")
+	if err := json.Unmarshal(data, account); err != nil {
+		return nil, fmt.Errorf("failed to parse account snapshot: %v", err)
+	}
+	// The names are not part of the policy syntax
+	for name, doc := range account.Policies {
+		doc.Name = name
+	}
+	return account, nil
+}
+
+// cacheTTL is how long the account snapshot is reused by the checks of the same evaluation
+const cacheTTL = 10 * time.Minute
+
+var (
+	accountMu     sync.Mutex
+	cachedAccount *Account
+	accountRegion string
+	accountAt     time.Time
+)
+
+// CachedAccount returns the account snapshot, fetching it again when older than cacheTTL
+func CachedAccount(cfg aws.Config) (*Account, error) {
+	accountMu.Lock()
+	defer accountMu.Unlock()
+
+	if cachedAccount != nil && accountRegion == cfg.Region && time.Since(accountAt) < cacheTTL {
+		return cachedAccount, nil
+	}
+
+	account, err := FetchAccount(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cachedAccount, accountRegion, accountAt = account, cfg.Region, time.Now()
+	return account, nil
+}
+
+// FetchAccount reads the IAM users, roles, groups and policies of the account and, when the account
+// can read them, the service control policies of the organization.
+func FetchAccount(cfg aws.Config) (*Account, error) {
+	ctx := context.TODO()
+
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller identity: %v", err)
+	}
+	account := NewAccount(aws.ToString(identity.Account))
+
+	if err := account.fetchIAM(ctx, iam.NewFromConfig(cfg)); err != nil {
+		return nil, err
+	}
+	if err := account.fetchSCPs(ctx, organizations.NewFromConfig(cfg)); err != nil {
+		log.Printf("Service control policies not evaluated: %v\n", err)
+	}
+	return account, nil
+}
+
+// fetchIAM loads the authorization details of the account
+func (a *Account) fetchIAM(ctx context.Context, client *iam.Client) error {
+	var users []iamtypes.UserDetail
+	var roles []iamtypes.RoleDetail
+	groups := make(map[string]iamtypes.GroupDetail)
+
+	paginator := iam.NewGetAccountAuthorizationDetailsPaginator(client, &iam.GetAccountAuthorizationDetailsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get account authorization details: %v", err)
+		}
+		users = append(users, page.UserDetailList...)
+		roles = append(roles, page.RoleDetailList...)
+		for _, group := range page.GroupDetailList {
+			groups[aws.ToString(group.GroupName)] = group
+		}
+		for _, managed := range page.Policies {
+			for _, version := range managed.PolicyVersionList {
+				if !version.IsDefaultVersion {
+					continue
+				}
+				doc, err := ParseNamed(aws.ToString(managed.Arn), aws.ToString(version.Document))
+				if err != nil {
+					log.Printf("Skipping policy: %v\n", err)
+					continue
+				}
+				a.AddPolicy(doc)
+			}
+		}
+	}
+
+	for _, user := range users {
+		name := aws.ToString(user.UserName)
+		e := &Entity{Name: name, ARN: aws.ToString(user.Arn), Type: EntityUser, Groups: user.GroupList,
+			Created: user.CreateDate, Path: aws.ToString(user.Path)}
+		e.Policies = append(e.Policies, a.attached(user.AttachedManagedPolicies)...)
+		e.Policies = append(e.Policies, a.inline("user/"+name, user.UserPolicyList)...)
+		for _, groupName := range user.GroupList {
+			if group, ok := groups[groupName]; ok {
+				e.Policies = append(e.Policies, a.attached(group.AttachedManagedPolicies)...)
+				e.Policies = append(e.Policies, a.inline("group/"+groupName, group.GroupPolicyList)...)
+			}
+		}
+		if user.PermissionsBoundary != nil {
+			e.Boundary = aws.ToString(user.PermissionsBoundary.PermissionsBoundaryArn)
+		}
+		a.Entities = append(a.Entities, e)
+	}
+
+	for _, role := range roles {
+		name := aws.ToString(role.RoleName)
+		e := &Entity{Name: name, ARN: aws.ToString(role.Arn), Type: EntityRole,
+			Created: role.CreateDate, Path: aws.ToString(role.Path)}
+		e.Policies = append(e.Policies, a.attached(role.AttachedManagedPolicies)...)
+		e.Policies = append(e.Policies, a.inline("role/"+name, role.RolePolicyList)...)
+		if role.PermissionsBoundary != nil {
+			e.Boundary = aws.ToString(role.PermissionsBoundary.PermissionsBoundaryArn)
+		}
+		a.Entities = append(a.Entities, e)
+	}
+
+	log.Printf("Loaded %d principal(s) and %d policies\n", len(a.Entities), len(a.Policies))
+	return nil
+}
+
+// attached returns the names of the attached managed policies
+func (a *Account) attached(policies []iamtypes.AttachedPolicy) []string {
+	var names []string
+	for _, p := range policies {
+		names = append(names, aws.ToString(p.PolicyArn))
+	}
+	return names
+}
+
+// inline parses the inline policies of a user, group or role and returns their names
+func (a *Account) inline(owner string, policies []iamtypes.PolicyDetail) []string {
+	var names []string
+	for _, p := range policies {
+		doc, err := ParseNamed(owner+"/"+aws.ToString(p.PolicyName), aws.ToString(p.PolicyDocument))
+		if err != nil {
+			log.Printf("Skipping policy: %v\n", err)
+			continue
+		}
+		a.AddPolicy(doc)
+		names = append(names, doc.Name)
+	}
+	return names
+}
+
+// fetchSCPs loads the service control policies attached to the root, to the OUs and to the account
+func (a *Account) fetchSCPs(ctx context.Context, client *organizations.Client) error {
+	organization, err := client.DescribeOrganization(ctx, &organizations.DescribeOrganizationInput{})
+	if err != nil {
+		return fmt.Errorf("account not in an organization: %v", err)
+	}
+	if organization.Organization != nil && aws.ToString(organization.Organization.MasterAccountId) == a.ID {
+		a.Management = true
+		log.Println("Management account of the organization: service control policies don't apply")
+		return nil
+	}
+
+	// Walk from the account up to the root
+	targets := []string{a.ID}
+	for target := a.ID; ; {
+		parents, err := client.ListParents(ctx, &organizations.ListParentsInput{ChildId: aws.String(target)})
+		if err != nil {
+			return fmt.Errorf("failed to list parents of %s: %v", target, err)
+		}
+		if len(parents.Parents) == 0 {
+			break
+		}
+		parent := parents.Parents[0]
+		target = aws.ToString(parent.Id)
+		targets = append(targets, target)
+		if parent.Type == orgtypes.ParentTypeRoot {
+			break
+		}
+	}
+
+	var levels [][]string
+	for i := len(targets) - 1; i >= 0; i-- {
+		var names []string
+		paginator := organizations.NewListPoliciesForTargetPaginator(client, &organizations.ListPoliciesForTargetInput{
+			TargetId: aws.String(targets[i]),
+			Filter:   orgtypes.PolicyTypeServiceControlPolicy,
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to list service control policies of %s: %v", targets[i], err)
+			}
+			for _, summary := range page.Policies {
+				name := "scp/" + aws.ToString(summary.Name)
+				if _, ok := a.Policies[name]; !ok {
+					described, err := client.DescribePolicy(ctx, &organizations.DescribePolicyInput{PolicyId: summary.Id})
+					if err != nil {
+						return fmt.Errorf("failed to describe service control policy %s: %v", aws.ToString(summary.Name), err)
+					}
+					doc, err := ParseNamed(name, aws.ToString(described.Policy.Content))
+					if err != nil {
+						return err
+					}
+					a.AddPolicy(doc)
+				}
+				names = append(names, name)
+			}
+		}
+		levels = append(levels, names)
+	}
+
+	a.SCPs = levels
+	log.Printf("Loaded service control policies for %d organization level(s)\n", len(levels))
+	return nil
+}
+
+// FetchResourcePolicies loads the resource-based policies of the S3 buckets, KMS keys, Lambda functions
+// and SNS topics. Resources whose policy can't be read are skipped.
+func (a *Account) FetchResourcePolicies(cfg aws.Config) {
+	ctx := context.TODO()
+	a.fetchBucketPolicies(ctx, s3.NewFromConfig(cfg))
+	a.fetchKeyPolicies(ctx, kms.NewFromConfig(cfg))
+	a.fetchFunctionPolicies(ctx, lambda.NewFromConfig(cfg))
+	a.fetchTopicPolicies(ctx, sns.NewFromConfig(cfg))
+	log.Printf("Loaded %d resource-based policies\n", len(a.ResourcePolicies))
+}
+
+// addResourcePolicy parses and adds the policy of a resource
+func (a *Account) addResourcePolicy(resource, document string) {
+	if document == "" {
+		return
+	}
+	doc, err := ParseNamed("resource/"+resource, document)
+	if err != nil {
+		log.Printf("Skipping policy: %v\n", err)
+		return
+	}
+	a.AddPolicy(doc)
+	a.ResourcePolicies[resource] = doc.Name
+}
+
+func (a *Account) fetchBucketPolicies(ctx context.Context, client *s3.Client) {
+	buckets, err := client.ListBuckets(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		log.Printf("Unable to list S3 buckets: %v\n", err)
+		return
+	}
+	for _, bucket := range buckets.Buckets {
+		output, err := client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: bucket.Name})
+		if err != nil {
+			// NoSuchBucketPolicy: the bucket has no policy
+			continue
+		}
+		a.addResourcePolicy("arn:aws:s3:::"+aws.ToString(bucket.Name), aws.ToString(output.Policy))
+	}
+}
+
+func (a *Account) fetchKeyPolicies(ctx context.Context, client *kms.Client) {
+	paginator := kms.NewListKeysPaginator(client, &kms.ListKeysInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			log.Printf("Unable to list KMS keys: %v\n", err)
+			return
+		}
+		for _, key := range page.Keys {
+			output, err := client.GetKeyPolicy(ctx, &kms.GetKeyPolicyInput{KeyId: key.KeyId, PolicyName: aws.String("default")})
+			if err != nil {
+				continue
+			}
+			a.addResourcePolicy(aws.ToString(key.KeyArn), aws.ToString(output.Policy))
+		}
+	}
+}
+
+func (a *Account) fetchFunctionPolicies(ctx context.Context, client *lambda.Client) {
+	paginator := lambda.NewListFunctionsPaginator(client, &lambda.ListFunctionsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			log.Printf("Unable to list Lambda functions: %v\n", err)
+			return
+		}
+		for _, function := range page.Functions {
+			output, err := client.GetPolicy(ctx, &lambda.GetPolicyInput{FunctionName: function.FunctionName})
+			if err != nil {
+				// ResourceNotFoundException: the function has no policy
+				continue
+			}
+			a.addResourcePolicy(aws.ToString(function.FunctionArn), aws.ToString(output.Policy))
+		}
+	}
+}
+
+func (a *Account) fetchTopicPolicies(ctx context.Context, client *sns.Client) {
+	paginator := sns.NewListTopicsPaginator(client, &sns.ListTopicsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			log.Printf("Unable to list SNS topics: %v\n", err)
+			return
+		}
+		for _, topic := range page.Topics {
+			output, err := client.GetTopicAttributes(ctx, &sns.GetTopicAttributesInput{TopicArn: topic.TopicArn})
+			if err != nil {
+				continue
+			}
+			a.addResourcePolicy(aws.ToString(topic.TopicArn), output.Attributes["Policy"])
+		}
+	}
+}
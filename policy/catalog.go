@@ -0,0 +1,113 @@
+package policy
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Access levels of the actions, as in the AWS service authorization reference
+const (
+	AccessLevelList                  = "List"
+	AccessLevelRead                  = "Read"
+	AccessLevelWrite                 = "Write"
+	AccessLevelPermissionsManagement = "Permissions management"
+	AccessLevelTagging               = "Tagging"
+)
+
+// actionsJSON is the offline catalog of the actions: service prefix -> access level -> action names.
+// It covers the services used by the checks, not every AWS service.
+//
+//go:embed actions.json
+var actionsJSON []byte
+
+// Catalog is the offline list of the known IAM actions
+type Catalog struct {
+	actions  []string          // service:Action, sorted
+	levels   map[string]string // lowercase action -> access level
+	services map[string]bool   // service prefixes
+}
+
+var (
+	defaultCatalog     *Catalog
+	defaultCatalogOnce sync.Once
+)
+
+// DefaultCatalog returns the embedded action catalog
+func DefaultCatalog() *Catalog {
+	defaultCatalogOnce.Do(func() {
+		catalog, err := LoadCatalog(actionsJSON)
+		if err != nil {
+			panic(fmt.Sprintf("invalid embedded action catalog: %v", err))
+		}
+		defaultCatalog = catalog
+	})
+	return defaultCatalog
+}
+
+// LoadCatalog loads a catalog in the service -> access level -> actions format
+func LoadCatalog(data []byte) (*Catalog, error) {
+	var services map[string]map[string][]string
+	if err := json.Unmarshal(data, &services); err != nil {
+		return nil, fmt.Errorf("failed to parse action catalog: %v", err)
+	}
+
+	catalog := &Catalog{levels: make(map[string]string), services: make(map[string]bool)}
+	for service, levels := range services {
+		catalog.services[service] = true
+		for level, names := range levels {
+			for _, name := range names {
+				action := service + ":" + name
+				catalog.actions = append(catalog.actions, action)
+				catalog.levels[strings.ToLower(action)] = level
+			}
+		}
+	}
+	sort.Strings(catalog.actions)
+	return catalog, nil
+}
+
+// Actions returns all the actions of the catalog
+func (c *Catalog) Actions() []string {
+	return c.actions
+}
+
+// Expand returns the actions of the catalog matching an action pattern such as "s3:Put*" or "*"
+func (c *Catalog) Expand(pattern string) []string {
+	var actions []string
+	for _, action := range c.actions {
+		if matchAction(pattern, action) {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// AccessLevel returns the access level of an action, empty if the action is not in the catalog
+func (c *Catalog) AccessLevel(action string) string {
+	return c.levels[strings.ToLower(action)]
+}
+
+// HasService checks if the catalog lists the actions of a service
+func (c *Catalog) HasService(service string) bool {
+	return c.services[strings.ToLower(service)]
+}
+
+// Allowed returns the actions of the catalog allowed to the principal on at least one resource
+func (c *Catalog) Allowed(principal string, set PolicySet) []string {
+	var actions []string
+	for _, action := range c.actions {
+		if Evaluate(Request{Principal: principal, Action: action}, set).Allowed() {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// Expand expands an action pattern against the embedded catalog
+func Expand(pattern string) []string {
+	return DefaultCatalog().Expand(pattern)
+}
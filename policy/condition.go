@@ -0,0 +1,259 @@
+package policy
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Context holds the condition keys of a request (aws:SourceIp, aws:MultiFactorAuthPresent, s3:prefix, ...).
+// Keys are case insensitive, values are always lists.
+type Context map[string][]string
+
+// Set sets the values of a condition key
+func (c Context) Set(key string, values ...string) {
+	c[strings.ToLower(key)] = values
+}
+
+// Get returns the values of a condition key
+func (c Context) Get(key string) []string {
+	if c == nil {
+		return nil
+	}
+	return c[strings.ToLower(key)]
+}
+
+// Has checks if the condition key is present in the request
+func (c Context) Has(key string) bool {
+	_, ok := c[strings.ToLower(key)]
+	return ok
+}
+
+// matchConditions checks if all the condition blocks of a statement are satisfied by the request context.
+// Operators not supported are considered not satisfied in an Allow and satisfied in a Deny, so that the
+// evaluation never allows more than AWS does.
+func matchConditions(conditions map[string]map[string]StringList, ctx Context, effect string) bool {
+	for operator, block := range conditions {
+		for key, values := range block {
+			matched, supported := matchCondition(operator, key, values, ctx)
+			if !supported {
+				matched = effect == EffectDeny
+			}
+			if !matched {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchCondition evaluates a single condition operator on a key. It returns false as second value when the
+// operator is not supported.
+func matchCondition(operator, key string, policyValues []string, ctx Context) (bool, bool) {
+	op := operator
+
+	// Set operators for multivalued keys
+	setOperator := ""
+	if prefix, rest, ok := strings.Cut(op, ":"); ok {
+		setOperator, op = strings.ToLower(prefix), rest
+	}
+
+	ifExists := strings.HasSuffix(op, "IfExists")
+	op = strings.TrimSuffix(op, "IfExists")
+
+	requestValues := ctx.Get(key)
+	present := ctx.Has(key)
+
+	if op == "Null" {
+		// Null: true means the key must be absent
+		if len(policyValues) == 0 {
+			return false, true
+		}
+		wantAbsent := strings.EqualFold(policyValues[0], "true")
+		return wantAbsent == !present, true
+	}
+
+	compare, negated, ok := comparator(op)
+	if !ok {
+		return false, false
+	}
+	// The escaped wildcards only matter to the operators with wildcards
+	wildcards := strings.HasSuffix(op, "Like") || strings.HasPrefix(op, "Arn")
+
+	if !present {
+		switch {
+		case ifExists:
+			return true, true
+		case setOperator == "forallvalues":
+			// ForAllValues is true for an empty set of values
+			return true, true
+		case setOperator == "foranyvalue":
+			// ForAnyValue is false for an empty set of values
+			return false, true
+		default:
+			// A negated operator is satisfied by a missing key, as StringNotEquals on aws:PrincipalOrgID
+			return negated, true
+		}
+	}
+
+	match := func(value string) bool {
+		for _, policyValue := range policyValues {
+			resolved := substituteVariables(policyValue, ctx)
+			if !wildcards {
+				resolved = literalValue(resolved)
+			}
+			if compare(resolved, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch setOperator {
+	case "forallvalues":
+		// Every request value must match one of the policy values
+		for _, value := range requestValues {
+			if match(value) == negated {
+				return false, true
+			}
+		}
+		return true, true
+	case "foranyvalue":
+		// At least one request value must match, or not match any policy value with a negated operator
+		for _, value := range requestValues {
+			if match(value) != negated {
+				return true, true
+			}
+		}
+		return false, true
+	default:
+		// Single-valued keys: at least one request value must match
+		for _, value := range requestValues {
+			if match(value) {
+				return !negated, true
+			}
+		}
+		return negated, true
+	}
+}
+
+// comparator returns the comparison function of an operator and whether the operator is negated
+func comparator(op string) (func(policyValue, value string) bool, bool, bool) {
+	switch op {
+	case "StringEquals":
+		return func(p, v string) bool { return p == v }, false, true
+	case "StringNotEquals":
+		return func(p, v string) bool { return p == v }, true, true
+	case "StringEqualsIgnoreCase":
+		return strings.EqualFold, false, true
+	case "StringNotEqualsIgnoreCase":
+		return strings.EqualFold, true, true
+	case "StringLike":
+		return MatchWildcard, false, true
+	case "StringNotLike":
+		return MatchWildcard, true, true
+	case "NumericEquals":
+		return numeric(func(p, v float64) bool { return v == p }), false, true
+	case "NumericNotEquals":
+		return numeric(func(p, v float64) bool { return v == p }), true, true
+	case "NumericLessThan":
+		return numeric(func(p, v float64) bool { return v < p }), false, true
+	case "NumericLessThanEquals":
+		return numeric(func(p, v float64) bool { return v <= p }), false, true
+	case "NumericGreaterThan":
+		return numeric(func(p, v float64) bool { return v > p }), false, true
+	case "NumericGreaterThanEquals":
+		return numeric(func(p, v float64) bool { return v >= p }), false, true
+	case "DateEquals":
+		return date(func(p, v time.Time) bool { return v.Equal(p) }), false, true
+	case "DateNotEquals":
+		return date(func(p, v time.Time) bool { return v.Equal(p) }), true, true
+	case "DateLessThan":
+		return date(func(p, v time.Time) bool { return v.Before(p) }), false, true
+	case "DateLessThanEquals":
+		return date(func(p, v time.Time) bool { return !v.After(p) }), false, true
+	case "DateGreaterThan":
+		return date(func(p, v time.Time) bool { return v.After(p) }), false, true
+	case "DateGreaterThanEquals":
+		return date(func(p, v time.Time) bool { return !v.Before(p) }), false, true
+	case "Bool":
+		return strings.EqualFold, false, true
+	case "BinaryEquals":
+		return func(p, v string) bool { return p == v }, false, true
+	case "IpAddress":
+		return ipInRange, false, true
+	case "NotIpAddress":
+		return ipInRange, true, true
+	case "ArnEquals", "ArnLike":
+		return arnLike, false, true
+	case "ArnNotEquals", "ArnNotLike":
+		return arnLike, true, true
+	}
+	return nil, false, false
+}
+
+// numeric wraps a numeric comparison; values that are not numbers never match
+func numeric(cmp func(policyValue, value float64) bool) func(string, string) bool {
+	return func(p, v string) bool {
+		pv, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return false
+		}
+		rv, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return false
+		}
+		return cmp(pv, rv)
+	}
+}
+
+// date wraps a date comparison; dates can be RFC 3339 or epoch seconds
+func date(cmp func(policyValue, value time.Time) bool) func(string, string) bool {
+	return func(p, v string) bool {
+		pt, ok := parseDate(p)
+		if !ok {
+			return false
+		}
+		rt, ok := parseDate(v)
+		if !ok {
+			return false
+		}
+		return cmp(pt, rt)
+	}
+}
+
+// parseDate parses the date formats accepted by the date condition operators
+func parseDate(s string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05Z", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	if epoch, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(epoch, 0).UTC(), true
+	}
+	return time.Time{}, false
+}
+
+// ipInRange checks if an IP address is in a CIDR block or is the same address
+func ipInRange(cidr, value string) bool {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return false
+	}
+	if !strings.Contains(cidr, "/") {
+		other := net.ParseIP(cidr)
+		return other != nil && other.Equal(ip)
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	return network.Contains(ip)
+}
+
+// arnLike matches an ARN against an ARN pattern segment by segment
+func arnLike(pattern, value string) bool {
+	return matchResource(pattern, value, nil)
+}
@@ -0,0 +1,173 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Effects of a statement
+const (
+	EffectAllow = "Allow"
+	EffectDeny  = "Deny"
+)
+
+// Document is an IAM policy document: identity-based, resource-based, permissions boundary or SCP
+type Document struct {
+	Version   string      `json:"Version,omitempty"`
+	ID        string      `json:"Id,omitempty"`
+	Statement []Statement `json:"Statement"`
+
+	// Name identifies the policy in the evaluation results (policy name or ARN)
+	Name string `json:"-"`
+}
+
+// Statement is a single statement of a policy document
+type Statement struct {
+	Sid          string                           `json:"Sid,omitempty"`
+	Effect       string                           `json:"Effect"`
+	Principal    *Principal                       `json:"Principal,omitempty"`
+	NotPrincipal *Principal                       `json:"NotPrincipal,omitempty"`
+	Action       StringList                       `json:"Action,omitempty"`
+	NotAction    StringList                       `json:"NotAction,omitempty"`
+	Resource     StringList                       `json:"Resource,omitempty"`
+	NotResource  StringList                       `json:"NotResource,omitempty"`
+	Condition    map[string]map[string]StringList `json:"Condition,omitempty"`
+}
+
+// StringList is a JSON value that can be a single string or an array. Booleans and numbers,
+// accepted by the condition values, are converted to strings.
+type StringList []string
+
+// UnmarshalJSON accepts a string, a number, a boolean or an array of them
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	switch v := raw.(type) {
+	case nil:
+		*l = nil
+	case []interface{}:
+		list := make(StringList, 0, len(v))
+		for _, item := range v {
+			list = append(list, scalarString(item))
+		}
+		*l = list
+	default:
+		*l = StringList{scalarString(v)}
+	}
+	return nil
+}
+
+// scalarString converts a JSON scalar to its string form
+func scalarString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case bool:
+		if s {
+			return "true"
+		}
+		return "false"
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	default:
+		return fmt.Sprint(s)
+	}
+}
+
+// Principal is the principal of a resource-based policy: "*" or a map of principal types
+// (AWS, Service, Federated, CanonicalUser) to identifiers.
+type Principal struct {
+	Wildcard bool
+	Values   map[string]StringList
+}
+
+// UnmarshalJSON accepts "*" or an object of principal types
+func (p *Principal) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		if s != "*" {
+			return fmt.Errorf("invalid principal %q", s)
+		}
+		p.Wildcard = true
+		return nil
+	}
+	return json.Unmarshal(data, &p.Values)
+}
+
+// MarshalJSON writes the principal back in the policy syntax
+func (p Principal) MarshalJSON() ([]byte, error) {
+	if p.Wildcard {
+		return json.Marshal("*")
+	}
+	return json.Marshal(p.Values)
+}
+
+// Parse parses a policy document. The documents returned URL encoded by IAM are decoded first.
+func Parse(document string) (*Document, error) {
+	document = strings.TrimSpace(document)
+	if strings.HasPrefix(document, "%7B") || strings.HasPrefix(document, "%7b") {
+		decoded, err := url.QueryUnescape(document)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode policy document: %v", err)
+		}
+		document = decoded
+	}
+
+	// Statement can be a single object instead of an array
+	var raw struct {
+		Version   string          `json:"Version"`
+		ID        string          `json:"Id"`
+		Statement json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal([]byte(document), &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse policy document: %v", err)
+	}
+
+	doc := &Document{Version: raw.Version, ID: raw.ID}
+	statement := strings.TrimSpace(string(raw.Statement))
+	switch {
+	case statement == "" || statement == "null":
+	case strings.HasPrefix(statement, "["):
+		if err := json.Unmarshal(raw.Statement, &doc.Statement); err != nil {
+			return nil, fmt.Errorf("failed to parse policy statements: %v", err)
+		}
+	default:
+		var single Statement
+		if err := json.Unmarshal(raw.Statement, &single); err != nil {
+			return nil, fmt.Errorf("failed to parse policy statement: %v", err)
+		}
+		doc.Statement = []Statement{single}
+	}
+
+	for i, st := range doc.Statement {
+		if st.Effect != EffectAllow && st.Effect != EffectDeny {
+			return nil, fmt.Errorf("statement %d has an invalid effect %q", i, st.Effect)
+		}
+	}
+	return doc, nil
+}
+
+// MustParse parses a policy document and panics on error. Used for the built-in documents.
+func MustParse(document string) *Document {
+	doc, err := Parse(document)
+	if err != nil {
+		panic(err)
+	}
+	return doc
+}
+
+// ParseNamed parses a policy document and sets its name
+func ParseNamed(name, document string) (*Document, error) {
+	doc, err := Parse(document)
+	if err != nil {
+		return nil, fmt.Errorf("policy %s: %v", name, err)
+	}
+	doc.Name = name
+	return doc, nil
+}
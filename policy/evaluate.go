@@ -0,0 +1,310 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Decision is the result of the evaluation of a request
+type Decision string
+
+// Decisions of the policy evaluation logic
+const (
+	Allowed      Decision = "ALLOWED"
+	ExplicitDeny Decision = "EXPLICIT_DENY"
+	ImplicitDeny Decision = "IMPLICIT_DENY"
+)
+
+// Request is the question "can Principal do Action on Resource". An empty Resource asks if the action
+// is allowed on at least one resource: Allow statements match regardless of resource and conditions,
+// Deny statements only when they are unconditional and apply to every resource.
+type Request struct {
+	Principal string // ARN of the IAM user, role or assumed-role session
+	Action    string // service:Action
+	Resource  string // ARN of the resource, empty for any resource
+	Context   Context
+
+	// ResourceAccount is the account owning the resource, when not part of its ARN (S3 buckets)
+	ResourceAccount string
+}
+
+// PolicySet holds the policies that apply to a request
+type PolicySet struct {
+	Identity []*Document   // managed and inline policies of the principal, and of its groups
+	Resource *Document     // resource-based policy of the resource, if any
+	Boundary *Document     // permissions boundary of the principal, if any
+	SCPs     [][]*Document // service control policies, one list per level of the organization (root, OUs, account)
+}
+
+// MatchedStatement is a statement that matched the request
+type MatchedStatement struct {
+	Policy string
+	Sid    string
+	Effect string
+	Kind   string // identity, resource, boundary, scp
+
+	direct bool // resource policy statement naming the principal ARN
+}
+
+// Result is the decision on a request with the statements that determined it
+type Result struct {
+	Decision Decision
+	Reason   string
+	Matched  []MatchedStatement
+}
+
+// Allowed checks if the request is allowed
+func (r Result) Allowed() bool {
+	return r.Decision == Allowed
+}
+
+// Policy kinds used in the matched statements
+const (
+	kindIdentity = "identity"
+	kindResource = "resource"
+	kindBoundary = "boundary"
+	kindSCP      = "scp"
+)
+
+// Evaluate applies the AWS policy evaluation logic to a request:
+// an explicit deny in any policy wins, then every SCP level must allow the action, a resource-based policy
+// naming the principal allows it within the account, the permissions boundary must allow it and finally
+// an identity-based policy must allow it. Cross-account requests need both the identity and the resource policy.
+func Evaluate(req Request, set PolicySet) Result {
+	var result Result
+
+	identity := matchDocuments(set.Identity, req, kindIdentity, &result)
+	var scpLevels [][]MatchedStatement
+	for _, level := range set.SCPs {
+		scpLevels = append(scpLevels, matchDocuments(level, req, kindSCP, &result))
+	}
+	var boundary, resource []MatchedStatement
+	if set.Boundary != nil {
+		boundary = matchDocuments([]*Document{set.Boundary}, req, kindBoundary, &result)
+	}
+	if set.Resource != nil && req.Resource != "" {
+		resource = matchDocuments([]*Document{set.Resource}, req, kindResource, &result)
+	}
+
+	// 1. Explicit deny
+	for _, m := range result.Matched {
+		if m.Effect == EffectDeny {
+			result.Decision = ExplicitDeny
+			result.Reason = fmt.Sprintf("explicitly denied by %s policy %s", m.Kind, describe(m))
+			return result
+		}
+	}
+
+	// 2. Service control policies
+	for i, level := range scpLevels {
+		if !hasAllow(level) {
+			result.Decision = ImplicitDeny
+			result.Reason = fmt.Sprintf("not allowed by the service control policies at level %d", i)
+			return result
+		}
+	}
+
+	crossAccount := isCrossAccount(req)
+
+	// 3. Resource-based policy naming the principal in the same account
+	if !crossAccount {
+		for _, m := range resource {
+			if m.Effect == EffectAllow && m.direct {
+				result.Decision = Allowed
+				result.Reason = fmt.Sprintf("allowed by resource policy %s", describe(m))
+				return result
+			}
+		}
+	}
+
+	// 4. Permissions boundary
+	if set.Boundary != nil && !hasAllow(boundary) {
+		result.Decision = ImplicitDeny
+		result.Reason = fmt.Sprintf("not allowed by the permissions boundary %s", set.Boundary.Name)
+		return result
+	}
+
+	// 5. Identity-based policies
+	if !hasAllow(identity) {
+		result.Decision = ImplicitDeny
+		result.Reason = "no identity-based policy allows the action"
+		return result
+	}
+	if crossAccount && !hasAllow(resource) {
+		result.Decision = ImplicitDeny
+		result.Reason = "cross-account request not allowed by the resource-based policy"
+		return result
+	}
+
+	result.Decision = Allowed
+	for _, m := range identity {
+		if m.Effect == EffectAllow {
+			result.Reason = fmt.Sprintf("allowed by identity policy %s", describe(m))
+			break
+		}
+	}
+	return result
+}
+
+// AllowsAction checks if the document alone allows the action on at least one resource
+func (d *Document) AllowsAction(action string) bool {
+	return Evaluate(Request{Action: action}, PolicySet{Identity: []*Document{d}}).Allowed()
+}
+
+// matchDocuments collects the statements of the documents matching the request
+func matchDocuments(docs []*Document, req Request, kind string, result *Result) []MatchedStatement {
+	var matched []MatchedStatement
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		for _, st := range doc.Statement {
+			ok, direct := st.matches(req, kind)
+			if !ok {
+				continue
+			}
+			m := MatchedStatement{Policy: doc.Name, Sid: st.Sid, Effect: st.Effect, Kind: kind, direct: direct}
+			result.Matched = append(result.Matched, m)
+			matched = append(matched, m)
+		}
+	}
+	return matched
+}
+
+// matches checks if the statement applies to the request. For resource-based policies it also
+// reports if the principal is named directly rather than through its account.
+func (st Statement) matches(req Request, kind string) (bool, bool) {
+	if len(st.Action) > 0 && !matchAnyAction(st.Action, req.Action) {
+		return false, false
+	}
+	if len(st.NotAction) > 0 && matchAnyAction(st.NotAction, req.Action) {
+		return false, false
+	}
+	if len(st.Action) == 0 && len(st.NotAction) == 0 {
+		return false, false
+	}
+
+	anyResource := req.Resource == ""
+	if anyResource {
+		// Only unconditional denies on every resource apply to any resource
+		if st.Effect == EffectDeny && (len(st.Condition) > 0 || len(st.NotResource) > 0 ||
+			(len(st.Resource) > 0 && !containsWildcard(st.Resource))) {
+			return false, false
+		}
+	} else {
+		if len(st.Resource) > 0 && !matchAnyResource(st.Resource, req.Resource, req.Context) {
+			return false, false
+		}
+		if len(st.NotResource) > 0 && matchAnyResource(st.NotResource, req.Resource, req.Context) {
+			return false, false
+		}
+		// SCPs can omit the resource, identity policies can't
+		if len(st.Resource) == 0 && len(st.NotResource) == 0 && kind != kindSCP {
+			return false, false
+		}
+		if !matchConditions(st.Condition, req.Context, st.Effect) {
+			return false, false
+		}
+	}
+
+	if kind != kindResource {
+		return true, false
+	}
+	switch {
+	case st.Principal != nil:
+		return principalMatches(st.Principal, req.Principal)
+	case st.NotPrincipal != nil:
+		matched, _ := principalMatches(st.NotPrincipal, req.Principal)
+		return !matched, false
+	}
+	return false, false
+}
+
+// principalMatches checks if the principal element names the principal ARN, directly or through its account.
+// A wildcard principal grants access to everyone, so it counts as naming the principal directly.
+func principalMatches(p *Principal, arn string) (bool, bool) {
+	if p.Wildcard {
+		return true, true
+	}
+	account := accountOf(arn)
+	roleARN := sessionRole(arn)
+	for principalType, values := range p.Values {
+		if principalType != "AWS" {
+			continue
+		}
+		for _, value := range values {
+			switch value {
+			case "*":
+				return true, true
+			case arn, roleARN:
+				return true, true
+			case account, "arn:aws:iam::" + account + ":root":
+				if account != "" {
+					return true, false
+				}
+			}
+		}
+	}
+	return false, false
+}
+
+// isCrossAccount checks if the principal and the resource belong to different accounts
+func isCrossAccount(req Request) bool {
+	resourceAccount := req.ResourceAccount
+	if resourceAccount == "" {
+		resourceAccount = accountOf(req.Resource)
+	}
+	principalAccount := accountOf(req.Principal)
+	return resourceAccount != "" && principalAccount != "" && resourceAccount != principalAccount
+}
+
+// accountOf returns the account of an ARN
+func accountOf(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 {
+		return ""
+	}
+	return parts[4]
+}
+
+// sessionRole returns the role ARN of an assumed-role session ARN
+func sessionRole(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 || parts[2] != "sts" || !strings.HasPrefix(parts[5], "assumed-role/") {
+		return arn
+	}
+	role := strings.SplitN(strings.TrimPrefix(parts[5], "assumed-role/"), "/", 2)[0]
+	return fmt.Sprintf("%s:%s:iam::%s:role/%s", parts[0], parts[1], parts[4], role)
+}
+
+// hasAllow checks if one of the matched statements is an Allow
+func hasAllow(matched []MatchedStatement) bool {
+	for _, m := range matched {
+		if m.Effect == EffectAllow {
+			return true
+		}
+	}
+	return false
+}
+
+// containsWildcard checks if the resource list contains "*"
+func containsWildcard(resources []string) bool {
+	for _, r := range resources {
+		if r == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// describe formats a matched statement for the reasons
+func describe(m MatchedStatement) string {
+	name := m.Policy
+	if name == "" {
+		name = "(unnamed)"
+	}
+	if m.Sid != "" {
+		return fmt.Sprintf("%s (statement %s)", name, m.Sid)
+	}
+	return name
+}
@@ -0,0 +1,189 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	alice     = "arn:aws:iam::111111111111:user/alice"
+	cuiBucket = "arn:aws:s3:::cui-documents"
+)
+
+func TestParseSingleStatementAndEncoded(t *testing.T) {
+	doc, err := Parse(`%7B%22Version%22%3A%222012-10-17%22%2C%22Statement%22%3A%7B%22Effect%22%3A%22Allow%22%2C%22Action%22%3A%22s3%3AGet%2A%22%2C%22Resource%22%3A%22%2A%22%7D%7D`)
+	assert.NoError(t, err)
+	assert.Len(t, doc.Statement, 1)
+	assert.Equal(t, StringList{"s3:Get*"}, doc.Statement[0].Action)
+
+	_, err = Parse(`{"Statement":[{"Effect":"Maybe","Action":"*","Resource":"*"}]}`)
+	assert.Error(t, err)
+}
+
+func TestEvaluateIdentityAndDeny(t *testing.T) {
+	identity := MustParse(`{"Statement":[
+		{"Effect":"Allow","Action":"s3:*","Resource":"*"},
+		{"Effect":"Deny","Action":"s3:DeleteBucket","Resource":"arn:aws:s3:::cui-*"}
+	]}`)
+	set := PolicySet{Identity: []*Document{identity}}
+
+	assert.True(t, Evaluate(Request{Principal: alice, Action: "S3:GetObject", Resource: cuiBucket + "/a.txt"}, set).Allowed())
+	assert.Equal(t, ExplicitDeny, Evaluate(Request{Principal: alice, Action: "s3:DeleteBucket", Resource: cuiBucket}, set).Decision)
+	assert.Equal(t, ImplicitDeny, Evaluate(Request{Principal: alice, Action: "ec2:RunInstances", Resource: "*"}, set).Decision)
+
+	// The deny is scoped to some buckets: the action is still allowed on other resources
+	assert.True(t, identity.AllowsAction("s3:DeleteBucket"))
+	assert.False(t, identity.AllowsAction("iam:CreateUser"))
+}
+
+func TestEvaluateConditions(t *testing.T) {
+	identity := MustParse(`{"Statement":[{"Effect":"Allow","Action":"iam:*","Resource":"*",
+		"Condition":{"Bool":{"aws:MultiFactorAuthPresent":"true"},"IpAddress":{"aws:SourceIp":"10.0.0.0/8"}}}]}`)
+	set := PolicySet{Identity: []*Document{identity}}
+	req := Request{Principal: alice, Action: "iam:CreateUser", Resource: "arn:aws:iam::111111111111:user/bob", Context: Context{}}
+
+	assert.False(t, Evaluate(req, set).Allowed())
+
+	req.Context.Set("aws:MultiFactorAuthPresent", "true")
+	req.Context.Set("aws:SourceIp", "10.1.2.3")
+	assert.True(t, Evaluate(req, set).Allowed())
+
+	req.Context.Set("aws:SourceIp", "192.168.1.1")
+	assert.False(t, Evaluate(req, set).Allowed())
+}
+
+func TestEvaluateMissingConditionKey(t *testing.T) {
+	// A negated operator on a key missing from the request is satisfied: the guardrail denies
+	set := PolicySet{Identity: []*Document{MustParse(`{"Statement":[
+		{"Effect":"Allow","Action":"s3:*","Resource":"*"},
+		{"Effect":"Deny","Action":"s3:*","Resource":"*","Condition":{"StringNotEquals":{"aws:PrincipalOrgID":"o-123"}}}
+	]}`)}}
+	req := Request{Principal: alice, Action: "s3:GetObject", Resource: cuiBucket + "/a", Context: Context{}}
+	assert.Equal(t, ExplicitDeny, Evaluate(req, set).Decision)
+
+	req.Context.Set("aws:PrincipalOrgID", "o-123")
+	assert.True(t, Evaluate(req, set).Allowed())
+
+	// The positive operators and ForAnyValue are not satisfied by a missing key
+	set = PolicySet{Identity: []*Document{MustParse(`{"Statement":[
+		{"Effect":"Allow","Action":"s3:*","Resource":"*","Condition":{"ForAnyValue:StringLike":{"aws:TagKeys":"cui*"}}}
+	]}`)}}
+	assert.False(t, Evaluate(Request{Principal: alice, Action: "s3:GetObject", Resource: cuiBucket + "/a", Context: Context{}}, set).Allowed())
+}
+
+func TestEvaluateUnknownOperator(t *testing.T) {
+	// An unknown operator never broadens an Allow and never skips a Deny
+	set := PolicySet{Identity: []*Document{MustParse(`{"Statement":[
+		{"Effect":"Allow","Action":"s3:*","Resource":"*"},
+		{"Effect":"Deny","Action":"s3:DeleteObject","Resource":"*","Condition":{"StringMatchesRegex":{"aws:username":"^x"}}},
+		{"Effect":"Allow","Action":"iam:*","Resource":"*","Condition":{"StringMatchesRegex":{"aws:username":"^x"}}}
+	]}`)}}
+	ctx := Context{}
+	ctx.Set("aws:username", "alice")
+	assert.Equal(t, ExplicitDeny, Evaluate(Request{Principal: alice, Action: "s3:DeleteObject", Resource: cuiBucket + "/a", Context: ctx}, set).Decision)
+	assert.True(t, Evaluate(Request{Principal: alice, Action: "s3:GetObject", Resource: cuiBucket + "/a", Context: ctx}, set).Allowed())
+	assert.False(t, Evaluate(Request{Principal: alice, Action: "iam:CreateUser", Resource: "*", Context: ctx}, set).Allowed())
+}
+
+func TestEvaluatePolicyVariables(t *testing.T) {
+	identity := MustParse(`{"Statement":[{"Effect":"Allow","Action":"iam:ChangePassword","Resource":"arn:aws:iam::*:user/${aws:username}"}]}`)
+	set := PolicySet{Identity: []*Document{identity}}
+	ctx := Context{}
+	ctx.Set("aws:username", "alice")
+
+	assert.True(t, Evaluate(Request{Principal: alice, Action: "iam:ChangePassword", Resource: alice, Context: ctx}, set).Allowed())
+	assert.False(t, Evaluate(Request{Principal: alice, Action: "iam:ChangePassword", Resource: "arn:aws:iam::111111111111:user/bob", Context: ctx}, set).Allowed())
+}
+
+func TestEvaluateBoundaryAndSCP(t *testing.T) {
+	admin := MustParse(`{"Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`)
+	boundary := MustParse(`{"Statement":[{"Effect":"Allow","Action":["s3:*","ec2:Describe*"],"Resource":"*"}]}`)
+	scp := MustParse(`{"Statement":[{"Effect":"Allow","NotAction":"cloudtrail:*"}]}`)
+
+	set := PolicySet{Identity: []*Document{admin}, Boundary: boundary}
+	assert.True(t, Evaluate(Request{Principal: alice, Action: "s3:PutObject", Resource: cuiBucket + "/x"}, set).Allowed())
+	assert.Equal(t, ImplicitDeny, Evaluate(Request{Principal: alice, Action: "iam:CreateUser", Resource: "*"}, set).Decision)
+
+	set = PolicySet{Identity: []*Document{admin}, SCPs: [][]*Document{{scp}}}
+	assert.False(t, Evaluate(Request{Principal: alice, Action: "cloudtrail:StopLogging", Resource: "*"}, set).Allowed())
+	assert.True(t, Evaluate(Request{Principal: alice, Action: "iam:CreateUser", Resource: "*"}, set).Allowed())
+}
+
+func TestEvaluateResourcePolicy(t *testing.T) {
+	bucketPolicy := MustParse(`{"Statement":[
+		{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111111111111:user/alice"},"Action":"s3:GetObject","Resource":"arn:aws:s3:::cui-documents/*"},
+		{"Effect":"Allow","Principal":{"AWS":"222222222222"},"Action":"s3:PutObject","Resource":"arn:aws:s3:::cui-documents/*"}
+	]}`)
+
+	// Same account: the resource policy naming the user is enough
+	set := PolicySet{Resource: bucketPolicy}
+	assert.True(t, Evaluate(Request{Principal: alice, Action: "s3:GetObject", Resource: cuiBucket + "/a"}, set).Allowed())
+
+	// Cross account: both the identity and the resource policy must allow
+	bob := "arn:aws:iam::222222222222:user/bob"
+	req := Request{Principal: bob, Action: "s3:PutObject", Resource: cuiBucket + "/a", ResourceAccount: "111111111111"}
+	assert.False(t, Evaluate(req, set).Allowed())
+
+	set.Identity = []*Document{MustParse(`{"Statement":[{"Effect":"Allow","Action":"s3:PutObject","Resource":"*"}]}`)}
+	assert.True(t, Evaluate(req, set).Allowed())
+}
+
+func TestCatalogAndFunctions(t *testing.T) {
+	actions := Expand("kms:*Key")
+	assert.Contains(t, actions, "kms:DisableKey")
+	assert.NotContains(t, actions, "kms:Decrypt")
+	assert.Equal(t, AccessLevelPermissionsManagement, DefaultCatalog().AccessLevel("IAM:AttachUserPolicy"))
+
+	iamFull := MustParse(`{"Statement":[{"Effect":"Allow","Action":["iam:*","organizations:Describe*"],"Resource":"*"}]}`)
+	held := HeldFunctions(alice, PolicySet{Identity: []*Document{iamFull}})
+	assert.Equal(t, []string{"ManageIAM"}, held)
+
+	_, err := HoldsFunction(alice, "ManageEverything", PolicySet{})
+	assert.Error(t, err)
+
+	assert.False(t, Privileged("SSMCoreAccess"))
+	assert.True(t, Privileged("ManageIAM"))
+	assert.NotContains(t, PrivilegedActions(), "ssm:UpdateInstanceInformation")
+}
+
+func TestEvaluateForAnyValueNegated(t *testing.T) {
+	doc := MustParse(`{"Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*",
+		"Condition":{"ForAnyValue:StringNotEquals":{"aws:TagKeys":["team"]}}}]}`)
+	set := PolicySet{Identity: []*Document{doc}}
+
+	ctx := Context{}
+	ctx.Set("aws:TagKeys", "team", "project")
+	assert.True(t, Evaluate(Request{Principal: alice, Action: "s3:GetObject", Resource: "*", Context: ctx}, set).Allowed())
+	ctx.Set("aws:TagKeys", "team")
+	assert.False(t, Evaluate(Request{Principal: alice, Action: "s3:GetObject", Resource: "*", Context: ctx}, set).Allowed())
+}
+
+func TestEvaluateEscapedWildcard(t *testing.T) {
+	doc := MustParse(`{"Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::cui-documents/${*}report"}]}`)
+	set := PolicySet{Identity: []*Document{doc}}
+
+	assert.True(t, Evaluate(Request{Principal: alice, Action: "s3:GetObject", Resource: cuiBucket + "/*report"}, set).Allowed())
+	assert.False(t, Evaluate(Request{Principal: alice, Action: "s3:GetObject", Resource: cuiBucket + "/2024-report"}, set).Allowed())
+}
+
+func TestAccountSCPExemptions(t *testing.T) {
+	account := NewAccount("111111111111")
+	admin := MustParse(`{"Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`)
+	admin.Name = "admin"
+	scp := MustParse(`{"Statement":[{"Effect":"Deny","Action":"cloudtrail:*","Resource":"*"}]}`)
+	scp.Name = "scp/deny-trail"
+	account.AddPolicy(admin)
+	account.AddPolicy(scp)
+	account.SCPs = [][]string{{"scp/deny-trail"}}
+	user := &Entity{Name: "alice", ARN: alice, Type: EntityUser, Policies: []string{"admin"}}
+	linked := &Entity{Name: "AWSServiceRoleForTrail", ARN: "arn:aws:iam::111111111111:role/aws-service-role/trail/AWSServiceRoleForTrail",
+		Path: "/aws-service-role/trail/", Policies: []string{"admin"}}
+
+	req := Request{Principal: alice, Action: "cloudtrail:StopLogging", Resource: "*"}
+	assert.False(t, Evaluate(req, account.PolicySet(user, "")).Allowed())
+	assert.True(t, Evaluate(Request{Principal: linked.ARN, Action: "cloudtrail:StopLogging", Resource: "*"}, account.PolicySet(linked, "")).Allowed())
+
+	account.Management = true
+	assert.True(t, Evaluate(req, account.PolicySet(user, "")).Allowed())
+}
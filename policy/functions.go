@@ -0,0 +1,136 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FunctionAdministrator is the security function that covers all the others
+const FunctionAdministrator = "AdministratorAccess"
+
+// securityFunctions maps the security functions named in the configuration to the actions that
+// together give control over them. A principal holds a function when it is allowed every action.
+var securityFunctions = map[string][]string{
+	FunctionAdministrator: {
+		"iam:CreateUser", "iam:AttachRolePolicy", "iam:PutUserPolicy",
+		"ec2:RunInstances", "ec2:AuthorizeSecurityGroupIngress",
+		"s3:PutBucketPolicy", "kms:PutKeyPolicy",
+		"cloudtrail:StopLogging", "lambda:CreateFunction",
+	},
+	"ManageIAM": {
+		"iam:CreateUser", "iam:CreateRole", "iam:CreateAccessKey",
+		"iam:AttachUserPolicy", "iam:AttachRolePolicy", "iam:PutUserPolicy", "iam:PutRolePolicy",
+	},
+	"ManageEC2": {
+		"ec2:RunInstances", "ec2:TerminateInstances", "ec2:ModifyInstanceAttribute",
+	},
+	"ManageNetwork": {
+		"ec2:AuthorizeSecurityGroupIngress", "ec2:CreateRoute", "ec2:CreateNetworkAclEntry",
+	},
+	"ManageKMS": {
+		"kms:PutKeyPolicy", "kms:DisableKey", "kms:ScheduleKeyDeletion",
+	},
+	"ManageCloudTrail": {
+		"cloudtrail:StopLogging", "cloudtrail:DeleteTrail", "cloudtrail:UpdateTrail",
+	},
+	"ManageS3": {
+		"s3:PutBucketPolicy", "s3:PutBucketPublicAccessBlock", "s3:DeleteBucket",
+	},
+	"SSMCoreAccess": {
+		"ssm:UpdateInstanceInformation", "ssmmessages:CreateControlChannel", "ec2messages:GetMessages",
+	},
+}
+
+// SecurityFunctions returns the names of the known security functions
+func SecurityFunctions() []string {
+	names := make([]string, 0, len(securityFunctions))
+	for name := range securityFunctions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FunctionActions returns the actions of a security function
+func FunctionActions(function string) ([]string, error) {
+	actions, ok := securityFunctions[function]
+	if !ok {
+		return nil, fmt.Errorf("unknown security function %s (known: %v)", function, SecurityFunctions())
+	}
+	return actions, nil
+}
+
+// agentActions are the actions of the SSM agent channel. The agent calls them with the instance
+// credentials, which can't use MFA, so they are not privileged actions.
+var agentActions = map[string]bool{
+	"ssm:UpdateInstanceInformation":    true,
+	"ssmmessages:CreateControlChannel": true,
+	"ec2messages:GetMessages":          true,
+}
+
+// PrivilegedActions returns the actions of all the security functions but the SSM agent channel,
+// sorted and without duplicates
+func PrivilegedActions() []string {
+	seen := map[string]bool{}
+	var actions []string
+	for _, function := range securityFunctions {
+		for _, action := range function {
+			if !seen[action] && !agentActions[action] {
+				seen[action] = true
+				actions = append(actions, action)
+			}
+		}
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+// Privileged checks if a security function grants actions other than the SSM agent channel
+func Privileged(function string) bool {
+	for _, action := range securityFunctions[function] {
+		if !agentActions[action] {
+			return true
+		}
+	}
+	return false
+}
+
+// HoldsFunction checks if the principal is allowed every action of the security function
+func HoldsFunction(principal, function string, set PolicySet) (bool, error) {
+	actions, err := FunctionActions(function)
+	if err != nil {
+		return false, err
+	}
+	for _, action := range actions {
+		if !Evaluate(Request{Principal: principal, Action: action}, set).Allowed() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// HeldFunctions returns the security functions held by the principal
+func HeldFunctions(principal string, set PolicySet) []string {
+	var held []string
+	for _, function := range SecurityFunctions() {
+		if ok, _ := HoldsFunction(principal, function, set); ok {
+			held = append(held, function)
+		}
+	}
+	return held
+}
+
+// Covers checks if the declared security functions include the function, directly or through AdministratorAccess
+func Covers(declared []string, function string) bool {
+	for _, d := range declared {
+		if d == function || d == FunctionAdministrator {
+			return true
+		}
+	}
+	return false
+}
+
+// Functions returns the security functions held by a principal of the snapshot
+func (a *Account) Functions(e *Entity) []string {
+	return HeldFunctions(e.ARN, a.PolicySet(e, ""))
+}
@@ -0,0 +1,156 @@
+package policy
+
+import (
+	"strings"
+)
+
+// Markers of the escaped characters ${*} and ${?}, that match a literal "*" and "?"
+const (
+	literalStar     = '\x01'
+	literalQuestion = '\x02'
+)
+
+// literalValue replaces the markers of the escaped characters with the characters
+func literalValue(s string) string {
+	return strings.NewReplacer(string(literalStar), "*", string(literalQuestion), "?").Replace(s)
+}
+
+// unescape returns the character matched by a pattern byte
+func unescape(c byte) byte {
+	switch c {
+	case literalStar:
+		return '*'
+	case literalQuestion:
+		return '?'
+	}
+	return c
+}
+
+// MatchWildcard matches a value against a pattern where "*" matches any sequence of characters
+// and "?" any single character, as in the Action, Resource and StringLike elements.
+func MatchWildcard(pattern, value string) bool {
+	// Iterative matching with backtracking on the last "*"
+	p, v := 0, 0
+	star, mark := -1, 0
+	for v < len(value) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || unescape(pattern[p]) == value[v]):
+			p++
+			v++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, v
+			p++
+		case star >= 0:
+			p = star + 1
+			mark++
+			v = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchAction matches an action against an action pattern. Actions are case insensitive.
+func matchAction(pattern, action string) bool {
+	return MatchWildcard(strings.ToLower(pattern), strings.ToLower(action))
+}
+
+// matchAnyAction checks if the action matches one of the patterns
+func matchAnyAction(patterns []string, action string) bool {
+	for _, pattern := range patterns {
+		if matchAction(pattern, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchResource matches a resource ARN against a resource pattern, after resolving the policy variables.
+// The ARN service, region and account segments are matched segment by segment, so that "*" in one of them
+// does not span the others.
+func matchResource(pattern, resource string, ctx Context) bool {
+	pattern = substituteVariables(pattern, ctx)
+	if pattern == "*" {
+		return true
+	}
+
+	patternParts := strings.SplitN(pattern, ":", 6)
+	resourceParts := strings.SplitN(resource, ":", 6)
+	if len(patternParts) != 6 || len(resourceParts) != 6 {
+		return MatchWildcard(pattern, resource)
+	}
+	for i := range patternParts {
+		if !MatchWildcard(patternParts[i], resourceParts[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAnyResource checks if the resource matches one of the patterns
+func matchAnyResource(patterns []string, resource string, ctx Context) bool {
+	for _, pattern := range patterns {
+		if matchResource(pattern, resource, ctx) {
+			return true
+		}
+	}
+	return false
+}
+
+// substituteVariables replaces the policy variables (${aws:username}, ${aws:PrincipalTag/team}, ...)
+// with the values of the request context. The special variables ${*}, ${?} and ${$} are the escaped characters:
+// "*" and "?" are written as markers that only match themselves, see literalValue.
+// A variable without value in the context is left unresolved, so that it never matches.
+func substituteVariables(s string, ctx Context) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end += start
+
+		b.WriteString(s[:start])
+		name := s[start+2 : end]
+
+		// ${key, 'default'}
+		defaultValue, hasDefault := "", false
+		if comma := strings.Index(name, ","); comma >= 0 {
+			defaultValue = strings.Trim(strings.TrimSpace(name[comma+1:]), "'")
+			name, hasDefault = strings.TrimSpace(name[:comma]), true
+		}
+
+		switch name {
+		case "*":
+			b.WriteByte(literalStar)
+		case "?":
+			b.WriteByte(literalQuestion)
+		case "$":
+			b.WriteString(name)
+		default:
+			if values := ctx.Get(name); len(values) > 0 {
+				b.WriteString(values[0])
+			} else if hasDefault {
+				b.WriteString(defaultValue)
+			} else {
+				// Unresolved variable: keep a value that no resource can contain
+				b.WriteString("\x00")
+			}
+		}
+		s = s[end+1:]
+	}
+}
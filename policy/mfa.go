@@ -0,0 +1,95 @@
+package policy
+
+import "strings"
+
+// MFA condition keys
+const (
+	KeyMFAPresent = "aws:MultiFactorAuthPresent"
+	KeyMFAAge     = "aws:MultiFactorAuthAge"
+)
+
+// Sessions authenticated without MFA
+const (
+	// SessionAccessKeys are the requests signed with long-term access keys: the MFA keys are absent
+	SessionAccessKeys = "access keys"
+	// SessionConsole are the console and temporary credential sessions without MFA: aws:MultiFactorAuthPresent is false
+	SessionConsole = "console"
+)
+
+// noMFAContexts are the request contexts of the sessions authenticated without MFA
+var noMFAContexts = []struct {
+	session string
+	ctx     Context
+}{
+	{SessionAccessKeys, Context{}},
+	{SessionConsole, Context{strings.ToLower(KeyMFAPresent): {"false"}}},
+}
+
+// SessionsWithoutMFA returns the sessions without MFA (SessionAccessKeys, SessionConsole) in which the action
+// is allowed on at least one resource. Only the MFA condition keys are evaluated: Allow statements are assumed
+// to meet their other conditions, and Deny statements with other conditions or limited to some resources are
+// ignored. The resource-based policy of the set is not considered.
+func SessionsWithoutMFA(principal, action string, set PolicySet) []string {
+	view := PolicySet{Identity: mfaView(set.Identity)}
+	if set.Boundary != nil {
+		view.Boundary = mfaView([]*Document{set.Boundary})[0]
+	}
+	for _, level := range set.SCPs {
+		view.SCPs = append(view.SCPs, mfaView(level))
+	}
+
+	var sessions []string
+	for _, c := range noMFAContexts {
+		req := Request{Principal: principal, Action: action, Resource: "*", Context: c.ctx}
+		if Evaluate(req, view).Allowed() {
+			sessions = append(sessions, c.session)
+		}
+	}
+	return sessions
+}
+
+// mfaView rewrites the documents so that the statements apply to the resource "*" and keep only
+// their MFA conditions
+func mfaView(docs []*Document) []*Document {
+	var view []*Document
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		rewritten := &Document{Version: doc.Version, Name: doc.Name}
+		for _, st := range doc.Statement {
+			conditions, others := mfaConditions(st.Condition)
+			if st.Effect == EffectDeny && (others || len(st.NotResource) > 0 ||
+				(len(st.Resource) > 0 && !containsWildcard(st.Resource))) {
+				continue
+			}
+			st.Resource, st.NotResource = StringList{"*"}, nil
+			st.Condition = conditions
+			rewritten.Statement = append(rewritten.Statement, st)
+		}
+		view = append(view, rewritten)
+	}
+	return view
+}
+
+// mfaConditions returns the condition blocks on the MFA keys, and whether the statement has other conditions
+func mfaConditions(conditions map[string]map[string]StringList) (map[string]map[string]StringList, bool) {
+	var kept map[string]map[string]StringList
+	others := false
+	for operator, block := range conditions {
+		for key, values := range block {
+			if !strings.EqualFold(key, KeyMFAPresent) && !strings.EqualFold(key, KeyMFAAge) {
+				others = true
+				continue
+			}
+			if kept == nil {
+				kept = map[string]map[string]StringList{}
+			}
+			if kept[operator] == nil {
+				kept[operator] = map[string]StringList{}
+			}
+			kept[operator][key] = values
+		}
+	}
+	return kept, others
+}
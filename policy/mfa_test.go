@@ -0,0 +1,30 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionsWithoutMFA(t *testing.T) {
+	// No MFA condition: allowed in every session
+	open := MustParse(`{"Statement":[{"Effect":"Allow","Action":"iam:*","Resource":"arn:aws:iam::111111111111:user/*"}]}`)
+	assert.Equal(t, []string{SessionAccessKeys, SessionConsole}, SessionsWithoutMFA(alice, "iam:CreateUser", PolicySet{Identity: []*Document{open}}))
+
+	// BoolIfExists true is met when the key is absent: access keys bypass the MFA
+	ifExists := MustParse(`{"Statement":[{"Effect":"Allow","Action":"iam:*","Resource":"*",
+		"Condition":{"BoolIfExists":{"aws:MultiFactorAuthPresent":"true"},"IpAddress":{"aws:SourceIp":"10.0.0.0/8"}}}]}`)
+	assert.Equal(t, []string{SessionAccessKeys}, SessionsWithoutMFA(alice, "iam:CreateUser", PolicySet{Identity: []*Document{ifExists}}))
+
+	// The usual deny without MFA closes both sessions, a deny with other conditions does not
+	deny := MustParse(`{"Statement":[{"Effect":"Deny","NotAction":["iam:ChangePassword","sts:GetSessionToken"],"Resource":"*",
+		"Condition":{"BoolIfExists":{"aws:MultiFactorAuthPresent":"false"}}}]}`)
+	assert.Empty(t, SessionsWithoutMFA(alice, "iam:CreateUser", PolicySet{Identity: []*Document{open, deny}}))
+	scoped := MustParse(`{"Statement":[{"Effect":"Deny","Action":"*","Resource":"*",
+		"Condition":{"BoolIfExists":{"aws:MultiFactorAuthPresent":"false"},"StringEquals":{"aws:RequestedRegion":"eu-west-1"}}}]}`)
+	assert.Len(t, SessionsWithoutMFA(alice, "iam:CreateUser", PolicySet{Identity: []*Document{open, scoped}}), 2)
+
+	// Allowed only with a recent MFA
+	age := MustParse(`{"Statement":[{"Effect":"Allow","Action":"iam:*","Resource":"*","Condition":{"NumericLessThan":{"aws:MultiFactorAuthAge":"3600"}}}]}`)
+	assert.Empty(t, SessionsWithoutMFA(alice, "iam:CreateUser", PolicySet{Identity: []*Document{age}}))
+}
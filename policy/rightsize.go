@@ -0,0 +1,232 @@
+package policy
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServiceAccess is the last access of a service by a principal, as reported by the IAM access advisor
+type ServiceAccess struct {
+	Namespace    string
+	LastAccessed *time.Time
+
+	// Actions holds the last access of the actions tracked at action level (lowercase name, nil if never used)
+	Actions map[string]*time.Time
+}
+
+// AccessData is the access advisor report of a principal
+type AccessData struct {
+	Since    time.Time // accesses before this time count as unused
+	Services map[string]*ServiceAccess
+}
+
+// ServiceUsed checks if the service was used after Since
+func (d AccessData) ServiceUsed(namespace string) bool {
+	service, ok := d.Services[strings.ToLower(namespace)]
+	return ok && service.LastAccessed != nil && service.LastAccessed.After(d.Since)
+}
+
+// ActionUsed checks if the action was used after Since. Actions not tracked at action level
+// are used when their service is used.
+func (d AccessData) ActionUsed(action string) bool {
+	namespace, name, ok := strings.Cut(action, ":")
+	if !ok || !d.ServiceUsed(namespace) {
+		return false
+	}
+	service := d.Services[strings.ToLower(namespace)]
+	if last, tracked := service.Actions[strings.ToLower(name)]; tracked {
+		return last != nil && last.After(d.Since)
+	}
+	return true
+}
+
+// ActionLevel checks if the access data tracks some actions of the service
+func (d AccessData) ActionLevel(namespace string) bool {
+	service, ok := d.Services[strings.ToLower(namespace)]
+	return ok && len(service.Actions) > 0
+}
+
+// RightSize rewrites the Allow statements of the documents keeping only the actions used according to the
+// access data. Wildcards are expanded against the catalog only for the services with action-level data;
+// the others keep the pattern when the service was used, since the catalog does not list every action.
+// Deny statements are kept unchanged, resources and conditions are preserved, and the Sids repeated by the
+// merged policies are made unique. It returns the right-sized document, nil if nothing is used, and the
+// allowed actions that were removed.
+func (c *Catalog) RightSize(name string, docs []*Document, usage AccessData) (*Document, []string) {
+	result := &Document{Version: "2012-10-17", Name: name}
+	removed := make(map[string]bool)
+	allows := 0
+
+	for _, doc := range docs {
+		for _, st := range doc.Statement {
+			if st.Effect == EffectDeny {
+				result.Statement = append(result.Statement, st)
+				continue
+			}
+
+			var candidates []string
+			if len(st.NotAction) > 0 {
+				candidates = c.expandNotAction(st.NotAction, usage)
+			}
+			for _, pattern := range st.Action {
+				candidates = append(candidates, c.expandPattern(pattern, usage)...)
+			}
+
+			var kept []string
+			for _, action := range candidates {
+				if usage.ActionUsed(action) {
+					kept = appendAction(kept, action)
+				} else {
+					removed[action] = true
+				}
+			}
+			if len(kept) == 0 {
+				continue
+			}
+			sort.Strings(kept)
+			st.Action, st.NotAction = kept, nil
+			result.Statement = append(result.Statement, st)
+			allows++
+		}
+	}
+
+	uniqueSids(result.Statement)
+
+	// An action kept by another statement is not removed
+	for _, st := range result.Statement {
+		if st.Effect == EffectAllow {
+			for _, action := range st.Action {
+				delete(removed, action)
+			}
+		}
+	}
+	var removedActions []string
+	for action := range removed {
+		removedActions = append(removedActions, action)
+	}
+	sort.Strings(removedActions)
+
+	if allows == 0 {
+		return nil, removedActions
+	}
+	return result, removedActions
+}
+
+// expandPattern expands an action pattern to the actions checked against the access data: the catalog
+// actions and the tracked actions it matches for the services with action-level data, and the pattern
+// itself, narrowed to each service, for the other services
+func (c *Catalog) expandPattern(pattern string, usage AccessData) []string {
+	if !strings.ContainsAny(pattern, "*?") {
+		return []string{pattern}
+	}
+	patternService, patternAction, ok := strings.Cut(pattern, ":")
+	if !ok {
+		patternService, patternAction = pattern, "*"
+	}
+	patternService = strings.ToLower(patternService)
+
+	var actions []string
+	namespaces := map[string]bool{}
+	if !strings.ContainsAny(patternService, "*?") {
+		namespaces[patternService] = true
+	}
+	for _, action := range c.Expand(pattern) {
+		namespace, _, _ := strings.Cut(action, ":")
+		namespaces[strings.ToLower(namespace)] = true
+	}
+	for namespace := range usage.Services {
+		if MatchWildcard(patternService, namespace) {
+			namespaces[namespace] = true
+		}
+	}
+
+	for _, namespace := range sortedKeys(namespaces) {
+		if !usage.ActionLevel(namespace) {
+			actions = append(actions, namespace+":"+patternAction)
+			continue
+		}
+		actions = append(actions, c.Expand(namespace+":"+patternAction)...)
+		for name := range usage.Services[namespace].Actions {
+			if action := namespace + ":" + name; matchAction(pattern, action) {
+				actions = appendAction(actions, action)
+			}
+		}
+	}
+	return actions
+}
+
+// expandNotAction returns the actions allowed by a NotAction statement. The services without action-level
+// data that the NotAction does not mention are kept at service level; the catalog actions are used for the
+// others, since a partial exclusion can't be expressed with an Action list.
+func (c *Catalog) expandNotAction(notAction []string, usage AccessData) []string {
+	mentioned := func(namespace string) bool {
+		for _, pattern := range notAction {
+			service, _, _ := strings.Cut(strings.ToLower(pattern), ":")
+			if MatchWildcard(service, namespace) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var actions []string
+	namespaces := map[string]bool{}
+	for _, action := range c.actions {
+		namespace, _, _ := strings.Cut(action, ":")
+		namespaces[strings.ToLower(namespace)] = true
+	}
+	for namespace := range usage.Services {
+		namespaces[namespace] = true
+	}
+	for _, namespace := range sortedKeys(namespaces) {
+		if !usage.ActionLevel(namespace) && !mentioned(namespace) {
+			actions = append(actions, namespace+":*")
+			continue
+		}
+		for _, action := range c.Expand(namespace + ":*") {
+			if !matchAnyAction(notAction, action) {
+				actions = append(actions, action)
+			}
+		}
+	}
+	return actions
+}
+
+// uniqueSids renames the statements whose Sid is already used, as the VisualEditor0 of the policies created
+// in the console, since IAM rejects a document with repeated Sids
+func uniqueSids(statements []Statement) {
+	used := map[string]bool{}
+	for i := range statements {
+		sid := statements[i].Sid
+		if sid == "" {
+			continue
+		}
+		for n := 2; used[sid]; n++ {
+			sid = statements[i].Sid + strconv.Itoa(n)
+		}
+		used[sid] = true
+		statements[i].Sid = sid
+	}
+}
+
+// sortedKeys returns the keys of a set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// appendAction appends an action if not already present (case insensitive)
+func appendAction(actions []string, action string) []string {
+	for _, a := range actions {
+		if strings.EqualFold(a, action) {
+			return actions
+		}
+	}
+	return append(actions, action)
+}
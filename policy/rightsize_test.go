@@ -0,0 +1,81 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRightSize(t *testing.T) {
+	now := time.Now()
+	old := now.AddDate(0, -6, 0)
+	usage := AccessData{
+		Since: now.AddDate(0, 0, -90),
+		Services: map[string]*ServiceAccess{
+			"s3": {Namespace: "s3", LastAccessed: &now, Actions: map[string]*time.Time{
+				"getobject": &now,
+				"putobject": &old,
+			}},
+			"kms":      {Namespace: "kms", LastAccessed: &old},
+			"dynamodb": {Namespace: "dynamodb", LastAccessed: &now},
+		},
+	}
+
+	docs := []*Document{MustParse(`{"Statement":[
+		{"Sid":"Data","Effect":"Allow","Action":["s3:GetObject","s3:PutObject","kms:Decrypt"],"Resource":"arn:aws:s3:::cui-*"},
+		{"Effect":"Allow","Action":"dynamodb:*","Resource":"*"},
+		{"Effect":"Deny","Action":"s3:DeleteBucket","Resource":"*"}
+	]}`)}
+
+	rightSized, removed := DefaultCatalog().RightSize("alice", docs, usage)
+	assert.Equal(t, []string{"kms:Decrypt", "s3:PutObject"}, removed)
+	if assert.NotNil(t, rightSized) && assert.Len(t, rightSized.Statement, 3) {
+		assert.Equal(t, StringList{"s3:GetObject"}, rightSized.Statement[0].Action)
+		assert.Equal(t, StringList{"arn:aws:s3:::cui-*"}, rightSized.Statement[0].Resource)
+		assert.Equal(t, StringList{"dynamodb:*"}, rightSized.Statement[1].Action)
+		assert.Equal(t, EffectDeny, rightSized.Statement[2].Effect)
+	}
+
+	// Nothing used: no right-sized policy
+	usage.Services = nil
+	rightSized, removed = DefaultCatalog().RightSize("alice", docs, usage)
+	assert.Nil(t, rightSized)
+	assert.Equal(t, []string{"dynamodb:*", "kms:Decrypt", "s3:GetObject", "s3:PutObject"}, removed)
+}
+
+func TestRightSizeWildcards(t *testing.T) {
+	now := time.Now()
+	usage := AccessData{
+		Since: now.AddDate(0, 0, -90),
+		Services: map[string]*ServiceAccess{
+			"s3":  {Namespace: "s3", LastAccessed: &now},
+			"iam": {Namespace: "iam", LastAccessed: &now, Actions: map[string]*time.Time{"createuser": nil, "getuser": &now}},
+		},
+	}
+	docs := []*Document{
+		MustParse(`{"Statement":[{"Sid":"VisualEditor0","Effect":"Allow","Action":["s3:Get*","iam:*User"],"Resource":"*"}]}`),
+		MustParse(`{"Statement":[{"Sid":"VisualEditor0","Effect":"Allow","Action":"s3:*","Resource":"arn:aws:s3:::cui-*"},
+			{"Sid":"VisualEditor0","Effect":"Deny","Action":"s3:DeleteBucket","Resource":"*"}]}`),
+	}
+
+	// Without action-level data the pattern is kept: the catalog does not list every action, such as s3:GetObjectTagging
+	rightSized, removed := DefaultCatalog().RightSize("alice", docs, usage)
+	assert.Contains(t, removed, "iam:CreateUser")
+	if assert.NotNil(t, rightSized) && assert.Len(t, rightSized.Statement, 3) {
+		assert.Contains(t, rightSized.Statement[0].Action, "s3:Get*")
+		assert.Contains(t, rightSized.Statement[0].Action, "iam:GetUser")
+		assert.NotContains(t, rightSized.Statement[0].Action, "iam:CreateUser")
+		assert.Equal(t, StringList{"s3:*"}, rightSized.Statement[1].Action)
+
+		// The merged statements get unique Sids
+		assert.Equal(t, []string{"VisualEditor0", "VisualEditor02", "VisualEditor03"},
+			[]string{rightSized.Statement[0].Sid, rightSized.Statement[1].Sid, rightSized.Statement[2].Sid})
+	}
+
+	// NotAction keeps the used services it does not mention at service level
+	rightSized, _ = DefaultCatalog().RightSize("bob", []*Document{MustParse(`{"Statement":[{"Effect":"Allow","NotAction":"iam:*","Resource":"*"}]}`)}, usage)
+	if assert.NotNil(t, rightSized) {
+		assert.Equal(t, StringList{"s3:*"}, rightSized.Statement[0].Action)
+	}
+}
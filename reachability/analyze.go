@@ -0,0 +1,578 @@
+package reachability
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// Hop is a step of a path: a gateway, a route, a network ACL, a load balancer, security groups or the instance
+type Hop struct {
+	Resource string `json:"resource"`
+	Detail   string `json:"detail"`
+}
+
+// Path is a way to reach ports of an instance from a source
+type Path struct {
+	Source       string `json:"source"` // CIDR of the internet or of a subnet
+	Instance     string `json:"instance"`
+	InstanceName string `json:"instance_name,omitempty"`
+	Protocol     string `json:"protocol"`
+	Ports        Ports  `json:"ports"` // ports of the instance
+
+	// Paths through a load balancer
+	LoadBalancer string `json:"load_balancer,omitempty"`
+	EntryPort    int32  `json:"entry_port,omitempty"`
+
+	Hops []Hop `json:"hops"`
+}
+
+// String formats the path hop by hop
+func (p Path) String() string {
+	target := p.Instance
+	if p.InstanceName != "" {
+		target = fmt.Sprintf("%s (%s)", p.Instance, p.InstanceName)
+	}
+	hops := make([]string, 0, len(p.Hops))
+	for _, hop := range p.Hops {
+		hops = append(hops, fmt.Sprintf("%s [%s]", hop.Resource, hop.Detail))
+	}
+	return fmt.Sprintf("%s -> %s %s %s: %s", p.Source, target, p.Protocol, p.Ports, strings.Join(hops, " -> "))
+}
+
+// analyzedProtocols are the protocols of the paths
+var analyzedProtocols = []string{ProtocolTCP, ProtocolUDP}
+
+// ephemeralPorts are the ports of the return traffic
+var ephemeralPorts = Ports{{ephemeralFrom, ephemeralTo}}
+
+// FromInternet returns the paths from the internet to the instances, directly through their public IP
+// and through the internet-facing load balancers
+func (n *Network) FromInternet() []Path {
+	var paths []Path
+	for _, instance := range n.Instances {
+		paths = append(paths, n.directPaths(instance)...)
+	}
+	for _, lb := range n.LoadBalancers {
+		if lb.InternetFacing {
+			paths = append(paths, n.loadBalancerPaths(lb)...)
+		}
+	}
+	sortPaths(paths)
+	return paths
+}
+
+// directPaths returns the paths from the internet to the public IPv4 and the IPv6 addresses of an instance
+func (n *Network) directPaths(instance *Instance) []Path {
+	var paths []Path
+	if instance.PublicIP != "" {
+		paths = append(paths, n.publicPaths(instance, false, "public IP of "+instance.ID, instance.PublicIP)...)
+	}
+	if len(instance.IPv6) > 0 {
+		paths = append(paths, n.publicPaths(instance, true, "IPv6 addresses of "+instance.ID, instance.IPv6...)...)
+	}
+	return paths
+}
+
+// publicPaths returns the paths from the internet to the addresses of an instance through the internet
+// route of their address family
+func (n *Network) publicPaths(instance *Instance, ipv6 bool, detail string, addresses ...string) []Path {
+	rt := n.routeTable(instance.Subnet)
+	route, ok := internetRoute(rt, ipv6)
+	if !ok {
+		return nil
+	}
+	source, _ := parsePrefix(route.Destination)
+
+	var paths []Path
+	for _, protocol := range analyzedProtocols {
+		ports, sgHop := n.sgAllows(instance.SecurityGroups, protocol, source, nil, AllPorts)
+		if ports.Empty() {
+			continue
+		}
+		ports, aclHop, ok := n.aclInbound(instance.Subnet, protocol, source, ports)
+		if !ok {
+			continue
+		}
+		paths = append(paths, Path{
+			Source:       route.Destination,
+			Instance:     instance.ID,
+			InstanceName: instance.Name,
+			Protocol:     protocol,
+			Ports:        ports,
+			Hops: []Hop{
+				{route.Target, fmt.Sprintf("route %s in %s", route.Destination, rt.ID)},
+				{strings.Join(addresses, ", "), detail},
+				aclHop,
+				sgHop,
+				{instance.ID, "instance in " + instance.Subnet},
+			},
+		})
+	}
+	return paths
+}
+
+// loadBalancerPaths returns the paths from the internet through the listeners of a load balancer to its targets
+func (n *Network) loadBalancerPaths(lb *LoadBalancer) []Path {
+	var paths []Path
+	for _, listener := range lb.Listeners {
+		source, entry, ok := n.loadBalancerEntry(lb, listener)
+		if !ok {
+			continue
+		}
+		for _, target := range listener.Targets {
+			instance := n.Instance(target.Instance)
+			if instance == nil {
+				continue
+			}
+			backend, ok := n.loadBalancerBackend(lb, listener.Protocol, source, instance, target.Port)
+			if !ok {
+				continue
+			}
+			paths = append(paths, Path{
+				Source:       source.String(),
+				Instance:     instance.ID,
+				InstanceName: instance.Name,
+				Protocol:     listener.Protocol,
+				Ports:        NewPorts(PortRange{target.Port, target.Port}),
+				LoadBalancer: lb.Name,
+				EntryPort:    listener.Port,
+				Hops:         append(append(append([]Hop{}, entry...), backend...), Hop{instance.ID, "instance in " + instance.Subnet}),
+			})
+		}
+	}
+	return paths
+}
+
+// loadBalancerEntry checks if the listener is reachable from the internet through one of the public subnets of the load balancer
+func (n *Network) loadBalancerEntry(lb *LoadBalancer, listener Listener) (netip.Prefix, []Hop, bool) {
+	port := NewPorts(PortRange{listener.Port, listener.Port})
+	families := []bool{false}
+	if lb.DualStack {
+		families = append(families, true)
+	}
+	for _, subnet := range lb.Subnets {
+		rt := n.routeTable(subnet)
+		for _, ipv6 := range families {
+			route, ok := internetRoute(rt, ipv6)
+			if !ok {
+				continue
+			}
+			source, _ := parsePrefix(route.Destination)
+
+			hops := []Hop{{route.Target, fmt.Sprintf("route %s in %s", route.Destination, rt.ID)}}
+			if len(lb.SecurityGroups) > 0 {
+				allowed, sgHop := n.sgAllows(lb.SecurityGroups, listener.Protocol, source, nil, port)
+				if allowed.Empty() {
+					continue
+				}
+				hops = append(hops, sgHop)
+			}
+			if _, aclHop, ok := n.aclInbound(subnet, listener.Protocol, source, port); ok {
+				hops = append(hops, aclHop)
+			} else {
+				continue
+			}
+			hops = append(hops, Hop{lb.Name, fmt.Sprintf("%s load balancer listener %s %d in %s", lb.Type, listener.Protocol, listener.Port, subnet)})
+			return source, hops, true
+		}
+	}
+	return netip.Prefix{}, nil, false
+}
+
+// loadBalancerBackend checks if a load balancer node reaches the target port. Network load balancers without
+// security groups preserve the client IP, so the target must allow the source of the traffic.
+func (n *Network) loadBalancerBackend(lb *LoadBalancer, protocol string, source netip.Prefix, instance *Instance, port int32) ([]Hop, bool) {
+	ports := NewPorts(PortRange{port, port})
+	preserved := lb.Type == "network" && len(lb.SecurityGroups) == 0
+	peerGroups := toSet(lb.SecurityGroups)
+
+	for _, subnet := range lb.Subnets {
+		peer := source
+		if !preserved {
+			s, ok := n.Subnets[subnet]
+			if !ok {
+				continue
+			}
+			if peer, ok = parsePrefix(s.CIDR); !ok {
+				continue
+			}
+		}
+
+		var hops []Hop
+		if subnet != instance.Subnet {
+			_, hop, ok := n.subnetToSubnet(subnet, instance, protocol, peer, ports)
+			if !ok {
+				continue
+			}
+			hops = append(hops, hop...)
+		}
+		allowed, sgHop := n.sgAllows(instance.SecurityGroups, protocol, peer, peerGroups, ports)
+		if allowed.Empty() {
+			continue
+		}
+		return append(hops, sgHop), true
+	}
+	return nil, false
+}
+
+// FromSubnet returns the paths from the hosts of a subnet to the instances
+func (n *Network) FromSubnet(subnetID string, instances []*Instance) []Path {
+	subnet, ok := n.Subnets[subnetID]
+	if !ok {
+		return nil
+	}
+	source, ok := parsePrefix(subnet.CIDR)
+	if !ok {
+		return nil
+	}
+	peerGroups := n.groupsInSubnet(subnetID)
+
+	var paths []Path
+	for _, instance := range instances {
+		for _, protocol := range analyzedProtocols {
+			ports, sgHop := n.sgAllows(instance.SecurityGroups, protocol, source, peerGroups, AllPorts)
+			if ports.Empty() {
+				continue
+			}
+			hops := []Hop{{subnetID, fmt.Sprintf("hosts of %s", subnet.CIDR)}}
+			if instance.Subnet != subnetID {
+				allowed, network, ok := n.subnetToSubnet(subnetID, instance, protocol, source, ports)
+				if !ok {
+					continue
+				}
+				ports = allowed
+				hops = append(hops, network...)
+			}
+			paths = append(paths, Path{
+				Source:       fmt.Sprintf("%s (%s)", subnetID, subnet.CIDR),
+				Instance:     instance.ID,
+				InstanceName: instance.Name,
+				Protocol:     protocol,
+				Ports:        ports,
+				Hops:         append(hops, sgHop, Hop{instance.ID, "instance in " + instance.Subnet}),
+			})
+		}
+	}
+	sortPaths(paths)
+	return paths
+}
+
+// subnetToSubnet checks the routes and the network ACLs between a subnet and an instance of another subnet,
+// and returns the ports that get through. The traffic comes from peer, the CIDR of the subnet or the source
+// preserved by a load balancer.
+func (n *Network) subnetToSubnet(subnet string, instance *Instance, protocol string, peer netip.Prefix, ports Ports) (Ports, []Hop, bool) {
+	target, ok := parsePrefix(instance.PrivateIP + "/32")
+	if !ok {
+		return nil, nil, false
+	}
+
+	// Source subnet: outbound ACL and route to the instance
+	acl := n.acl(subnet)
+	allowed, outRules := acl.allows(true, protocol, target, ports)
+	returned, inRules := acl.allows(false, protocol, target, ephemeralPorts)
+	if allowed.Empty() || returned.Empty() {
+		return nil, nil, false
+	}
+	rt := n.routeTable(subnet)
+	forward, ok := privateRoute(rt, target)
+	if !ok {
+		return nil, nil, false
+	}
+	hops := []Hop{
+		aclHop(acl, "outbound", outRules, inRules),
+		{forward.Target, fmt.Sprintf("route %s in %s", forward.Destination, rt.ID)},
+	}
+
+	// Target subnet: route back to the peer and inbound ACL
+	if _, ok := privateRoute(n.routeTable(instance.Subnet), peer); !ok {
+		return nil, nil, false
+	}
+	allowed, hop, ok := n.aclInbound(instance.Subnet, protocol, peer, allowed)
+	if !ok {
+		return nil, nil, false
+	}
+	return allowed, append(hops, hop), true
+}
+
+// aclInbound checks the inbound rules of the network ACL of a subnet for the ports, and the outbound
+// rules for the return traffic on the ephemeral ports
+func (n *Network) aclInbound(subnet, protocol string, peer netip.Prefix, ports Ports) (Ports, Hop, bool) {
+	acl := n.acl(subnet)
+	allowed, inRules := acl.allows(false, protocol, peer, ports)
+	returned, outRules := acl.allows(true, protocol, peer, ephemeralPorts)
+	if allowed.Empty() || returned.Empty() {
+		return nil, Hop{}, false
+	}
+	return allowed, aclHop(acl, "inbound", inRules, outRules), true
+}
+
+// aclHop describes the rules of a network ACL that let the traffic and its return through
+func aclHop(acl *NetworkACL, direction string, rules, returnRules []int32) Hop {
+	if acl == nil {
+		return Hop{"network ACL", "no network ACL associated"}
+	}
+	return Hop{acl.ID, fmt.Sprintf("%s rules %s, return traffic rules %s", direction, joinRules(rules), joinRules(returnRules))}
+}
+
+// routeTable returns the route table of a subnet: the associated one or the main table of the VPC
+func (n *Network) routeTable(subnet string) *RouteTable {
+	for _, rt := range n.RouteTables {
+		for _, s := range rt.Subnets {
+			if s == subnet {
+				return rt
+			}
+		}
+	}
+	if s, ok := n.Subnets[subnet]; ok {
+		for _, rt := range n.RouteTables {
+			if rt.Main && rt.VPC == s.VPC {
+				return rt
+			}
+		}
+	}
+	return nil
+}
+
+// acl returns the network ACL of a subnet
+func (n *Network) acl(subnet string) *NetworkACL {
+	for _, acl := range n.ACLs {
+		for _, s := range acl.Subnets {
+			if s == subnet {
+				return acl
+			}
+		}
+	}
+	return nil
+}
+
+// groupsInSubnet returns the security groups of the instances and load balancers of a subnet
+func (n *Network) groupsInSubnet(subnet string) map[string]bool {
+	groups := map[string]bool{}
+	for _, instance := range n.Instances {
+		if instance.Subnet == subnet {
+			for _, group := range instance.SecurityGroups {
+				groups[group] = true
+			}
+		}
+	}
+	for _, lb := range n.LoadBalancers {
+		for _, s := range lb.Subnets {
+			if s == subnet {
+				for _, group := range lb.SecurityGroups {
+					groups[group] = true
+				}
+			}
+		}
+	}
+	return groups
+}
+
+// internetRoute returns the IPv4 or IPv6 route to an internet gateway with the widest destination
+func internetRoute(rt *RouteTable, ipv6 bool) (Route, bool) {
+	var best Route
+	bestBits := -1
+	if rt == nil {
+		return best, false
+	}
+	for _, route := range rt.Routes {
+		prefix, ok := parsePrefix(route.Destination)
+		if !ok || prefix.Addr().Is6() != ipv6 || route.Blackhole || !strings.HasPrefix(route.Target, "igw-") {
+			continue
+		}
+		if bestBits < 0 || prefix.Bits() < bestBits {
+			best, bestBits = route, prefix.Bits()
+		}
+	}
+	return best, bestBits >= 0
+}
+
+// privateRoute returns the most specific route to a private destination. The traffic stays in the
+// VPC or goes through a peering connection, a transit gateway or a network appliance.
+func privateRoute(rt *RouteTable, destination netip.Prefix) (Route, bool) {
+	if rt == nil {
+		return Route{}, false
+	}
+	var best Route
+	bestBits := -1
+	for _, route := range rt.Routes {
+		prefix, ok := parsePrefix(route.Destination)
+		if !ok || !containsPrefix(prefix, destination) || prefix.Bits() <= bestBits {
+			continue
+		}
+		best, bestBits = route, prefix.Bits()
+	}
+	if bestBits < 0 || best.Blackhole {
+		return Route{}, false
+	}
+	for _, prefix := range []string{"local", "pcx-", "tgw-", "eni-", "i-"} {
+		if strings.HasPrefix(best.Target, prefix) {
+			return best, true
+		}
+	}
+	return Route{}, false
+}
+
+// allows evaluates the rules of the network ACL in order for the traffic from (inbound) or to (outbound) the peer.
+// A rule covering the whole peer decides for its ports. A rule covering part of the peer allows its ports for
+// that part and leaves the decision open for the rest. It returns the allowed ports and the allowing rules.
+// Without a network ACL everything is allowed.
+func (acl *NetworkACL) allows(egress bool, protocol string, peer netip.Prefix, ports Ports) (Ports, []int32) {
+	if acl == nil {
+		return ports, nil
+	}
+	entries := make([]ACLEntry, 0, len(acl.Entries))
+	for _, entry := range acl.Entries {
+		if entry.Egress == egress {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].RuleNumber < entries[j].RuleNumber })
+
+	undecided := ports
+	var allowed Ports
+	var rules []int32
+	for _, entry := range entries {
+		if undecided.Empty() {
+			break
+		}
+		if entry.Protocol != ProtocolAll && entry.Protocol != protocol {
+			continue
+		}
+		cidr, ok := parsePrefix(entry.CIDR)
+		if !ok || !overlaps(cidr, peer) {
+			continue
+		}
+		matched := undecided.Intersect(NewPorts(entry.Ports))
+		if matched.Empty() {
+			continue
+		}
+		if entry.Allow {
+			allowed = allowed.Union(matched)
+			rules = append(rules, entry.RuleNumber)
+		}
+		if containsPrefix(cidr, peer) {
+			undecided = undecided.Subtract(matched)
+		}
+	}
+	return allowed, rules
+}
+
+// sgAllows returns the ports of the security groups allowed from the peer CIDR or from one of the peer
+// security groups, with a hop describing the matching rules
+func (n *Network) sgAllows(groups []string, protocol string, peer netip.Prefix, peerGroups map[string]bool, ports Ports) (Ports, Hop) {
+	var allowed Ports
+	var matched []string
+	for _, id := range groups {
+		sg, ok := n.SecurityGroups[id]
+		if !ok {
+			continue
+		}
+		for _, rule := range sg.Ingress {
+			if rule.Protocol != ProtocolAll && rule.Protocol != protocol {
+				continue
+			}
+			rulePorts := ports.Intersect(NewPorts(rule.Ports))
+			if rulePorts.Empty() {
+				continue
+			}
+			from := ""
+			for _, c := range rule.CIDRs {
+				if cidr, ok := parsePrefix(c); ok && overlaps(cidr, peer) {
+					from = c
+					break
+				}
+			}
+			for _, group := range rule.Groups {
+				if from == "" && peerGroups[group] {
+					from = group
+				}
+			}
+			if from == "" {
+				continue
+			}
+			allowed = allowed.Union(rulePorts)
+			matched = append(matched, fmt.Sprintf("%s %s %s from %s", sg.ID, protocol, rulePorts, from))
+		}
+	}
+	return allowed, Hop{strings.Join(groups, ", "), strings.Join(matched, "; ")}
+}
+
+// parsePrefix parses an IPv4 or IPv6 CIDR. An IPv4-mapped IPv6 address is not a valid rule.
+func parsePrefix(cidr string) (netip.Prefix, bool) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil || prefix.Addr().Is4In6() {
+		return netip.Prefix{}, false
+	}
+	return prefix.Masked(), true
+}
+
+// privateRanges are the address ranges that are not reachable from the internet
+var privateRanges = []netip.Prefix{
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("::1/128"),
+}
+
+// isPrivate checks if every address of the prefix is private
+func isPrivate(prefix netip.Prefix) bool {
+	for _, r := range privateRanges {
+		if containsPrefix(r, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlaps checks if a rule CIDR matches part of the peer. For an internet peer the rule must
+// cover public addresses: a rule for 10.0.0.0/8 doesn't open anything to the internet. Prefixes of
+// different address families never overlap.
+func overlaps(cidr, peer netip.Prefix) bool {
+	if !cidr.Overlaps(peer) {
+		return false
+	}
+	return isPrivate(peer) || !isPrivate(cidr)
+}
+
+// containsPrefix checks if outer contains every address of inner
+func containsPrefix(outer, inner netip.Prefix) bool {
+	return outer.Bits() <= inner.Bits() && outer.Contains(inner.Addr())
+}
+
+// joinRules formats the rule numbers of a network ACL
+func joinRules(rules []int32) string {
+	parts := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		parts = append(parts, fmt.Sprint(rule))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sortPaths orders the paths by instance, load balancer and protocol
+func sortPaths(paths []Path) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		if paths[i].Instance != paths[j].Instance {
+			return paths[i].Instance < paths[j].Instance
+		}
+		if paths[i].LoadBalancer != paths[j].LoadBalancer {
+			return paths[i].LoadBalancer < paths[j].LoadBalancer
+		}
+		return paths[i].Protocol < paths[j].Protocol
+	})
+}
+
+// toSet converts a list to a set
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
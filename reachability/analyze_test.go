@@ -0,0 +1,163 @@
+package reachability
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testNetwork is a VPC with a public subnet (web server and load balancer), a private subnet (application
+// server behind the load balancer) and a subnet of other hosts (jump host)
+func testNetwork() *Network {
+	n := NewNetwork("us-east-1")
+	for _, s := range []*Subnet{
+		{ID: "subnet-public", VPC: "vpc-1", CIDR: "10.0.1.0/24"},
+		{ID: "subnet-private", VPC: "vpc-1", CIDR: "10.0.2.0/24"},
+		{ID: "subnet-other", VPC: "vpc-1", CIDR: "10.0.3.0/24"},
+	} {
+		n.Subnets[s.ID] = s
+	}
+	n.RouteTables = []*RouteTable{
+		{ID: "rtb-public", VPC: "vpc-1", Subnets: []string{"subnet-public"}, Routes: []Route{
+			{Destination: "10.0.0.0/16", Target: "local"},
+			{Destination: "0.0.0.0/0", Target: "igw-1"},
+		}},
+		{ID: "rtb-main", VPC: "vpc-1", Main: true, Routes: []Route{
+			{Destination: "10.0.0.0/16", Target: "local"},
+			{Destination: "0.0.0.0/0", Target: "nat-1"},
+		}},
+	}
+	allowAll := []ACLEntry{
+		{RuleNumber: 100, Protocol: ProtocolAll, Ports: PortRange{0, 65535}, CIDR: "0.0.0.0/0", Allow: true},
+		{RuleNumber: 100, Egress: true, Protocol: ProtocolAll, Ports: PortRange{0, 65535}, CIDR: "0.0.0.0/0", Allow: true},
+		{RuleNumber: 32767, Protocol: ProtocolAll, Ports: PortRange{0, 65535}, CIDR: "0.0.0.0/0"},
+		{RuleNumber: 32767, Egress: true, Protocol: ProtocolAll, Ports: PortRange{0, 65535}, CIDR: "0.0.0.0/0"},
+	}
+	n.ACLs = []*NetworkACL{
+		{ID: "acl-default", VPC: "vpc-1", Subnets: []string{"subnet-public", "subnet-other"}, Entries: allowAll},
+		{ID: "acl-private", VPC: "vpc-1", Subnets: []string{"subnet-private"}, Entries: append([]ACLEntry{
+			{RuleNumber: 90, Protocol: ProtocolTCP, Ports: PortRange{22, 22}, CIDR: "10.0.3.0/24"},
+		}, allowAll...)},
+	}
+	for _, sg := range []*SecurityGroup{
+		{ID: "sg-web", VPC: "vpc-1", Ingress: []SGRule{
+			{Protocol: ProtocolTCP, Ports: PortRange{443, 443}, CIDRs: []string{"0.0.0.0/0"}},
+			{Protocol: ProtocolTCP, Ports: PortRange{22, 22}, CIDRs: []string{"10.0.0.0/8"}},
+		}},
+		{ID: "sg-alb", VPC: "vpc-1", Ingress: []SGRule{
+			{Protocol: ProtocolTCP, Ports: PortRange{443, 443}, CIDRs: []string{"0.0.0.0/0"}},
+		}},
+		{ID: "sg-app", VPC: "vpc-1", Ingress: []SGRule{
+			{Protocol: ProtocolTCP, Ports: PortRange{8080, 8080}, Groups: []string{"sg-alb"}},
+			{Protocol: ProtocolTCP, Ports: PortRange{22, 22}, CIDRs: []string{"10.0.0.0/16"}},
+			{Protocol: ProtocolTCP, Ports: PortRange{5432, 5432}, Groups: []string{"sg-jump"}},
+		}},
+		{ID: "sg-jump", VPC: "vpc-1"},
+	} {
+		n.SecurityGroups[sg.ID] = sg
+	}
+	n.Instances = []*Instance{
+		{ID: "i-web", Name: "web", VPC: "vpc-1", Subnet: "subnet-public", PrivateIP: "10.0.1.10", PublicIP: "54.0.0.10", SecurityGroups: []string{"sg-web"}},
+		{ID: "i-app", Name: "app", VPC: "vpc-1", Subnet: "subnet-private", PrivateIP: "10.0.2.20", SecurityGroups: []string{"sg-app"}},
+		{ID: "i-jump", Name: "jump", VPC: "vpc-1", Subnet: "subnet-other", PrivateIP: "10.0.3.30", SecurityGroups: []string{"sg-jump"}},
+	}
+	n.LoadBalancers = []*LoadBalancer{{
+		Name: "alb", Type: "application", InternetFacing: true, VPC: "vpc-1",
+		Subnets: []string{"subnet-public"}, SecurityGroups: []string{"sg-alb"},
+		Listeners: []Listener{{Protocol: ProtocolTCP, Port: 443, Targets: []Target{{Instance: "i-app", Port: 8080}}}},
+	}}
+	return n
+}
+
+func TestFromInternet(t *testing.T) {
+	paths := testNetwork().FromInternet()
+	if !assert.Len(t, paths, 2) {
+		return
+	}
+
+	// The load balancer reaches the application port, the SSH rule for 10.0.0.0/8 is not internet exposure
+	app, web := paths[0], paths[1]
+	assert.Equal(t, "i-app", app.Instance)
+	assert.Equal(t, "alb", app.LoadBalancer)
+	assert.Equal(t, int32(443), app.EntryPort)
+	assert.Equal(t, "8080", app.Ports.String())
+	assert.Equal(t, "igw-1", app.Hops[0].Resource)
+
+	assert.Equal(t, "i-web", web.Instance)
+	assert.Equal(t, "0.0.0.0/0", web.Source)
+	assert.Equal(t, "443", web.Ports.String())
+	assert.Equal(t, []string{"igw-1", "54.0.0.10", "acl-default", "sg-web", "i-web"}, resources(web))
+}
+
+func TestFromInternetIPv6(t *testing.T) {
+	n := testNetwork()
+	n.RouteTables[0].Routes = append(n.RouteTables[0].Routes, Route{Destination: "::/0", Target: "igw-1"})
+	n.ACLs[0].Entries = append(n.ACLs[0].Entries,
+		ACLEntry{RuleNumber: 101, Protocol: ProtocolAll, Ports: PortRange{0, 65535}, CIDR: "::/0", Allow: true},
+		ACLEntry{RuleNumber: 101, Egress: true, Protocol: ProtocolAll, Ports: PortRange{0, 65535}, CIDR: "::/0", Allow: true},
+	)
+	n.Instances[0].IPv6 = []string{"2600:1f18::10"}
+	n.SecurityGroups["sg-web"].Ingress = append(n.SecurityGroups["sg-web"].Ingress,
+		SGRule{Protocol: ProtocolTCP, Ports: PortRange{22, 22}, CIDRs: []string{"::/0"}},
+		SGRule{Protocol: ProtocolTCP, Ports: PortRange{3389, 3389}, CIDRs: []string{"fd00::/8"}},
+	)
+
+	// SSH is open to ::/0 but only over IPv6, the rule for the unique local range is not internet exposure
+	var web []Path
+	for _, p := range n.FromInternet() {
+		if p.Instance == "i-web" {
+			web = append(web, p)
+		}
+	}
+	if !assert.Len(t, web, 2) {
+		return
+	}
+	sources := map[string]string{}
+	for _, p := range web {
+		sources[p.Source] = p.Ports.String()
+	}
+	assert.Equal(t, map[string]string{"0.0.0.0/0": "443", "::/0": "22"}, sources)
+
+	// Without an IPv6 internet route the IPv6 address is not reachable
+	n.RouteTables[0].Routes = n.RouteTables[0].Routes[:2]
+	for _, p := range n.FromInternet() {
+		assert.NotEqual(t, "::/0", p.Source)
+	}
+}
+
+func TestFromSubnet(t *testing.T) {
+	n := testNetwork()
+	paths := n.FromSubnet("subnet-other", []*Instance{n.Instance("i-app"), n.Instance("i-web")})
+	if !assert.Len(t, paths, 2) {
+		return
+	}
+
+	// SSH to the application server is allowed by its security group but denied by the network ACL
+	assert.Equal(t, "i-app", paths[0].Instance)
+	assert.Equal(t, "5432", paths[0].Ports.String())
+	assert.Equal(t, []string{"subnet-other", "acl-default", "local", "acl-private", "sg-app", "i-app"}, resources(paths[0]))
+
+	assert.Equal(t, "i-web", paths[1].Instance)
+	assert.Equal(t, "22, 443", paths[1].Ports.String())
+
+	// A blackhole route cuts the path
+	n.RouteTables[1].Routes = append(n.RouteTables[1].Routes, Route{Destination: "10.0.2.0/24", Target: "eni-1", Blackhole: true})
+	paths = n.FromSubnet("subnet-other", []*Instance{n.Instance("i-app")})
+	assert.Empty(t, paths)
+}
+
+func TestPorts(t *testing.T) {
+	ports := NewPorts(PortRange{80, 90}, PortRange{85, 100}, PortRange{22, 22})
+	assert.Equal(t, "22, 80-100", ports.String())
+	assert.Equal(t, "22, 80-84, 96-100", ports.Subtract(NewPorts(PortRange{85, 95})).String())
+	assert.Equal(t, "85-90", ports.Intersect(NewPorts(PortRange{85, 90})).String())
+	assert.True(t, AllPorts.Contains(65535))
+}
+
+func resources(p Path) []string {
+	var list []string
+	for _, hop := range p.Hops {
+		list = append(list, hop.Resource)
+	}
+	return list
+}
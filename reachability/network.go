@@ -0,0 +1,526 @@
+// Package reachability computes which instance ports are reachable from the internet or from other
+// subnets, combining route tables, internet and NAT gateways, network ACLs, security groups, public IPs
+// and load balancers, and describes each path hop by hop.
+package reachability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancing"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbv2types "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+)
+
+// Protocols analyzed. Rules for all protocols ("-1") apply to both.
+const (
+	ProtocolTCP = "tcp"
+	ProtocolUDP = "udp"
+	ProtocolAll = "-1"
+)
+
+// Route is a route of a route table
+type Route struct {
+	Destination string `json:"destination"` // IPv4 or IPv6 CIDR
+	Target      string `json:"target"`      // local, igw-, nat-, pcx-, tgw-, vgw-, eni-, ...
+	Blackhole   bool   `json:"blackhole,omitempty"`
+}
+
+// RouteTable is a route table with its subnet associations
+type RouteTable struct {
+	ID      string   `json:"id"`
+	VPC     string   `json:"vpc"`
+	Main    bool     `json:"main,omitempty"`
+	Subnets []string `json:"subnets,omitempty"`
+	Routes  []Route  `json:"routes"`
+}
+
+// ACLEntry is a rule of a network ACL
+type ACLEntry struct {
+	RuleNumber int32     `json:"rule_number"`
+	Egress     bool      `json:"egress,omitempty"`
+	Protocol   string    `json:"protocol"` // tcp, udp, -1 or the protocol number
+	Ports      PortRange `json:"ports"`
+	CIDR       string    `json:"cidr"` // IPv4 or IPv6
+	Allow      bool      `json:"allow"`
+}
+
+// NetworkACL is a network ACL with its subnet associations
+type NetworkACL struct {
+	ID      string     `json:"id"`
+	VPC     string     `json:"vpc"`
+	Subnets []string   `json:"subnets,omitempty"`
+	Entries []ACLEntry `json:"entries"`
+}
+
+// SGRule is an inbound rule of a security group
+type SGRule struct {
+	Protocol string    `json:"protocol"` // tcp, udp, -1 or the protocol number
+	Ports    PortRange `json:"ports"`
+	CIDRs    []string  `json:"cidrs,omitempty"`
+	Groups   []string  `json:"groups,omitempty"`
+}
+
+// SecurityGroup is a security group with its inbound rules
+type SecurityGroup struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	VPC     string   `json:"vpc"`
+	Ingress []SGRule `json:"ingress"`
+}
+
+// Subnet is a subnet with its IPv4 CIDR
+type Subnet struct {
+	ID   string `json:"id"`
+	VPC  string `json:"vpc"`
+	CIDR string `json:"cidr"`
+	Name string `json:"name,omitempty"`
+}
+
+// Instance is a running EC2 instance
+type Instance struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name,omitempty"`
+	VPC            string   `json:"vpc"`
+	Subnet         string   `json:"subnet"`
+	PrivateIP      string   `json:"private_ip"`
+	PublicIP       string   `json:"public_ip,omitempty"`
+	IPv6           []string `json:"ipv6,omitempty"` // IPv6 addresses are public, reachable through an IPv6 internet route
+	SecurityGroups []string `json:"security_groups"`
+}
+
+// Target is an instance port behind a listener
+type Target struct {
+	Instance string `json:"instance"`
+	Port     int32  `json:"port"`
+}
+
+// Listener is a port of a load balancer with the targets of its default action
+type Listener struct {
+	Protocol string   `json:"protocol"` // tcp or udp
+	Port     int32    `json:"port"`
+	Targets  []Target `json:"targets"`
+}
+
+// LoadBalancer is an application, network or classic load balancer
+type LoadBalancer struct {
+	Name           string     `json:"name"`
+	Type           string     `json:"type"` // application, network, gateway, classic
+	InternetFacing bool       `json:"internet_facing"`
+	DualStack      bool       `json:"dual_stack,omitempty"` // reachable over IPv6
+	VPC            string     `json:"vpc"`
+	Subnets        []string   `json:"subnets"`
+	SecurityGroups []string   `json:"security_groups,omitempty"`
+	Listeners      []Listener `json:"listeners"`
+}
+
+// Network is a snapshot of the network configuration of a region
+type Network struct {
+	Region         string                    `json:"region"`
+	Subnets        map[string]*Subnet        `json:"subnets"`
+	RouteTables    []*RouteTable             `json:"route_tables"`
+	ACLs           []*NetworkACL             `json:"network_acls"`
+	SecurityGroups map[string]*SecurityGroup `json:"security_groups"`
+	Instances      []*Instance               `json:"instances"`
+	LoadBalancers  []*LoadBalancer           `json:"load_balancers"`
+}
+
+// NewNetwork creates an empty snapshot
+func NewNetwork(region string) *Network {
+	return &Network{
+		Region:         region,
+		Subnets:        make(map[string]*Subnet),
+		SecurityGroups: make(map[string]*SecurityGroup),
+	}
+}
+
+// Instance returns an instance by ID
+func (n *Network) Instance(id string) *Instance {
+	for _, instance := range n.Instances {
+		if instance.ID == id {
+			return instance
+		}
+	}
+	return nil
+}
+
+// instanceByIP returns the instance with the private IP, for the targets registered by IP
+func (n *Network) instanceByIP(ip string) *Instance {
+	for _, instance := range n.Instances {
+		if instance.PrivateIP == ip {
+			return instance
+		}
+	}
+	return nil
+}
+
+// Fetch describes the network of the region of cfg.
+// Errors are collected and the partial snapshot is returned, as for the asset discovery.
+func Fetch(cfg aws.Config) (*Network, error) {
+	ctx := context.TODO()
+	n := NewNetwork(cfg.Region)
+	client := ec2.NewFromConfig(cfg)
+
+	var errs []error
+	for _, step := range []struct {
+		name string
+		fn   func(ctx context.Context, client *ec2.Client) error
+	}{
+		{"subnets", n.fetchSubnets},
+		{"route tables", n.fetchRouteTables},
+		{"network ACLs", n.fetchACLs},
+		{"security groups", n.fetchSecurityGroups},
+		{"instances", n.fetchInstances},
+	} {
+		if err := step.fn(ctx, client); err != nil {
+			log.Printf("Reachability: %s failed: %v\n", step.name, err)
+			errs = append(errs, fmt.Errorf("%s: %v", step.name, err))
+		}
+	}
+	if err := n.fetchLoadBalancers(ctx, cfg); err != nil {
+		log.Printf("Reachability: load balancers failed: %v\n", err)
+		errs = append(errs, fmt.Errorf("load balancers: %v", err))
+	}
+
+	log.Printf("Network of %s: %d subnet(s), %d instance(s), %d load balancer(s)\n", n.Region, len(n.Subnets), len(n.Instances), len(n.LoadBalancers))
+	return n, errors.Join(errs...)
+}
+
+func (n *Network) fetchSubnets(ctx context.Context, client *ec2.Client) error {
+	paginator := ec2.NewDescribeSubnetsPaginator(client, &ec2.DescribeSubnetsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range page.Subnets {
+			id := aws.ToString(s.SubnetId)
+			n.Subnets[id] = &Subnet{ID: id, VPC: aws.ToString(s.VpcId), CIDR: aws.ToString(s.CidrBlock), Name: tagName(s.Tags)}
+		}
+	}
+	return nil
+}
+
+func (n *Network) fetchRouteTables(ctx context.Context, client *ec2.Client) error {
+	paginator := ec2.NewDescribeRouteTablesPaginator(client, &ec2.DescribeRouteTablesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, rt := range page.RouteTables {
+			table := &RouteTable{ID: aws.ToString(rt.RouteTableId), VPC: aws.ToString(rt.VpcId)}
+			for _, assoc := range rt.Associations {
+				if aws.ToBool(assoc.Main) {
+					table.Main = true
+				}
+				if assoc.SubnetId != nil {
+					table.Subnets = append(table.Subnets, aws.ToString(assoc.SubnetId))
+				}
+			}
+			for _, r := range rt.Routes {
+				// Prefix list destinations are not analyzed
+				destination := aws.ToString(r.DestinationCidrBlock)
+				if destination == "" {
+					destination = aws.ToString(r.DestinationIpv6CidrBlock)
+				}
+				if destination == "" {
+					continue
+				}
+				table.Routes = append(table.Routes, Route{
+					Destination: destination,
+					Target:      routeTarget(r),
+					Blackhole:   r.State == ec2types.RouteStateBlackhole,
+				})
+			}
+			n.RouteTables = append(n.RouteTables, table)
+		}
+	}
+	return nil
+}
+
+// routeTarget returns the target of a route
+func routeTarget(r ec2types.Route) string {
+	for _, target := range []*string{r.GatewayId, r.NatGatewayId, r.TransitGatewayId, r.VpcPeeringConnectionId,
+		r.NetworkInterfaceId, r.InstanceId, r.LocalGatewayId, r.CarrierGatewayId, r.EgressOnlyInternetGatewayId} {
+		if target != nil {
+			return aws.ToString(target)
+		}
+	}
+	return "unknown"
+}
+
+func (n *Network) fetchACLs(ctx context.Context, client *ec2.Client) error {
+	paginator := ec2.NewDescribeNetworkAclsPaginator(client, &ec2.DescribeNetworkAclsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, a := range page.NetworkAcls {
+			acl := &NetworkACL{ID: aws.ToString(a.NetworkAclId), VPC: aws.ToString(a.VpcId)}
+			for _, assoc := range a.Associations {
+				acl.Subnets = append(acl.Subnets, aws.ToString(assoc.SubnetId))
+			}
+			for _, e := range a.Entries {
+				cidr := aws.ToString(e.CidrBlock)
+				if cidr == "" {
+					cidr = aws.ToString(e.Ipv6CidrBlock)
+				}
+				entry := ACLEntry{
+					RuleNumber: aws.ToInt32(e.RuleNumber),
+					Egress:     aws.ToBool(e.Egress),
+					Protocol:   normalizeProtocol(aws.ToString(e.Protocol)),
+					Ports:      PortRange{minPort, maxPort},
+					CIDR:       cidr,
+					Allow:      e.RuleAction == ec2types.RuleActionAllow,
+				}
+				if e.PortRange != nil {
+					entry.Ports = PortRange{aws.ToInt32(e.PortRange.From), aws.ToInt32(e.PortRange.To)}
+				}
+				acl.Entries = append(acl.Entries, entry)
+			}
+			n.ACLs = append(n.ACLs, acl)
+		}
+	}
+	return nil
+}
+
+func (n *Network) fetchSecurityGroups(ctx context.Context, client *ec2.Client) error {
+	paginator := ec2.NewDescribeSecurityGroupsPaginator(client, &ec2.DescribeSecurityGroupsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, g := range page.SecurityGroups {
+			sg := &SecurityGroup{ID: aws.ToString(g.GroupId), Name: aws.ToString(g.GroupName), VPC: aws.ToString(g.VpcId)}
+			for _, p := range g.IpPermissions {
+				rule := SGRule{Protocol: normalizeProtocol(aws.ToString(p.IpProtocol)), Ports: PortRange{minPort, maxPort}}
+				if rule.Protocol != ProtocolAll && p.FromPort != nil {
+					rule.Ports = PortRange{aws.ToInt32(p.FromPort), aws.ToInt32(p.ToPort)}
+				}
+				for _, r := range p.IpRanges {
+					rule.CIDRs = append(rule.CIDRs, aws.ToString(r.CidrIp))
+				}
+				for _, r := range p.Ipv6Ranges {
+					rule.CIDRs = append(rule.CIDRs, aws.ToString(r.CidrIpv6))
+				}
+				for _, pair := range p.UserIdGroupPairs {
+					rule.Groups = append(rule.Groups, aws.ToString(pair.GroupId))
+				}
+				sg.Ingress = append(sg.Ingress, rule)
+			}
+			n.SecurityGroups[sg.ID] = sg
+		}
+	}
+	return nil
+}
+
+func (n *Network) fetchInstances(ctx context.Context, client *ec2.Client) error {
+	paginator := ec2.NewDescribeInstancesPaginator(client, &ec2.DescribeInstancesInput{
+		Filters: []ec2types.Filter{{Name: aws.String("instance-state-name"), Values: []string{"running"}}},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, reservation := range page.Reservations {
+			for _, i := range reservation.Instances {
+				instance := &Instance{
+					ID:        aws.ToString(i.InstanceId),
+					Name:      tagName(i.Tags),
+					VPC:       aws.ToString(i.VpcId),
+					Subnet:    aws.ToString(i.SubnetId),
+					PrivateIP: aws.ToString(i.PrivateIpAddress),
+					PublicIP:  aws.ToString(i.PublicIpAddress),
+				}
+				for _, sg := range i.SecurityGroups {
+					instance.SecurityGroups = append(instance.SecurityGroups, aws.ToString(sg.GroupId))
+				}
+				for _, eni := range i.NetworkInterfaces {
+					for _, address := range eni.Ipv6Addresses {
+						instance.IPv6 = append(instance.IPv6, aws.ToString(address.Ipv6Address))
+					}
+				}
+				n.Instances = append(n.Instances, instance)
+			}
+		}
+	}
+	return nil
+}
+
+// fetchLoadBalancers describes the load balancers with the targets of the default action of their listeners.
+// Listener rules other than the default action are not analyzed.
+func (n *Network) fetchLoadBalancers(ctx context.Context, cfg aws.Config) error {
+	client := elasticloadbalancingv2.NewFromConfig(cfg)
+	var errs []error
+
+	paginator := elasticloadbalancingv2.NewDescribeLoadBalancersPaginator(client, &elasticloadbalancingv2.DescribeLoadBalancersInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+		for _, l := range page.LoadBalancers {
+			lb := &LoadBalancer{
+				Name:           aws.ToString(l.LoadBalancerName),
+				Type:           string(l.Type),
+				InternetFacing: l.Scheme == elbv2types.LoadBalancerSchemeEnumInternetFacing,
+				DualStack:      l.IpAddressType == elbv2types.IpAddressTypeDualstack || l.IpAddressType == elbv2types.IpAddressTypeDualstackWithoutPublicIpv4,
+				VPC:            aws.ToString(l.VpcId),
+				SecurityGroups: l.SecurityGroups,
+			}
+			for _, az := range l.AvailabilityZones {
+				lb.Subnets = append(lb.Subnets, aws.ToString(az.SubnetId))
+			}
+			if err := n.fetchListeners(ctx, client, l.LoadBalancerArn, lb); err != nil {
+				errs = append(errs, fmt.Errorf("load balancer %s: %v", lb.Name, err))
+			}
+			n.LoadBalancers = append(n.LoadBalancers, lb)
+		}
+	}
+
+	classic := elasticloadbalancing.NewFromConfig(cfg)
+	classicPaginator := elasticloadbalancing.NewDescribeLoadBalancersPaginator(classic, &elasticloadbalancing.DescribeLoadBalancersInput{})
+	for classicPaginator.HasMorePages() {
+		page, err := classicPaginator.NextPage(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+		for _, l := range page.LoadBalancerDescriptions {
+			lb := &LoadBalancer{
+				Name:           aws.ToString(l.LoadBalancerName),
+				Type:           "classic",
+				InternetFacing: aws.ToString(l.Scheme) == "internet-facing",
+				VPC:            aws.ToString(l.VPCId),
+				Subnets:        l.Subnets,
+				SecurityGroups: l.SecurityGroups,
+			}
+			for _, description := range l.ListenerDescriptions {
+				if description.Listener == nil {
+					continue
+				}
+				listener := Listener{Protocol: ProtocolTCP, Port: description.Listener.LoadBalancerPort}
+				for _, instance := range l.Instances {
+					listener.Targets = append(listener.Targets, Target{Instance: aws.ToString(instance.InstanceId), Port: aws.ToInt32(description.Listener.InstancePort)})
+				}
+				lb.Listeners = append(lb.Listeners, listener)
+			}
+			n.LoadBalancers = append(n.LoadBalancers, lb)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// fetchListeners adds the listeners of an application or network load balancer with their targets
+func (n *Network) fetchListeners(ctx context.Context, client *elasticloadbalancingv2.Client, arn *string, lb *LoadBalancer) error {
+	paginator := elasticloadbalancingv2.NewDescribeListenersPaginator(client, &elasticloadbalancingv2.DescribeListenersInput{LoadBalancerArn: arn})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, l := range page.Listeners {
+			listener := Listener{Protocol: ProtocolTCP, Port: aws.ToInt32(l.Port)}
+			if l.Protocol == elbv2types.ProtocolEnumUdp {
+				listener.Protocol = ProtocolUDP
+			}
+			for _, group := range forwardedTargetGroups(l.DefaultActions) {
+				health, err := client.DescribeTargetHealth(ctx, &elasticloadbalancingv2.DescribeTargetHealthInput{TargetGroupArn: aws.String(group)})
+				if err != nil {
+					return fmt.Errorf("target group %s: %v", group, err)
+				}
+				for _, description := range health.TargetHealthDescriptions {
+					if description.Target == nil {
+						continue
+					}
+					id := aws.ToString(description.Target.Id)
+					if instance := n.instanceByIP(id); instance != nil {
+						id = instance.ID
+					}
+					listener.Targets = append(listener.Targets, Target{Instance: id, Port: aws.ToInt32(description.Target.Port)})
+				}
+			}
+			lb.Listeners = append(lb.Listeners, listener)
+		}
+	}
+	return nil
+}
+
+// forwardedTargetGroups returns the target groups of the forward actions
+func forwardedTargetGroups(actions []elbv2types.Action) []string {
+	var groups []string
+	for _, action := range actions {
+		if action.Type != elbv2types.ActionTypeEnumForward {
+			continue
+		}
+		if action.ForwardConfig != nil {
+			for _, group := range action.ForwardConfig.TargetGroups {
+				groups = append(groups, aws.ToString(group.TargetGroupArn))
+			}
+		} else if action.TargetGroupArn != nil {
+			groups = append(groups, aws.ToString(action.TargetGroupArn))
+		}
+	}
+	return groups
+}
+
+// normalizeProtocol converts the protocol numbers of TCP and UDP to their names
+func normalizeProtocol(protocol string) string {
+	switch strings.ToLower(protocol) {
+	case "6", ProtocolTCP:
+		return ProtocolTCP
+	case "17", ProtocolUDP:
+		return ProtocolUDP
+	case "-1", "all":
+		return ProtocolAll
+	}
+	return protocol
+}
+
+// tagName returns the Name tag
+func tagName(tags []ec2types.Tag) string {
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == "Name" {
+			return aws.ToString(tag.Value)
+		}
+	}
+	return ""
+}
+
+// cacheTTL is how long the network snapshot is reused by the checks of the same evaluation
+const cacheTTL = 10 * time.Minute
+
+var (
+	networkMu     sync.Mutex
+	cachedNetwork *Network
+	networkAt     time.Time
+)
+
+// Cached returns the network of the region of cfg, describing it again when older than cacheTTL.
+// A partial snapshot is returned with its error and not cached, so that the next call describes it again.
+func Cached(cfg aws.Config) (*Network, error) {
+	networkMu.Lock()
+	defer networkMu.Unlock()
+
+	if cachedNetwork != nil && cachedNetwork.Region == cfg.Region && time.Since(networkAt) < cacheTTL {
+		return cachedNetwork, nil
+	}
+	n, err := Fetch(cfg)
+	if err == nil {
+		cachedNetwork, networkAt = n, time.Now()
+	}
+	return n, err
+}
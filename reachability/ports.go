@@ -0,0 +1,123 @@
+package reachability
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Port limits
+const (
+	minPort = 0
+	maxPort = 65535
+	// Ephemeral ports used by the return traffic
+	ephemeralFrom = 1024
+	ephemeralTo   = 65535
+)
+
+// PortRange is an inclusive range of ports
+type PortRange struct {
+	From int32 `json:"from"`
+	To   int32 `json:"to"`
+}
+
+// Ports is a set of ports as sorted, non-overlapping ranges
+type Ports []PortRange
+
+// AllPorts is the set of every port
+var AllPorts = Ports{{minPort, maxPort}}
+
+// NewPorts creates a set from ranges in any order
+func NewPorts(ranges ...PortRange) Ports {
+	var valid Ports
+	for _, r := range ranges {
+		if r.From <= r.To {
+			valid = append(valid, r)
+		}
+	}
+	sort.Slice(valid, func(i, j int) bool { return valid[i].From < valid[j].From })
+
+	var merged Ports
+	for _, r := range valid {
+		if n := len(merged); n > 0 && r.From <= merged[n-1].To+1 {
+			if r.To > merged[n-1].To {
+				merged[n-1].To = r.To
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// Empty checks if the set has no port
+func (p Ports) Empty() bool {
+	return len(p) == 0
+}
+
+// Contains checks if the port is in the set
+func (p Ports) Contains(port int32) bool {
+	for _, r := range p {
+		if port >= r.From && port <= r.To {
+			return true
+		}
+	}
+	return false
+}
+
+// Union returns the ports in p or in other
+func (p Ports) Union(other Ports) Ports {
+	return NewPorts(append(append(Ports{}, p...), other...)...)
+}
+
+// Intersect returns the ports in both p and other
+func (p Ports) Intersect(other Ports) Ports {
+	var ranges Ports
+	for _, a := range p {
+		for _, b := range other {
+			from, to := max(a.From, b.From), min(a.To, b.To)
+			if from <= to {
+				ranges = append(ranges, PortRange{from, to})
+			}
+		}
+	}
+	return NewPorts(ranges...)
+}
+
+// Subtract returns the ports in p and not in other
+func (p Ports) Subtract(other Ports) Ports {
+	remaining := append(Ports{}, p...)
+	for _, b := range other {
+		var next Ports
+		for _, a := range remaining {
+			if b.To < a.From || b.From > a.To {
+				next = append(next, a)
+				continue
+			}
+			if a.From < b.From {
+				next = append(next, PortRange{a.From, b.From - 1})
+			}
+			if a.To > b.To {
+				next = append(next, PortRange{b.To + 1, a.To})
+			}
+		}
+		remaining = next
+	}
+	return NewPorts(remaining...)
+}
+
+// String formats the set as "22, 80, 8000-8080"
+func (p Ports) String() string {
+	if len(p) == 1 && p[0].From == minPort && p[0].To == maxPort {
+		return "all"
+	}
+	parts := make([]string, 0, len(p))
+	for _, r := range p {
+		if r.From == r.To {
+			parts = append(parts, fmt.Sprint(r.From))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", r.From, r.To))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
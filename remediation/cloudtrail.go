@@ -0,0 +1,83 @@
+package remediation
+
+import (
+	"cloud_compliance_checker/models"
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+)
+
+const cloudTrailTF = `resource "aws_cloudtrail" "{{ tfName .Name }}" {
+  name                          = "{{ .Name }}"
+  s3_bucket_name                = "{{ .Bucket }}"
+{{- if .KmsKeyID }}
+  kms_key_id                    = "{{ .KmsKeyID }}"
+{{- end }}
+  is_multi_region_trail         = true
+  include_global_service_events = true
+  enable_log_file_validation    = true
+  enable_logging                = true
+}
+`
+
+const cloudTrailCFN = `{{ cfnName .Name }}:
+  Type: AWS::CloudTrail::Trail
+  Properties:
+    TrailName: {{ .Name }}
+    S3BucketName: {{ .Bucket }}
+{{- if .KmsKeyID }}
+    KMSKeyId: {{ .KmsKeyID }}
+{{- end }}
+    IsLogging: true
+    IsMultiRegionTrail: true
+    IncludeGlobalServiceEvents: true
+    EnableLogFileValidation: true
+`
+
+type trailData struct {
+	Name     string
+	Bucket   string
+	KmsKeyID string
+}
+
+// cloudTrailRemediations emits a multi-region trail definition for every trail that only covers its home
+// region, or a new trail when the account has none.
+func cloudTrailRemediations(cfg aws.Config) ([]models.Remediation, error) {
+	svc := cloudtrail.NewFromConfig(cfg)
+
+	result, err := svc.DescribeTrails(context.TODO(), &cloudtrail.DescribeTrailsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe trails: %v", err)
+	}
+
+	if len(result.TrailList) == 0 {
+		log.Println("No CloudTrail trail found, generating a new multi-region trail")
+		r, err := snippet("cloudtrail", "create a multi-region trail", cloudTrailTF, cloudTrailCFN,
+			trailData{Name: "organization-audit-trail", Bucket: "REPLACE_WITH_LOG_BUCKET"})
+		if err != nil {
+			return nil, err
+		}
+		return []models.Remediation{r}, nil
+	}
+
+	var remediations []models.Remediation
+	for _, trail := range result.TrailList {
+		if aws.ToBool(trail.IsMultiRegionTrail) && aws.ToBool(trail.LogFileValidationEnabled) && aws.ToBool(trail.IncludeGlobalServiceEvents) {
+			continue
+		}
+
+		name := aws.ToString(trail.Name)
+		log.Printf("Generating multi-region remediation for trail %s\n", name)
+		r, err := snippet(name, "enable multi-region coverage, global service events and log file validation",
+			cloudTrailTF, cloudTrailCFN, trailData{Name: name, Bucket: aws.ToString(trail.S3BucketName), KmsKeyID: aws.ToString(trail.KmsKeyId)})
+		if err != nil {
+			return nil, err
+		}
+		remediations = append(remediations, r)
+	}
+
+	return remediations, nil
+}
@@ -0,0 +1,196 @@
+package remediation
+
+import (
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/internal/checks/id_auth"
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/scope"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+const passwordPolicyTF = `resource "aws_iam_account_password_policy" "this" {
+  minimum_password_length        = {{ .MinLength }}
+  require_numbers                = {{ .RequireNumbers }}
+  require_symbols                = {{ .RequireSymbols }}
+  require_uppercase_characters   = {{ .RequireUppercase }}
+  require_lowercase_characters   = {{ .RequireLowercase }}
+{{- if gt .MaxAgeDays 0 }}
+  max_password_age               = {{ .MaxAgeDays }}
+{{- end }}
+{{- if gt .ReusePrevention 0 }}
+  password_reuse_prevention      = {{ .ReusePrevention }}
+{{- end }}
+  hard_expiry                    = {{ .HardExpiry }}
+  allow_users_to_change_password = true
+}
+`
+
+// CloudFormation has no resource type for the account password policy
+const passwordPolicyCFN = `# CloudFormation has no resource type for the IAM account password policy.
+# Apply it out of band (or through a custom resource) with:
+#   aws iam update-account-password-policy \
+#     --minimum-password-length {{ .MinLength }} \
+{{- if .RequireNumbers }}
+#     --require-numbers \
+{{- end }}
+{{- if .RequireSymbols }}
+#     --require-symbols \
+{{- end }}
+{{- if .RequireUppercase }}
+#     --require-uppercase-characters \
+{{- end }}
+{{- if .RequireLowercase }}
+#     --require-lowercase-characters \
+{{- end }}
+{{- if gt .MaxAgeDays 0 }}
+#     --max-password-age {{ .MaxAgeDays }} \
+{{- end }}
+{{- if gt .ReusePrevention 0 }}
+#     --password-reuse-prevention {{ .ReusePrevention }} \
+{{- end }}
+{{- if .HardExpiry }}
+#     --hard-expiry \
+{{- end }}
+#     --allow-users-to-change-password
+`
+
+// mfaPolicyDocument denies everything but the self-service MFA setup actions when the caller is not MFA authenticated
+const mfaPolicyDocument = `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Sid": "DenyAllExceptListedIfNoMFA",
+      "Effect": "Deny",
+      "NotAction": [
+        "iam:CreateVirtualMFADevice",
+        "iam:EnableMFADevice",
+        "iam:GetUser",
+        "iam:ListMFADevices",
+        "iam:ListVirtualMFADevices",
+        "iam:ResyncMFADevice",
+        "iam:ChangePassword",
+        "sts:GetSessionToken"
+      ],
+      "Resource": "*",
+      "Condition": {
+        "BoolIfExists": {
+          "aws:MultiFactorAuthPresent": "false"
+        }
+      }
+    }
+  ]
+}`
+
+const mfaPolicyTF = `resource "aws_iam_user_policy" "{{ tfName .User }}_enforce_mfa" {
+  name   = "EnforceMFA"
+  user   = "{{ .User }}"
+  policy = <<-EOT
+{{ .Document }}
+  EOT
+}
+`
+
+const mfaPolicyCFN = `{{ cfnName .User }}EnforceMFA:
+  Type: AWS::IAM::UserPolicy
+  Properties:
+    UserName: {{ .User }}
+    PolicyName: EnforceMFA
+    PolicyDocument:
+      Version: "2012-10-17"
+      Statement:
+        - Sid: DenyAllExceptListedIfNoMFA
+          Effect: Deny
+          NotAction:
+            - iam:CreateVirtualMFADevice
+            - iam:EnableMFADevice
+            - iam:GetUser
+            - iam:ListMFADevices
+            - iam:ListVirtualMFADevices
+            - iam:ResyncMFADevice
+            - iam:ChangePassword
+            - sts:GetSessionToken
+          Resource: "*"
+          Condition:
+            BoolIfExists:
+              aws:MultiFactorAuthPresent: "false"
+`
+
+type mfaData struct {
+	User     string
+	Document string
+}
+
+// passwordPolicyRemediations emits the account password policy described by password_policy in config.yaml
+// when the actual policy is weaker. The whole policy is rendered, since the settings left out would be reset.
+func passwordPolicyRemediations(cfg aws.Config) ([]models.Remediation, error) {
+	policy := config.AppConfig.AWS.PasswordPolicy
+	if policy.MinLength == 0 {
+		return nil, fmt.Errorf("password_policy is not defined in the configuration file")
+	}
+
+	findings, err := id_auth.AccountPasswordFindings(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(findings) == 0 {
+		return nil, nil
+	}
+	var settings []string
+	for _, finding := range findings {
+		settings = append(settings, finding.Setting)
+	}
+
+	r, err := snippet("account-password-policy", fmt.Sprintf("align the account password policy with config.yaml (%s)", strings.Join(settings, ", ")),
+		passwordPolicyTF, passwordPolicyCFN, policy)
+	if err != nil {
+		return nil, err
+	}
+	return []models.Remediation{r}, nil
+}
+
+// mfaRemediations emits an MFA enforcement policy for every IAM user without an MFA device at least as
+// strong as the one required by the mfa settings. This is the declarative equivalent of
+// id_auth.AttachMFAEnforcementPolicy.
+func mfaRemediations(cfg aws.Config) ([]models.Remediation, error) {
+	iamClient := iam.NewFromConfig(cfg)
+
+	var remediations []models.Remediation
+	paginator := iam.NewListUsersPaginator(iamClient, &iam.ListUsersInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list IAM users: %v", err)
+		}
+
+		for _, user := range page.Users {
+			if !scope.Includes(cfg, models.AssetTypeIAMUser, aws.ToString(user.UserName)) {
+				continue
+			}
+			name := aws.ToString(user.UserName)
+			devices, err := id_auth.ListMFADeviceTypes(name, iamClient)
+			if err != nil {
+				return nil, err
+			}
+			required := id_auth.RequiredMFADevice(id_auth.IsPrivilegedUser(name))
+			if id_auth.MeetsMFARequirement(devices, required) {
+				continue
+			}
+
+			log.Printf("Generating MFA enforcement remediation for user %s\n", name)
+			r, err := snippet(name, fmt.Sprintf("register a %s MFA device and deny every action until MFA is used", required),
+				mfaPolicyTF, mfaPolicyCFN, mfaData{User: name, Document: strings.TrimRight(indent(mfaPolicyDocument, "    "), "\n")})
+			if err != nil {
+				return nil, err
+			}
+			remediations = append(remediations, r)
+		}
+	}
+
+	return remediations, nil
+}
@@ -0,0 +1,307 @@
+package remediation
+
+import (
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/scope"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// The whole group is emitted with only the compliant rules: replacing the inline rules of the
+// group is how a rule gets removed declaratively. Every kind of source of the kept rules is carried over:
+// IPv4 and IPv6 blocks, prefix lists, other security groups and the group itself.
+const securityGroupTF = `resource "aws_security_group" "{{ tfName .Name }}" {
+  name        = "{{ .Name }}"
+  description = "{{ .Description }}"
+  vpc_id      = "{{ .VpcID }}"
+{{ range .Removed }}
+  # removed: {{ . }}
+{{- end }}
+{{- range .Ingress }}
+
+  ingress {
+{{- template "tfRule" . }}
+  }
+{{- end }}
+{{- range .Egress }}
+
+  egress {
+{{- template "tfRule" . }}
+  }
+{{- end }}
+}
+{{- define "tfRule" }}
+    protocol    = "{{ .Protocol }}"
+    from_port   = {{ .FromPort }}
+    to_port     = {{ .ToPort }}
+{{- if .Cidrs }}
+    cidr_blocks = [{{ quoteList .Cidrs }}]
+{{- end }}
+{{- if .Ipv6Cidrs }}
+    ipv6_cidr_blocks = [{{ quoteList .Ipv6Cidrs }}]
+{{- end }}
+{{- if .PrefixLists }}
+    prefix_list_ids = [{{ quoteList .PrefixLists }}]
+{{- end }}
+{{- if .Groups }}
+    security_groups = [{{ quoteList .Groups }}]
+{{- end }}
+{{- if .Self }}
+    self = true
+{{- end }}
+{{- end }}
+`
+
+// The rules referencing the group itself can't be inline in CloudFormation, they are separate resources
+const securityGroupCFN = `{{ cfnName .Name }}:
+  Type: AWS::EC2::SecurityGroup
+  Properties:
+    GroupName: {{ .Name }}
+    GroupDescription: "{{ .Description }}"
+    VpcId: {{ .VpcID }}
+{{- range .Removed }}
+    # removed: {{ . }}
+{{- end }}
+    SecurityGroupIngress:{{ if not (.CFNSources .Ingress false) }} []{{ end }}
+{{- range .CFNSources .Ingress false }}
+      - IpProtocol: "{{ .Rule.Protocol }}"
+        FromPort: {{ .Rule.FromPort }}
+        ToPort: {{ .Rule.ToPort }}
+        {{ .Key }}: {{ .Value }}
+{{- end }}
+    SecurityGroupEgress:{{ if not (.CFNSources .Egress true) }} []{{ end }}
+{{- range .CFNSources .Egress true }}
+      - IpProtocol: "{{ .Rule.Protocol }}"
+        FromPort: {{ .Rule.FromPort }}
+        ToPort: {{ .Rule.ToPort }}
+        {{ .Key }}: {{ .Value }}
+{{- end }}
+{{- range $i, $rule := .Ingress }}
+{{- if $rule.Self }}
+{{ cfnName $.Name }}SelfIngress{{ $i }}:
+  Type: AWS::EC2::SecurityGroupIngress
+  Properties:
+    GroupId: !GetAtt {{ cfnName $.Name }}.GroupId
+    IpProtocol: "{{ $rule.Protocol }}"
+    FromPort: {{ $rule.FromPort }}
+    ToPort: {{ $rule.ToPort }}
+    SourceSecurityGroupId: !GetAtt {{ cfnName $.Name }}.GroupId
+{{- end }}
+{{- end }}
+{{- range $i, $rule := .Egress }}
+{{- if $rule.Self }}
+{{ cfnName $.Name }}SelfEgress{{ $i }}:
+  Type: AWS::EC2::SecurityGroupEgress
+  Properties:
+    GroupId: !GetAtt {{ cfnName $.Name }}.GroupId
+    IpProtocol: "{{ $rule.Protocol }}"
+    FromPort: {{ $rule.FromPort }}
+    ToPort: {{ $rule.ToPort }}
+    DestinationSecurityGroupId: !GetAtt {{ cfnName $.Name }}.GroupId
+{{- end }}
+{{- end }}
+`
+
+type ruleData struct {
+	Protocol    string
+	FromPort    int32
+	ToPort      int32
+	Cidrs       []string
+	Ipv6Cidrs   []string
+	PrefixLists []string
+	Groups      []string // other security groups, as account/group for the groups of other accounts
+	Self        bool     // the group references itself
+}
+
+// sources describes the sources or destinations of the rule
+func (r ruleData) sources() string {
+	var sources []string
+	sources = append(sources, r.Cidrs...)
+	sources = append(sources, r.Ipv6Cidrs...)
+	sources = append(sources, r.PrefixLists...)
+	sources = append(sources, r.Groups...)
+	if r.Self {
+		sources = append(sources, "self")
+	}
+	return strings.Join(sources, ",")
+}
+
+// quoteList renders strings as a quoted HCL list body
+func quoteList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("%q", value)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// cfnSource is a source or a destination of an inline CloudFormation rule
+type cfnSource struct {
+	Rule  ruleData
+	Key   string
+	Value string
+}
+
+type securityGroupData struct {
+	Name        string
+	Description string
+	VpcID       string
+	Ingress     []ruleData
+	Egress      []ruleData
+	Removed     []string
+}
+
+// CFNSources returns an inline CloudFormation rule for each source of the rules, the self references excluded
+func (d securityGroupData) CFNSources(rules []ruleData, egress bool) []cfnSource {
+	groupKey, prefixKey := "SourceSecurityGroupId", "SourcePrefixListId"
+	if egress {
+		groupKey, prefixKey = "DestinationSecurityGroupId", "DestinationPrefixListId"
+	}
+	var sources []cfnSource
+	for _, rule := range rules {
+		for _, cidr := range rule.Cidrs {
+			sources = append(sources, cfnSource{rule, "CidrIp", cidr})
+		}
+		for _, cidr := range rule.Ipv6Cidrs {
+			sources = append(sources, cfnSource{rule, "CidrIpv6", cidr})
+		}
+		for _, prefixList := range rule.PrefixLists {
+			sources = append(sources, cfnSource{rule, prefixKey, prefixList})
+		}
+		for _, group := range rule.Groups {
+			sources = append(sources, cfnSource{rule, groupKey, group})
+		}
+	}
+	return sources
+}
+
+// securityGroupRemediations emits the compliant version of every security group that has rules on ports
+// not listed in allowed_ingress_ports / allowed_egress_ports. Unlike RunSecurityGroupCheck, which looks at
+// the first port of a rule, every port of a range must be allowed and all-traffic rules are removed.
+func securityGroupRemediations(cfg aws.Config) ([]models.Remediation, error) {
+	ec2Client := ec2.NewFromConfig(cfg)
+
+	result, err := ec2Client.DescribeSecurityGroups(context.TODO(), &ec2.DescribeSecurityGroupsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe security groups: %v", err)
+	}
+
+	sgMap := make(map[string]config.SecurityGroup)
+	for _, sg := range config.AppConfig.AWS.SecurityGroups {
+		sgMap[sg.Name] = sg
+	}
+
+	var remediations []models.Remediation
+	for _, sg := range result.SecurityGroups {
+		if !scope.Includes(cfg, models.AssetTypeSecurityGroup, aws.ToString(sg.GroupId)) {
+			continue
+		}
+		name := aws.ToString(sg.GroupName)
+		allowed := sgMap[name]
+
+		data := securityGroupData{
+			Name:        name,
+			Description: strings.ReplaceAll(aws.ToString(sg.Description), `"`, `'`),
+			VpcID:       aws.ToString(sg.VpcId),
+		}
+		groupID := aws.ToString(sg.GroupId)
+		data.Ingress, data.Removed = splitRules(sg.IpPermissions, allowed.AllowedIngressPorts, "ingress", groupID, data.Removed)
+		data.Egress, data.Removed = splitRules(sg.IpPermissionsEgress, allowed.AllowedEgressPorts, "egress", groupID, data.Removed)
+
+		if len(data.Removed) == 0 {
+			continue
+		}
+
+		log.Printf("Generating remediation for security group %s (%s): %d rule(s) removed\n", name, aws.ToString(sg.GroupId), len(data.Removed))
+		r, err := snippet(aws.ToString(sg.GroupId), fmt.Sprintf("remove %d rule(s) on ports not allowed for %s", len(data.Removed), name),
+			securityGroupTF, securityGroupCFN, data)
+		if err != nil {
+			return nil, err
+		}
+		remediations = append(remediations, r)
+	}
+
+	return remediations, nil
+}
+
+// splitRules separates the rules that can be kept from the ones opening ports not in the allowed list.
+// groupID is the group of the rules, to recognize the references to itself.
+func splitRules(permissions []ec2types.IpPermission, allowedPorts []int, direction, groupID string, removed []string) ([]ruleData, []string) {
+	var kept []ruleData
+	for _, permission := range permissions {
+		rule := ruleData{
+			Protocol: aws.ToString(permission.IpProtocol),
+			FromPort: aws.ToInt32(permission.FromPort),
+			ToPort:   aws.ToInt32(permission.ToPort),
+		}
+		for _, ipRange := range permission.IpRanges {
+			rule.Cidrs = append(rule.Cidrs, aws.ToString(ipRange.CidrIp))
+		}
+		for _, ipRange := range permission.Ipv6Ranges {
+			rule.Ipv6Cidrs = append(rule.Ipv6Cidrs, aws.ToString(ipRange.CidrIpv6))
+		}
+		for _, prefixList := range permission.PrefixListIds {
+			rule.PrefixLists = append(rule.PrefixLists, aws.ToString(prefixList.PrefixListId))
+		}
+		for _, pair := range permission.UserIdGroupPairs {
+			group := aws.ToString(pair.GroupId)
+			switch {
+			case group == groupID:
+				rule.Self = true
+			case pair.UserId != nil && pair.VpcPeeringConnectionId != nil:
+				// Groups of peered VPCs in other accounts are referenced as account/group
+				rule.Groups = append(rule.Groups, aws.ToString(pair.UserId)+"/"+group)
+			default:
+				rule.Groups = append(rule.Groups, group)
+			}
+		}
+		if rule.Protocol == "-1" && permission.FromPort == nil {
+			rule.FromPort, rule.ToPort = 0, 0
+		}
+
+		if rule.Protocol == "-1" {
+			removed = append(removed, fmt.Sprintf("%s all traffic from %s", direction, rule.sources()))
+			continue
+		}
+		if permission.FromPort != nil && !portsAllowed(rule, allowedPorts) {
+			removed = append(removed, fmt.Sprintf("%s %s %d-%d from %s", direction, rule.Protocol, rule.FromPort, rule.ToPort, rule.sources()))
+			continue
+		}
+		if rule.sources() != "" {
+			kept = append(kept, rule)
+		}
+	}
+	return kept, removed
+}
+
+// portsAllowed checks that every port of the rule is in the allowed list. For ICMP the ports are the type
+// and the code, and only the type is checked.
+func portsAllowed(rule ruleData, allowedPorts []int) bool {
+	switch rule.Protocol {
+	case "icmp", "1", "icmpv6", "58":
+		return containsPort(allowedPorts, int(rule.FromPort))
+	}
+	for port := rule.FromPort; port <= rule.ToPort; port++ {
+		if !containsPort(allowedPorts, int(port)) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsPort checks if a port is present in the list
+func containsPort(ports []int, port int) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
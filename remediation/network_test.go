@@ -0,0 +1,55 @@
+package remediation
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitRules(t *testing.T) {
+	permissions := []ec2types.IpPermission{
+		{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(443), ToPort: aws.Int32(443),
+			IpRanges:      []ec2types.IpRange{{CidrIp: aws.String("10.0.0.0/8")}},
+			Ipv6Ranges:    []ec2types.Ipv6Range{{CidrIpv6: aws.String("2001:db8::/32")}},
+			PrefixListIds: []ec2types.PrefixListId{{PrefixListId: aws.String("pl-1234")}}},
+		{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(8443), ToPort: aws.Int32(8443),
+			UserIdGroupPairs: []ec2types.UserIdGroupPair{{GroupId: aws.String("sg-self")}, {GroupId: aws.String("sg-web")}}},
+		{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(22), ToPort: aws.Int32(22),
+			IpRanges: []ec2types.IpRange{{CidrIp: aws.String("0.0.0.0/0")}}},
+		// The first port is allowed but not the rest of the range
+		{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(443), ToPort: aws.Int32(8080),
+			IpRanges: []ec2types.IpRange{{CidrIp: aws.String("10.0.0.0/8")}}},
+		{IpProtocol: aws.String("-1"), IpRanges: []ec2types.IpRange{{CidrIp: aws.String("10.0.0.0/8")}}},
+	}
+
+	kept, removed := splitRules(permissions, []int{443, 8443}, "ingress", "sg-self", nil)
+	assert.Equal(t, []string{
+		"ingress tcp 22-22 from 0.0.0.0/0",
+		"ingress tcp 443-8080 from 10.0.0.0/8",
+		"ingress all traffic from 10.0.0.0/8",
+	}, removed)
+	assert.Equal(t, []ruleData{
+		{Protocol: "tcp", FromPort: 443, ToPort: 443, Cidrs: []string{"10.0.0.0/8"}, Ipv6Cidrs: []string{"2001:db8::/32"}, PrefixLists: []string{"pl-1234"}},
+		{Protocol: "tcp", FromPort: 8443, ToPort: 8443, Groups: []string{"sg-web"}, Self: true},
+	}, kept)
+
+	// The replacement group keeps every kind of source
+	data := securityGroupData{Name: "default", Description: "default VPC security group", VpcID: "vpc-1", Ingress: kept, Removed: removed}
+	r, err := snippet("sg-self", "remove", securityGroupTF, securityGroupCFN, data)
+	if assert.NoError(t, err) {
+		assert.Contains(t, r.Terraform, `ipv6_cidr_blocks = ["2001:db8::/32"]`)
+		assert.Contains(t, r.Terraform, `prefix_list_ids = ["pl-1234"]`)
+		assert.Contains(t, r.Terraform, `security_groups = ["sg-web"]`)
+		assert.Contains(t, r.Terraform, "self = true")
+		assert.Contains(t, r.Terraform, "# removed: ingress tcp 22-22 from 0.0.0.0/0")
+
+		assert.Contains(t, r.CloudFormation, "CidrIpv6: 2001:db8::/32")
+		assert.Contains(t, r.CloudFormation, "SourcePrefixListId: pl-1234")
+		assert.Contains(t, r.CloudFormation, "SourceSecurityGroupId: sg-web")
+		assert.Contains(t, r.CloudFormation, "Type: AWS::EC2::SecurityGroupIngress")
+		assert.Contains(t, r.CloudFormation, "SourceSecurityGroupId: !GetAtt Default.GroupId")
+		assert.Contains(t, r.CloudFormation, "SecurityGroupEgress: []")
+	}
+}
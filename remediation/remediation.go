@@ -0,0 +1,212 @@
+package remediation
+
+import (
+	"bytes"
+	"cloud_compliance_checker/models"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// generator produces the remediation snippets for the resources failing a check
+type generator func(cfg aws.Config) ([]models.Remediation, error)
+
+// generators maps a check function (as defined in control.json) to its remediation generator
+var generators = map[string]generator{
+	// 03.01.03 Information Flow Enforcement
+	"CheckCUIFlow": securityGroupRemediations,
+	// 03.13.01 Boundary Protection
+	"CheckBP": securityGroupRemediations,
+	// 03.13.05 Deny by Default
+	"CheckNetworkTraffic": securityGroupRemediations,
+	// 03.13.04 Information in Shared System Resources
+	"CheckISR": bucketPublicAccessRemediations,
+	// 03.13.08 Transmission and Storage Confidentiality
+	"CheckTSC": bucketEncryptionRemediations,
+	// 03.13.11 Cryptographic Protection
+	"CheckCP": bucketEncryptionRemediations,
+	// 03.05.03 Multi-Factor Authentication
+	"CheckMFA": mfaRemediations,
+	// 03.05.04 Replay-Resistant Authentication
+	"CheckRRA":                mfaRemediations,
+	"CheckPasswordComplexity": passwordPolicyRemediations,
+	// 03.03.01 Event Logging
+	"CheckAuditLogs": cloudTrailRemediations,
+	// 03.12.01 Security Assessments
+	"CheckSA": cloudTrailRemediations,
+	// 03.12.03 Continuous Monitoring
+	"CheckCM": cloudTrailRemediations,
+}
+
+// HasGenerator reports whether a remediation generator exists for the check function
+func HasGenerator(checkFunction string) bool {
+	_, ok := generators[checkFunction]
+	return ok
+}
+
+// Generate returns the Terraform and CloudFormation snippets that fix the resources failing the check.
+// The generators only read the AWS account: nothing is modified, the snippets are meant to be
+// reviewed and merged into the IaC modules that own the resources.
+func Generate(checkFunction string, cfg aws.Config) ([]models.Remediation, error) {
+	gen, ok := generators[checkFunction]
+	if !ok {
+		return nil, nil
+	}
+
+	snippets, err := gen(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate remediation for %s: %v", checkFunction, err)
+	}
+
+	for i := range snippets {
+		snippets[i].CheckFunction = checkFunction
+	}
+	return snippets, nil
+}
+
+// WriteSnippets writes one Terraform (.tf) and one CloudFormation (.yaml) file per check function into dir
+func WriteSnippets(dir string, snippets []models.Remediation) error {
+	if len(snippets) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create remediation directory %s: %v", dir, err)
+	}
+
+	byCheck := make(map[string][]models.Remediation)
+	for _, snippet := range snippets {
+		byCheck[snippet.CheckFunction] = append(byCheck[snippet.CheckFunction], snippet)
+	}
+
+	checks := make([]string, 0, len(byCheck))
+	for check := range byCheck {
+		checks = append(checks, check)
+	}
+	sort.Strings(checks)
+
+	for _, check := range checks {
+		var tf, cfn strings.Builder
+
+		fmt.Fprintf(&tf, "# Remediation for %s generated by cloud_compliance_checker\n\n", check)
+		fmt.Fprintf(&cfn, "# Remediation for %s generated by cloud_compliance_checker\n", check)
+		cfn.WriteString("AWSTemplateFormatVersion: \"2010-09-09\"\n")
+		cfn.WriteString("Resources:\n")
+
+		for _, snippet := range byCheck[check] {
+			fmt.Fprintf(&tf, "# %s: %s\n", snippet.Resource, snippet.Description)
+			tf.WriteString(snippet.Terraform)
+			tf.WriteString("\n")
+
+			fmt.Fprintf(&cfn, "  # %s: %s\n", snippet.Resource, snippet.Description)
+			cfn.WriteString(indent(snippet.CloudFormation, "  "))
+			cfn.WriteString("\n")
+		}
+
+		tfFile := filepath.Join(dir, check+".tf")
+		if err := os.WriteFile(tfFile, []byte(tf.String()), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", tfFile, err)
+		}
+		cfnFile := filepath.Join(dir, check+".yaml")
+		if err := os.WriteFile(cfnFile, []byte(cfn.String()), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", cfnFile, err)
+		}
+		log.Printf("Remediation snippets for %s written to %s and %s\n", check, tfFile, cfnFile)
+	}
+
+	return nil
+}
+
+// render executes a text template with the given data
+func render(name, text string, data interface{}) (string, error) {
+	tmpl, err := template.New(name).Funcs(template.FuncMap{
+		"tfName":    tfName,
+		"cfnName":   cfnName,
+		"quoteList": quoteList,
+	}).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template %s: %v", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %v", name, err)
+	}
+	return buf.String(), nil
+}
+
+// snippet renders both templates and builds a remediation for the resource
+func snippet(resource, description, tfTemplate, cfnTemplate string, data interface{}) (models.Remediation, error) {
+	tf, err := render(resource+".tf", tfTemplate, data)
+	if err != nil {
+		return models.Remediation{}, err
+	}
+	cfn, err := render(resource+".yaml", cfnTemplate, data)
+	if err != nil {
+		return models.Remediation{}, err
+	}
+
+	return models.Remediation{
+		Resource:       resource,
+		Description:    description,
+		Terraform:      tf,
+		CloudFormation: cfn,
+	}, nil
+}
+
+// tfName converts a resource name into a valid Terraform resource label
+func tfName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	label := b.String()
+	if label == "" || unicode.IsDigit(rune(label[0])) {
+		label = "r_" + label
+	}
+	return label
+}
+
+// cfnName converts a resource name into a valid CloudFormation logical ID
+func cfnName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	id := b.String()
+	if id == "" || unicode.IsDigit(rune(id[0])) {
+		id = "R" + id
+	}
+	return id
+}
+
+// indent prefixes every non empty line of text
+func indent(text, prefix string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,178 @@
+package remediation
+
+import (
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/models"
+	"cloud_compliance_checker/s3client"
+	"cloud_compliance_checker/scope"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+const bucketEncryptionTF = `resource "aws_s3_bucket_server_side_encryption_configuration" "{{ tfName .Bucket }}" {
+  bucket = "{{ .Bucket }}"
+
+  rule {
+    apply_server_side_encryption_by_default {
+      sse_algorithm = "{{ .Algorithm }}"
+    }
+{{- if eq .Algorithm "aws:kms" }}
+    bucket_key_enabled = true
+{{- end }}
+  }
+}
+`
+
+const bucketEncryptionCFN = `{{ cfnName .Bucket }}:
+  Type: AWS::S3::Bucket
+  DeletionPolicy: Retain
+  Properties:
+    BucketName: {{ .Bucket }}
+    BucketEncryption:
+      ServerSideEncryptionConfiguration:
+        - ServerSideEncryptionByDefault:
+            SSEAlgorithm: {{ .Algorithm }}
+{{- if eq .Algorithm "aws:kms" }}
+          BucketKeyEnabled: true
+{{- end }}
+`
+
+const bucketPublicAccessTF = `resource "aws_s3_bucket_public_access_block" "{{ tfName .Bucket }}" {
+  bucket = "{{ .Bucket }}"
+
+  block_public_acls       = true
+  block_public_policy     = true
+  ignore_public_acls      = true
+  restrict_public_buckets = true
+}
+`
+
+const bucketPublicAccessCFN = `{{ cfnName .Bucket }}:
+  Type: AWS::S3::Bucket
+  DeletionPolicy: Retain
+  Properties:
+    BucketName: {{ .Bucket }}
+    PublicAccessBlockConfiguration:
+      BlockPublicAcls: true
+      BlockPublicPolicy: true
+      IgnorePublicAcls: true
+      RestrictPublicBuckets: true
+`
+
+type bucketData struct {
+	Bucket    string
+	Algorithm string
+}
+
+// bucketEncryptionRemediations emits the encryption configuration for every bucket without default encryption.
+// The algorithm declared in s3_buckets is used when present, AES256 otherwise. The encryption is read in the
+// region of each bucket.
+func bucketEncryptionRemediations(cfg aws.Config) ([]models.Remediation, error) {
+	svc := s3.NewFromConfig(cfg)
+
+	result, err := svc.ListBuckets(context.TODO(), &s3.ListBucketsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list S3 buckets: %v", err)
+	}
+
+	declared := make(map[string]string)
+	for _, bucket := range config.AppConfig.AWS.S3Buckets {
+		declared[bucket.Name] = bucket.Encryption
+	}
+
+	var remediations []models.Remediation
+	for _, bucket := range result.Buckets {
+		name := aws.ToString(bucket.Name)
+		if !scope.Includes(cfg, models.AssetTypeS3Bucket, name) {
+			continue
+		}
+		expected := declared[name]
+		if expected == "" {
+			expected = "AES256"
+		}
+
+		client, err := s3client.ForBucket(context.TODO(), cfg, name)
+		if err != nil {
+			return nil, err
+		}
+		encryption, err := client.GetBucketEncryption(context.TODO(), &s3.GetBucketEncryptionInput{Bucket: bucket.Name})
+		var apiErr smithy.APIError
+		if err != nil && !(errors.As(err, &apiErr) && apiErr.ErrorCode() == "ServerSideEncryptionConfigurationNotFoundError") {
+			return nil, fmt.Errorf("failed to get the encryption of bucket %s: %v", name, err)
+		}
+		if err == nil && encryption.ServerSideEncryptionConfiguration != nil && len(encryption.ServerSideEncryptionConfiguration.Rules) > 0 {
+			rule := encryption.ServerSideEncryptionConfiguration.Rules[0]
+			if rule.ApplyServerSideEncryptionByDefault != nil && string(rule.ApplyServerSideEncryptionByDefault.SSEAlgorithm) == expected {
+				continue
+			}
+		}
+
+		log.Printf("Generating encryption remediation for S3 bucket %s (%s)\n", name, expected)
+		r, err := snippet(name, fmt.Sprintf("enable default %s encryption", expected),
+			bucketEncryptionTF, bucketEncryptionCFN, bucketData{Bucket: name, Algorithm: expected})
+		if err != nil {
+			return nil, err
+		}
+		remediations = append(remediations, r)
+	}
+
+	return remediations, nil
+}
+
+// bucketPublicAccessRemediations emits a public access block for every bucket that has a public policy or ACL,
+// read in the region of the bucket
+func bucketPublicAccessRemediations(cfg aws.Config) ([]models.Remediation, error) {
+	svc := s3.NewFromConfig(cfg)
+
+	result, err := svc.ListBuckets(context.TODO(), &s3.ListBucketsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list S3 buckets: %v", err)
+	}
+
+	var remediations []models.Remediation
+	for _, bucket := range result.Buckets {
+		name := aws.ToString(bucket.Name)
+		if !scope.Includes(cfg, models.AssetTypeS3Bucket, name) {
+			continue
+		}
+		client, err := s3client.ForBucket(context.TODO(), cfg, name)
+		if err != nil {
+			return nil, err
+		}
+		if !isBucketPublic(client, name) {
+			continue
+		}
+
+		log.Printf("Generating public access block remediation for S3 bucket %s\n", name)
+		r, err := snippet(name, "block public access", bucketPublicAccessTF, bucketPublicAccessCFN, bucketData{Bucket: name})
+		if err != nil {
+			return nil, err
+		}
+		remediations = append(remediations, r)
+	}
+
+	return remediations, nil
+}
+
+// isBucketPublic reports whether the bucket grants access to everyone through its ACL or policy
+func isBucketPublic(svc *s3.Client, bucketName string) bool {
+	acl, err := svc.GetBucketAcl(context.TODO(), &s3.GetBucketAclInput{Bucket: &bucketName})
+	if err == nil {
+		for _, grant := range acl.Grants {
+			if grant.Grantee != nil && grant.Grantee.URI != nil &&
+				(*grant.Grantee.URI == "http://acs.amazonaws.com/groups/global/AllUsers" ||
+					*grant.Grantee.URI == "http://acs.amazonaws.com/groups/global/AuthenticatedUsers") {
+				return true
+			}
+		}
+	}
+
+	status, err := svc.GetBucketPolicyStatus(context.TODO(), &s3.GetBucketPolicyStatusInput{Bucket: &bucketName})
+	return err == nil && status.PolicyStatus != nil && aws.ToBool(status.PolicyStatus.IsPublic)
+}
@@ -0,0 +1,52 @@
+// Package s3client returns S3 clients for the region of a bucket and lists the folders of a bucket.
+package s3client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// defaultRegion is the region of the buckets without location constraint
+const defaultRegion = "us-east-1"
+
+// Region returns the region of a bucket
+func Region(ctx context.Context, cfg aws.Config, bucket string) (string, error) {
+	location, err := s3.NewFromConfig(cfg).GetBucketLocation(ctx, &s3.GetBucketLocationInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return "", fmt.Errorf("failed to get the location of bucket %s: %v", bucket, err)
+	}
+	if location.LocationConstraint == "" {
+		return defaultRegion, nil
+	}
+	return string(location.LocationConstraint), nil
+}
+
+// ForBucket returns an S3 client for the region of the bucket
+func ForBucket(ctx context.Context, cfg aws.Config, bucket string) (*s3.Client, error) {
+	region, err := Region(ctx, cfg, bucket)
+	if err != nil {
+		return nil, err
+	}
+	regional := cfg.Copy()
+	regional.Region = region
+	return s3.NewFromConfig(regional), nil
+}
+
+// Folders returns the folders under a prefix
+func Folders(ctx context.Context, client *s3.Client, bucket, prefix string) ([]string, error) {
+	var folders []string
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix), Delimiter: aws.String("/")})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list s3://%s/%s: %v", bucket, prefix, err)
+		}
+		for _, common := range page.CommonPrefixes {
+			folders = append(folders, aws.ToString(common.Prefix))
+		}
+	}
+	return folders, nil
+}
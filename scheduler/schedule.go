@@ -0,0 +1,119 @@
+package scheduler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule returns the next activation time after a given time
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// intervalSchedule fires at a fixed calendar interval from the previous run
+type intervalSchedule struct {
+	years, months, days int
+	duration            time.Duration
+}
+
+// Next returns t plus the interval. Months and years follow the calendar, as in time.AddDate.
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.AddDate(s.years, s.months, s.days).Add(s.duration)
+}
+
+// Keyword frequencies already used in config.yaml
+var keywordSchedules = map[string]intervalSchedule{
+	"hourly":    {duration: time.Hour},
+	"daily":     {days: 1},
+	"weekly":    {days: 7},
+	"monthly":   {months: 1},
+	"quarterly": {months: 3},
+	"yearly":    {years: 1},
+	"annually":  {years: 1},
+}
+
+// ParseSchedule parses a frequency expressed as:
+//   - a keyword: hourly, daily, weekly, monthly, quarterly, yearly
+//   - an ISO-8601 duration: P1D, PT6H, P1W, P1M, P1Y2M10DT2H30M
+//   - a Go duration: 90m, 12h
+//   - a 5-field cron expression or macro: "0 3 * * MON", "@daily"
+func ParseSchedule(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, fmt.Errorf("empty schedule")
+	}
+
+	if s, ok := keywordSchedules[strings.ToLower(expr)]; ok {
+		return s, nil
+	}
+
+	if strings.HasPrefix(expr, "@") || strings.Contains(expr, " ") {
+		return ParseCron(expr)
+	}
+
+	if strings.HasPrefix(strings.ToUpper(expr), "P") {
+		return ParseISODuration(expr)
+	}
+
+	d, err := time.ParseDuration(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: expected a keyword, an ISO-8601 duration, a duration or a cron expression", expr)
+	}
+	if d <= 0 {
+		return nil, fmt.Errorf("invalid schedule %q: duration must be positive", expr)
+	}
+	return intervalSchedule{duration: d}, nil
+}
+
+var isoDurationRegex = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// ParseISODuration parses an ISO-8601 duration such as P1M, P2W or PT12H
+func ParseISODuration(expr string) (Schedule, error) {
+	match := isoDurationRegex.FindStringSubmatch(strings.ToUpper(expr))
+	if match == nil || expr == "P" || strings.HasSuffix(strings.ToUpper(expr), "T") {
+		return nil, fmt.Errorf("invalid ISO-8601 duration %q", expr)
+	}
+
+	values := make([]int, len(match))
+	for i := 1; i < len(match); i++ {
+		if match[i] == "" {
+			continue
+		}
+		v, err := strconv.Atoi(match[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid ISO-8601 duration %q: %v", expr, err)
+		}
+		values[i] = v
+	}
+
+	s := intervalSchedule{
+		years:  values[1],
+		months: values[2],
+		days:   values[3]*7 + values[4],
+		duration: time.Duration(values[5])*time.Hour +
+			time.Duration(values[6])*time.Minute +
+			time.Duration(values[7])*time.Second,
+	}
+	if s.years == 0 && s.months == 0 && s.days == 0 && s.duration == 0 {
+		return nil, fmt.Errorf("invalid ISO-8601 duration %q: duration must be positive", expr)
+	}
+	return s, nil
+}
+
+// Interval returns the time between two consecutive activations of the schedule after from.
+// For interval schedules this is the interval itself, for cron expressions the gap between the next two runs.
+// Zero is returned when the schedule has no next two runs.
+func Interval(s Schedule, from time.Time) time.Duration {
+	next := s.Next(from)
+	if next.IsZero() {
+		return 0
+	}
+	after := s.Next(next)
+	if after.IsZero() {
+		return 0
+	}
+	return after.Sub(next)
+}
@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScheduleIntervals(t *testing.T) {
+	from := time.Date(2024, time.January, 31, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{"daily", time.Date(2024, time.February, 1, 10, 0, 0, 0, time.UTC)},
+		{"weekly", time.Date(2024, time.February, 7, 10, 0, 0, 0, time.UTC)},
+		{"monthly", from.AddDate(0, 1, 0)},
+		{"P1D", time.Date(2024, time.February, 1, 10, 0, 0, 0, time.UTC)},
+		{"P2W", time.Date(2024, time.February, 14, 10, 0, 0, 0, time.UTC)},
+		{"PT6H30M", time.Date(2024, time.January, 31, 16, 30, 0, 0, time.UTC)},
+		{"P1Y2M3DT4H", from.AddDate(1, 2, 3).Add(4 * time.Hour)},
+		{"90m", time.Date(2024, time.January, 31, 11, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		schedule, err := ParseSchedule(tt.expr)
+		assert.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.next, schedule.Next(from), tt.expr)
+	}
+}
+
+func TestParseScheduleCron(t *testing.T) {
+	// Wednesday
+	from := time.Date(2024, time.January, 31, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, time.January, 31, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, time.February, 1, 3, 0, 0, 0, time.UTC)},
+		{"0 0 * * MON", time.Date(2024, time.February, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 9 1-7 * 1-5", time.Date(2024, time.February, 1, 9, 0, 0, 0, time.UTC)},
+		{"30 2 29 FEB *", time.Date(2024, time.February, 29, 2, 30, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, time.February, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, time.February, 4, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		schedule, err := ParseSchedule(tt.expr)
+		assert.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.next, schedule.Next(from), tt.expr)
+	}
+
+	// Never matches
+	_, err := ParseCron("0 0 31 2 *")
+	assert.Error(t, err)
+	_, err = ParseCron("0 0 30 FEB ?")
+	assert.Error(t, err)
+
+	// "*/1" and "?" leave the day of week alone: only the 1st of the month matches
+	for _, expr := range []string{"0 0 1 * */1", "0 0 1 * ?"} {
+		schedule, err := ParseCron(expr)
+		assert.NoError(t, err, expr)
+		assert.Equal(t, time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC), schedule.Next(from), expr)
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, expr := range []string{"", "sometimes", "P", "PT", "P1H", "-1h", "60 * * * *", "* * * *", "0 0 5-1 * *", "*/0 * * * *"} {
+		_, err := ParseSchedule(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestInterval(t *testing.T) {
+	from := time.Date(2024, time.January, 31, 10, 0, 0, 0, time.UTC)
+
+	schedule, _ := ParseSchedule("weekly")
+	assert.Equal(t, 7*24*time.Hour, Interval(schedule, from))
+
+	schedule, _ = ParseSchedule("0 */6 * * *")
+	assert.Equal(t, 6*time.Hour, Interval(schedule, from))
+}
@@ -0,0 +1,329 @@
+package scheduler
+
+import (
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// tickInterval is how often the scheduler looks for due jobs
+const tickInterval = 30 * time.Second
+
+// Job is a group of controls evaluated at its own frequency
+type Job struct {
+	Name     string
+	Schedule string
+	// Controls is the list of control IDs to evaluate, empty for the whole catalog
+	Controls []string
+
+	schedule Schedule
+}
+
+// JobState is the persisted state of a job
+type JobState struct {
+	LastRun    time.Time `json:"last_run"`
+	LastStatus string    `json:"last_status,omitempty"`
+	LastScore  *int      `json:"last_score,omitempty"`
+	LastError  string    `json:"last_error,omitempty"`
+	NextRun    time.Time `json:"next_run"`
+}
+
+// RunFunc evaluates the controls of a job and returns the score
+type RunFunc func(job Job) (int, error)
+
+// Scheduler runs every job at its own frequency.
+// Jobs are executed one at a time because the checks share the global configuration; a job that is due
+// while its previous run is still queued or running is skipped.
+type Scheduler struct {
+	jobs      []*Job
+	stateFile string
+	run       RunFunc
+
+	mu      sync.Mutex
+	state   map[string]*JobState
+	running map[string]bool
+
+	execMu sync.Mutex
+}
+
+// Built-in jobs created from the frequencies already present in the configuration
+var frequencyJobs = []struct {
+	name          string
+	checkFunction string
+	frequency     func(cfg config.AWSConfig) string
+}{
+	{"risk_assessment", "CheckRA", func(cfg config.AWSConfig) string { return cfg.RiskAssessmentConfig.Frequency }},
+	{"vulnerability_scanning", "CheckMonitorAndScanning", func(cfg config.AWSConfig) string {
+		return cfg.RiskAssessmentConfig.VulnerabilityScanning.Frequency
+	}},
+	{"incident_response_testing", "CheckIRTesting", func(cfg config.AWSConfig) string { return cfg.TestIncidentRensponseFrequency }},
+}
+
+// JobsFromConfig builds the jobs from the scheduler section and from the frequencies of
+// risk_assessment, vulnerability_scanning and test_incident_response_frequency
+func JobsFromConfig(cfg config.AWSConfig, controls models.NISTControls) ([]Job, error) {
+	var jobs []Job
+	names := make(map[string]bool)
+
+	for _, configured := range cfg.Scheduler.Jobs {
+		if configured.Name == "" {
+			return nil, fmt.Errorf("scheduler job without a name")
+		}
+		if names[configured.Name] {
+			return nil, fmt.Errorf("duplicate scheduler job %s", configured.Name)
+		}
+
+		ids, err := resolveControls(controls, configured.Controls, configured.CheckFunctions)
+		if err != nil {
+			return nil, fmt.Errorf("scheduler job %s: %v", configured.Name, err)
+		}
+		if (len(configured.Controls) > 0 || len(configured.CheckFunctions) > 0) && len(ids) == 0 {
+			return nil, fmt.Errorf("scheduler job %s: no control matches", configured.Name)
+		}
+
+		jobs = append(jobs, Job{Name: configured.Name, Schedule: configured.Schedule, Controls: ids})
+		names[configured.Name] = true
+	}
+
+	for _, builtin := range frequencyJobs {
+		frequency := builtin.frequency(cfg)
+		if frequency == "" || names[builtin.name] {
+			continue
+		}
+
+		ids, _ := resolveControls(controls, nil, []string{builtin.checkFunction})
+		if len(ids) == 0 {
+			log.Printf("Scheduler: no control uses %s, %s frequency ignored\n", builtin.checkFunction, builtin.name)
+			continue
+		}
+
+		jobs = append(jobs, Job{Name: builtin.name, Schedule: frequency, Controls: ids})
+		names[builtin.name] = true
+	}
+
+	return jobs, nil
+}
+
+// resolveControls merges the control IDs with the IDs of the controls using the given check functions
+func resolveControls(controls models.NISTControls, ids []string, checkFunctions []string) ([]string, error) {
+	known := make(map[string]bool)
+	for _, control := range controls.Controls {
+		known[control.ID] = true
+	}
+
+	seen := make(map[string]bool)
+	var resolved []string
+	for _, id := range ids {
+		if !known[id] {
+			return nil, fmt.Errorf("unknown control %s", id)
+		}
+		if !seen[id] {
+			resolved = append(resolved, id)
+			seen[id] = true
+		}
+	}
+
+	for _, checkFunction := range checkFunctions {
+		for _, control := range controls.Controls {
+			for _, criteria := range control.Criteria {
+				if criteria.CheckFunction == checkFunction && !seen[control.ID] {
+					resolved = append(resolved, control.ID)
+					seen[control.ID] = true
+				}
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// New creates a Scheduler and loads the last-run times from stateFile
+func New(jobs []Job, stateFile string, run RunFunc) (*Scheduler, error) {
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("no job to schedule")
+	}
+
+	s := &Scheduler{
+		stateFile: stateFile,
+		run:       run,
+		state:     make(map[string]*JobState),
+		running:   make(map[string]bool),
+	}
+
+	for i := range jobs {
+		job := jobs[i]
+		schedule, err := ParseSchedule(job.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %v", job.Name, err)
+		}
+		job.schedule = schedule
+		s.jobs = append(s.jobs, &job)
+	}
+
+	if err := s.loadState(); err != nil {
+		return nil, err
+	}
+
+	// Jobs never run, or whose next run was missed while the daemon was stopped, run at the first tick
+	now := time.Now()
+	for _, job := range s.jobs {
+		state, ok := s.state[job.Name]
+		if !ok {
+			s.state[job.Name] = &JobState{NextRun: now}
+			continue
+		}
+		state.NextRun = job.schedule.Next(state.LastRun)
+		if state.NextRun.IsZero() || state.NextRun.Before(now) {
+			state.NextRun = now
+		}
+	}
+
+	return s, nil
+}
+
+// Run checks for due jobs until stop is closed
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	for _, job := range s.jobs {
+		state := s.State(job.Name)
+		log.Printf("Scheduler: job %s (%s, %d control(s)) next run at %s\n", job.Name, job.Schedule, len(job.Controls), state.NextRun.Format(time.RFC3339))
+	}
+
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	s.tick(time.Now())
+	for {
+		select {
+		case <-stop:
+			log.Println("Scheduler stopped")
+			return
+		case now := <-ticker.C:
+			s.tick(now)
+		}
+	}
+}
+
+// tick starts the jobs that are due
+func (s *Scheduler) tick(now time.Time) {
+	for _, job := range s.jobs {
+		s.mu.Lock()
+		state := s.state[job.Name]
+		due := !state.NextRun.IsZero() && !now.Before(state.NextRun)
+		if !due {
+			s.mu.Unlock()
+			continue
+		}
+
+		if s.running[job.Name] {
+			s.mu.Unlock()
+			continue
+		}
+
+		// The next run is computed when this one finishes, so activations falling while the job
+		// is queued or running are skipped instead of piling up
+		s.running[job.Name] = true
+		state.NextRun = time.Time{}
+		s.mu.Unlock()
+
+		go s.execute(job)
+	}
+}
+
+// execute runs a job and persists its state
+func (s *Scheduler) execute(job *Job) {
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+
+	start := time.Now()
+	log.Printf("Scheduler: running job %s\n", job.Name)
+	score, err := s.run(*job)
+	finish := time.Now()
+
+	s.mu.Lock()
+	state := s.state[job.Name]
+	state.LastRun = start
+	state.LastScore = nil
+	state.LastError = ""
+	if err != nil {
+		state.LastStatus = "failed"
+		state.LastError = err.Error()
+	} else {
+		state.LastStatus = "completed"
+		state.LastScore = &score
+	}
+
+	// Activations that fell while the job was running are skipped, not recovered
+	state.NextRun = job.schedule.Next(start)
+	if !state.NextRun.IsZero() && state.NextRun.Before(finish) {
+		log.Printf("Scheduler: job %s took %v, skipping the runs missed in the meantime\n", job.Name, finish.Sub(start).Round(time.Second))
+		state.NextRun = job.schedule.Next(finish)
+	}
+	s.running[job.Name] = false
+	next := state.NextRun
+	s.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Scheduler: job %s failed: %v\n", job.Name, err)
+	} else {
+		log.Printf("Scheduler: job %s completed with score %d. Next run at %s\n", job.Name, score, next.Format(time.RFC3339))
+	}
+
+	if err := s.saveState(); err != nil {
+		log.Printf("Scheduler: error saving state: %v\n", err)
+	}
+}
+
+// State returns a copy of the state of a job
+func (s *Scheduler) State(name string) JobState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if state, ok := s.state[name]; ok {
+		return *state
+	}
+	return JobState{}
+}
+
+// loadState reads the last-run times persisted by a previous execution
+func (s *Scheduler) loadState() error {
+	data, err := os.ReadFile(s.stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read scheduler state %s: %v", s.stateFile, err)
+	}
+
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return fmt.Errorf("failed to decode scheduler state %s: %v", s.stateFile, err)
+	}
+	log.Printf("Scheduler state loaded from %s\n", s.stateFile)
+	return nil
+}
+
+// saveState writes the state of all the jobs, replacing the file atomically
+func (s *Scheduler) saveState() error {
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(s.stateFile); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	tmp := s.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.stateFile)
+}
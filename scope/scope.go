@@ -0,0 +1,289 @@
+package scope
+
+import (
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/discovery"
+	"cloud_compliance_checker/models"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// DefaultCategoryTag is the tag holding the CUI category of an asset
+const DefaultCategoryTag = "cui_category"
+
+// Scope decides which assets belong to the CUI enclave
+type Scope struct {
+	cfg      config.CUIScope
+	accounts map[string]bool
+	regions  map[string]bool
+	vpcs     map[string]bool
+	arns     []string
+}
+
+// New creates the scope from the configuration
+func New(cfg config.CUIScope) *Scope {
+	s := &Scope{
+		cfg:      cfg,
+		accounts: toSet(cfg.Accounts),
+		regions:  toSet(cfg.Regions),
+		vpcs:     toSet(cfg.VPCs),
+		arns:     cfg.ARNs,
+	}
+	return s
+}
+
+// Configured reports if a boundary is defined. Without it every asset is in scope.
+func (s *Scope) Configured() bool {
+	return len(s.cfg.Tags) > 0 || len(s.accounts) > 0 || len(s.regions) > 0 || len(s.vpcs) > 0 || len(s.arns) > 0
+}
+
+// Match reports if the asset is in scope, with the reason of the decision
+func (s *Scope) Match(asset models.Asset) (bool, string) {
+	if !s.Configured() {
+		return true, "no CUI scope configured"
+	}
+
+	// Accounts and regions restrict the enclave, the other selectors pick the assets inside it
+	if len(s.accounts) > 0 {
+		if account := arnAccount(asset.ARN); account != "" && !s.accounts[account] {
+			return false, fmt.Sprintf("account %s not in scope", account)
+		}
+	}
+	// Global resources (IAM, CloudFront, S3 namespace) are not bound to a region
+	if len(s.regions) > 0 && asset.Region != models.GlobalRegion && asset.Region != "" && !s.regions[asset.Region] {
+		return false, fmt.Sprintf("region %s not in scope", asset.Region)
+	}
+
+	if len(s.cfg.Tags) == 0 && len(s.vpcs) == 0 && len(s.arns) == 0 {
+		return true, "in scope account and region"
+	}
+
+	for _, pattern := range s.arns {
+		if matchARN(pattern, asset.ARN) {
+			return true, fmt.Sprintf("ARN matches %s", pattern)
+		}
+	}
+	for _, tag := range s.cfg.Tags {
+		value, ok := asset.Tags[tag.Key]
+		if ok && (tag.Value == "" || strings.EqualFold(tag.Value, value)) {
+			return true, fmt.Sprintf("tag %s=%s", tag.Key, value)
+		}
+	}
+	if vpc := VpcID(asset); vpc != "" && s.vpcs[vpc] {
+		return true, fmt.Sprintf("in VPC %s", vpc)
+	}
+	// An asset whose tags could not be read is never excluded because of the missing tags
+	if asset.TagsUnknown && len(s.cfg.Tags) > 0 {
+		return true, "tags could not be read"
+	}
+
+	return false, "no matching CUI tag, VPC or ARN"
+}
+
+// Partition splits the assets in the in-scope ones and the out-of-scope ones
+func (s *Scope) Partition(assets []models.Asset) ([]models.Asset, []models.OutOfScopeAsset) {
+	var in []models.Asset
+	var out []models.OutOfScopeAsset
+	for _, asset := range assets {
+		if ok, reason := s.Match(asset); ok {
+			in = append(in, asset)
+		} else {
+			out = append(out, outOfScope(asset, reason))
+		}
+	}
+	return in, out
+}
+
+// Category returns the CUI category of an in-scope asset, read from the category tag
+func (s *Scope) Category(asset models.Asset) string {
+	tag := s.cfg.CategoryTag
+	if tag == "" {
+		tag = DefaultCategoryTag
+	}
+	if category := asset.Tags[tag]; category != "" {
+		return category
+	}
+	return "CUI"
+}
+
+// AccessUsers returns the users and roles authorized to access the enclave
+func (s *Scope) AccessUsers() []string {
+	return s.cfg.AccessUsers
+}
+
+// VpcID returns the VPC of the asset, empty for the resources outside a VPC
+func VpcID(asset models.Asset) string {
+	switch d := asset.Details.(type) {
+	case models.EC2InstanceDetails:
+		return d.VpcID
+	case models.RDSInstanceDetails:
+		return d.VpcID
+	case models.LambdaFunctionDetails:
+		return d.VpcID
+	case models.VPCDetails:
+		return d.VpcID
+	case models.SubnetDetails:
+		return d.VpcID
+	case models.SecurityGroupDetails:
+		return d.VpcID
+	case models.LoadBalancerDetails:
+		return d.VpcID
+	}
+	return ""
+}
+
+var (
+	mu      sync.Mutex
+	current = New(config.CUIScope{})
+
+	// Index of the discovered assets by type and identifier, rebuilt when the discovery changes
+	indexed []models.Asset
+	index   map[string]models.Asset
+
+	// Assets skipped by the checks since the last Drain
+	excluded     []models.OutOfScopeAsset
+	excludedSeen = make(map[string]bool)
+)
+
+// Setup sets the scope used by the checks
+func Setup(cfg config.CUIScope) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = New(cfg)
+	if current.Configured() {
+		log.Printf("CUI scope: tags %v, accounts %v, regions %v, VPCs %v, ARNs %v\n", cfg.Tags, cfg.Accounts, cfg.Regions, cfg.VPCs, cfg.ARNs)
+	}
+}
+
+// Current returns the scope used by the checks
+func Current() *Scope {
+	mu.Lock()
+	defer mu.Unlock()
+	return current
+}
+
+// Includes reports if the resource of the given type, identified by name, ID or ARN, is in scope.
+// Out-of-scope resources are recorded so that the evaluation can report them with the check.
+// Resources that were not discovered are kept in scope: a check is never skipped because of a discovery failure.
+func Includes(awsCfg aws.Config, assetType, id string) bool {
+	s := Current()
+	if !s.Configured() {
+		return true
+	}
+
+	assets, err := discovery.CachedAssets(awsCfg)
+	if err != nil && len(assets) == 0 {
+		return true
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !sameAssets(indexed, assets) {
+		indexed, index = assets, buildIndex(assets)
+	}
+
+	asset, ok := index[assetType+"|"+id]
+	if !ok {
+		return true
+	}
+	in, reason := s.Match(asset)
+	if !in {
+		log.Printf("%s %s is outside the CUI scope (%s), skipped\n", assetType, id, reason)
+		key := asset.Type + "|" + asset.ARN + "|" + asset.Name
+		if !excludedSeen[key] {
+			excludedSeen[key] = true
+			excluded = append(excluded, outOfScope(asset, reason))
+		}
+	}
+	return in
+}
+
+// Assets returns the discovered assets split in the in-scope and out-of-scope ones
+func Assets(awsCfg aws.Config) ([]models.Asset, []models.OutOfScopeAsset, error) {
+	assets, err := discovery.CachedAssets(awsCfg)
+	in, out := Current().Partition(assets)
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Type != out[j].Type {
+			return out[i].Type < out[j].Type
+		}
+		return out[i].Name < out[j].Name
+	})
+	return in, out, err
+}
+
+// Drain returns the assets skipped by the checks since the previous call
+func Drain() []models.OutOfScopeAsset {
+	mu.Lock()
+	defer mu.Unlock()
+	skipped := excluded
+	excluded = nil
+	excludedSeen = make(map[string]bool)
+	return skipped
+}
+
+// buildIndex indexes the assets by type and by name and ARN
+func buildIndex(assets []models.Asset) map[string]models.Asset {
+	idx := make(map[string]models.Asset, 2*len(assets))
+	for _, asset := range assets {
+		idx[asset.Type+"|"+asset.Name] = asset
+		if asset.ARN != "" {
+			idx[asset.Type+"|"+asset.ARN] = asset
+		}
+	}
+	return idx
+}
+
+// sameAssets checks if two slices are the same discovery result
+func sameAssets(a, b []models.Asset) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	return len(a) == 0 || &a[0] == &b[0]
+}
+
+// outOfScope converts an asset to its out-of-scope record
+func outOfScope(asset models.Asset, reason string) models.OutOfScopeAsset {
+	return models.OutOfScopeAsset{
+		Name:   asset.Name,
+		Type:   asset.Type,
+		ARN:    asset.ARN,
+		Region: asset.Region,
+		Reason: reason,
+	}
+}
+
+// arnAccount returns the account of an ARN, empty for the ARNs without account (S3 buckets)
+func arnAccount(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 {
+		return ""
+	}
+	return parts[4]
+}
+
+// matchARN matches an ARN against a configured ARN, which can end with "*" to match a prefix
+func matchARN(pattern, arn string) bool {
+	if arn == "" {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(arn, prefix)
+	}
+	return pattern == arn
+}
+
+// toSet converts a list to a set, ignoring empty values
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		if v != "" {
+			set[v] = true
+		}
+	}
+	return set
+}
@@ -0,0 +1,83 @@
+package scope
+
+import (
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchWithoutScope(t *testing.T) {
+	s := New(config.CUIScope{})
+
+	in, _ := s.Match(models.Asset{Name: "sandbox", Region: "eu-west-1"})
+	assert.False(t, s.Configured())
+	assert.True(t, in)
+}
+
+func TestMatchSelectors(t *testing.T) {
+	s := New(config.CUIScope{
+		Tags: []config.ScopeTag{{Key: "cui", Value: "true"}, {Key: "enclave"}},
+		VPCs: []string{"vpc-cui"},
+		ARNs: []string{"arn:aws:s3:::cui-*"},
+	})
+
+	tests := []struct {
+		name  string
+		asset models.Asset
+		in    bool
+	}{
+		{"tag value", models.Asset{Tags: map[string]string{"cui": "TRUE"}}, true},
+		{"tag value mismatch", models.Asset{Tags: map[string]string{"cui": "false"}}, false},
+		{"tag key only", models.Asset{Tags: map[string]string{"enclave": "a"}}, true},
+		{"vpc", models.Asset{Details: models.EC2InstanceDetails{VpcID: "vpc-cui"}}, true},
+		{"other vpc", models.Asset{Details: models.EC2InstanceDetails{VpcID: "vpc-sandbox"}}, false},
+		{"arn prefix", models.Asset{ARN: "arn:aws:s3:::cui-documents"}, true},
+		{"no match", models.Asset{ARN: "arn:aws:s3:::sandbox"}, false},
+		{"unreadable tags", models.Asset{ARN: "arn:aws:s3:::sandbox", TagsUnknown: true}, true},
+	}
+	for _, tt := range tests {
+		in, reason := s.Match(tt.asset)
+		assert.Equal(t, tt.in, in, "%s: %s", tt.name, reason)
+	}
+}
+
+func TestMatchAccountsAndRegions(t *testing.T) {
+	s := New(config.CUIScope{
+		Accounts: []string{"111111111111"},
+		Regions:  []string{"us-east-1"},
+	})
+
+	in, _ := s.Match(models.Asset{ARN: "arn:aws:ec2:us-east-1:111111111111:instance/i-1", Region: "us-east-1"})
+	assert.True(t, in)
+
+	in, _ = s.Match(models.Asset{ARN: "arn:aws:ec2:us-east-1:222222222222:instance/i-2", Region: "us-east-1"})
+	assert.False(t, in)
+
+	in, _ = s.Match(models.Asset{ARN: "arn:aws:ec2:eu-west-1:111111111111:instance/i-3", Region: "eu-west-1"})
+	assert.False(t, in)
+
+	// Unreadable tags do not bring an asset of another region in scope
+	in, _ = s.Match(models.Asset{ARN: "arn:aws:ec2:eu-west-1:111111111111:instance/i-4", Region: "eu-west-1", TagsUnknown: true})
+	assert.False(t, in)
+
+	// Global resources are not bound to the regions
+	in, _ = s.Match(models.Asset{ARN: "arn:aws:iam::111111111111:user/alice", Region: models.GlobalRegion})
+	assert.True(t, in)
+}
+
+func TestPartition(t *testing.T) {
+	s := New(config.CUIScope{Tags: []config.ScopeTag{{Key: "cui", Value: "true"}}})
+	assets := []models.Asset{
+		{Name: "cui", Type: models.AssetTypeS3Bucket, Tags: map[string]string{"cui": "true", "cui_category": "CTI"}},
+		{Name: "sandbox", Type: models.AssetTypeS3Bucket},
+	}
+
+	in, out := s.Partition(assets)
+	assert.Len(t, in, 1)
+	assert.Equal(t, "CTI", s.Category(in[0]))
+	assert.Len(t, out, 1)
+	assert.Equal(t, "sandbox", out[0].Name)
+	assert.NotEmpty(t, out[0].Reason)
+}
@@ -0,0 +1,469 @@
+package server
+
+import (
+	"cloud_compliance_checker/evaluation"
+	"cloud_compliance_checker/metrics"
+	"cloud_compliance_checker/models"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Scan status values
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+const (
+	scanFileName   = "scan.json"
+	reportFileName = "report.json"
+)
+
+// Timeouts of the HTTP servers. Scans run in the background, so no request waits for one.
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = 2 * time.Minute
+	idleTimeout       = 2 * time.Minute
+)
+
+// Scan represents an on-demand compliance scan started through the API
+type Scan struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Controls   []string   `json:"controls,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Score      *int       `json:"score,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// ScanRequest is the body accepted by POST /api/scans
+type ScanRequest struct {
+	Controls []string `json:"controls"`
+}
+
+// Server exposes the compliance checker through a REST API.
+// Scans are executed one at a time because the checks share the global configuration
+// and write their artifacts in the working directory.
+type Server struct {
+	controls models.NISTControls
+	awsCfg   aws.Config
+	dataDir  string
+	token    string
+	metrics  *metrics.Exporter
+	// evaluate runs the checks of a scan, evaluation.RunEvaluation outside the tests
+	evaluate func(controls models.NISTControls, cfg aws.Config, outputDir string) (models.Report, error)
+
+	mu    sync.Mutex
+	scans map[string]*Scan
+	queue chan *Scan
+}
+
+// NewServer creates a new Server and loads the past scans stored in dataDir.
+// Every request must carry token as a bearer token.
+func NewServer(controls models.NISTControls, awsCfg aws.Config, dataDir, token string) (*Server, error) {
+	if token == "" {
+		return nil, fmt.Errorf("an API token is required")
+	}
+	s := &Server{
+		controls: controls,
+		awsCfg:   awsCfg,
+		dataDir:  dataDir,
+		token:    token,
+		metrics:  metrics.NewExporter(),
+		evaluate: evaluation.RunEvaluation,
+		scans:    make(map[string]*Scan),
+		queue:    make(chan *Scan, 100),
+	}
+
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory %s: %v", dataDir, err)
+	}
+
+	if err := s.loadScans(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ListenAndServe starts the scan worker and serves the API on addr
+func (s *Server) ListenAndServe(addr string) error {
+	go s.worker()
+
+	log.Printf("API server listening on %s\n", addr)
+	return NewHTTPServer(addr, s.Handler()).ListenAndServe()
+}
+
+// NewHTTPServer returns an HTTP server with timeouts, so that slow or idle clients can't hold connections open
+func NewHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+}
+
+// Handler returns the HTTP handler with all the API routes
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.Handle("/metrics", s.metrics)
+	mux.HandleFunc("/api/controls", s.handleControls)
+	mux.HandleFunc("/api/scans", s.handleScans)
+	mux.HandleFunc("/api/scans/", s.handleScan)
+	return RequireToken(s.token, mux)
+}
+
+// RequireToken rejects the requests without the bearer token
+func RequireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleHealth reports that the server is up
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleControls lists the control catalog
+// GET /api/controls
+func (s *Server) handleControls(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.controls.Controls)
+}
+
+// handleScans lists the past scans or starts a new one
+// GET  /api/scans
+// POST /api/scans {"controls": ["03.01.01", "03.05.03"]}
+func (s *Server) handleScans(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.listScans())
+
+	case http.MethodPost:
+		// An empty body starts a scan of the whole catalog
+		var req ScanRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+
+		if _, err := evaluation.FilterControls(s.controls, req.Controls); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		scan, err := s.enqueue(req.Controls)
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusAccepted, scan)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleScan returns the status, the JSON results or the PDF report of a scan
+// GET /api/scans/{id}
+// GET /api/scans/{id}/results[?format=json|pdf]
+// GET /api/scans/{id}/report.pdf
+func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/scans/"), "/"), "/")
+	scan, ok := s.getScan(parts[0])
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("scan %s not found", parts[0]))
+		return
+	}
+
+	if len(parts) == 1 {
+		writeJSON(w, http.StatusOK, scan)
+		return
+	}
+
+	if len(parts) != 2 || (parts[1] != "results" && parts[1] != "report.pdf") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if scan.Status != StatusCompleted {
+		writeError(w, http.StatusConflict, fmt.Sprintf("scan %s is %s", scan.ID, scan.Status))
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if parts[1] == "report.pdf" {
+		format = "pdf"
+	}
+
+	switch format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		http.ServeFile(w, r, filepath.Join(s.dataDir, scan.ID, reportFileName))
+	case "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		http.ServeFile(w, r, filepath.Join(s.dataDir, scan.ID, evaluation.ReportFileName))
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported format %s", format))
+	}
+}
+
+// enqueue registers a new scan and schedules it for execution
+func (s *Server) enqueue(controls []string) (Scan, error) {
+	id, err := newScanID()
+	if err != nil {
+		return Scan{}, err
+	}
+
+	scan := &Scan{
+		ID:        id,
+		Status:    StatusQueued,
+		Controls:  controls,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	s.mu.Lock()
+	s.scans[id] = scan
+	snapshot := *scan
+	s.mu.Unlock()
+
+	if err := s.saveScan(snapshot); err != nil {
+		log.Printf("Error saving scan %s: %v\n", id, err)
+	}
+
+	select {
+	case s.queue <- scan:
+	default:
+		s.finish(scan, nil, fmt.Errorf("scan queue is full"))
+		return Scan{}, fmt.Errorf("scan queue is full, retry later")
+	}
+
+	log.Printf("Scan %s queued (controls: %v)\n", id, controls)
+	return snapshot, nil
+}
+
+// worker runs the queued scans sequentially
+func (s *Server) worker() {
+	for scan := range s.queue {
+		s.run(scan)
+	}
+}
+
+// run executes a single scan and stores its artifacts
+func (s *Server) run(scan *Scan) {
+	s.mu.Lock()
+	now := time.Now().UTC()
+	scan.Status = StatusRunning
+	scan.StartedAt = &now
+	snapshot := *scan
+	s.mu.Unlock()
+
+	if err := s.saveScan(snapshot); err != nil {
+		log.Printf("Error saving scan %s: %v\n", scan.ID, err)
+	}
+	log.Printf("Scan %s started\n", scan.ID)
+
+	controls, err := evaluation.FilterControls(s.controls, scan.Controls)
+	if err != nil {
+		s.finish(scan, nil, err)
+		return
+	}
+
+	report, err := s.evaluate(controls, s.awsCfg, filepath.Join(s.dataDir, scan.ID))
+	s.finish(scan, &report, err)
+}
+
+// finish records the outcome of a scan
+func (s *Server) finish(scan *Scan, report *models.Report, err error) {
+	if report != nil {
+		if saveErr := writeJSONFile(filepath.Join(s.dataDir, scan.ID, reportFileName), report); saveErr != nil && err == nil {
+			err = saveErr
+		}
+	}
+
+	s.mu.Lock()
+	now := time.Now().UTC()
+	scan.FinishedAt = &now
+	if err != nil {
+		scan.Status = StatusFailed
+		scan.Error = err.Error()
+	} else {
+		scan.Status = StatusCompleted
+		scan.Score = &report.Score
+	}
+	snapshot := *scan
+	s.mu.Unlock()
+
+	var duration time.Duration
+	if snapshot.StartedAt != nil {
+		duration = now.Sub(*snapshot.StartedAt)
+	}
+	s.metrics.Observe(report, duration, len(snapshot.Controls) == 0, err)
+
+	if saveErr := s.saveScan(snapshot); saveErr != nil {
+		log.Printf("Error saving scan %s: %v\n", scan.ID, saveErr)
+	}
+	log.Printf("Scan %s %s\n", scan.ID, snapshot.Status)
+}
+
+// getScan returns a copy of the scan with the given ID
+func (s *Server) getScan(id string) (Scan, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scan, ok := s.scans[id]
+	if !ok {
+		return Scan{}, false
+	}
+	return *scan, true
+}
+
+// listScans returns all the scans, most recent first
+func (s *Server) listScans() []Scan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scans := make([]Scan, 0, len(s.scans))
+	for _, scan := range s.scans {
+		scans = append(scans, *scan)
+	}
+	sort.Slice(scans, func(i, j int) bool {
+		return scans[i].CreatedAt.After(scans[j].CreatedAt)
+	})
+	return scans
+}
+
+// loadScans reads the scans persisted in the data directory.
+// Scans that were still queued or running when the server stopped are marked as failed.
+func (s *Server) loadScans() error {
+	entries, err := os.ReadDir(s.dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to read data directory %s: %v", s.dataDir, err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.dataDir, entry.Name(), scanFileName))
+		if err != nil {
+			continue
+		}
+
+		var scan Scan
+		if err := json.Unmarshal(data, &scan); err != nil {
+			log.Printf("Skipping scan %s: %v\n", entry.Name(), err)
+			continue
+		}
+
+		if scan.Status == StatusQueued || scan.Status == StatusRunning {
+			scan.Status = StatusFailed
+			scan.Error = "interrupted by server restart"
+			if err := s.saveScan(scan); err != nil {
+				log.Printf("Error saving scan %s: %v\n", scan.ID, err)
+			}
+		}
+		s.scans[scan.ID] = &scan
+
+		if scan.Status == StatusCompleted && scan.FinishedAt != nil {
+			s.restoreMetrics(scan)
+		}
+	}
+
+	log.Printf("Loaded %d past scan(s) from %s\n", len(s.scans), s.dataDir)
+	return nil
+}
+
+// restoreMetrics publishes the results of a scan completed before the server started
+func (s *Server) restoreMetrics(scan Scan) {
+	data, err := os.ReadFile(filepath.Join(s.dataDir, scan.ID, reportFileName))
+	if err != nil {
+		return
+	}
+
+	var report models.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		log.Printf("Skipping report of scan %s: %v\n", scan.ID, err)
+		return
+	}
+	s.metrics.Restore(&report, *scan.FinishedAt, len(scan.Controls) == 0)
+}
+
+// saveScan persists the scan metadata
+func (s *Server) saveScan(scan Scan) error {
+	dir := filepath.Join(s.dataDir, scan.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(dir, scanFileName), scan)
+}
+
+// newScanID generates a sortable and unique scan identifier
+func newScanID() (string, error) {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to generate scan ID: %v", err)
+	}
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(suffix), nil
+}
+
+// writeJSONFile writes v as indented JSON into fileName
+func writeJSONFile(fileName string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, data, 0644)
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding response: %v\n", err)
+	}
+}
+
+// writeError writes an error as a JSON response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
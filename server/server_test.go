@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud_compliance_checker/models"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireToken(t *testing.T) {
+	_, err := NewServer(models.NISTControls{}, aws.Config{}, t.TempDir(), "")
+	assert.Error(t, err)
+
+	s, err := NewServer(models.NISTControls{}, aws.Config{}, t.TempDir(), "s3cret")
+	assert.NoError(t, err)
+	handler := s.Handler()
+
+	for _, path := range []string{"/healthz", "/metrics", "/api/controls", "/api/scans", "/api/scans/x"} {
+		for _, authorization := range []string{"", "Bearer wrong", "s3cret", "Basic s3cret"} {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			if authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusUnauthorized, rec.Code, "%s with %q", path, authorization)
+			assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+// call sends an authenticated request to the handler
+func call(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestScanLifecycle(t *testing.T) {
+	controls := models.NISTControls{Controls: []models.Control{{ID: "03.01.01"}, {ID: "03.05.03"}}}
+	s, err := NewServer(controls, aws.Config{}, t.TempDir(), "s3cret")
+	assert.NoError(t, err)
+
+	release := make(chan struct{})
+	s.evaluate = func(controls models.NISTControls, cfg aws.Config, outputDir string) (models.Report, error) {
+		<-release
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return models.Report{}, err
+		}
+		return models.Report{Score: 80, TotalControls: len(controls.Controls)}, nil
+	}
+	go s.worker()
+	handler := s.Handler()
+
+	// Unknown controls are rejected
+	assert.Equal(t, http.StatusBadRequest, call(handler, http.MethodPost, "/api/scans", `{"controls":["99.99.99"]}`).Code)
+
+	// Start
+	rec := call(handler, http.MethodPost, "/api/scans", `{"controls":["03.05.03"]}`)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	var scan Scan
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &scan))
+	assert.Equal(t, StatusQueued, scan.Status)
+	assert.Equal(t, []string{"03.05.03"}, scan.Controls)
+
+	// Results are not available until the scan completes
+	assert.Equal(t, http.StatusConflict, call(handler, http.MethodGet, "/api/scans/"+scan.ID+"/results", "").Code)
+	close(release)
+
+	// Status
+	assert.Eventually(t, func() bool {
+		rec := call(handler, http.MethodGet, "/api/scans/"+scan.ID, "")
+		return json.Unmarshal(rec.Body.Bytes(), &scan) == nil && scan.Status == StatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	if assert.NotNil(t, scan.Score) {
+		assert.Equal(t, 80, *scan.Score)
+	}
+	assert.FileExists(t, filepath.Join(s.dataDir, scan.ID, scanFileName))
+
+	// Result
+	rec = call(handler, http.MethodGet, "/api/scans/"+scan.ID+"/results", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var report models.Report
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, 80, report.Score)
+	assert.Equal(t, 1, report.TotalControls)
+
+	// The scan is listed and survives a restart
+	rec = call(handler, http.MethodGet, "/api/scans", "")
+	assert.Contains(t, rec.Body.String(), scan.ID)
+	restarted, err := NewServer(controls, aws.Config{}, s.dataDir, "s3cret")
+	assert.NoError(t, err)
+	loaded, ok := restarted.getScan(scan.ID)
+	assert.True(t, ok)
+	assert.Equal(t, StatusCompleted, loaded.Status)
+
+	assert.Equal(t, http.StatusNotFound, call(handler, http.MethodGet, "/api/scans/missing", "").Code)
+}
+
+func TestNewHTTPServer(t *testing.T) {
+	srv := NewHTTPServer("127.0.0.1:0", http.NotFoundHandler())
+	assert.NotZero(t, srv.ReadHeaderTimeout)
+	assert.NotZero(t, srv.ReadTimeout)
+	assert.NotZero(t, srv.WriteTimeout)
+	assert.NotZero(t, srv.IdleTimeout)
+}
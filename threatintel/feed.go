@@ -0,0 +1,342 @@
+// Package threatintel reads threat-intel feeds of IP addresses, networks and domains, such as the indicators
+// shared by an ISAC, and matches them against the audit sources: the source IPs of the CloudTrail events,
+// the destinations of the VPC Flow Logs and the names and answers of the Route 53 resolver query logs.
+package threatintel
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Formats of the feeds
+const (
+	FormatSTIX  = "stix"
+	FormatCSV   = "csv"
+	FormatPlain = "plain"
+)
+
+// Types of the indicators
+const (
+	TypeIP      = "ip"
+	TypeNetwork = "network"
+	TypeDomain  = "domain"
+)
+
+// Indicator is an IP address, a network or a domain of a feed
+type Indicator struct {
+	Value       string
+	Type        string
+	Feed        string
+	Description string
+}
+
+func (i Indicator) String() string {
+	if i.Description == "" {
+		return fmt.Sprintf("%s (%s)", i.Value, i.Feed)
+	}
+	return fmt.Sprintf("%s (%s: %s)", i.Value, i.Feed, i.Description)
+}
+
+// Set is the indicators of the feeds
+type Set struct {
+	addrs    map[netip.Addr]Indicator
+	networks map[int]map[netip.Prefix]Indicator // by prefix length
+	domains  map[string]Indicator
+}
+
+// NewSet returns an empty set
+func NewSet() *Set {
+	return &Set{addrs: map[netip.Addr]Indicator{}, networks: map[int]map[netip.Prefix]Indicator{}, domains: map[string]Indicator{}}
+}
+
+// Len returns the number of indicators
+func (s *Set) Len() int {
+	n := len(s.addrs) + len(s.domains)
+	for _, networks := range s.networks {
+		n += len(networks)
+	}
+	return n
+}
+
+// Add adds an indicator: an IP address, a network in CIDR notation, a domain or a URL, whose host is added.
+// Defanged values such as 203.0.113[.]9 and hxxp://example[.]com are accepted. It returns false for values
+// that are none of them.
+func (s *Set) Add(value, feed, description string) bool {
+	value = strings.TrimSpace(value)
+	value = strings.NewReplacer("[.]", ".", "(.)", ".", "[:]", ":", "hxxp", "http").Replace(value)
+	if strings.Contains(value, "://") {
+		parsed, err := url.Parse(value)
+		if err != nil || parsed.Hostname() == "" {
+			return false
+		}
+		value = parsed.Hostname()
+	}
+
+	indicator := Indicator{Value: value, Feed: feed, Description: description}
+	if addr, err := netip.ParseAddr(value); err == nil {
+		indicator.Type = TypeIP
+		s.addrs[addr.Unmap()] = indicator
+		return true
+	}
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		prefix = prefix.Masked()
+		indicator.Type, indicator.Value = TypeNetwork, prefix.String()
+		if s.networks[prefix.Bits()] == nil {
+			s.networks[prefix.Bits()] = map[netip.Prefix]Indicator{}
+		}
+		s.networks[prefix.Bits()][prefix] = indicator
+		return true
+	}
+	domain := normalizeDomain(strings.TrimPrefix(value, "*."))
+	if !validDomain(domain) {
+		return false
+	}
+	indicator.Type, indicator.Value = TypeDomain, domain
+	s.domains[domain] = indicator
+	return true
+}
+
+// normalizeDomain returns a domain in lower case without the final dot
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// validDomain checks that a value is a domain name with at least two labels and a top-level domain that
+// is not a number, as in the malformed addresses
+func validDomain(domain string) bool {
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.Contains(domain, "..") {
+		return false
+	}
+	if strings.Trim(domain[strings.LastIndexByte(domain, '.')+1:], "0123456789") == "" {
+		return false
+	}
+	for _, c := range domain {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '.' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchIP returns the indicator of an address or of a network including it
+func (s *Set) MatchIP(ip string) (Indicator, bool) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return Indicator{}, false
+	}
+	addr = addr.Unmap()
+	if indicator, ok := s.addrs[addr]; ok {
+		return indicator, true
+	}
+	for bits, networks := range s.networks {
+		if bits > addr.BitLen() {
+			continue
+		}
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if indicator, ok := networks[prefix]; ok {
+			return indicator, true
+		}
+	}
+	return Indicator{}, false
+}
+
+// MatchDomain returns the indicator of a domain or of one of its parent domains
+func (s *Set) MatchDomain(name string) (Indicator, bool) {
+	domain := normalizeDomain(name)
+	for domain != "" {
+		if indicator, ok := s.domains[domain]; ok {
+			return indicator, true
+		}
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			break
+		}
+		domain = domain[i+1:]
+	}
+	return Indicator{}, false
+}
+
+// FormatOf returns the format of a feed: the configured one, otherwise the one of the extension of its
+// file or URL
+func FormatOf(format, location string) string {
+	if format != "" {
+		return strings.ToLower(format)
+	}
+	if parsed, err := url.Parse(location); err == nil && parsed.Scheme != "" {
+		location = parsed.Path
+	}
+	switch strings.ToLower(path.Ext(location)) {
+	case ".json", ".stix":
+		return FormatSTIX
+	case ".csv":
+		return FormatCSV
+	}
+	return FormatPlain
+}
+
+// Read adds the indicators of a feed in the given format and returns how many were added
+func (s *Set) Read(r io.Reader, format, feed string) (int, error) {
+	switch format {
+	case FormatSTIX:
+		return s.readSTIX(r, feed)
+	case FormatCSV:
+		return s.readCSV(r, feed)
+	case FormatPlain:
+		return s.readPlain(r, feed)
+	}
+	return 0, fmt.Errorf("unknown feed format %q", format)
+}
+
+// readPlain reads one indicator per line. Text after # and after the first space or comma is ignored.
+func (s *Set) readPlain(r io.Reader, feed string) (int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.FieldsFunc(line, func(c rune) bool { return c == ' ' || c == '\t' || c == ',' || c == ';' || c == '\r' })
+		if len(fields) > 0 && s.Add(fields[0], feed, "") {
+			added++
+		}
+	}
+	return added, nil
+}
+
+// indicatorColumns and descriptionColumns are the accepted names of the columns of a CSV feed
+var (
+	indicatorColumns   = []string{"indicator", "value", "ioc", "observable", "ip", "ip_address", "ipaddress", "network", "cidr", "domain", "hostname", "url"}
+	descriptionColumns = []string{"description", "comment", "threat", "threat_type", "malware", "tags", "category"}
+)
+
+// readCSV reads the indicator column of a CSV feed, and the description column if any. Without a known
+// header the indicators are the first column of every row.
+func (s *Set) readCSV(r io.Reader, feed string) (int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	indicator, description := -1, -1
+	for i, column := range records[0] {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if indicator < 0 && contains(indicatorColumns, column) {
+			indicator = i
+		}
+		if description < 0 && contains(descriptionColumns, column) {
+			description = i
+		}
+	}
+	if indicator < 0 {
+		indicator = 0
+	} else {
+		records = records[1:]
+	}
+
+	added := 0
+	for _, record := range records {
+		if indicator >= len(record) {
+			continue
+		}
+		text := ""
+		if description >= 0 && description < len(record) {
+			text = strings.TrimSpace(record[description])
+		}
+		if s.Add(record[indicator], feed, text) {
+			added++
+		}
+	}
+	return added, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// stixComparison is a comparison of an indicator pattern on an address, a domain or a URL
+var stixComparison = regexp.MustCompile(`(ipv4-addr|ipv6-addr|domain-name|url):value\s*(?:=|ISSUBSET)\s*'((?:[^'\\]|\\.)*)'`)
+
+// stixObject is an object of a STIX 2 bundle
+type stixObject struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Pattern     string `json:"pattern"`
+	PatternType string `json:"pattern_type"`
+	Value       string `json:"value"`
+	Revoked     bool   `json:"revoked"`
+	ValidUntil  string `json:"valid_until"`
+}
+
+// readSTIX reads the indicators of a STIX 2 bundle, or of a list of its objects: the addresses, domains and
+// URLs compared in the patterns of the indicators, and the address, domain and URL objects. Revoked and
+// expired indicators are skipped.
+func (s *Set) readSTIX(r io.Reader, feed string) (int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	var objects []stixObject
+	var bundle struct {
+		Objects []stixObject `json:"objects"`
+	}
+	if err := json.Unmarshal(data, &bundle); err == nil {
+		objects = bundle.Objects
+	} else if err := json.Unmarshal(data, &objects); err != nil {
+		return 0, fmt.Errorf("invalid STIX bundle: %v", err)
+	}
+
+	now := time.Now()
+	added := 0
+	for _, object := range objects {
+		switch object.Type {
+		case "indicator":
+			if object.Revoked || (object.PatternType != "" && object.PatternType != "stix") {
+				continue
+			}
+			if until, err := time.Parse(time.RFC3339, object.ValidUntil); err == nil && until.Before(now) {
+				continue
+			}
+			description := object.Name
+			if description == "" {
+				description = object.Description
+			}
+			for _, match := range stixComparison.FindAllStringSubmatch(object.Pattern, -1) {
+				if s.Add(strings.ReplaceAll(match[2], `\'`, "'"), feed, description) {
+					added++
+				}
+			}
+		case "ipv4-addr", "ipv6-addr", "domain-name", "url":
+			if s.Add(object.Value, feed, "") {
+				added++
+			}
+		}
+	}
+	return added, nil
+}
@@ -0,0 +1,161 @@
+package threatintel
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud_compliance_checker/flowlogs"
+	"cloud_compliance_checker/trailstore"
+)
+
+// Sources of the findings
+const (
+	SourceCloudTrail = "cloudtrail"
+	SourceFlowLogs   = "flowlogs"
+	SourceResolver   = "resolver"
+)
+
+// Finding is an address or a domain of an audit source that matches an indicator. The same observation
+// repeated is a single finding with its count.
+type Finding struct {
+	Source    string
+	Time      time.Time // of the first observation
+	Observed  string    // the address or the domain that matched
+	Indicator Indicator
+	Detail    string // what was observed, such as the event and the user
+	Count     int
+}
+
+func (f Finding) String() string {
+	text := fmt.Sprintf("%s %s %s matches %s: %s", f.Time.UTC().Format(time.RFC3339), f.Source, f.Observed, f.Indicator, f.Detail)
+	if f.Count > 1 {
+		text += fmt.Sprintf(" (%d times)", f.Count)
+	}
+	return text
+}
+
+// findings aggregates the repeated observations
+type findings struct {
+	index map[string]int
+	list  []Finding
+}
+
+// add records an observation
+func (fs *findings) add(source string, at time.Time, observed string, indicator Indicator, detail string) {
+	key := source + "\x00" + observed + "\x00" + detail
+	if fs.index == nil {
+		fs.index = map[string]int{}
+	}
+	if i, ok := fs.index[key]; ok {
+		fs.list[i].Count++
+		if at.Before(fs.list[i].Time) {
+			fs.list[i].Time = at
+		}
+		return
+	}
+	fs.index[key] = len(fs.list)
+	fs.list = append(fs.list, Finding{Source: source, Time: at, Observed: observed, Indicator: indicator, Detail: detail, Count: 1})
+}
+
+// sorted returns the findings by time
+func (fs *findings) sorted() []Finding {
+	sort.SliceStable(fs.list, func(i, j int) bool { return fs.list[i].Time.Before(fs.list[j].Time) })
+	return fs.list
+}
+
+// MatchEvents matches the source IPs of the CloudTrail events
+func MatchEvents(set *Set, events []trailstore.Event) []Finding {
+	var fs findings
+	for _, e := range events {
+		if indicator, ok := set.MatchIP(e.SourceIP); ok {
+			fs.add(SourceCloudTrail, e.EventTime, e.SourceIP, indicator, fmt.Sprintf("%s by %s in %s", e.EventName, e.User(), e.Region))
+		}
+	}
+	return fs.sorted()
+}
+
+// MatchFlows matches the destinations of the VPC Flow Log records
+func MatchFlows(set *Set, records []flowlogs.Record) []Finding {
+	var fs findings
+	for _, r := range records {
+		if !r.Dest.IsValid() {
+			continue
+		}
+		dest := r.Dest.String()
+		if indicator, ok := set.MatchIP(dest); ok {
+			fs.add(SourceFlowLogs, r.Start, dest, indicator, fmt.Sprintf("%s traffic from %s to port %d on %s", r.Action, r.Source, r.DstPort, r.Interface))
+		}
+	}
+	return fs.sorted()
+}
+
+// Query is a record of the Route 53 resolver query logs
+type Query struct {
+	Time      time.Time `json:"query_timestamp"`
+	Name      string    `json:"query_name"`
+	Type      string    `json:"query_type"`
+	Rcode     string    `json:"rcode"`
+	SourceIP  string    `json:"srcaddr"`
+	VpcID     string    `json:"vpc_id"`
+	SourceIDs struct {
+		Instance string `json:"instance"`
+	} `json:"srcids"`
+	Answers []struct {
+		Rdata string `json:"Rdata"`
+		Type  string `json:"Type"`
+	} `json:"answers"`
+}
+
+// ParseQuery parses a JSON record of the resolver query logs
+func ParseQuery(line string) (Query, error) {
+	var q Query
+	if err := json.Unmarshal([]byte(line), &q); err != nil {
+		return Query{}, fmt.Errorf("invalid resolver query log record: %v", err)
+	}
+	if q.Name == "" {
+		return Query{}, fmt.Errorf("invalid resolver query log record: no query_name")
+	}
+	return q, nil
+}
+
+// MatchQueries matches the names of the resolver queries and the addresses of their answers
+func MatchQueries(set *Set, queries []Query) []Finding {
+	var fs findings
+	for _, q := range queries {
+		source := q.SourceIP
+		if q.SourceIDs.Instance != "" {
+			source = q.SourceIDs.Instance + " (" + q.SourceIP + ")"
+		}
+		name := normalizeDomain(q.Name)
+		if indicator, ok := set.MatchDomain(name); ok {
+			fs.add(SourceResolver, q.Time, name, indicator, fmt.Sprintf("%s query from %s in %s, %s", q.Type, source, q.VpcID, q.Rcode))
+		}
+		for _, answer := range q.Answers {
+			if answer.Type != "A" && answer.Type != "AAAA" {
+				continue
+			}
+			if indicator, ok := set.MatchIP(answer.Rdata); ok {
+				fs.add(SourceResolver, q.Time, answer.Rdata, indicator, fmt.Sprintf("answer of %s queried from %s in %s", name, source, q.VpcID))
+			}
+		}
+	}
+	return fs.sorted()
+}
+
+// Summary returns the number of findings of each source, such as "cloudtrail 2, resolver 1"
+func Summary(found []Finding) string {
+	counts := map[string]int{}
+	for _, f := range found {
+		counts[f.Source]++
+	}
+	var parts []string
+	for _, source := range []string{SourceCloudTrail, SourceFlowLogs, SourceResolver} {
+		if counts[source] > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", source, counts[source]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
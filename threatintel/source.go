@@ -0,0 +1,316 @@
+package threatintel
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/flowlogs"
+	"cloud_compliance_checker/trailstore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+)
+
+// Defaults of the matching
+const (
+	defaultCacheDir     = "threat_intel"
+	defaultRefreshHours = 24
+	defaultHours        = 24
+	maxQueries          = 100000 // per log group
+)
+
+var httpClient = &http.Client{Timeout: 60 * time.Second}
+
+// feedName returns the name of a feed, default the base name of its file or URL
+func feedName(feed config.ThreatIntelFeed) string {
+	if feed.Name != "" {
+		return feed.Name
+	}
+	if feed.Path != "" {
+		return filepath.Base(feed.Path)
+	}
+	return path.Base(feed.URL)
+}
+
+// Load reads the indicators of the feeds, downloading the URL feeds whose copy in cache_dir is older than
+// refresh_hours. A feed that can't be downloaded uses its previous copy. Feeds that fail are skipped and
+// reported in the error.
+func Load(intelCfg config.ThreatIntelConfig) (*Set, error) {
+	set := NewSet()
+	var errs []error
+	for _, feed := range intelCfg.Feeds {
+		name := feedName(feed)
+		location := feed.Path
+		if feed.URL != "" {
+			var err error
+			location, err = refresh(feed, name, intelCfg)
+			if err != nil {
+				if location == "" {
+					errs = append(errs, err)
+					continue
+				}
+				log.Printf("Using the previous copy of feed %s: %v\n", name, err)
+			}
+		}
+		if location == "" {
+			errs = append(errs, fmt.Errorf("feed %s has neither a path nor a url", name))
+			continue
+		}
+
+		file, err := os.Open(location)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to open feed %s: %v", name, err))
+			continue
+		}
+		added, err := set.Read(file, FormatOf(feed.Format, location), name)
+		file.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read feed %s: %v", name, err))
+			continue
+		}
+		log.Printf("Loaded %d indicators of feed %s\n", added, name)
+	}
+	return set, errors.Join(errs...)
+}
+
+// refresh downloads a URL feed when its copy is missing or older than refresh_hours and returns the path of
+// the copy. On a failed download the path of the previous copy, if any, is returned with the error.
+func refresh(feed config.ThreatIntelFeed, name string, intelCfg config.ThreatIntelConfig) (string, error) {
+	dir := intelCfg.CacheDir
+	if dir == "" {
+		dir = defaultCacheDir
+	}
+	refreshHours := intelCfg.RefreshHours
+	if refreshHours <= 0 {
+		refreshHours = defaultRefreshHours
+	}
+	// The copy keeps the extension of the URL, so that the format is detected the same way
+	copyPath := filepath.Join(dir, strings.Map(func(c rune) rune {
+		if c == '/' || c == '\\' || c == ':' {
+			return '_'
+		}
+		return c
+	}, name)+path.Ext(strings.SplitN(feed.URL, "?", 2)[0]))
+
+	info, statErr := os.Stat(copyPath)
+	if statErr == nil && time.Since(info.ModTime()) < time.Duration(refreshHours)*time.Hour {
+		return copyPath, nil
+	}
+	previous := ""
+	if statErr == nil {
+		previous = copyPath
+	}
+
+	if err := download(feed.URL, copyPath); err != nil {
+		return previous, fmt.Errorf("failed to download feed %s: %v", name, err)
+	}
+	log.Printf("Downloaded feed %s from %s\n", name, feed.URL)
+	return copyPath, nil
+}
+
+// download writes the body of a URL to a file, replacing it only when the download is complete
+func download(url, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	tmp := dest + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// cacheTTL is how long the indicators are reused by the checks of the same evaluation
+const cacheTTL = 10 * time.Minute
+
+var (
+	setMu     sync.Mutex
+	cachedSet *Set
+	cachedErr error
+	setAt     time.Time
+)
+
+// Cached returns the indicators loaded in the last cacheTTL, or loads them
+func Cached() (*Set, error) {
+	setMu.Lock()
+	defer setMu.Unlock()
+
+	if !setAt.IsZero() && time.Since(setAt) < cacheTTL {
+		return cachedSet, cachedErr
+	}
+	cachedSet, cachedErr = Load(config.AppConfig.AWS.ThreatIntel)
+	setAt = time.Now()
+	return cachedSet, cachedErr
+}
+
+// ReadQueryFile reads a local export of the resolver query logs, one JSON record per line, plain text or gzip
+func ReadQueryFile(path string) ([]Query, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var input io.Reader = reader
+	if magic, err := reader.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		defer gz.Close()
+		input = gz
+	}
+
+	var queries []Query
+	invalid := 0
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		q, err := ParseQuery(line)
+		if err != nil {
+			invalid++
+			continue
+		}
+		queries = append(queries, q)
+	}
+	if err := scanner.Err(); err != nil {
+		return queries, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if invalid > 0 {
+		log.Printf("Skipped %d invalid resolver query log records in %s\n", invalid, path)
+	}
+	return queries, nil
+}
+
+// readQueryLogGroup reads up to maxQueries resolver queries of a log group since the given time. The queries
+// read are returned with an error when the log group has more.
+func readQueryLogGroup(cfg aws.Config, group string, since time.Time) ([]Query, error) {
+	var queries []Query
+	paginator := cloudwatchlogs.NewFilterLogEventsPaginator(cloudwatchlogs.NewFromConfig(cfg), &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName: aws.String(group),
+		StartTime:    aws.Int64(since.UnixMilli()),
+	})
+	for paginator.HasMorePages() && len(queries) < maxQueries {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return queries, fmt.Errorf("failed to read log group %s: %v", group, err)
+		}
+		for _, event := range page.Events {
+			if q, err := ParseQuery(aws.ToString(event.Message)); err == nil {
+				queries = append(queries, q)
+			}
+		}
+	}
+	log.Printf("Read %d resolver queries from %s\n", len(queries), group)
+	if paginator.HasMorePages() {
+		return queries, fmt.Errorf("log group %s has more than %d resolver queries, the rest were not matched", group, maxQueries)
+	}
+	return queries, nil
+}
+
+// Report is the outcome of the matching of the audit sources
+type Report struct {
+	Indicators int
+	Events     int // CloudTrail events matched
+	Flows      int // flow log records matched
+	Queries    int // resolver queries matched
+	Findings   []Finding
+}
+
+// Match matches the indicators of the feeds against the CloudTrail events and the resolver queries of the
+// last threat_intel.hours and against the flow_logs records. Feeds and sources that fail or are read only in
+// part are skipped and reported in the error.
+func Match(cfg aws.Config) (Report, error) {
+	intelCfg := config.AppConfig.AWS.ThreatIntel
+	if len(intelCfg.Feeds) == 0 {
+		return Report{}, fmt.Errorf("no threat-intel feeds configured")
+	}
+	set, err := Cached()
+	if set == nil || set.Len() == 0 {
+		return Report{}, fmt.Errorf("no indicators in the threat-intel feeds: %v", err)
+	}
+	var errs []error
+	if err != nil {
+		errs = append(errs, err)
+	}
+	hours := intelCfg.Hours
+	if hours <= 0 {
+		hours = defaultHours
+	}
+	end := time.Now()
+	since := end.Add(-time.Duration(hours) * time.Hour)
+
+	report := Report{Indicators: set.Len()}
+	events, err := trailstore.Search(cloudtrail.NewFromConfig(cfg), trailstore.Query{Start: since, End: end})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to read the CloudTrail events: %v", err))
+	}
+	report.Events = len(events)
+	report.Findings = append(report.Findings, MatchEvents(set, events)...)
+
+	records, err := flowlogs.Cached(cfg)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	report.Flows = len(records)
+	report.Findings = append(report.Findings, MatchFlows(set, records)...)
+
+	var queries []Query
+	for _, path := range intelCfg.ResolverLogFiles {
+		found, err := ReadQueryFile(path)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		queries = append(queries, found...)
+	}
+	for _, group := range intelCfg.ResolverLogGroups {
+		found, err := readQueryLogGroup(cfg, group, since)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		queries = append(queries, found...)
+	}
+	report.Queries = len(queries)
+	report.Findings = append(report.Findings, MatchQueries(set, queries)...)
+
+	return report, errors.Join(errs...)
+}
@@ -0,0 +1,149 @@
+package threatintel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/flowlogs"
+	"cloud_compliance_checker/trailstore"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const bundle = `{"type": "bundle", "objects": [
+	{"type": "indicator", "name": "C2 server", "pattern_type": "stix",
+	 "pattern": "[ipv4-addr:value = '203.0.113.9'] OR [domain-name:value = 'evil.example.com']"},
+	{"type": "indicator", "name": "Scanner", "pattern": "[ipv4-addr:value ISSUBSET '198.51.100.0/25']"},
+	{"type": "indicator", "name": "Revoked", "revoked": true, "pattern": "[ipv4-addr:value = '192.0.2.1']"},
+	{"type": "indicator", "name": "Expired", "valid_until": "2020-01-01T00:00:00Z", "pattern": "[ipv4-addr:value = '192.0.2.2']"},
+	{"type": "indicator", "pattern_type": "yara", "pattern": "rule x { condition: true }"},
+	{"type": "domain-name", "value": "phish.example.net"}
+]}`
+
+func TestRead(t *testing.T) {
+	set := NewSet()
+	added, err := set.Read(strings.NewReader(bundle), FormatSTIX, "isac")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, added)
+
+	added, err = set.Read(strings.NewReader("indicator,type,description\n192.0.2[.]77,ip,Botnet\nhxxps://drop.example[.]org/payload,url,Dropper\n"), FormatCSV, "csv")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, added)
+
+	added, err = set.Read(strings.NewReader("# blocklist\n2001:db8::bad\n10.1.2.3 # internal test\nnot-a-domain\n1.2.3\n"), FormatPlain, "plain")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, added)
+	assert.Equal(t, 8, set.Len())
+
+	indicator, ok := set.MatchIP("198.51.100.42")
+	assert.True(t, ok)
+	assert.Equal(t, Indicator{Value: "198.51.100.0/25", Type: TypeNetwork, Feed: "isac", Description: "Scanner"}, indicator)
+	_, ok = set.MatchIP("198.51.100.200")
+	assert.False(t, ok)
+	_, ok = set.MatchIP("192.0.2.1")
+	assert.False(t, ok)
+	indicator, ok = set.MatchIP("192.0.2.77")
+	assert.True(t, ok)
+	assert.Equal(t, "192.0.2.77 (csv: Botnet)", indicator.String())
+	_, ok = set.MatchIP("2001:db8::bad")
+	assert.True(t, ok)
+
+	indicator, ok = set.MatchDomain("cdn.Evil.example.com.")
+	assert.True(t, ok)
+	assert.Equal(t, "evil.example.com", indicator.Value)
+	_, ok = set.MatchDomain("drop.example.org")
+	assert.True(t, ok)
+	_, ok = set.MatchDomain("example.com")
+	assert.False(t, ok)
+
+	assert.Equal(t, FormatSTIX, FormatOf("", "https://isac.example.org/feed.json?key=1"))
+	assert.Equal(t, FormatCSV, FormatOf("", "intel/list.CSV"))
+	assert.Equal(t, FormatPlain, FormatOf("", "intel/list.txt"))
+	assert.Equal(t, FormatCSV, FormatOf("CSV", "intel/list.txt"))
+}
+
+func TestMatch(t *testing.T) {
+	set := NewSet()
+	_, err := set.Read(strings.NewReader(bundle), FormatSTIX, "isac")
+	assert.NoError(t, err)
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	var events []trailstore.Event
+	for _, record := range []string{
+		`{"eventTime": "2024-05-01T10:00:00Z", "eventName": "ConsoleLogin", "awsRegion": "us-east-1", "sourceIPAddress": "203.0.113.9", "userIdentity": {"userName": "alice"}}`,
+		`{"eventTime": "2024-05-01T09:00:00Z", "eventName": "ConsoleLogin", "awsRegion": "us-east-1", "sourceIPAddress": "203.0.113.9", "userIdentity": {"userName": "alice"}}`,
+		`{"eventTime": "2024-05-01T11:00:00Z", "eventName": "GetObject", "awsRegion": "us-east-1", "sourceIPAddress": "s3.amazonaws.com", "userIdentity": {"userName": "bob"}}`,
+	} {
+		e, err := trailstore.ParseEvent([]byte(record))
+		assert.NoError(t, err)
+		events = append(events, e)
+	}
+	found := MatchEvents(set, events)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, 2, found[0].Count)
+		assert.Equal(t, "2024-05-01T09:00:00Z cloudtrail 203.0.113.9 matches 203.0.113.9 (isac: C2 server): ConsoleLogin by alice in us-east-1 (2 times)", found[0].String())
+	}
+
+	records := []flowlogs.Record{
+		{Interface: "eni-1", Source: netip.MustParseAddr("10.0.1.5"), Dest: netip.MustParseAddr("198.51.100.7"), DstPort: 443, Start: at, Action: flowlogs.ActionAccept},
+		{Interface: "eni-1", Source: netip.MustParseAddr("198.51.100.7"), Dest: netip.MustParseAddr("10.0.1.5"), DstPort: 22, Start: at, Action: flowlogs.ActionReject},
+	}
+	found = MatchFlows(set, records)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, "ACCEPT traffic from 10.0.1.5 to port 443 on eni-1", found[0].Detail)
+	}
+
+	var queries []Query
+	for _, line := range []string{
+		`{"query_timestamp": "2024-05-01T10:00:00Z", "query_name": "www.phish.example.net.", "query_type": "A", "rcode": "NOERROR", "srcaddr": "10.0.1.5",
+		  "vpc_id": "vpc-1", "srcids": {"instance": "i-1"}, "answers": [{"Rdata": "203.0.113.9", "Type": "A"}]}`,
+		`{"query_timestamp": "2024-05-01T10:01:00Z", "query_name": "aws.amazon.com.", "query_type": "A", "srcaddr": "10.0.1.5", "answers": []}`,
+	} {
+		q, err := ParseQuery(line)
+		assert.NoError(t, err)
+		queries = append(queries, q)
+	}
+	_, err = ParseQuery(`{"srcaddr": "10.0.1.5"}`)
+	assert.Error(t, err)
+
+	found = MatchQueries(set, queries)
+	if assert.Len(t, found, 2) {
+		assert.Equal(t, "www.phish.example.net", found[0].Observed)
+		assert.Equal(t, "A query from i-1 (10.0.1.5) in vpc-1, NOERROR", found[0].Detail)
+		assert.Equal(t, "203.0.113.9", found[1].Observed)
+		assert.Equal(t, "answer of www.phish.example.net queried from i-1 (10.0.1.5) in vpc-1", found[1].Detail)
+	}
+	assert.Equal(t, "resolver 2", Summary(found))
+}
+
+func TestLoad(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("203.0.113.9\nevil.example.com\n"))
+	}))
+	intelCfg := config.ThreatIntelConfig{
+		Feeds:    []config.ThreatIntelFeed{{Name: "isac", URL: server.URL + "/list.txt"}},
+		CacheDir: t.TempDir(),
+	}
+
+	set, err := Load(intelCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, set.Len())
+
+	// An old copy is downloaded again, and used when the download fails
+	server.Close()
+	old := time.Now().Add(-48 * time.Hour)
+	assert.NoError(t, os.Chtimes(intelCfg.CacheDir+"/isac.txt", old, old))
+	set, err = Load(intelCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, set.Len())
+
+	intelCfg.CacheDir = t.TempDir()
+	_, err = Load(intelCfg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,137 @@
+// Package trailstore keeps the CloudTrail events of the trail log files in a local store, indexed by
+// user, event name, source IP and resource, so that months of history are queried without the limits of
+// LookupEvents.
+package trailstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+)
+
+// Event is a CloudTrail record
+type Event struct {
+	EventID           string          `json:"eventID"`
+	EventTime         time.Time       `json:"eventTime"`
+	EventName         string          `json:"eventName"`
+	EventSource       string          `json:"eventSource"`
+	EventType         string          `json:"eventType"`
+	Region            string          `json:"awsRegion"`
+	SourceIP          string          `json:"sourceIPAddress"`
+	UserAgent         string          `json:"userAgent"`
+	ErrorCode         string          `json:"errorCode"`
+	ErrorMessage      string          `json:"errorMessage"`
+	ReadOnly          *bool           `json:"readOnly"`
+	UserIdentity      UserIdentity    `json:"userIdentity"`
+	Resources         []Resource      `json:"resources"`
+	RequestParameters json.RawMessage `json:"requestParameters"`
+
+	Raw json.RawMessage `json:"-"` // the record as delivered
+}
+
+// UserIdentity is the identity that made a request
+type UserIdentity struct {
+	Type           string `json:"type"`
+	PrincipalID    string `json:"principalId"`
+	ARN            string `json:"arn"`
+	AccountID      string `json:"accountId"`
+	AccessKeyID    string `json:"accessKeyId"`
+	UserName       string `json:"userName"`
+	InvokedBy      string `json:"invokedBy"`
+	SessionContext struct {
+		SessionIssuer struct {
+			UserName string `json:"userName"`
+			ARN      string `json:"arn"`
+		} `json:"sessionIssuer"`
+	} `json:"sessionContext"`
+}
+
+// Resource is a resource accessed by a request
+type Resource struct {
+	ARN       string `json:"ARN"`
+	AccountID string `json:"accountId"`
+	Type      string `json:"type"`
+}
+
+// ParseEvent parses a CloudTrail record
+func ParseEvent(raw []byte) (Event, error) {
+	var event Event
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return Event{}, fmt.Errorf("invalid CloudTrail record: %v", err)
+	}
+	event.Raw = raw
+	return event, nil
+}
+
+// User returns the name of the identity: the IAM user, the role of an assumed role session, or the
+// service or type of the identity
+func (e Event) User() string {
+	identity := e.UserIdentity
+	switch {
+	case identity.UserName != "":
+		return identity.UserName
+	case identity.SessionContext.SessionIssuer.UserName != "":
+		return identity.SessionContext.SessionIssuer.UserName
+	case identity.ARN != "":
+		return identity.ARN[strings.LastIndexAny(identity.ARN, ":/")+1:]
+	case identity.InvokedBy != "":
+		return identity.InvokedBy
+	}
+	return identity.Type
+}
+
+// Users returns the values the event is indexed with for a user: the name and the ARNs of the identity
+func (e Event) Users() []string {
+	return nonEmpty(e.User(), e.UserIdentity.ARN, e.UserIdentity.SessionContext.SessionIssuer.ARN)
+}
+
+// ResourceNames returns the ARNs of the resources and their names, the part after the last : or /
+func (e Event) ResourceNames() []string {
+	var names []string
+	for _, resource := range e.Resources {
+		names = append(names, resource.ARN, resource.ARN[strings.LastIndexAny(resource.ARN, ":/")+1:])
+	}
+	return nonEmpty(names...)
+}
+
+// nonEmpty returns the distinct non-empty values
+func nonEmpty(values ...string) []string {
+	var result []string
+	seen := map[string]bool{}
+	for _, value := range values {
+		if value != "" && !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// LookupEvent converts the event to the type returned by LookupEvents
+func (e Event) LookupEvent() types.Event {
+	event := types.Event{
+		EventId:         aws.String(e.EventID),
+		EventName:       aws.String(e.EventName),
+		EventSource:     aws.String(e.EventSource),
+		EventTime:       aws.Time(e.EventTime),
+		Username:        aws.String(e.User()),
+		CloudTrailEvent: aws.String(string(e.Raw)),
+	}
+	if e.UserIdentity.AccessKeyID != "" {
+		event.AccessKeyId = aws.String(e.UserIdentity.AccessKeyID)
+	}
+	if e.ReadOnly != nil {
+		event.ReadOnly = aws.String(fmt.Sprint(*e.ReadOnly))
+	}
+	for _, resource := range e.Resources {
+		event.Resources = append(event.Resources, types.Resource{
+			ResourceName: aws.String(resource.ARN),
+			ResourceType: aws.String(resource.Type),
+		})
+	}
+	return event
+}
@@ -0,0 +1,393 @@
+package trailstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud_compliance_checker/config"
+	"cloud_compliance_checker/s3client"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// flushEvery is the number of log files ingested between two flushes of the store
+const flushEvery = 500
+
+// maxLookupEvents caps the events read from LookupEvents by Search without a store
+const maxLookupEvents = 10000
+
+// ErrTruncated is returned by Search, with the events read, when LookupEvents has more events than maxLookupEvents
+var ErrTruncated = errors.New("more than 10000 CloudTrail events in the time range, configure an event store to read them all")
+
+// cacheTTL is how long the configured store is kept open before its indexes are read again
+const cacheTTL = 10 * time.Minute
+
+// defaultIngestInterval is the default time between two ingestions of the configured store
+const defaultIngestInterval = 24 * time.Hour
+
+// logFolderDepth bounds the folders walked from the configured prefix down to CloudTrail/: AWSLogs,
+// the organization, the account and the key prefix of the trail
+const logFolderDepth = 6
+
+// IngestDir ingests the CloudTrail log files of a directory, such as a local copy of a trail bucket.
+// Digests and files already ingested are skipped, files that are not log files are reported and skipped.
+func (s *Store) IngestDir(dir string) (int, error) {
+	added, files := 0, 0
+	err := filepath.WalkDir(dir, func(file string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.Contains(filepath.ToSlash(file), "/CloudTrail-Digest/") ||
+			!(strings.HasSuffix(file, ".json.gz") || strings.HasSuffix(file, ".json")) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		source, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		if s.Ingested(source, info.Size()) {
+			return nil
+		}
+
+		content, err := os.ReadFile(file)
+		if err == nil {
+			content, err = uncompress(content)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", file, err)
+		}
+		n, err := s.Ingest(source, info.Size(), content)
+		if err != nil {
+			log.Printf("Skipping %s: %v\n", file, err)
+			return nil
+		}
+		added += n
+		if files++; files%flushEvery == 0 {
+			return s.Flush()
+		}
+		return nil
+	})
+	if flushErr := s.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		return added, fmt.Errorf("failed to ingest %s: %v", dir, err)
+	}
+	return added, nil
+}
+
+// IngestS3 ingests the CloudTrail log files of a bucket delivered after since (zero for all). Files already
+// ingested are not downloaded again.
+func (s *Store) IngestS3(cfg aws.Config, bucket, prefix string, since time.Time) (int, error) {
+	ctx := context.TODO()
+	client, err := s3client.ForBucket(ctx, cfg, bucket)
+	if err != nil {
+		return 0, err
+	}
+
+	// Since a day only the day folders from that day on are listed, not the whole bucket
+	prefixes := []string{prefix}
+	if !since.IsZero() {
+		if prefixes, err = dayPrefixes(ctx, client, bucket, prefix, since, logFolderDepth); err != nil {
+			return 0, err
+		}
+	}
+
+	added, files := 0, 0
+	for _, prefix := range prefixes {
+		n, err := s.ingestPrefix(ctx, client, bucket, prefix, since, &files)
+		added += n
+		if err != nil {
+			s.Flush()
+			return added, err
+		}
+	}
+	return added, s.Flush()
+}
+
+// dayPrefixes walks the folders of a trail bucket down to the CloudTrail/<region>/ folders of every
+// account and returns their YYYY/MM/DD/ folders from the day of since to today
+func dayPrefixes(ctx context.Context, client *s3.Client, bucket, prefix string, since time.Time, depth int) ([]string, error) {
+	if path.Base(prefix) == "CloudTrail" {
+		regions, err := s3client.Folders(ctx, client, bucket, prefix)
+		if err != nil {
+			return nil, err
+		}
+		var prefixes []string
+		today := time.Now().UTC()
+		for _, region := range regions {
+			for day := since.UTC().Truncate(24 * time.Hour); !day.After(today); day = day.Add(24 * time.Hour) {
+				prefixes = append(prefixes, region+day.Format("2006/01/02/"))
+			}
+		}
+		return prefixes, nil
+	}
+	if depth == 0 {
+		return nil, nil
+	}
+	folders, err := s3client.Folders(ctx, client, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var prefixes []string
+	for _, folder := range folders {
+		// The digests and the Insights events are not ingested
+		if base := path.Base(folder); base == "CloudTrail-Digest" || base == "CloudTrail-Insight" {
+			continue
+		}
+		found, err := dayPrefixes(ctx, client, bucket, folder, since, depth-1)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, found...)
+	}
+	return prefixes, nil
+}
+
+// ingestPrefix ingests the log files under a prefix delivered since the given time, flushing the store
+// every flushEvery files
+func (s *Store) ingestPrefix(ctx context.Context, client *s3.Client, bucket, prefix string, since time.Time, files *int) (int, error) {
+	added := 0
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return added, fmt.Errorf("failed to list s3://%s/%s: %v", bucket, prefix, err)
+		}
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			if !strings.Contains(key, "/CloudTrail/") || !strings.HasSuffix(key, ".json.gz") {
+				continue
+			}
+			source := "s3://" + bucket + "/" + key
+			size := aws.ToInt64(object.Size)
+			if (!since.IsZero() && aws.ToTime(object.LastModified).Before(since)) || s.Ingested(source, size) {
+				continue
+			}
+
+			content, err := getObject(ctx, client, bucket, key)
+			if err != nil {
+				return added, err
+			}
+			n, err := s.Ingest(source, size, content)
+			if err != nil {
+				log.Printf("Skipping %s: %v\n", source, err)
+				continue
+			}
+			added += n
+			if *files++; *files%flushEvery == 0 {
+				if err := s.Flush(); err != nil {
+					return added, err
+				}
+			}
+		}
+	}
+	return added, nil
+}
+
+// IngestConfigured ingests the directories and buckets of trail_store
+func (s *Store) IngestConfigured(cfg aws.Config) (int, error) {
+	storeCfg := config.AppConfig.AWS.TrailStore
+	added := 0
+	for _, dir := range storeCfg.Directories {
+		n, err := s.IngestDir(dir)
+		added += n
+		if err != nil {
+			return added, err
+		}
+	}
+	var since time.Time
+	if storeCfg.Days > 0 {
+		since = time.Now().AddDate(0, 0, -storeCfg.Days)
+	}
+	for _, bucket := range storeCfg.Buckets {
+		n, err := s.IngestS3(cfg, bucket.Bucket, bucket.Prefix, since)
+		added += n
+		if err != nil {
+			return added, err
+		}
+	}
+	return added, nil
+}
+
+// getObject downloads and uncompresses a log file
+func getObject(ctx context.Context, client *s3.Client, bucket, key string) ([]byte, error) {
+	object, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download s3://%s/%s: %v", bucket, key, err)
+	}
+	defer object.Body.Close()
+	content, err := io.ReadAll(object.Body)
+	if err == nil {
+		content, err = uncompress(content)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download s3://%s/%s: %v", bucket, key, err)
+	}
+	return content, nil
+}
+
+// uncompress returns the content of gzip data, or the data when not compressed
+func uncompress(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return data, nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+var (
+	storeMu  sync.Mutex
+	store    *Store
+	storeDir string
+	storeAt  time.Time
+)
+
+// Default returns the store of trail_store.dir, nil when not configured. The store is opened again after
+// cacheTTL to read the events ingested meanwhile.
+func Default() (*Store, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	dir := config.AppConfig.AWS.TrailStore.Dir
+	if dir == "" {
+		return nil, nil
+	}
+	if store != nil && storeDir == dir && time.Since(storeAt) < cacheTTL {
+		return store, nil
+	}
+	opened, err := Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	store, storeDir, storeAt = opened, dir, time.Now()
+	return store, nil
+}
+
+// checkFresh checks that the store holds the events up to the end of a query (now when zero): its newest
+// event must not be older than trail_store.ingest_interval_hours before the end, or the ingestion stopped
+// and the recent events are missing
+func checkFresh(s *Store, end time.Time) error {
+	if end.IsZero() {
+		end = time.Now()
+	}
+	interval := defaultIngestInterval
+	if hours := config.AppConfig.AWS.TrailStore.IngestIntervalHours; hours > 0 {
+		interval = time.Duration(hours) * time.Hour
+	}
+	newest, err := s.Newest()
+	if err != nil {
+		return err
+	}
+	if newest.IsZero() {
+		return fmt.Errorf("the trail store %s is empty, run the ingest command", s.dir)
+	}
+	if end.Sub(newest) > interval {
+		return fmt.Errorf("the trail store %s is stale: its newest event is of %s, more than %s before %s",
+			s.dir, newest.UTC().Format(time.RFC3339), interval, end.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// LookupEvents returns the events between start and end from the configured store, or from the
+// LookupEvents API when no store is configured
+func LookupEvents(client *cloudtrail.Client, start, end time.Time) ([]types.Event, error) {
+	s, err := Default()
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		output, err := client.LookupEvents(context.TODO(), &cloudtrail.LookupEventsInput{StartTime: &start, EndTime: &end})
+		if err != nil {
+			return nil, err
+		}
+		return output.Events, nil
+	}
+
+	if err := checkFresh(s, end); err != nil {
+		return nil, err
+	}
+	found, err := s.Query(Query{Start: start, End: end})
+	if err != nil {
+		return nil, err
+	}
+	events := make([]types.Event, 0, len(found))
+	for _, event := range found {
+		events = append(events, event.LookupEvent())
+	}
+	return events, nil
+}
+
+// Search returns the events matching the query from the configured store or, when no store is
+// configured, from the first maxLookupEvents events of LookupEvents in the time range, filtered on the
+// event name by LookupEvents. When the cap is reached the events read are returned with ErrTruncated.
+func Search(client *cloudtrail.Client, q Query) ([]Event, error) {
+	s, err := Default()
+	if err != nil {
+		return nil, err
+	}
+	if s != nil {
+		if err := checkFresh(s, q.End); err != nil {
+			return nil, err
+		}
+		return s.Query(q)
+	}
+
+	input := &cloudtrail.LookupEventsInput{}
+	if !q.Start.IsZero() {
+		input.StartTime = aws.Time(q.Start)
+	}
+	if !q.End.IsZero() {
+		input.EndTime = aws.Time(q.End)
+	}
+	if q.EventName != "" {
+		input.LookupAttributes = []types.LookupAttribute{{AttributeKey: types.LookupAttributeKeyEventName, AttributeValue: aws.String(q.EventName)}}
+	}
+	var events []Event
+	read := 0
+	paginator := cloudtrail.NewLookupEventsPaginator(client, input)
+	for paginator.HasMorePages() && read < maxLookupEvents {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		for _, found := range page.Events {
+			read++
+			event, err := ParseEvent([]byte(aws.ToString(found.CloudTrailEvent)))
+			if err != nil {
+				continue
+			}
+			if q.Matches(event) {
+				events = append(events, event)
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].EventTime.Before(events[j].EventTime) })
+	if paginator.HasMorePages() {
+		return events, ErrTruncated
+	}
+	return events, nil
+}
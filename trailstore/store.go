@@ -0,0 +1,434 @@
+package trailstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fields of the day indexes
+const (
+	fieldID       = "id"
+	fieldUser     = "user"
+	fieldEvent    = "event"
+	fieldSourceIP = "ip"
+	fieldResource = "resource"
+)
+
+// dayLayout names the files of the events of a day (UTC)
+const dayLayout = "2006-01-02"
+
+// Store keeps the events in a JSON lines segment per day, with an index per day from the values of the
+// indexed fields to the offsets of the events in the segment
+type Store struct {
+	dir     string
+	mu      sync.Mutex
+	days    map[string]*dayIndex
+	writers map[string]*os.File
+	sources map[string]int64 // size of the ingested log files
+	dirty   bool
+}
+
+// dayIndex is the index of the segment of a day
+type dayIndex struct {
+	Fields map[string]map[string][]int64 `json:"fields"`
+	Size   int64                         `json:"size"`   // bytes of the segment indexed
+	Newest time.Time                     `json:"newest"` // time of the newest event of the day
+	dirty  bool
+}
+
+// Query selects the events: every field set must match, user and resource case-insensitive. The user
+// matches the name or the ARN of the identity, the resource its ARN or name. A zero time is no bound.
+type Query struct {
+	User      string
+	EventName string
+	SourceIP  string
+	Resource  string
+	Start     time.Time
+	End       time.Time
+}
+
+// Matches checks if an event matches the query
+func (q Query) Matches(e Event) bool {
+	if (!q.Start.IsZero() && e.EventTime.Before(q.Start)) || (!q.End.IsZero() && e.EventTime.After(q.End)) {
+		return false
+	}
+	if (q.EventName != "" && e.EventName != q.EventName) || (q.SourceIP != "" && e.SourceIP != q.SourceIP) {
+		return false
+	}
+	return (q.User == "" || containsFold(e.Users(), q.User)) && (q.Resource == "" || containsFold(e.ResourceNames(), q.Resource))
+}
+
+// containsFold checks if the values include the given one, case-insensitive
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Open opens the store of a directory, creating it when missing
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "events"), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create the trail store %s: %v", dir, err)
+	}
+	s := &Store{dir: dir, days: map[string]*dayIndex{}, writers: map[string]*os.File{}, sources: map[string]int64{}}
+	data, err := os.ReadFile(filepath.Join(dir, "sources.json"))
+	if err == nil {
+		err = json.Unmarshal(data, &s.sources)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read the sources of the trail store %s: %v", dir, err)
+	}
+	return s, nil
+}
+
+// segment returns the path of the events of a day
+func (s *Store) segment(day string) string {
+	return filepath.Join(s.dir, "events", day+".jsonl")
+}
+
+// indexFile returns the path of the index of a day
+func (s *Store) indexFile(day string) string {
+	return filepath.Join(s.dir, "events", day+".idx.json")
+}
+
+// day loads the index of a day
+func (s *Store) day(day string) (*dayIndex, error) {
+	if index, ok := s.days[day]; ok {
+		return index, nil
+	}
+	index := &dayIndex{Fields: map[string]map[string][]int64{}}
+	data, err := os.ReadFile(s.indexFile(day))
+	if err == nil {
+		err = json.Unmarshal(data, index)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read the index of %s: %v", day, err)
+	}
+	s.days[day] = index
+	return index, nil
+}
+
+// add appends an event to the segment of its day and indexes it. Events already in the store are skipped.
+func (s *Store) add(raw []byte) (bool, error) {
+	event, err := ParseEvent(raw)
+	if err != nil {
+		return false, err
+	}
+	if event.EventID == "" || event.EventTime.IsZero() {
+		return false, nil
+	}
+	day := event.EventTime.UTC().Format(dayLayout)
+	index, err := s.day(day)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := index.Fields[fieldID][event.EventID]; ok {
+		return false, nil
+	}
+
+	writer, ok := s.writers[day]
+	if !ok {
+		// Events appended after the last flush of the index, by an interrupted ingestion, are dropped: their
+		// log files were not recorded and are ingested again
+		if info, err := os.Stat(s.segment(day)); err == nil && info.Size() > index.Size {
+			if err := os.Truncate(s.segment(day), index.Size); err != nil {
+				return false, err
+			}
+		}
+		if writer, err = os.OpenFile(s.segment(day), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+			return false, err
+		}
+		s.writers[day] = writer
+	}
+	if _, err := writer.Write(append(raw, '\n')); err != nil {
+		return false, fmt.Errorf("failed to write the events of %s: %v", day, err)
+	}
+
+	offset := index.Size
+	index.Size += int64(len(raw)) + 1
+	index.dirty = true
+	if event.EventTime.After(index.Newest) {
+		index.Newest = event.EventTime
+	}
+	index.put(fieldID, event.EventID, offset)
+	index.put(fieldEvent, event.EventName, offset)
+	index.put(fieldSourceIP, event.SourceIP, offset)
+	for _, user := range event.Users() {
+		index.put(fieldUser, strings.ToLower(user), offset)
+	}
+	for _, resource := range event.ResourceNames() {
+		index.put(fieldResource, strings.ToLower(resource), offset)
+	}
+	return true, nil
+}
+
+// put adds the offset of an event to a value of a field
+func (d *dayIndex) put(field, value string, offset int64) {
+	if value == "" {
+		return
+	}
+	if d.Fields[field] == nil {
+		d.Fields[field] = map[string][]int64{}
+	}
+	d.Fields[field][value] = append(d.Fields[field][value], offset)
+}
+
+// Ingested checks if a log file of the given size was already ingested
+func (s *Store) Ingested(source string, size int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ingested, ok := s.sources[source]
+	return ok && ingested == size
+}
+
+// Ingest adds the records of a CloudTrail log file, uncompressed, and returns the number of new events.
+// The source identifies the file, such as its path or S3 URL.
+func (s *Store) Ingest(source string, size int64, content []byte) (int, error) {
+	var file struct {
+		Records []json.RawMessage `json:"Records"`
+	}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return 0, fmt.Errorf("failed to parse CloudTrail log file %s: %v", source, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added := 0
+	var compact bytes.Buffer
+	for _, record := range file.Records {
+		compact.Reset()
+		if err := json.Compact(&compact, record); err != nil {
+			return added, fmt.Errorf("invalid record in %s: %v", source, err)
+		}
+		ok, err := s.add(bytes.Clone(compact.Bytes()))
+		if err != nil {
+			return added, fmt.Errorf("failed to add a record of %s: %v", source, err)
+		}
+		if ok {
+			added++
+		}
+	}
+	s.sources[source] = size
+	s.dirty = true
+	return added, nil
+}
+
+// Flush closes the segments and saves the indexes and the ingested sources
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for day, writer := range s.writers {
+		if err := writer.Close(); err != nil {
+			return fmt.Errorf("failed to write the events of %s: %v", day, err)
+		}
+		delete(s.writers, day)
+	}
+	for day, index := range s.days {
+		if !index.dirty {
+			continue
+		}
+		data, err := json.Marshal(index)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(s.indexFile(day), data, 0o644); err != nil {
+			return fmt.Errorf("failed to write the index of %s: %v", day, err)
+		}
+		index.dirty = false
+	}
+	if s.dirty {
+		data, err := json.MarshalIndent(s.sources, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(s.dir, "sources.json"), data, 0o644); err != nil {
+			return fmt.Errorf("failed to write the sources of the trail store: %v", err)
+		}
+		s.dirty = false
+	}
+	return nil
+}
+
+// Days returns the days with events, sorted
+func (s *Store) Days() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "events", "*.idx.json"))
+	if err != nil {
+		return nil, err
+	}
+	days := make([]string, 0, len(files))
+	for _, file := range files {
+		days = append(days, strings.TrimSuffix(filepath.Base(file), ".idx.json"))
+	}
+	sort.Strings(days)
+	return days, nil
+}
+
+// Newest returns the time of the newest event of the store, zero when the store is empty
+func (s *Store) Newest() (time.Time, error) {
+	days, err := s.Days()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(days) - 1; i >= 0; i-- {
+		index, err := s.day(days[i])
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !index.Newest.IsZero() {
+			return index.Newest, nil
+		}
+		// Indexes written before the newest event was recorded: the events of the day are read
+		var offsets []int64
+		for _, found := range index.Fields[fieldID] {
+			offsets = append(offsets, found...)
+		}
+		sort.Slice(offsets, func(a, b int) bool { return offsets[a] < offsets[b] })
+		events, err := s.read(days[i], offsets)
+		if err != nil {
+			return time.Time{}, err
+		}
+		for _, event := range events {
+			if event.EventTime.After(index.Newest) {
+				index.Newest = event.EventTime
+			}
+		}
+		if !index.Newest.IsZero() {
+			return index.Newest, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+// Query returns the events matching the query, sorted by time. Only the indexes of the days in the time
+// range and the matching events are read.
+func (s *Store) Query(q Query) ([]Event, error) {
+	days, err := s.Days()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []Event
+	for _, day := range days {
+		if (!q.Start.IsZero() && day < q.Start.UTC().Format(dayLayout)) || (!q.End.IsZero() && day > q.End.UTC().Format(dayLayout)) {
+			continue
+		}
+		index, err := s.day(day)
+		if err != nil {
+			return nil, err
+		}
+		found, err := s.read(day, index.lookup(q))
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range found {
+			if (q.Start.IsZero() || !event.EventTime.Before(q.Start)) && (q.End.IsZero() || !event.EventTime.After(q.End)) {
+				events = append(events, event)
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].EventTime.Before(events[j].EventTime) })
+	return events, nil
+}
+
+// lookup returns the offsets of the events matching the indexed fields of the query
+func (d *dayIndex) lookup(q Query) []int64 {
+	var offsets []int64
+	filtered := false
+	for _, filter := range []struct{ field, value string }{
+		{fieldUser, strings.ToLower(q.User)},
+		{fieldEvent, q.EventName},
+		{fieldSourceIP, q.SourceIP},
+		{fieldResource, strings.ToLower(q.Resource)},
+	} {
+		if filter.value == "" {
+			continue
+		}
+		matching := d.Fields[filter.field][filter.value]
+		if !filtered {
+			offsets, filtered = matching, true
+			continue
+		}
+		offsets = intersect(offsets, matching)
+	}
+	if filtered {
+		return offsets
+	}
+
+	for _, ids := range d.Fields[fieldID] {
+		offsets = append(offsets, ids...)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets
+}
+
+// intersect returns the offsets in both sorted lists
+func intersect(a, b []int64) []int64 {
+	var result []int64
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// read reads the events at the given offsets of the segment of a day
+func (s *Store) read(day string, offsets []int64) ([]Event, error) {
+	if len(offsets) == 0 {
+		return nil, nil
+	}
+	file, err := os.Open(s.segment(day))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the events of %s: %v", day, err)
+	}
+	defer file.Close()
+
+	events := make([]Event, 0, len(offsets))
+	reader := bufio.NewReader(file)
+	position := int64(0)
+	for _, offset := range offsets {
+		if offset < position {
+			continue
+		}
+		// Offsets are sorted: skip the events in between instead of seeking
+		if _, err := reader.Discard(int(offset - position)); err != nil {
+			return nil, fmt.Errorf("failed to read the events of %s: %v", day, err)
+		}
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read the events of %s: %v", day, err)
+		}
+		position = offset + int64(len(line))
+		event, err := ParseEvent(bytes.TrimSuffix(line, []byte("\n")))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the events of %s: %v", day, err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -0,0 +1,89 @@
+package trailstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const logFile = `{"Records": [
+	{"eventID": "1", "eventTime": "2024-05-01T10:00:00Z", "eventName": "GetObject", "eventSource": "s3.amazonaws.com",
+	 "sourceIPAddress": "198.51.100.7", "readOnly": true,
+	 "userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::111111111111:user/alice", "userName": "alice"},
+	 "resources": [{"ARN": "arn:aws:s3:::cui-data/report.pdf", "type": "AWS::S3::Object"}]},
+	{"eventID": "2", "eventTime": "2024-05-01T11:00:00Z", "eventName": "DeleteObject", "eventSource": "s3.amazonaws.com",
+	 "sourceIPAddress": "198.51.100.7",
+	 "userIdentity": {"type": "AssumedRole", "arn": "arn:aws:sts::111111111111:assumed-role/Admin/bob",
+	  "sessionContext": {"sessionIssuer": {"userName": "Admin", "arn": "arn:aws:iam::111111111111:role/Admin"}}},
+	 "resources": [{"ARN": "arn:aws:s3:::cui-data/report.pdf", "type": "AWS::S3::Object"}]},
+	{"eventID": "3", "eventTime": "2024-05-02T09:30:00Z", "eventName": "ConsoleLogin", "eventSource": "signin.amazonaws.com",
+	 "sourceIPAddress": "203.0.113.9",
+	 "userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::111111111111:user/alice", "userName": "alice"}}
+]}`
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	logs := filepath.Join(dir, "logs", "AWSLogs", "111111111111", "CloudTrail")
+	if !assert.NoError(t, os.MkdirAll(logs, 0o755)) {
+		return
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(logs, "log.json"), []byte(logFile), 0o644))
+
+	store, err := Open(filepath.Join(dir, "store"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	added, err := store.IngestDir(filepath.Join(dir, "logs"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, added)
+
+	// Files already ingested are skipped, and the same events delivered twice are stored once
+	added, err = store.IngestDir(filepath.Join(dir, "logs"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, added)
+	added, err = store.Ingest("copy", 1, []byte(logFile))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, added)
+	assert.NoError(t, store.Flush())
+
+	// Queries read the indexes saved by another instance
+	store, err = Open(filepath.Join(dir, "store"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	ids := func(q Query) []string {
+		events, err := store.Query(q)
+		assert.NoError(t, err)
+		var found []string
+		for _, event := range events {
+			found = append(found, event.EventID)
+		}
+		return found
+	}
+	assert.Equal(t, []string{"1", "2", "3"}, ids(Query{}))
+	assert.Equal(t, []string{"1", "3"}, ids(Query{User: "Alice"}))
+	assert.Equal(t, []string{"2"}, ids(Query{User: "arn:aws:iam::111111111111:role/Admin"}))
+	assert.Equal(t, []string{"1", "2"}, ids(Query{Resource: "report.pdf", SourceIP: "198.51.100.7"}))
+	assert.Equal(t, []string{"1"}, ids(Query{User: "alice", Resource: "arn:aws:s3:::cui-data/report.pdf"}))
+	assert.Empty(t, ids(Query{EventName: "DeleteObject", User: "alice"}))
+	assert.Equal(t, []string{"2", "3"}, ids(Query{Start: time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)}))
+	assert.Equal(t, []string{"3"}, ids(Query{EventName: "ConsoleLogin", Start: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)}))
+
+	events, err := store.Query(Query{EventName: "DeleteObject"})
+	if assert.NoError(t, err) && assert.Len(t, events, 1) {
+		event := events[0].LookupEvent()
+		assert.Equal(t, "Admin", *event.Username)
+		assert.Equal(t, "arn:aws:s3:::cui-data/report.pdf", *event.Resources[0].ResourceName)
+		assert.JSONEq(t, string(events[0].Raw), *event.CloudTrailEvent)
+	}
+
+	// The store is stale for the queries ending more than the ingestion interval after its newest event
+	newest, err := store.Newest()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 2, 9, 30, 0, 0, time.UTC), newest)
+	assert.NoError(t, checkFresh(store, time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)))
+	assert.Error(t, checkFresh(store, time.Date(2024, 5, 4, 0, 0, 0, 0, time.UTC)))
+}
@@ -0,0 +1,371 @@
+// Package trailvalidation proves that CloudTrail log files were not modified or deleted after delivery.
+// It verifies the signature chain of the hourly digest files and the SHA-256 of every log file they
+// list, working offline on a local copy of the trail bucket.
+package trailvalidation
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PublicKeysFile is the file of the local directory holding the CloudTrail public keys
+const PublicKeysFile = "public-keys.json"
+
+// signatureSuffix is the suffix of the file holding the signature of a digest, taken from the
+// metadata of the S3 object
+const signatureSuffix = ".sig"
+
+// Digest is a CloudTrail digest file
+type Digest struct {
+	AccountID            string    `json:"awsAccountId"`
+	StartTime            string    `json:"digestStartTime"`
+	EndTime              string    `json:"digestEndTime"`
+	Bucket               string    `json:"digestS3Bucket"`
+	Object               string    `json:"digestS3Object"`
+	PublicKeyFingerprint string    `json:"digestPublicKeyFingerprint"`
+	SignatureAlgorithm   string    `json:"digestSignatureAlgorithm"`
+	PreviousBucket       *string   `json:"previousDigestS3Bucket"`
+	PreviousObject       *string   `json:"previousDigestS3Object"`
+	PreviousSignature    *string   `json:"previousDigestSignature"`
+	PreviousHashValue    *string   `json:"previousDigestHashValue"`
+	LogFiles             []LogFile `json:"logFiles"`
+
+	// Read from the local copy
+	Signature string    `json:"-"`
+	Hash      string    `json:"-"` // SHA-256 of the uncompressed digest
+	End       time.Time `json:"-"`
+}
+
+// LogFile is a log file listed in a digest
+type LogFile struct {
+	Bucket        string `json:"s3Bucket"`
+	Object        string `json:"s3Object"`
+	HashValue     string `json:"hashValue"`
+	HashAlgorithm string `json:"hashAlgorithm"`
+}
+
+// Path returns the S3 path of the digest as bucket/key
+func (d *Digest) Path() string {
+	return d.Bucket + "/" + d.Object
+}
+
+// chain identifies the digests of the same trail and region: the digest path without the date folders
+// and the timestamp of the file name
+func (d *Digest) chain() string {
+	dir, name := path.Split(d.Object)
+	for i := 0; i < 3; i++ {
+		dir = path.Dir(strings.TrimSuffix(dir, "/"))
+	}
+	if i := strings.LastIndex(name, "_"); i > 0 {
+		name = name[:i]
+	}
+	return d.Bucket + "/" + dir + "/" + name
+}
+
+// PublicKey is a public key used by CloudTrail to sign the digests
+type PublicKey struct {
+	Fingerprint string    `json:"fingerprint"`
+	Value       []byte    `json:"value"` // DER encoded PKCS#1 RSA public key
+	ValidFrom   time.Time `json:"validity_start"`
+	ValidTo     time.Time `json:"validity_end"`
+}
+
+// validAt checks that the key is in its validity period at the given time. A missing bound is not checked.
+func (k *PublicKey) validAt(t time.Time) bool {
+	return (k.ValidFrom.IsZero() || !t.Before(k.ValidFrom)) && (k.ValidTo.IsZero() || !t.After(k.ValidTo))
+}
+
+// Report is the outcome of a validation
+type Report struct {
+	Digests       int
+	ValidDigests  int
+	LogFiles      int
+	ValidLogFiles int
+	Problems      []string
+	ChainsStarted []string // digests starting a new chain, after logging was stopped or at the first delivery
+}
+
+// Valid checks if every digest and log file was verified
+func (r Report) Valid() bool {
+	return len(r.Problems) == 0
+}
+
+// LocalPath returns the path of an S3 object in the local directory
+func LocalPath(dir, bucket, key string) string {
+	return filepath.Join(dir, bucket, filepath.FromSlash(key))
+}
+
+// Validate verifies the digests of the local directory with an end time between start and end (zero
+// for no bound): the signature of each digest, the chain of the digests of each trail and region, and
+// the hash of every log file they list
+func Validate(dir string, start, end time.Time) (Report, error) {
+	keys, err := LoadPublicKeys(filepath.Join(dir, PublicKeysFile))
+	if err != nil {
+		return Report{}, err
+	}
+	digests, unreadable, err := LoadDigests(dir, start, end)
+	if err != nil {
+		return Report{}, err
+	}
+
+	var report Report
+	report.Digests += len(unreadable)
+	report.Problems = append(report.Problems, unreadable...)
+	chains := map[string][]*Digest{}
+	for _, d := range digests {
+		chains[d.chain()] = append(chains[d.chain()], d)
+	}
+
+	names := make([]string, 0, len(chains))
+	for name := range chains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		chain := chains[name]
+		for i, d := range chain {
+			report.Digests++
+			problems := len(report.Problems)
+			if err := verifySignature(d, keys); err != nil {
+				report.Problems = append(report.Problems, fmt.Sprintf("digest %s: %v", d.Path(), err))
+			}
+
+			switch {
+			case d.PreviousSignature == nil || d.PreviousObject == nil:
+				report.ChainsStarted = append(report.ChainsStarted, d.Path())
+			case i > 0:
+				previous := chain[i-1]
+				if deref(d.PreviousBucket)+"/"+*d.PreviousObject != previous.Path() {
+					report.Problems = append(report.Problems, fmt.Sprintf("digest %s: previous digest %s/%s missing, the chain is broken after %s",
+						d.Path(), deref(d.PreviousBucket), *d.PreviousObject, previous.Path()))
+				} else if *d.PreviousSignature != previous.Signature {
+					report.Problems = append(report.Problems, fmt.Sprintf("digest %s: previous digest signature does not match %s", d.Path(), previous.Path()))
+				}
+			}
+			if len(report.Problems) == problems {
+				report.ValidDigests++
+			}
+
+			for _, logFile := range d.LogFiles {
+				report.LogFiles++
+				if err := verifyLogFile(dir, logFile); err != nil {
+					report.Problems = append(report.Problems, fmt.Sprintf("log file %s/%s: %v", logFile.Bucket, logFile.Object, err))
+					continue
+				}
+				report.ValidLogFiles++
+			}
+		}
+	}
+	return report, nil
+}
+
+// deref returns the value of an optional string
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// LoadDigests reads the digests of the local directory with an end time between start and end,
+// sorted by end time. A digest that can't be read or parsed doesn't stop the validation: it is
+// returned as a problem, when the timestamp of its file name is in the period.
+func LoadDigests(dir string, start, end time.Time) ([]*Digest, []string, error) {
+	var digests []*Digest
+	var unreadable []string
+	inPeriod := func(t time.Time) bool {
+		return (start.IsZero() || !t.Before(start)) && (end.IsZero() || !t.After(end))
+	}
+	err := filepath.WalkDir(dir, func(file string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !strings.Contains(filepath.ToSlash(file), "/CloudTrail-Digest/") || !strings.HasSuffix(file, ".json.gz") {
+			return nil
+		}
+		d, err := ReadDigest(file)
+		if err != nil {
+			if t, ok := fileNameTime(file); !ok || inPeriod(t) {
+				unreadable = append(unreadable, fmt.Sprintf("digest file %s: %v", file, err))
+			}
+			return nil
+		}
+		if inPeriod(d.End) {
+			digests = append(digests, d)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read the digests of %s: %v", dir, err)
+	}
+	sortDigests(digests)
+	return digests, unreadable, nil
+}
+
+// fileNameTime returns the end time at the end of a digest file name
+func fileNameTime(file string) (time.Time, bool) {
+	name := strings.TrimSuffix(filepath.Base(file), ".json.gz")
+	i := strings.LastIndex(name, "_")
+	if i < 0 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(digestTimeLayout, name[i+1:])
+	return t, err == nil
+}
+
+// sortDigests sorts the digests by end time
+func sortDigests(digests []*Digest) {
+	sort.SliceStable(digests, func(i, j int) bool { return digests[i].End.Before(digests[j].End) })
+}
+
+// ReadDigest reads a digest file and the signature next to it
+func ReadDigest(file string) (*Digest, error) {
+	content, err := readGzip(file)
+	if err != nil {
+		return nil, err
+	}
+	d := &Digest{}
+	if err := json.Unmarshal(content, d); err != nil {
+		return nil, fmt.Errorf("failed to parse digest %s: %v", file, err)
+	}
+	if d.End, err = time.Parse(time.RFC3339, d.EndTime); err != nil {
+		return nil, fmt.Errorf("invalid end time of digest %s: %v", file, err)
+	}
+	sum := sha256.Sum256(content)
+	d.Hash = hex.EncodeToString(sum[:])
+
+	signature, err := os.ReadFile(file + signatureSuffix)
+	if err == nil {
+		d.Signature = strings.TrimSpace(string(signature))
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return d, nil
+}
+
+// verifySignature verifies the RSA signature of a digest with the public key of its fingerprint, which must
+// be valid at the end time of the digest. The signed data is the end time, the S3 path, the hash of the
+// digest and the previous signature.
+func verifySignature(d *Digest, keys []PublicKey) error {
+	if d.Signature == "" {
+		return fmt.Errorf("signature not found")
+	}
+	if d.SignatureAlgorithm != "SHA256withRSA" {
+		return fmt.Errorf("unsupported signature algorithm %s", d.SignatureAlgorithm)
+	}
+	var key, expired *PublicKey
+	for i := range keys {
+		if !strings.EqualFold(keys[i].Fingerprint, d.PublicKeyFingerprint) {
+			continue
+		}
+		if keys[i].validAt(d.End) {
+			key = &keys[i]
+		} else {
+			expired = &keys[i]
+		}
+	}
+	if key == nil && expired != nil {
+		return fmt.Errorf("public key %s is valid from %s to %s, not at the end of the digest %s", expired.Fingerprint,
+			expired.ValidFrom.UTC().Format(time.RFC3339), expired.ValidTo.UTC().Format(time.RFC3339), d.EndTime)
+	}
+	if key == nil {
+		return fmt.Errorf("public key %s not found", d.PublicKeyFingerprint)
+	}
+	publicKey, err := x509.ParsePKCS1PublicKey(key.Value)
+	if err != nil {
+		return fmt.Errorf("invalid public key %s: %v", key.Fingerprint, err)
+	}
+	signature, err := hex.DecodeString(d.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+
+	signed := sha256.Sum256([]byte(SignedData(d)))
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, signed[:], signature); err != nil {
+		return fmt.Errorf("invalid signature, the digest was modified")
+	}
+	return nil
+}
+
+// SignedData returns the data signed by CloudTrail for a digest
+func SignedData(d *Digest) string {
+	previous := "null"
+	if d.PreviousSignature != nil {
+		previous = *d.PreviousSignature
+	}
+	return fmt.Sprintf("%s\n%s\n%s\n%s", d.EndTime, d.Path(), d.Hash, previous)
+}
+
+// verifyLogFile compares the SHA-256 of the uncompressed log file with the hash of the digest
+func verifyLogFile(dir string, logFile LogFile) error {
+	if logFile.HashAlgorithm != "" && logFile.HashAlgorithm != "SHA-256" {
+		return fmt.Errorf("unsupported hash algorithm %s", logFile.HashAlgorithm)
+	}
+	content, err := readGzip(LocalPath(dir, logFile.Bucket, logFile.Object))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("missing, the log file was deleted or not downloaded")
+	}
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != strings.ToLower(logFile.HashValue) {
+		return fmt.Errorf("hash does not match the digest, the log file was modified")
+	}
+	return nil
+}
+
+// LoadPublicKeys reads the public keys saved by Download
+func LoadPublicKeys(file string) ([]PublicKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public keys: %v", err)
+	}
+	var keys []PublicKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse public keys %s: %v", file, err)
+	}
+	return keys, nil
+}
+
+// SavePublicKeys writes the public keys in the local directory
+func SavePublicKeys(dir string, keys []PublicKey) error {
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, PublicKeysFile), data, 0o644)
+}
+
+// readGzip reads a gzip file
+func readGzip(file string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", file, err)
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", file, err)
+	}
+	return content, nil
+}
@@ -0,0 +1,165 @@
+package trailvalidation
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// noError stops the test on an error
+func noError(t *testing.T, err error) {
+	t.Helper()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+}
+
+// writeGzip writes a gzip file, creating its folders
+func writeGzip(t *testing.T, file string, content []byte) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write(content)
+	noError(t, err)
+	noError(t, writer.Close())
+	noError(t, os.MkdirAll(filepath.Dir(file), 0o755))
+	noError(t, os.WriteFile(file, buf.Bytes(), 0o644))
+}
+
+// writeChain writes a chain of signed digests, each with one log file, as CloudTrail delivers them
+func writeChain(t *testing.T, dir string, key *rsa.PrivateKey, hours int) []*Digest {
+	const bucket = "trail-logs"
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	var digests []*Digest
+	var previous *Digest
+	for i := 0; i < hours; i++ {
+		end := start.Add(time.Duration(i+1) * time.Hour)
+		logKey := fmt.Sprintf("AWSLogs/111111111111/CloudTrail/us-east-1/2024/05/01/111111111111_CloudTrail_us-east-1_%s_%d.json.gz", end.Format(digestTimeLayout), i)
+		logContent := []byte(fmt.Sprintf(`{"Records":[{"eventName":"PutObject","eventID":"%d"}]}`, i))
+		writeGzip(t, LocalPath(dir, bucket, logKey), logContent)
+		logHash := sha256.Sum256(logContent)
+
+		d := &Digest{
+			AccountID:            "111111111111",
+			StartTime:            end.Add(-time.Hour).Format(time.RFC3339),
+			EndTime:              end.Format(time.RFC3339),
+			Bucket:               bucket,
+			Object:               fmt.Sprintf("AWSLogs/111111111111/CloudTrail-Digest/us-east-1/2024/05/01/111111111111_CloudTrail-Digest_us-east-1_main_us-east-1_%s.json.gz", end.Format(digestTimeLayout)),
+			PublicKeyFingerprint: "fingerprint",
+			SignatureAlgorithm:   "SHA256withRSA",
+			LogFiles:             []LogFile{{Bucket: bucket, Object: logKey, HashValue: hex.EncodeToString(logHash[:]), HashAlgorithm: "SHA-256"}},
+		}
+		if previous != nil {
+			d.PreviousBucket, d.PreviousObject = &previous.Bucket, &previous.Object
+			d.PreviousSignature, d.PreviousHashValue = &previous.Signature, &previous.Hash
+		}
+		content, err := json.Marshal(d)
+		noError(t, err)
+		hash := sha256.Sum256(content)
+		d.Hash = hex.EncodeToString(hash[:])
+
+		signed := sha256.Sum256([]byte(SignedData(d)))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, signed[:])
+		noError(t, err)
+		d.Signature = hex.EncodeToString(signature)
+
+		file := LocalPath(dir, bucket, d.Object)
+		writeGzip(t, file, content)
+		noError(t, os.WriteFile(file+signatureSuffix, []byte(d.Signature), 0o644))
+		digests = append(digests, d)
+		previous = d
+	}
+	return digests
+}
+
+func TestValidate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	noError(t, err)
+	setupWithKey := func(publicKey PublicKey) (string, []*Digest) {
+		dir := t.TempDir()
+		publicKey.Fingerprint, publicKey.Value = "fingerprint", x509.MarshalPKCS1PublicKey(&key.PublicKey)
+		noError(t, SavePublicKeys(dir, []PublicKey{publicKey}))
+		return dir, writeChain(t, dir, key, 3)
+	}
+	setup := func() (string, []*Digest) {
+		return setupWithKey(PublicKey{})
+	}
+
+	dir, digests := setup()
+	report, err := Validate(dir, time.Time{}, time.Time{})
+	noError(t, err)
+	assert.True(t, report.Valid(), report.Problems)
+	assert.Equal(t, 3, report.ValidDigests)
+	assert.Equal(t, 3, report.ValidLogFiles)
+	assert.Equal(t, []string{digests[0].Path()}, report.ChainsStarted)
+
+	// A modified log file
+	dir, digests = setup()
+	logFile := digests[1].LogFiles[0]
+	writeGzip(t, LocalPath(dir, logFile.Bucket, logFile.Object), []byte(`{"Records":[]}`))
+	report, err = Validate(dir, time.Time{}, time.Time{})
+	noError(t, err)
+	assert.Equal(t, 3, report.ValidDigests)
+	assert.Equal(t, 2, report.ValidLogFiles)
+	if assert.Len(t, report.Problems, 1) {
+		assert.Contains(t, report.Problems[0], "the log file was modified")
+	}
+
+	// A deleted digest breaks the chain
+	dir, digests = setup()
+	noError(t, os.Remove(LocalPath(dir, digests[1].Bucket, digests[1].Object)))
+	report, err = Validate(dir, time.Time{}, time.Time{})
+	noError(t, err)
+	if assert.Len(t, report.Problems, 1) {
+		assert.True(t, strings.HasPrefix(report.Problems[0], "digest "+digests[2].Path()+": previous digest"), report.Problems[0])
+	}
+	assert.Equal(t, 2, report.ValidLogFiles)
+
+	// A corrupt digest is a problem, the other digests are still validated
+	dir, digests = setup()
+	writeGzip(t, LocalPath(dir, digests[2].Bucket, digests[2].Object), []byte("{"))
+	report, err = Validate(dir, time.Time{}, time.Time{})
+	noError(t, err)
+	assert.Equal(t, 3, report.Digests)
+	assert.Equal(t, 2, report.ValidDigests)
+	if assert.Len(t, report.Problems, 1) {
+		assert.Contains(t, report.Problems[0], "failed to parse digest")
+	}
+
+	// A modified digest no longer matches its signature
+	dir, digests = setup()
+	digests[0].LogFiles = nil
+	content, err := json.Marshal(digests[0])
+	noError(t, err)
+	writeGzip(t, LocalPath(dir, digests[0].Bucket, digests[0].Object), content)
+	report, err = Validate(dir, time.Time{}, time.Time{})
+	noError(t, err)
+	if assert.Len(t, report.Problems, 1) {
+		assert.Contains(t, report.Problems[0], "invalid signature")
+	}
+
+	// The key must be valid at the end of each digest
+	dir, _ = setupWithKey(PublicKey{
+		ValidFrom: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		ValidTo:   time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC),
+	})
+	report, err = Validate(dir, time.Time{}, time.Time{})
+	noError(t, err)
+	assert.Equal(t, 2, report.ValidDigests)
+	if assert.Len(t, report.Problems, 1) {
+		assert.Contains(t, report.Problems[0], "public key fingerprint is valid from 2024-05-01T00:00:00Z to 2024-05-01T02:00:00Z, not at the end of the digest 2024-05-01T03:00:00Z")
+	}
+}
@@ -0,0 +1,241 @@
+package trailvalidation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloud_compliance_checker/s3client"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// digestTimeLayout is the timestamp at the end of the digest file names
+const digestTimeLayout = "20060102T150405Z"
+
+// Download copies in the local directory the public keys, the digests of the trail with an end time
+// between start and end, with their signatures, and the log files they list. Files already present
+// are kept. It returns the number of digests.
+func Download(cfg aws.Config, trailName string, start, end time.Time, dir string) (int, error) {
+	ctx := context.TODO()
+	client := cloudtrail.NewFromConfig(cfg)
+	described, err := client.DescribeTrails(ctx, &cloudtrail.DescribeTrailsInput{TrailNameList: []string{trailName}, IncludeShadowTrails: aws.Bool(true)})
+	if err != nil {
+		return 0, fmt.Errorf("failed to describe trail %s: %v", trailName, err)
+	}
+	if len(described.TrailList) == 0 {
+		return 0, fmt.Errorf("trail %s not found", trailName)
+	}
+	trail := described.TrailList[0]
+	trailARN, err := arn.Parse(aws.ToString(trail.TrailARN))
+	if err != nil {
+		return 0, fmt.Errorf("invalid trail ARN %s: %v", aws.ToString(trail.TrailARN), err)
+	}
+	bucket := aws.ToString(trail.S3BucketName)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, err
+	}
+
+	s3Client, err := s3client.ForBucket(ctx, cfg, bucket)
+	if err != nil {
+		return 0, err
+	}
+
+	// Digests are in AWSLogs/<account>/CloudTrail-Digest/<region>/YYYY/MM/DD, under the organization ID
+	// for organization trails
+	logs := "AWSLogs/"
+	if prefix := aws.ToString(trail.S3KeyPrefix); prefix != "" {
+		logs = strings.TrimSuffix(prefix, "/") + "/" + logs
+	}
+	var accounts []string
+	if aws.ToBool(trail.IsOrganizationTrail) {
+		orgs, err := s3client.Folders(ctx, s3Client, bucket, logs)
+		if err != nil {
+			return 0, err
+		}
+		for _, org := range orgs {
+			if strings.HasPrefix(path.Base(org), "o-") {
+				accounts = append(accounts, org+trailARN.AccountID+"/")
+			}
+		}
+	} else {
+		accounts = []string{logs + trailARN.AccountID + "/"}
+	}
+
+	// Each region signs its digests with its own keys
+	folders := map[string][]string{}
+	seenRegions := map[string]bool{}
+	var regionNames []string
+	for _, account := range accounts {
+		regions, err := s3client.Folders(ctx, s3Client, bucket, account+"CloudTrail-Digest/")
+		if err != nil {
+			return 0, err
+		}
+		folders[account] = regions
+		for _, region := range regions {
+			name := path.Base(region)
+			if !seenRegions[name] {
+				seenRegions[name] = true
+				regionNames = append(regionNames, name)
+			}
+		}
+	}
+	if err := downloadPublicKeys(ctx, cfg, regionNames, start, end, dir); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, account := range accounts {
+		for _, region := range folders[account] {
+			// The digest of the last hour is delivered in the following hour, possibly the next day
+			for day := start.UTC().Truncate(24 * time.Hour); !day.After(end.UTC().Add(time.Hour)); day = day.Add(24 * time.Hour) {
+				n, err := downloadDay(ctx, s3Client, bucket, region+day.Format("2006/01/02")+"/", trailNameOf(trail.Name), start, end, dir)
+				count += n
+				if err != nil {
+					return count, err
+				}
+			}
+		}
+	}
+	log.Printf("Downloaded %d digests of trail %s to %s\n", count, trailName, dir)
+	return count, nil
+}
+
+// trailNameOf returns the name of a trail from its name or ARN
+func trailNameOf(name *string) string {
+	n := aws.ToString(name)
+	if i := strings.LastIndex(n, "/"); i >= 0 {
+		return n[i+1:]
+	}
+	return n
+}
+
+// downloadPublicKeys saves the public keys of the regions valid between start and end, merged with the saved ones
+func downloadPublicKeys(ctx context.Context, cfg aws.Config, regions []string, start, end time.Time, dir string) error {
+	keys, err := LoadPublicKeys(filepath.Join(dir, PublicKeysFile))
+	if err != nil {
+		keys = nil
+	}
+	known := map[string]bool{}
+	for _, key := range keys {
+		known[key.Fingerprint] = true
+	}
+
+	for _, region := range regions {
+		regional := cfg.Copy()
+		regional.Region = region
+		client := cloudtrail.NewFromConfig(regional)
+		input := &cloudtrail.ListPublicKeysInput{StartTime: aws.Time(start), EndTime: aws.Time(end)}
+		for {
+			page, err := client.ListPublicKeys(ctx, input)
+			if err != nil {
+				return fmt.Errorf("failed to list the CloudTrail public keys of %s: %v", region, err)
+			}
+			for _, key := range page.PublicKeyList {
+				fingerprint := aws.ToString(key.Fingerprint)
+				if known[fingerprint] {
+					continue
+				}
+				known[fingerprint] = true
+				keys = append(keys, PublicKey{
+					Fingerprint: fingerprint,
+					Value:       key.Value,
+					ValidFrom:   aws.ToTime(key.ValidityStartTime),
+					ValidTo:     aws.ToTime(key.ValidityEndTime),
+				})
+			}
+			if page.NextToken == nil {
+				break
+			}
+			input.NextToken = page.NextToken
+		}
+	}
+	return SavePublicKeys(dir, keys)
+}
+
+// downloadDay downloads the digests of a trail in a day folder with an end time between start and end,
+// and their log files
+func downloadDay(ctx context.Context, client *s3.Client, bucket, prefix, trail string, start, end time.Time, dir string) (int, error) {
+	count := 0
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return count, fmt.Errorf("failed to list s3://%s/%s: %v", bucket, prefix, err)
+		}
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			name := strings.TrimSuffix(path.Base(key), ".json.gz")
+			i := strings.LastIndex(name, "_")
+			if i < 0 || !strings.Contains(name, "_"+trail+"_") {
+				continue
+			}
+			digestEnd, ok := fileNameTime(key)
+			if !ok || digestEnd.Before(start) || digestEnd.After(end) {
+				continue
+			}
+
+			file := LocalPath(dir, bucket, key)
+			if err := downloadObject(ctx, client, bucket, key, file, true); err != nil {
+				return count, err
+			}
+			count++
+			digest, err := ReadDigest(file)
+			if err != nil {
+				// A corrupt digest is reported by the validation
+				log.Printf("Unable to read digest %s/%s: %v\n", bucket, key, err)
+				continue
+			}
+			for _, logFile := range digest.LogFiles {
+				if err := downloadObject(ctx, client, logFile.Bucket, logFile.Object, LocalPath(dir, logFile.Bucket, logFile.Object), false); err != nil {
+					// A missing log file is reported by the validation
+					log.Printf("Unable to download log file %s/%s: %v\n", logFile.Bucket, logFile.Object, err)
+				}
+			}
+		}
+	}
+	return count, nil
+}
+
+// downloadObject saves an S3 object, with the signature of its metadata for the digests, unless the
+// file already exists
+func downloadObject(ctx context.Context, client *s3.Client, bucket, key, file string, signature bool) error {
+	if _, err := os.Stat(file); err == nil {
+		return nil
+	}
+	object, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return fmt.Errorf("failed to download s3://%s/%s: %v", bucket, key, err)
+	}
+	defer object.Body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, object.Body); err != nil {
+		out.Close()
+		os.Remove(file)
+		return fmt.Errorf("failed to download s3://%s/%s: %v", bucket, key, err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if signature {
+		return os.WriteFile(file+signatureSuffix, []byte(object.Metadata["signature"]+"\n"), 0o644)
+	}
+	return nil
+}